@@ -2,13 +2,18 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"discord-rag-bot/internal/ai"
 	"discord-rag-bot/internal/bot"
+	"discord-rag-bot/internal/config"
 	"discord-rag-bot/internal/database"
 	"discord-rag-bot/internal/rag"
 
@@ -22,6 +27,8 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	cfg := config.Load()
+
 	// Initialize database
 	db, err := database.NewDB(
 		os.Getenv("DB_HOST"),
@@ -33,15 +40,103 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if err := db.SetSearchQuery(cfg.Database.SearchQuery); err != nil {
+		log.Fatalf("Invalid database configuration: %v", err)
+	}
+	if err := db.LabelEmbeddingVersion(cfg.RAG.EmbeddingVersion); err != nil {
+		log.Fatalf("Failed to label stored embeddings with version %s: %v", cfg.RAG.EmbeddingVersion, err)
+	}
+	if err := db.CheckEmbeddingSettings(cfg.RAG.EmbeddingVersion, cfg.AI.NormalizeEmbeddings); err != nil {
+		log.Fatalf("Invalid AI_NORMALIZE_EMBEDDINGS: %v", err)
+	}
+
+	// Watch the connection so outages are logged and reflected in readiness
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	defer stopMonitor()
+	if cfg.Database.HealthInterval > 0 {
+		go db.MonitorHealth(monitorCtx, cfg.Database.HealthInterval)
+	}
+	if cfg.Bot.HealthAddr != "" {
+		go serveHealth(cfg.Bot.HealthAddr, db)
+	}
 
 	// Initialize AI service
-	aiService := ai.NewAIService(os.Getenv("OPENAI_API_KEY"))
+	aiService := ai.NewAIService(os.Getenv("OPENAI_API_KEY"), cfg.AI)
+	aiService.SetTempDir(cfg.Voice.TempDir)
+
+	// Accumulate token usage per guild for cost tracking, and per user for
+	// the daily budget
+	aiService.SetUsageFunc(func(usage ai.Usage) {
+		go func() {
+			now := time.Now()
+			if err := db.AddUsage(usage.GuildID, usage.Model, usage.PromptTokens, usage.CompletionTokens, now); err != nil {
+				log.Printf("Error recording token usage: %v", err)
+			}
+			if usage.UserID != "" {
+				if err := db.AddUserUsage(usage.UserID, usage.TotalTokens(), now); err != nil {
+					log.Printf("Error recording token usage for user %s: %v", usage.UserID, err)
+				}
+			}
+		}()
+	})
+
+	// Verify OpenAI credentials up front so misconfiguration shows immediately
+	if cfg.AI.Preflight {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := aiService.Preflight(ctx); err != nil {
+			log.Printf("Warning: OpenAI preflight check failed: %v", err)
+		} else {
+			log.Println("OpenAI preflight check passed")
+		}
+		cancel()
+	}
+
+	// Initialize speech providers, only needed for voice
+	var transcriber ai.Transcriber
+	var synthesizer ai.Synthesizer
+	if cfg.Voice.Enabled {
+		transcriber, err = ai.NewTranscriber(cfg.AI, aiService)
+		if err != nil {
+			log.Fatalf("Failed to initialize transcription provider: %v", err)
+		}
+
+		synthesizer, err = ai.NewSynthesizer(cfg.AI, aiService)
+		if err != nil {
+			log.Fatalf("Failed to initialize speech provider: %v", err)
+		}
+	}
 
 	// Initialize RAG retriever
-	ragRetriever := rag.NewRAGRetriever(db, aiService)
+	var ragRetriever *rag.RAGRetriever
+	switch cfg.RAG.VectorStore {
+	case "memory":
+		log.Println("Using in-memory vector store; embeddings are not persisted")
+		ragRetriever = rag.NewRAGRetrieverWithStore(db, rag.NewMemoryStore(), aiService, cfg.RAG)
+	default:
+		ragRetriever = rag.NewRAGRetriever(db, aiService, cfg.RAG)
+	}
+
+	ragRetriever.SetBotName(cfg.Bot.Name)
 
-	// Initialize bot handler (includes voice manager)
-	botHandler := bot.NewBotHandler(db, ragRetriever)
+	reranker, err := ai.NewReranker(cfg.AI, aiService)
+	if err != nil {
+		log.Fatalf("Failed to initialize re-ranker: %v", err)
+	}
+	ragRetriever.SetReranker(reranker)
+
+	prompts, err := rag.LoadPromptTemplates(cfg.RAG)
+	if err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+	ragRetriever.SetPromptTemplates(prompts)
+
+	// Query embedding cache size and memory, alongside the retrieval metrics
+	expvar.Publish("embedding_cache", expvar.Func(func() any {
+		return ragRetriever.EmbeddingCacheStats()
+	}))
+
+	// Initialize bot handler (includes voice manager when voice is enabled)
+	botHandler := bot.NewBotHandler(db, ragRetriever, transcriber, synthesizer, cfg)
 
 	// Create Discord session
 	discord, err := discordgo.New("Bot " + os.Getenv("DISCORD_TOKEN"))
@@ -51,14 +146,14 @@ func main() {
 
 	// Set up bot handler
 	botHandler.SetSession(discord)
+	ragRetriever.SetLiveSource(botHandler)
+	ragRetriever.SetUserNames(botHandler)
 
 	// Add event handlers
 	discord.AddHandler(botHandler.OnMessageCreate)
 
-	// Set intents (add voice state intent and interaction intent)
-	discord.Identify.Intents = discordgo.IntentsGuildMessages |
-		discordgo.IntentsDirectMessages |
-		discordgo.IntentsGuildVoiceStates
+	// Only request the voice state intent when voice is enabled
+	discord.Identify.Intents = bot.Intents(cfg)
 
 	// Open connection
 	if err := discord.Open(); err != nil {
@@ -73,16 +168,53 @@ func main() {
 
 	log.Println("🎤 Discord Voice RAG Bot is running!")
 	log.Println("Commands:")
-	log.Println("  /join - Join your voice channel")
-	log.Println("  /leave - Leave voice channel")
+	if cfg.Voice.Enabled {
+		log.Println("  /join - Join your voice channel")
+		log.Println("  /leave - Leave voice channel")
+		log.Println("  /voice-reset - Force-drop a stuck voice connection (admin)")
+	}
 	log.Println("  /ai <question> - Text chat with AI")
+	log.Println("  /feedback <text> - Send feedback on the last answer")
+	log.Println("  /history - Browse your recent questions")
+	log.Println("  /model [name] - View or switch the chat model (admin)")
+	log.Println("  /bot-name [name] - View or set the bot's name in this server (admin)")
+	log.Println("  /enable-here, /disable-here - Toggle the bot in a channel (admin)")
+	log.Println("  /threads <enabled> - Answer mentions in threads (admin)")
+	log.Println("  /usage - Show token usage and estimated spend (admin)")
+	log.Println("  /embedding-version [version] - View or switch the searched embedding version (admin)")
+	log.Println("  /backfill [version] - Re-embed messages under a new embedding version (admin)")
 	log.Println("  @bot <message> - Also works for text chat")
-	log.Println("  Just talk when bot is in voice channel!")
+	if cfg.Voice.Enabled {
+		log.Println("  Just talk when bot is in voice channel!")
+	}
 
 	// Wait for interrupt signal
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
+	stats := ragRetriever.CacheStats()
+	log.Printf("Context cache: %d hits, %d misses, %d entries", stats.Hits, stats.Misses, stats.Entries)
+	embeddingStats := ragRetriever.EmbeddingCacheStats()
+	log.Printf("Query embedding cache: %d hits, %d misses, %d entries, ~%d KB", embeddingStats.Hits, embeddingStats.Misses, embeddingStats.Entries, embeddingStats.Bytes>>10)
 	log.Println("Shutting down Discord Voice RAG Bot...")
 }
+
+// serveHealth serves a readiness probe that fails while the database is
+// unreachable, and runtime and retrieval metrics at /debug/vars
+func serveHealth(addr string, db *database.DB) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !db.Healthy() {
+			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	log.Printf("Serving readiness probe on %s/readyz", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Health server stopped: %v", err)
+	}
+}
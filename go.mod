@@ -4,24 +4,24 @@ go 1.24
 
 require (
 	github.com/bwmarrin/discordgo v0.27.1
+	github.com/gorilla/websocket v1.4.2
+	github.com/jackc/pgx/v5 v5.7.2
 	github.com/joho/godotenv v1.5.1
 	github.com/pgvector/pgvector-go v0.3.0
 	github.com/sashabaranov/go-openai v1.40.1
+	golang.org/x/sync v0.12.0
 	gorm.io/driver/postgres v1.6.0
 	gorm.io/gorm v1.25.10
 	layeh.com/gopus v0.0.0-20210501142526-1ee02d434e32
 )
 
 require (
-	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
-	github.com/jackc/pgx/v5 v5.7.2 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	golang.org/x/crypto v0.36.0 // indirect
-	golang.org/x/sync v0.12.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 )
@@ -0,0 +1,237 @@
+// internal/ai/deepgram.go
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const deepgramBaseURL = "api.deepgram.com/v1/listen"
+
+// StreamOptions configures a streaming transcription of raw PCM audio
+type StreamOptions struct {
+	TranscribeOptions
+	// SampleRate and Channels describe the signed 16-bit little-endian PCM
+	// that will be written to the stream
+	SampleRate int
+	Channels   int
+	// OnPartial, if set, receives interim transcripts as they arrive
+	OnPartial func(text string)
+}
+
+// TranscriptionStream accepts audio incrementally and yields the final
+// transcript when closed
+type TranscriptionStream interface {
+	Write(pcm []byte) error
+	// Close finishes the stream and returns everything transcribed
+	Close(ctx context.Context) (Transcription, error)
+	// Abort discards the stream without waiting for a result
+	Abort()
+}
+
+// StreamingTranscriber is a Transcriber that can also transcribe while
+// audio is still being captured
+type StreamingTranscriber interface {
+	Transcriber
+	StartStream(ctx context.Context, opts StreamOptions) (TranscriptionStream, error)
+}
+
+// DeepgramTranscriber uses Deepgram's pre-recorded and live STT APIs
+type DeepgramTranscriber struct {
+	apiKey string
+	client *http.Client
+}
+
+func NewDeepgramTranscriber(apiKey string) *DeepgramTranscriber {
+	return &DeepgramTranscriber{
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type deepgramAlternative struct {
+	Transcript string `json:"transcript"`
+}
+
+func deepgramQuery(opts TranscribeOptions) url.Values {
+	query := url.Values{}
+	query.Set("smart_format", "true")
+	if opts.Language != "" {
+		query.Set("language", opts.Language)
+	}
+	if opts.Prompt != "" {
+		for _, term := range strings.Fields(opts.Prompt) {
+			query.Add("keywords", term)
+		}
+	}
+	return query
+}
+
+func (d *DeepgramTranscriber) Transcribe(ctx context.Context, audio io.Reader, opts TranscribeOptions) (Transcription, error) {
+	endpoint := "https://" + deepgramBaseURL + "?" + deepgramQuery(opts).Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, audio)
+	if err != nil {
+		return Transcription{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Token "+d.apiKey)
+	req.Header.Set("Content-Type", "audio/wav")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return Transcription{}, fmt.Errorf("failed to transcribe audio: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return Transcription{}, fmt.Errorf("deepgram returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Results struct {
+			Channels []struct {
+				Alternatives     []deepgramAlternative `json:"alternatives"`
+				DetectedLanguage string                `json:"detected_language"`
+			} `json:"channels"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Transcription{}, fmt.Errorf("failed to decode transcription: %v", err)
+	}
+
+	transcription := Transcription{Language: opts.Language}
+	if len(result.Results.Channels) > 0 {
+		channel := result.Results.Channels[0]
+		if len(channel.Alternatives) > 0 {
+			transcription.Text = strings.TrimSpace(channel.Alternatives[0].Transcript)
+		}
+		if channel.DetectedLanguage != "" {
+			transcription.Language = channel.DetectedLanguage
+		}
+	}
+	return transcription, nil
+}
+
+func (d *DeepgramTranscriber) StartStream(ctx context.Context, opts StreamOptions) (TranscriptionStream, error) {
+	query := deepgramQuery(opts.TranscribeOptions)
+	query.Set("encoding", "linear16")
+	query.Set("sample_rate", strconv.Itoa(opts.SampleRate))
+	query.Set("channels", strconv.Itoa(opts.Channels))
+	query.Set("interim_results", "true")
+
+	header := http.Header{}
+	header.Set("Authorization", "Token "+d.apiKey)
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, "wss://"+deepgramBaseURL+"?"+query.Encode(), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open deepgram stream: %v", err)
+	}
+
+	stream := &deepgramStream{
+		conn:      conn,
+		onPartial: opts.OnPartial,
+		language:  opts.Language,
+		done:      make(chan struct{}),
+	}
+	go stream.readLoop()
+	return stream, nil
+}
+
+type deepgramStream struct {
+	conn      *websocket.Conn
+	writeMu   sync.Mutex
+	onPartial func(text string)
+	language  string
+
+	resultMu sync.Mutex
+	finals   []string
+	readErr  error
+	done     chan struct{}
+}
+
+func (s *deepgramStream) readLoop() {
+	defer close(s.done)
+
+	for {
+		var msg struct {
+			Type    string `json:"type"`
+			IsFinal bool   `json:"is_final"`
+			Channel struct {
+				Alternatives []deepgramAlternative `json:"alternatives"`
+			} `json:"channel"`
+		}
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				s.resultMu.Lock()
+				s.readErr = err
+				s.resultMu.Unlock()
+			}
+			return
+		}
+
+		if msg.Type != "Results" || len(msg.Channel.Alternatives) == 0 {
+			continue
+		}
+
+		text := strings.TrimSpace(msg.Channel.Alternatives[0].Transcript)
+		if text == "" {
+			continue
+		}
+
+		if msg.IsFinal {
+			s.resultMu.Lock()
+			s.finals = append(s.finals, text)
+			s.resultMu.Unlock()
+		} else if s.onPartial != nil {
+			s.onPartial(text)
+		}
+	}
+}
+
+func (s *deepgramStream) Write(pcm []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteMessage(websocket.BinaryMessage, pcm)
+}
+
+func (s *deepgramStream) Close(ctx context.Context) (Transcription, error) {
+	s.writeMu.Lock()
+	err := s.conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"CloseStream"}`))
+	s.writeMu.Unlock()
+	if err != nil {
+		s.conn.Close()
+		return Transcription{}, fmt.Errorf("failed to close deepgram stream: %v", err)
+	}
+
+	// Deepgram flushes the remaining results and then closes the socket
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.conn.Close()
+		return Transcription{}, ctx.Err()
+	}
+	s.conn.Close()
+
+	s.resultMu.Lock()
+	defer s.resultMu.Unlock()
+
+	if s.readErr != nil && len(s.finals) == 0 {
+		return Transcription{}, fmt.Errorf("deepgram stream failed: %v", s.readErr)
+	}
+	return Transcription{Text: strings.Join(s.finals, " "), Language: s.language}, nil
+}
+
+func (s *deepgramStream) Abort() {
+	s.conn.Close()
+}
@@ -4,33 +4,118 @@ package ai
 import (
 	"context"
 	"fmt"
+	"math"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 )
 
-// GenerateEmbeddings creates vector embeddings for multiple texts
-func (ai *AIService) GenerateEmbeddings(texts []string) ([][]float32, error) {
+// GenerateEmbeddings creates vector embeddings for multiple texts. Inputs
+// larger than the configured batch limits are sent as several sequential
+// requests; the results keep the order of texts.
+func (ai *AIService) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
 	if len(texts) == 0 {
 		return nil, fmt.Errorf("no texts provided for embedding")
 	}
 
+	embeddings := make([][]float32, 0, len(texts))
+	for _, batch := range splitEmbeddingBatches(texts, ai.embedBatchSize, ai.embedBatchTokens) {
+		batchEmbeddings, err := ai.generateEmbeddingBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batchEmbeddings...)
+	}
+
+	return embeddings, nil
+}
+
+// estimateTokens approximates the token count of text at ~4 bytes per token
+func estimateTokens(text string) int {
+	return len(text)/4 + 1
+}
+
+// splitEmbeddingBatches groups texts into consecutive batches of at most
+// maxCount texts and roughly maxTokens tokens. A single text over the token
+// budget still gets a batch of its own. Non-positive limits are ignored.
+func splitEmbeddingBatches(texts []string, maxCount, maxTokens int) [][]string {
+	var batches [][]string
+	start, tokens := 0, 0
+	for i, text := range texts {
+		textTokens := estimateTokens(text)
+		full := maxCount > 0 && i-start >= maxCount
+		overBudget := maxTokens > 0 && i > start && tokens+textTokens > maxTokens
+		if full || overBudget {
+			batches = append(batches, texts[start:i])
+			start, tokens = i, 0
+		}
+		tokens += textTokens
+	}
+	if start < len(texts) {
+		batches = append(batches, texts[start:])
+	}
+	return batches
+}
+
+type embeddingThrottleKey struct{}
+
+// WithEmbeddingThrottle paces the embedding requests made with ctx: each
+// one waits for a tick from throttle first. GenerateEmbeddings may split a
+// call into several requests, so pacing calls instead would undercount.
+func WithEmbeddingThrottle(ctx context.Context, throttle <-chan time.Time) context.Context {
+	return context.WithValue(ctx, embeddingThrottleKey{}, throttle)
+}
+
+// waitEmbeddingThrottle blocks until ctx's throttle, if any, lets another
+// embedding request through
+func waitEmbeddingThrottle(ctx context.Context) error {
+	throttle, _ := ctx.Value(embeddingThrottleKey{}).(<-chan time.Time)
+	if throttle == nil {
+		return nil
+	}
+	select {
+	case <-throttle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ai *AIService) generateEmbeddingBatch(ctx context.Context, texts []string) ([][]float32, error) {
 	req := openai.EmbeddingRequest{
 		Input: texts,
 		Model: openai.AdaEmbeddingV2,
 	}
 
-	resp, err := ai.client.CreateEmbeddings(context.Background(), req)
+	if err := waitEmbeddingThrottle(ctx); err != nil {
+		return nil, err
+	}
+
+	release, err := ai.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := ai.client.CreateEmbeddings(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create embeddings: %v", err)
 	}
 
+	ai.recordUsage(ctx, string(req.Model), resp.Usage)
+
 	if len(resp.Data) != len(texts) {
 		return nil, fmt.Errorf("embedding count mismatch: got %d, expected %d", len(resp.Data), len(texts))
 	}
 
+	// Place each embedding by its reported index so order never depends on
+	// the response ordering
 	embeddings := make([][]float32, len(resp.Data))
-	for i, data := range resp.Data {
-		embeddings[i] = data.Embedding
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(embeddings) || embeddings[data.Index] != nil {
+			return nil, fmt.Errorf("invalid embedding index %d in response", data.Index)
+		}
+		embeddings[data.Index] = ai.prepareEmbedding(data.Embedding)
 	}
 
 	return embeddings, nil
@@ -38,6 +123,12 @@ func (ai *AIService) GenerateEmbeddings(texts []string) ([][]float32, error) {
 
 // CalculateCosineSimilarity calculates similarity between two embeddings
 func (ai *AIService) CalculateCosineSimilarity(a, b []float32) float64 {
+	return CosineSimilarity(a, b)
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors, or 0
+// if their lengths differ or either is zero
+func CosineSimilarity(a, b []float32) float64 {
 	if len(a) != len(b) {
 		return 0
 	}
@@ -53,5 +144,38 @@ func (ai *AIService) CalculateCosineSimilarity(a, b []float32) float64 {
 		return 0
 	}
 
-	return dotProduct / (normA * normB)
+	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// NormalizesEmbeddings reports whether embeddings are L2-normalized
+func (ai *AIService) NormalizesEmbeddings() bool {
+	return ai.normalize
+}
+
+// prepareEmbedding applies the configured normalization. Every embedding
+// stored or queried goes through here so both sides always match.
+func (ai *AIService) prepareEmbedding(embedding []float32) []float32 {
+	if !ai.normalize {
+		return embedding
+	}
+	return NormalizeVector(embedding)
+}
+
+// NormalizeVector scales a vector to unit L2 length. Zero vectors are
+// returned unchanged.
+func NormalizeVector(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+
+	norm := math.Sqrt(sum)
+	normalized := make([]float32, len(v))
+	for i, x := range v {
+		normalized[i] = float32(float64(x) / norm)
+	}
+	return normalized
 }
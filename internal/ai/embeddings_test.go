@@ -0,0 +1,270 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newTestService returns a service whose OpenAI client talks to handler
+func newTestService(t *testing.T, handler http.Handler) *AIService {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	clientConfig := openai.DefaultConfig("test-key")
+	clientConfig.BaseURL = server.URL + "/v1"
+	return &AIService{client: openai.NewClientWithConfig(clientConfig), chatModel: openai.GPT4oMini}
+}
+
+// embeddingServer answers embedding requests with a vector per text of
+// [n, length] for texts named "text-n", listed in reverse so callers
+// must order results by index. It records the size of each request.
+type embeddingServer struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (s *embeddingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input []string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.batches = append(s.batches, len(req.Input))
+	s.mu.Unlock()
+
+	resp := openai.EmbeddingResponse{Object: "list", Model: openai.AdaEmbeddingV2}
+	for i := len(req.Input) - 1; i >= 0; i-- {
+		n, _ := strconv.Atoi(strings.TrimPrefix(req.Input[i], "text-"))
+		resp.Data = append(resp.Data, openai.Embedding{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: []float32{float32(n), float32(len(req.Input[i]))},
+		})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func numberedTexts(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = "text-" + strconv.Itoa(i)
+	}
+	return texts
+}
+
+func TestSplitEmbeddingBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		texts     []string
+		maxCount  int
+		maxTokens int
+		want      []int
+	}{
+		{"unlimited", numberedTexts(5), 0, 0, []int{5}},
+		{"by count", numberedTexts(5), 2, 0, []int{2, 2, 1}},
+		{"exact count", numberedTexts(4), 2, 0, []int{2, 2}},
+		// "text-n" is estimated at 2 tokens
+		{"by tokens", numberedTexts(5), 0, 5, []int{2, 2, 1}},
+		{"count before tokens", numberedTexts(6), 2, 100, []int{2, 2, 2}},
+		{"oversized text alone", []string{"a", strings.Repeat("x", 400), "b"}, 0, 10, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		batches := splitEmbeddingBatches(tt.texts, tt.maxCount, tt.maxTokens)
+
+		var sizes []int
+		var joined []string
+		for _, batch := range batches {
+			sizes = append(sizes, len(batch))
+			joined = append(joined, batch...)
+		}
+		if !slices.Equal(sizes, tt.want) {
+			t.Errorf("%s: batch sizes = %v, want %v", tt.name, sizes, tt.want)
+		}
+		if strings.Join(joined, ",") != strings.Join(tt.texts, ",") {
+			t.Errorf("%s: batches don't hold the texts in order", tt.name)
+		}
+	}
+}
+
+func TestGenerateEmbeddingsReassemblesBatches(t *testing.T) {
+	server := &embeddingServer{}
+	service := newTestService(t, server)
+	service.embedBatchSize = 7
+
+	texts := numberedTexts(30)
+	embeddings, err := service.GenerateEmbeddings(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("GenerateEmbeddings: %v", err)
+	}
+
+	if !slices.Equal(server.batches, []int{7, 7, 7, 7, 2}) {
+		t.Errorf("request sizes = %v, want batches of 7", server.batches)
+	}
+	if len(embeddings) != len(texts) {
+		t.Fatalf("got %d embeddings, want %d", len(embeddings), len(texts))
+	}
+	for i, embedding := range embeddings {
+		if embedding[0] != float32(i) || embedding[1] != float32(len(texts[i])) {
+			t.Errorf("embedding %d = %v, belongs to another text", i, embedding)
+		}
+	}
+}
+
+func TestGenerateEmbeddingsRejectsBadIndex(t *testing.T) {
+	service := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.EmbeddingResponse{Data: []openai.Embedding{
+			{Index: 0, Embedding: []float32{1}},
+			{Index: 0, Embedding: []float32{2}},
+		}})
+	}))
+
+	if _, err := service.GenerateEmbeddings(context.Background(), numberedTexts(2)); err == nil {
+		t.Error("GenerateEmbeddings accepted a response with a duplicate index")
+	}
+}
+
+func TestEmbeddingThrottlePacesRequests(t *testing.T) {
+	server := &embeddingServer{}
+	service := newTestService(t, server)
+	service.embedBatchSize = 2
+
+	throttle := make(chan time.Time)
+	ctx := WithEmbeddingThrottle(context.Background(), throttle)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := service.GenerateEmbeddings(ctx, numberedTexts(6))
+		done <- err
+	}()
+
+	// Three batches of two, each waiting for its own tick
+	for i := 0; i < 3; i++ {
+		select {
+		case throttle <- time.Now():
+		case err := <-done:
+			t.Fatalf("GenerateEmbeddings returned after %d ticks: %v", i, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("request %d never waited on the throttle", i)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("GenerateEmbeddings: %v", err)
+	}
+	if len(server.batches) != 3 {
+		t.Errorf("%d requests made, want 3", len(server.batches))
+	}
+}
+
+func TestEmbeddingThrottleHonorsContext(t *testing.T) {
+	service := newTestService(t, &embeddingServer{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := service.GenerateEmbeddings(WithEmbeddingThrottle(ctx, make(chan time.Time)), numberedTexts(1))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GenerateEmbeddings error = %v, want the context's", err)
+	}
+}
+
+// l2Norm returns a vector's Euclidean length
+func l2Norm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+// l2Distance returns the Euclidean distance between two vectors
+func l2Distance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+func TestNormalizeVector(t *testing.T) {
+	v := []float32{3, 4}
+	normalized := NormalizeVector(v)
+	if !slices.Equal(normalized, []float32{0.6, 0.8}) {
+		t.Errorf("NormalizeVector(%v) = %v, want [0.6 0.8]", v, normalized)
+	}
+	if !slices.Equal(v, []float32{3, 4}) {
+		t.Errorf("NormalizeVector modified its argument to %v", v)
+	}
+
+	zero := []float32{0, 0}
+	if got := NormalizeVector(zero); !slices.Equal(got, zero) {
+		t.Errorf("NormalizeVector(%v) = %v, want it unchanged", zero, got)
+	}
+}
+
+// Normalizing keeps cosine distances and makes L2 distances rank the same
+// way, which is what lets an L2 index serve cosine searches
+func TestNormalizedDistances(t *testing.T) {
+	query := []float32{1, 0}
+	near := []float32{10, 1} // almost the query's direction, but long
+	far := []float32{0.5, 0.5}
+
+	if raw, normalized := 1-CosineSimilarity(query, near), 1-CosineSimilarity(NormalizeVector(query), NormalizeVector(near)); math.Abs(raw-normalized) > 1e-6 {
+		t.Errorf("cosine distance = %v raw, %v normalized; want them equal", raw, normalized)
+	}
+
+	// Raw L2 ranks the long vector last, though it is the closer one
+	if l2Distance(query, near) < l2Distance(query, far) {
+		t.Fatal("test vectors don't tell raw L2 and cosine apart")
+	}
+	q, n, f := NormalizeVector(query), NormalizeVector(near), NormalizeVector(far)
+	if l2Distance(q, n) >= l2Distance(q, f) {
+		t.Errorf("normalized L2 distances %v and %v rank against cosine", l2Distance(q, n), l2Distance(q, f))
+	}
+
+	// For unit vectors, squared L2 distance is twice the cosine distance
+	for _, v := range [][]float32{n, f} {
+		l2, cosine := l2Distance(q, v), 1-CosineSimilarity(q, v)
+		if math.Abs(l2*l2-2*cosine) > 1e-6 {
+			t.Errorf("L2 distance %v and cosine distance %v disagree", l2, cosine)
+		}
+	}
+}
+
+func TestGenerateEmbeddingsNormalization(t *testing.T) {
+	for _, normalize := range []bool{false, true} {
+		service := newTestService(t, &embeddingServer{})
+		service.normalize = normalize
+
+		embeddings, err := service.GenerateEmbeddings(context.Background(), []string{"text-3"})
+		if err != nil {
+			t.Fatalf("GenerateEmbeddings: %v", err)
+		}
+		norm := l2Norm(embeddings[0])
+		if normalize && math.Abs(norm-1) > 1e-6 {
+			t.Errorf("normalized embedding %v has length %v", embeddings[0], norm)
+		}
+		if !normalize && !slices.Equal(embeddings[0], []float32{3, 6}) {
+			t.Errorf("raw embedding = %v, want it as returned", embeddings[0])
+		}
+		if service.NormalizesEmbeddings() != normalize {
+			t.Errorf("NormalizesEmbeddings = %v, want %v", service.NormalizesEmbeddings(), normalize)
+		}
+	}
+}
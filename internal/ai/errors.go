@@ -0,0 +1,23 @@
+// internal/ai/errors.go
+package ai
+
+import (
+	"errors"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrContextLengthExceeded is returned when a prompt doesn't fit the model's
+// context window. Callers can retry with less context.
+var ErrContextLengthExceeded = errors.New("prompt exceeds the model's context length")
+
+// isContextLengthError reports whether an OpenAI error is a context window
+// overflow
+func isContextLengthError(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	code, _ := apiErr.Code.(string)
+	return code == "context_length_exceeded"
+}
@@ -0,0 +1,21 @@
+// internal/ai/limit.go
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// acquire reserves one of the service's concurrent request slots, waiting
+// until one frees up or ctx ends. The returned func releases it. Every
+// OpenAI call goes through here so bursts of ingestion, retrieval and voice
+// traffic together stay under the account's limits.
+func (ai *AIService) acquire(ctx context.Context) (func(), error) {
+	if ai.requests == nil {
+		return func() {}, nil
+	}
+	if err := ai.requests.Acquire(ctx, 1); err != nil {
+		return nil, fmt.Errorf("waiting for an OpenAI request slot: %w", err)
+	}
+	return func() { ai.requests.Release(1) }, nil
+}
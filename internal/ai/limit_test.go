@@ -0,0 +1,135 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/sync/semaphore"
+)
+
+// concurrencyServer answers chat, embedding, speech and transcription
+// requests after a short delay, recording the most in flight at once
+type concurrencyServer struct {
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	requests atomic.Int32
+}
+
+func (s *concurrencyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	s.requests.Add(1)
+	for peak := s.peak.Load(); n > peak && !s.peak.CompareAndSwap(peak, n); peak = s.peak.Load() {
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "answer"}},
+		}})
+	case strings.HasSuffix(r.URL.Path, "/embeddings"):
+		json.NewEncoder(w).Encode(openai.EmbeddingResponse{Data: []openai.Embedding{{Embedding: []float32{1, 0}}}})
+	case strings.HasSuffix(r.URL.Path, "/audio/speech"):
+		w.Write(append([]byte("ID3"), make([]byte, minAudioBytes)...))
+	case strings.HasSuffix(r.URL.Path, "/audio/transcriptions"):
+		w.Write([]byte(`{"text": "hello", "language": "english"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRequestLimitAcrossOperations(t *testing.T) {
+	server := &concurrencyServer{}
+	service := newTestService(t, server)
+	service.ttsFormat = AudioFormatMP3
+	service.requests = semaphore.NewWeighted(2)
+	ctx := context.Background()
+
+	operations := []func() error{
+		func() error {
+			_, err := service.GenerateResponse(ctx, "system", "user")
+			return err
+		},
+		func() error {
+			_, err := service.GenerateEmbedding(ctx, "text")
+			return err
+		},
+		func() error {
+			_, err := service.GenerateEmbeddings(ctx, []string{"text"})
+			return err
+		},
+		func() error {
+			_, _, err := service.Synthesize(ctx, "text", SynthesizeOptions{})
+			return err
+		},
+		func() error {
+			_, err := service.Transcribe(ctx, strings.NewReader("RIFF audio"), TranscribeOptions{})
+			return err
+		},
+		func() error {
+			_, err := service.Summarize(ctx, "a long message")
+			return err
+		},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*len(operations))
+	for i := 0; i < 3; i++ {
+		for _, op := range operations {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := op(); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("request failed: %v", err)
+	}
+
+	if got := server.requests.Load(); got != int32(3*len(operations)) {
+		t.Errorf("server saw %d requests, want %d", got, 3*len(operations))
+	}
+	if peak := server.peak.Load(); peak > 2 {
+		t.Errorf("%d requests were in flight at once, want at most 2", peak)
+	}
+}
+
+func TestRequestLimitWaitHonorsContext(t *testing.T) {
+	service := newTestService(t, &concurrencyServer{})
+	service.requests = semaphore.NewWeighted(1)
+
+	release, err := service.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := service.GenerateEmbedding(ctx, "text"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GenerateEmbedding error = %v, want the context's while all slots are taken", err)
+	}
+}
+
+func TestRequestLimitUnlimited(t *testing.T) {
+	service := &AIService{}
+	for i := 0; i < 100; i++ {
+		if _, err := service.acquire(context.Background()); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+}
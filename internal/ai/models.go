@@ -0,0 +1,27 @@
+// internal/ai/models.go
+package ai
+
+import (
+	"github.com/sashabaranov/go-openai"
+)
+
+// SupportedChatModels is the allowlist of chat models that can be selected
+// at runtime. Anything else is rejected to avoid typos or unsupported models.
+var SupportedChatModels = []string{
+	openai.GPT4oMini,
+	openai.GPT4o,
+	openai.GPT4Dot1Mini,
+	openai.GPT4Dot1,
+	openai.GPT4Turbo,
+	openai.GPT3Dot5Turbo,
+}
+
+// IsSupportedChatModel reports whether model is in SupportedChatModels
+func IsSupportedChatModel(model string) bool {
+	for _, m := range SupportedChatModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package ai
 
 import (
 	"context"
+	"discord-rag-bot/internal/config"
 	"fmt"
 	"io"
 	"log"
@@ -11,24 +12,130 @@ import (
 	"time"
 
 	"github.com/sashabaranov/go-openai"
+	"golang.org/x/sync/semaphore"
 )
 
 type AIService struct {
-	client *openai.Client
+	client    *openai.Client
+	chatModel string
+	normalize bool
+	// ttsFormat is the audio format requested from OpenAI TTS
+	ttsFormat AudioFormat
+
+	embedBatchSize   int
+	embedBatchTokens int
+
+	onUsage UsageFunc
+
+	// tempDir holds audio uploaded for transcription; "" is the OS temp dir
+	tempDir string
+
+	// requests bounds in-flight API calls across all operations; nil is
+	// unlimited
+	requests *semaphore.Weighted
+}
+
+func NewAIService(apiKey string, cfg config.AIConfig) *AIService {
+	return NewAIServiceWithClientConfig(openai.DefaultConfig(apiKey), cfg)
 }
 
-func NewAIService(apiKey string) *AIService {
-	return &AIService{
-		client: openai.NewClient(apiKey),
+// NewAIServiceWithClientConfig is NewAIService with a custom OpenAI client
+// config, e.g. for an OpenAI-compatible endpoint
+func NewAIServiceWithClientConfig(clientConfig openai.ClientConfig, cfg config.AIConfig) *AIService {
+	chatModel := cfg.ChatModel
+	if !IsSupportedChatModel(chatModel) {
+		log.Printf("Unsupported chat model %q, falling back to %s", chatModel, openai.GPT4oMini)
+		chatModel = openai.GPT4oMini
+	}
+
+	ttsFormat, err := ParseAudioFormat(cfg.TTSFormat)
+	if err != nil {
+		log.Printf("%v, falling back to %s", err, AudioFormatMP3)
+		ttsFormat = AudioFormatMP3
+	}
+
+	service := &AIService{
+		client:    openai.NewClientWithConfig(clientConfig),
+		chatModel: chatModel,
+		normalize: cfg.NormalizeEmbeddings,
+		ttsFormat: ttsFormat,
+
+		embedBatchSize:   cfg.EmbeddingBatchSize,
+		embedBatchTokens: cfg.EmbeddingBatchTokens,
 	}
+	if cfg.MaxConcurrentRequests > 0 {
+		service.requests = semaphore.NewWeighted(int64(cfg.MaxConcurrentRequests))
+	}
+	return service
+}
+
+// SetTempDir sets the directory for temporary audio files
+func (ai *AIService) SetTempDir(dir string) {
+	ai.tempDir = dir
 }
 
-func (ai *AIService) GenerateResponse(systemPrompt, userPrompt string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// DefaultChatModel returns the model used when a guild has no override
+func (ai *AIService) DefaultChatModel() string {
+	return ai.chatModel
+}
+
+// Preflight makes a cheap models-list call to verify the API key and
+// that the default chat model is available to it
+func (ai *AIService) Preflight(ctx context.Context) error {
+	release, err := ai.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	models, err := ai.client.ListModels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list models: %v", err)
+	}
+
+	for _, model := range models.Models {
+		if model.ID == ai.chatModel {
+			return nil
+		}
+	}
+	return fmt.Errorf("chat model %s is not available to this API key", ai.chatModel)
+}
+
+// defaultTemperature is the sampling temperature of chat completions
+const defaultTemperature = 0.7
+
+type temperatureKey struct{}
+
+// WithTemperature overrides the sampling temperature of chat completions
+// made with ctx, e.g. to get a more varied answer when regenerating
+func WithTemperature(ctx context.Context, temperature float32) context.Context {
+	return context.WithValue(ctx, temperatureKey{}, temperature)
+}
+
+func temperatureFromContext(ctx context.Context) float32 {
+	if temperature, ok := ctx.Value(temperatureKey{}).(float32); ok {
+		return temperature
+	}
+	return defaultTemperature
+}
+
+func (ai *AIService) GenerateResponse(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
+	return ai.GenerateResponseWithModel(ctx, ai.chatModel, systemPrompt, userPrompt)
+}
+
+// GenerateResponseWithModel is GenerateResponse using a specific chat model
+func (ai *AIService) GenerateResponseWithModel(ctx context.Context, model, systemPrompt, userPrompt string) (string, error) {
+	release, err := ai.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	resp, err := ai.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: openai.GPT4oMini,
+	resp, err := ai.client.CreateChatCompletion(reqCtx, openai.ChatCompletionRequest{
+		Model: model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
@@ -40,13 +147,23 @@ func (ai *AIService) GenerateResponse(systemPrompt, userPrompt string) (string,
 			},
 		},
 		MaxTokens:   500, // Reasonable limit for voice responses
-		Temperature: 0.7,
+		Temperature: temperatureFromContext(ctx),
 	})
 
 	if err != nil {
+		// A cancelled or expired caller wants no answer at all, not a fallback one
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		// A smaller prompt may succeed, so let the caller decide
+		if isContextLengthError(err) {
+			return "", fmt.Errorf("%w: %v", ErrContextLengthExceeded, err)
+		}
 		return ai.getFallbackResponse(userPrompt, systemPrompt), nil
 	}
 
+	ai.recordUsage(ctx, model, resp.Usage)
+
 	if len(resp.Choices) == 0 {
 		return "I'm sorry, I couldn't generate a response right now.", nil
 	}
@@ -54,8 +171,68 @@ func (ai *AIService) GenerateResponse(systemPrompt, userPrompt string) (string,
 	return resp.Choices[0].Message.Content, nil
 }
 
-func (ai *AIService) GenerateEmbedding(text string) ([]float32, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// summaryPrompt asks for a summary that keeps what a search would match on
+const summaryPrompt = "Summarize the following Discord message in a few sentences for a search index. " +
+	"Keep names, technical terms, decisions and questions. Reply with the summary only."
+
+// Summarize condenses text with the default chat model. Unlike
+// GenerateResponse it never answers with a canned fallback: failures are
+// returned so the caller can use the original text.
+func (ai *AIService) Summarize(ctx context.Context, text string) (string, error) {
+	summary, err := ai.complete(ctx, summaryPrompt, text, 200)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize: %v", err)
+	}
+	return summary, nil
+}
+
+// complete runs a low-temperature chat completion with the default model
+// for internal tasks, returning errors and empty answers as errors
+func (ai *AIService) complete(ctx context.Context, systemPrompt, userPrompt string, maxTokens int) (string, error) {
+	release, err := ai.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := ai.client.CreateChatCompletion(reqCtx, openai.ChatCompletionRequest{
+		Model: ai.chatModel,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: systemPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: userPrompt,
+			},
+		},
+		MaxTokens:   maxTokens,
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ai.recordUsage(ctx, ai.chatModel, resp.Usage)
+
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("empty response")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+func (ai *AIService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	release, err := ai.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	resp, err := ai.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
@@ -67,59 +244,99 @@ func (ai *AIService) GenerateEmbedding(text string) ([]float32, error) {
 		return nil, fmt.Errorf("failed to generate embedding: %v", err)
 	}
 
+	ai.recordUsage(ctx, string(openai.AdaEmbeddingV2), resp.Usage)
+
 	if len(resp.Data) == 0 {
 		return nil, fmt.Errorf("no embedding data returned")
 	}
 
-	return resp.Data[0].Embedding, nil
+	return ai.prepareEmbedding(resp.Data[0].Embedding), nil
+}
+
+func (ai *AIService) TextToSpeech(ctx context.Context, text string) ([]byte, error) {
+	audioData, _, err := ai.Synthesize(ctx, text, SynthesizeOptions{})
+	return audioData, err
 }
 
-func (ai *AIService) TextToSpeech(text string) ([]byte, error) {
+// Synthesize implements Synthesizer using OpenAI TTS, returning audio in
+// the configured format. Raw PCM is converted to AudioFormatPCM here, so it
+// plays without FFmpeg.
+func (ai *AIService) Synthesize(ctx context.Context, text string, opts SynthesizeOptions) ([]byte, AudioFormat, error) {
+	voice := openai.VoiceAlloy
+	if opts.Voice != "" {
+		voice = openai.SpeechVoice(opts.Voice)
+	}
+
+	speed := 1.0
+	if opts.Speed > 0 {
+		speed = opts.Speed
+	}
+
 	req := openai.CreateSpeechRequest{
 		Model:          openai.TTSModel1,
 		Input:          text,
-		Voice:          openai.VoiceAlloy,
-		ResponseFormat: openai.SpeechResponseFormatMp3,
-		Speed:          1.0,
+		Voice:          voice,
+		ResponseFormat: openai.SpeechResponseFormat(ai.ttsFormat),
+		Speed:          speed,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	release, err := ai.acquire(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
 	response, err := ai.client.CreateSpeech(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create speech: %v", err)
+		return nil, "", fmt.Errorf("failed to create speech: %v", err)
 	}
 	defer response.Close()
 
 	audioData, err := io.ReadAll(response)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read audio data: %v", err)
+		return nil, "", fmt.Errorf("failed to read audio data: %v", err)
+	}
+	if ai.ttsFormat == AudioFormatPCM {
+		audioData = upsampleSpeechPCM(audioData)
+	}
+	if err := validateAudio(audioData, ai.ttsFormat); err != nil {
+		return nil, "", err
 	}
 
-	return audioData, nil
+	return audioData, ai.ttsFormat, nil
 }
 
-// Add this to your ai/openai.go file (or update the existing SpeechToText method)
-func (ai *AIService) SpeechToText(audioReader io.Reader) (string, error) {
+func (ai *AIService) SpeechToText(ctx context.Context, audioReader io.Reader) (string, error) {
+	result, err := ai.Transcribe(ctx, audioReader, TranscribeOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// Transcribe implements Transcriber using the OpenAI Whisper API
+func (ai *AIService) Transcribe(ctx context.Context, audioReader io.Reader, opts TranscribeOptions) (Transcription, error) {
 	// Create a temporary file to store the audio
-	tempFile, err := os.CreateTemp("", "speech-*.wav")
+	tempFile, err := os.CreateTemp(ai.tempDir, "speech-*.wav")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %v", err)
+		return Transcription{}, fmt.Errorf("failed to create temp file: %v", err)
 	}
 	defer os.Remove(tempFile.Name())
 	defer tempFile.Close()
 
 	// Copy audio data to temp file
 	if _, err := io.Copy(tempFile, audioReader); err != nil {
-		return "", fmt.Errorf("failed to write audio data: %v", err)
+		return Transcription{}, fmt.Errorf("failed to write audio data: %v", err)
 	}
 	tempFile.Close()
 
 	// Verify file size
 	fileInfo, err := os.Stat(tempFile.Name())
 	if err != nil {
-		return "", fmt.Errorf("failed to get file info: %v", err)
+		return Transcription{}, fmt.Errorf("failed to get file info: %v", err)
 	}
 
 	log.Printf("Sending audio file to OpenAI: %d bytes", fileInfo.Size())
@@ -127,7 +344,7 @@ func (ai *AIService) SpeechToText(audioReader io.Reader) (string, error) {
 	// Open file for reading
 	file, err := os.Open(tempFile.Name())
 	if err != nil {
-		return "", fmt.Errorf("failed to open temp file: %v", err)
+		return Transcription{}, fmt.Errorf("failed to open temp file: %v", err)
 	}
 	defer file.Close()
 
@@ -136,17 +353,30 @@ func (ai *AIService) SpeechToText(audioReader io.Reader) (string, error) {
 		Model:    openai.Whisper1,
 		FilePath: tempFile.Name(),
 		Reader:   file,
+		Language: opts.Language,
+		Prompt:   opts.Prompt,
+		Format:   openai.AudioResponseFormatVerboseJSON,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	release, err := ai.acquire(ctx)
+	if err != nil {
+		return Transcription{}, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
 	resp, err := ai.client.CreateTranscription(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("failed to transcribe audio: %v", err)
+		return Transcription{}, fmt.Errorf("failed to transcribe audio: %v", err)
 	}
 
-	return resp.Text, nil
+	language := opts.Language
+	if language == "" {
+		language = resp.Language
+	}
+	return Transcription{Text: resp.Text, Language: language}, nil
 }
 
 func (ai *AIService) getFallbackResponse(prompt string, contextInfo string) string {
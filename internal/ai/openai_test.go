@@ -0,0 +1,41 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestWithTemperature(t *testing.T) {
+	var mu sync.Mutex
+	var temperatures []float32
+	ai := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		temperatures = append(temperatures, req.Temperature)
+		mu.Unlock()
+		usageServer(w, r)
+	}))
+
+	ctx := context.Background()
+	if _, err := ai.GenerateResponse(ctx, "system", "question"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.GenerateResponse(WithTemperature(ctx, 1), "system", "question"); err != nil {
+		t.Fatal(err)
+	}
+	// The override only applies to the context it was set on
+	if _, err := ai.GenerateResponse(ctx, "system", "question"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []float32{defaultTemperature, 1, defaultTemperature}; !slices.Equal(temperatures, want) {
+		t.Errorf("temperatures = %v, want %v", temperatures, want)
+	}
+}
@@ -0,0 +1,180 @@
+// internal/ai/reranker.go
+package ai
+
+import (
+	"bytes"
+	"context"
+	"discord-rag-bot/internal/config"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reranker scores how relevant each document is to a query, to reorder
+// vector search results. Higher scores are more relevant; scores are only
+// compared within one call.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// NewReranker returns the re-ranker selected in config, or nil if
+// re-ranking is off
+func NewReranker(cfg config.AIConfig, service *AIService) (Reranker, error) {
+	switch strings.ToLower(cfg.Reranker) {
+	case "", "off":
+		return nil, nil
+	case "llm":
+		return NewLLMReranker(service), nil
+	case "http":
+		if cfg.RerankURL == "" {
+			return nil, fmt.Errorf("RERANK_URL is required for the http re-ranker")
+		}
+		return NewHTTPReranker(cfg.RerankURL, cfg.RerankAPIKey, cfg.RerankModel), nil
+	default:
+		return nil, fmt.Errorf("unknown re-ranker %q", cfg.Reranker)
+	}
+}
+
+// LLMReranker asks the chat model to rate each document in a single call
+type LLMReranker struct {
+	service *AIService
+}
+
+func NewLLMReranker(service *AIService) *LLMReranker {
+	return &LLMReranker{service: service}
+}
+
+const rerankPrompt = "You rate how relevant numbered Discord messages are to a question. " +
+	"Reply with one line per message in the form <number>: <score>, where the score is 0 (irrelevant) to 10 (answers the question), and nothing else."
+
+// rerankDocumentLength caps each document in the prompt, keeping the call
+// lightweight; the start of a message is usually enough to judge it
+const rerankDocumentLength = 500
+
+// rerankScorePattern matches a "<number>: <score>" line
+var rerankScorePattern = regexp.MustCompile(`(?m)^\s*(\d+)\s*[:.)-]\s*(\d+(?:\.\d+)?)`)
+
+func (l *LLMReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Question: %s\n\nMessages:\n", query)
+	for i, doc := range documents {
+		if runes := []rune(doc); len(runes) > rerankDocumentLength {
+			doc = string(runes[:rerankDocumentLength]) + "…"
+		}
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, strings.ReplaceAll(doc, "\n", " "))
+	}
+
+	reply, err := l.service.complete(ctx, rerankPrompt, sb.String(), 8*len(documents)+20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-rank: %v", err)
+	}
+	return parseRerankScores(reply, len(documents))
+}
+
+// parseRerankScores reads "<number>: <score>" lines for n documents.
+// Documents the model skipped score below every rated one.
+func parseRerankScores(reply string, n int) ([]float64, error) {
+	scores := make([]float64, n)
+	for i := range scores {
+		scores[i] = -1
+	}
+
+	rated := 0
+	for _, match := range rerankScorePattern.FindAllStringSubmatch(reply, -1) {
+		number, err := strconv.Atoi(match[1])
+		if err != nil || number < 1 || number > n {
+			continue
+		}
+		score, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		scores[number-1] = score
+		rated++
+	}
+	if rated == 0 {
+		return nil, fmt.Errorf("failed to re-rank: no scores in reply %q", reply)
+	}
+	return scores, nil
+}
+
+// HTTPReranker calls a re-ranking endpoint speaking the Cohere/Jina rerank
+// format: it posts {"model", "query", "documents"} and reads
+// {"results": [{"index", "relevance_score"}]}. The API key, if any, is sent
+// as a bearer token; hosted endpoints require both it and the model.
+type HTTPReranker struct {
+	url    string
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+func NewHTTPReranker(url, apiKey, model string) *HTTPReranker {
+	return &HTTPReranker{
+		url:    url,
+		apiKey: apiKey,
+		model:  model,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (h *HTTPReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	request := map[string]interface{}{
+		"query":     query,
+		"documents": documents,
+	}
+	if h.model != "" {
+		request["model"] = h.model
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode re-rank request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.apiKey)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-rank: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("re-ranker returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Results []struct {
+			Index          int     `json:"index"`
+			RelevanceScore float64 `json:"relevance_score"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode re-rank response: %v", err)
+	}
+
+	// Documents missing from the results score below every returned one
+	scores := make([]float64, len(documents))
+	for i := range scores {
+		scores[i] = -1
+	}
+	for _, r := range result.Results {
+		if r.Index >= 0 && r.Index < len(scores) {
+			scores[r.Index] = r.RelevanceScore
+		}
+	}
+	return scores, nil
+}
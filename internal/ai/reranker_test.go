@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestParseRerankScores(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    []float64
+		wantErr bool
+	}{
+		{"every document", "1: 3\n2: 9\n3: 0", []float64{3, 9, 0}, false},
+		{"out of order", "2: 9\n1: 3.5\n3: 1", []float64{3.5, 9, 1}, false},
+		{"other separators", "1. 3\n2) 9\n3 - 1", []float64{3, 9, 1}, false},
+		{"skipped document", "1: 3\n3: 1", []float64{3, -1, 1}, false},
+		{"out of range", "0: 7\n1: 3\n4: 8", []float64{3, -1, -1}, false},
+		{"no scores", "I can't rate these.", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRerankScores(tt.reply, 3)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: parseRerankScores = %v, %v, want %v (error %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHTTPReranker(t *testing.T) {
+	var req struct {
+		Model     string   `json:"model"`
+		Query     string   `json:"query"`
+		Documents []string `json:"documents"`
+	}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&req)
+		// Results come sorted by relevance, and may leave documents out
+		w.Write([]byte(`{"results": [{"index": 2, "relevance_score": 0.9}, {"index": 0, "relevance_score": 0.2}, {"index": 7, "relevance_score": 1}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	reranker := NewHTTPReranker(server.URL, "key", "rerank-v1")
+	scores, err := reranker.Rerank(context.Background(), "when is game night", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{0.2, -1, 0.9}; !slices.Equal(scores, want) {
+		t.Errorf("scores = %v, want %v", scores, want)
+	}
+	if auth != "Bearer key" || req.Model != "rerank-v1" || req.Query != "when is game night" || !slices.Equal(req.Documents, []string{"a", "b", "c"}) {
+		t.Errorf("request = %+v with authorization %q, want the query, documents, model and key", req, auth)
+	}
+}
+
+func TestHTTPRerankerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	if _, err := NewHTTPReranker(server.URL, "", "").Rerank(context.Background(), "q", []string{"a"}); err == nil {
+		t.Error("Rerank succeeded against a failing endpoint")
+	}
+}
+
+func TestNewReranker(t *testing.T) {
+	tests := []struct {
+		cfg     config.AIConfig
+		want    string
+		wantErr bool
+	}{
+		{config.AIConfig{}, "<nil>", false},
+		{config.AIConfig{Reranker: "off"}, "<nil>", false},
+		{config.AIConfig{Reranker: "LLM"}, "*ai.LLMReranker", false},
+		{config.AIConfig{Reranker: "http", RerankURL: "http://localhost"}, "*ai.HTTPReranker", false},
+		{config.AIConfig{Reranker: "http"}, "<nil>", true},
+		{config.AIConfig{Reranker: "cohere"}, "<nil>", true},
+	}
+	for _, tt := range tests {
+		reranker, err := NewReranker(tt.cfg, nil)
+		if got := typeName(reranker); got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("NewReranker(%q) = %s, %v, want %s (error %v)", tt.cfg.Reranker, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLLMReranker(t *testing.T) {
+	var prompt string
+	ai := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1].Content
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "1: 2\n2: 8"}}},
+		})
+	}))
+
+	scores, err := NewLLMReranker(ai).Rerank(context.Background(), "when is game night", []string{"the weather\nis nice", "game night is friday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{2, 8}; !slices.Equal(scores, want) {
+		t.Errorf("scores = %v, want %v", scores, want)
+	}
+	want := "Question: when is game night\n\nMessages:\n1. the weather is nice\n2. game night is friday\n"
+	if prompt != want {
+		t.Errorf("prompt = %q, want %q", prompt, want)
+	}
+}
@@ -0,0 +1,91 @@
+// internal/ai/speechtext.go
+package ai
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxSpeechChars is OpenAI's TTS input limit; longer text is synthesized in
+// several pieces
+const MaxSpeechChars = 4096
+
+// SplitSpeechText splits text into chunks of at most limit characters,
+// breaking after sentence ends where possible, then at word boundaries. A
+// single word longer than limit is the only thing ever cut.
+func SplitSpeechText(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	var chunks []string
+	var current strings.Builder
+	currentLen := 0
+
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+		currentLen = 0
+	}
+
+	add := func(piece string) {
+		pieceLen := utf8.RuneCountInString(piece)
+		if currentLen > 0 && currentLen+1+pieceLen > limit {
+			flush()
+		}
+		if currentLen > 0 {
+			current.WriteByte(' ')
+			currentLen++
+		}
+		current.WriteString(piece)
+		currentLen += pieceLen
+	}
+
+	for _, sentence := range splitSentences(text) {
+		if utf8.RuneCountInString(sentence) <= limit {
+			add(sentence)
+			continue
+		}
+
+		// Sentence too long on its own: fall back to words
+		for _, word := range strings.Fields(sentence) {
+			for utf8.RuneCountInString(word) > limit {
+				runes := []rune(word)
+				add(string(runes[:limit]))
+				word = string(runes[limit:])
+			}
+			add(word)
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// splitSentences splits text after '.', '!', '?' or a newline that is
+// followed by whitespace
+func splitSentences(text string) []string {
+	var sentences []string
+	runes := []rune(text)
+	start := 0
+	for i, r := range runes {
+		end := r == '.' || r == '!' || r == '?' || r == '\n'
+		if end && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])) {
+			if sentence := strings.TrimSpace(string(runes[start : i+1])); sentence != "" {
+				sentences = append(sentences, sentence)
+			}
+			start = i + 1
+		}
+	}
+	if sentence := strings.TrimSpace(string(runes[start:])); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
@@ -0,0 +1,201 @@
+// internal/ai/synthesizer.go
+package ai
+
+import (
+	"bytes"
+	"context"
+	"discord-rag-bot/internal/config"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// AudioFormat is the container/encoding of synthesized speech
+type AudioFormat string
+
+const (
+	AudioFormatMP3  AudioFormat = "mp3"
+	AudioFormatWAV  AudioFormat = "wav"
+	AudioFormatOpus AudioFormat = "opus"
+	// AudioFormatPCM is raw 16-bit little-endian 48kHz stereo, the format
+	// Discord playback encodes from, so it needs no conversion
+	AudioFormatPCM AudioFormat = "pcm"
+)
+
+// Extension returns the file extension FFmpeg uses to recognize the format
+func (f AudioFormat) Extension() string {
+	switch f {
+	case AudioFormatOpus:
+		return ".ogg"
+	case AudioFormatWAV:
+		return ".wav"
+	case AudioFormatPCM:
+		return ".pcm"
+	default:
+		return ".mp3"
+	}
+}
+
+// Demuxer returns the FFmpeg input format name for the format, so the
+// input is never guessed from its content or file name
+func (f AudioFormat) Demuxer() string {
+	switch f {
+	case AudioFormatOpus:
+		return "ogg"
+	case AudioFormatWAV:
+		return "wav"
+	case AudioFormatPCM:
+		return "s16le"
+	default:
+		return "mp3"
+	}
+}
+
+// ParseAudioFormat parses a configured audio format name
+func ParseAudioFormat(name string) (AudioFormat, error) {
+	switch format := AudioFormat(strings.ToLower(strings.TrimSpace(name))); format {
+	case AudioFormatMP3, AudioFormatWAV, AudioFormatOpus, AudioFormatPCM:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown audio format %q (use mp3, opus, wav or pcm)", name)
+	}
+}
+
+// pcmFrameBytes is one 16-bit stereo sample frame
+const pcmFrameBytes = 4
+
+// upsampleSpeechPCM converts OpenAI's raw speech, 16-bit little-endian
+// 24kHz mono, to AudioFormatPCM. Each input sample becomes two output
+// frames, the second interpolated toward the next sample, with the same
+// value on both channels.
+func upsampleSpeechPCM(data []byte) []byte {
+	samples := len(data) / 2
+	out := make([]byte, 0, samples*2*pcmFrameBytes)
+	for i := 0; i < samples; i++ {
+		current := int16(binary.LittleEndian.Uint16(data[2*i:]))
+		next := current
+		if i+1 < samples {
+			next = int16(binary.LittleEndian.Uint16(data[2*i+2:]))
+		}
+		mid := int16((int32(current) + int32(next)) / 2)
+		for _, sample := range []int16{current, current, mid, mid} {
+			out = binary.LittleEndian.AppendUint16(out, uint16(sample))
+		}
+	}
+	return out
+}
+
+// ErrInvalidAudio is returned when a provider answers with audio that can't
+// be played, so callers can skip playback instead of failing in FFmpeg
+var ErrInvalidAudio = errors.New("synthesized audio is invalid")
+
+// minAudioBytes is shorter than any playable clip, headers included
+const minAudioBytes = 128
+
+// validateAudio checks synthesized audio is long enough and starts like
+// the format it claims to be
+func validateAudio(data []byte, format AudioFormat) error {
+	if len(data) < minAudioBytes {
+		return fmt.Errorf("%w: only %d bytes of %s", ErrInvalidAudio, len(data), format)
+	}
+
+	var ok bool
+	switch format {
+	case AudioFormatMP3:
+		// Either an ID3 tag or an MPEG frame sync
+		ok = bytes.HasPrefix(data, []byte("ID3")) || (data[0] == 0xFF && data[1]&0xE0 == 0xE0)
+	case AudioFormatWAV:
+		ok = bytes.HasPrefix(data, []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE"))
+	case AudioFormatOpus:
+		ok = bytes.HasPrefix(data, []byte("OggS"))
+	case AudioFormatPCM:
+		// Headerless, so only whole sample frames can be checked
+		if len(data)%pcmFrameBytes != 0 {
+			return fmt.Errorf("%w: %d bytes isn't a whole number of PCM frames", ErrInvalidAudio, len(data))
+		}
+		ok = true
+	default:
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("%w: data doesn't start with a %s header", ErrInvalidAudio, format)
+	}
+	return nil
+}
+
+// SynthesizeOptions tunes a single text-to-speech request
+type SynthesizeOptions struct {
+	// Voice is a provider-specific voice name; empty uses the provider default
+	Voice string
+	// Speed is a playback rate multiplier; zero means normal speed
+	Speed float64
+}
+
+// Synthesizer converts text to speech audio in the returned format
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string, opts SynthesizeOptions) ([]byte, AudioFormat, error)
+}
+
+// NewSynthesizer returns the text-to-speech provider selected in config,
+// behind an audio cache if one is configured. OpenAI TTS is the default.
+func NewSynthesizer(cfg config.AIConfig, service *AIService) (Synthesizer, error) {
+	var synthesizer Synthesizer
+	switch strings.ToLower(cfg.SpeechProvider) {
+	case "", "openai":
+		synthesizer = service
+	case "piper":
+		if cfg.PiperModel == "" {
+			return nil, fmt.Errorf("PIPER_MODEL is required for the piper speech provider")
+		}
+		synthesizer = NewPiperSynthesizer(cfg.PiperBinary, cfg.PiperModel)
+	default:
+		return nil, fmt.Errorf("unknown speech provider %q", cfg.SpeechProvider)
+	}
+
+	if cfg.TTSCacheSize > 0 {
+		synthesizer = NewCachingSynthesizer(synthesizer, cfg.TTSCacheSize)
+	}
+	return synthesizer, nil
+}
+
+// PiperSynthesizer runs the local Piper TTS engine, which emits WAV audio
+type PiperSynthesizer struct {
+	binary string
+	model  string
+}
+
+func NewPiperSynthesizer(binary, model string) *PiperSynthesizer {
+	if binary == "" {
+		binary = "piper"
+	}
+	return &PiperSynthesizer{
+		binary: binary,
+		model:  model,
+	}
+}
+
+func (p *PiperSynthesizer) Synthesize(ctx context.Context, text string, opts SynthesizeOptions) ([]byte, AudioFormat, error) {
+	args := []string{"--model", p.model, "--output_file", "-"}
+	if opts.Speed > 0 {
+		// Piper expresses speed as phoneme length, the inverse of a rate
+		args = append(args, "--length_scale", fmt.Sprintf("%.2f", 1/opts.Speed))
+	}
+
+	cmd := exec.CommandContext(ctx, p.binary, args...)
+	cmd.Stdin = strings.NewReader(text)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, "", fmt.Errorf("piper synthesis failed: %v, stderr: %s", err, stderr.String())
+	}
+
+	if err := validateAudio(stdout.Bytes(), AudioFormatWAV); err != nil {
+		return nil, "", err
+	}
+	return stdout.Bytes(), AudioFormatWAV, nil
+}
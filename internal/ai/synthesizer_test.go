@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// countingSynthesizer returns the text as WAV-tagged audio and counts calls
+type countingSynthesizer struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *countingSynthesizer) Synthesize(ctx context.Context, text string, opts SynthesizeOptions) ([]byte, AudioFormat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return []byte(text), AudioFormatWAV, nil
+}
+
+func TestParseAudioFormat(t *testing.T) {
+	for name, want := range map[string]AudioFormat{"mp3": AudioFormatMP3, " WAV ": AudioFormatWAV, "Opus": AudioFormatOpus, "pcm": AudioFormatPCM} {
+		if got, err := ParseAudioFormat(name); err != nil || got != want {
+			t.Errorf("ParseAudioFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseAudioFormat("flac"); err == nil {
+		t.Error("ParseAudioFormat(flac) succeeded")
+	}
+}
+
+func TestAudioFormatDemuxer(t *testing.T) {
+	for format, want := range map[AudioFormat]string{AudioFormatMP3: "mp3", AudioFormatWAV: "wav", AudioFormatOpus: "ogg", AudioFormatPCM: "s16le"} {
+		if got := format.Demuxer(); got != want {
+			t.Errorf("%s.Demuxer() = %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestValidateAudio(t *testing.T) {
+	pad := func(header string) []byte {
+		return append([]byte(header), make([]byte, minAudioBytes)...)
+	}
+	wav := pad("RIFF\x00\x00\x00\x00WAVE")
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format AudioFormat
+		valid  bool
+	}{
+		{"mp3 with ID3", pad("ID3"), AudioFormatMP3, true},
+		{"mp3 frame sync", pad("\xff\xfb"), AudioFormatMP3, true},
+		{"wav", wav, AudioFormatWAV, true},
+		{"ogg", pad("OggS"), AudioFormatOpus, true},
+		{"pcm", make([]byte, 4*minAudioBytes), AudioFormatPCM, true},
+		{"too short", []byte("ID3"), AudioFormatMP3, false},
+		{"wav claimed as mp3", wav, AudioFormatMP3, false},
+		{"html error page", pad("<html>"), AudioFormatWAV, false},
+		{"partial pcm frame", make([]byte, 4*minAudioBytes+1), AudioFormatPCM, false},
+	}
+	for _, tt := range tests {
+		err := validateAudio(tt.data, tt.format)
+		if tt.valid && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidAudio) {
+			t.Errorf("%s: error = %v, want ErrInvalidAudio", tt.name, err)
+		}
+	}
+}
+
+func TestUpsampleSpeechPCM(t *testing.T) {
+	// Two 24kHz mono samples, 100 and 200, plus a stray byte
+	out := upsampleSpeechPCM([]byte{100, 0, 200, 0, 1})
+	want := []byte{100, 0, 100, 0, 150, 0, 150, 0, 200, 0, 200, 0, 200, 0, 200, 0}
+	if !bytes.Equal(out, want) {
+		t.Errorf("upsampleSpeechPCM = %v, want %v", out, want)
+	}
+}
+
+func TestCachingSynthesizer(t *testing.T) {
+	next := &countingSynthesizer{}
+	cache := NewCachingSynthesizer(next, 2)
+	ctx := context.Background()
+
+	for _, text := range []string{"one", "one", "two", "one", "three", "two"} {
+		audio, format, err := cache.Synthesize(ctx, text, SynthesizeOptions{})
+		if err != nil || string(audio) != text || format != AudioFormatWAV {
+			t.Fatalf("Synthesize(%q) = %q, %q, %v", text, audio, format, err)
+		}
+	}
+	// "two" was evicted by "three", as "one" was used more recently
+	if next.calls != 4 {
+		t.Errorf("provider called %d times, want 4", next.calls)
+	}
+
+	if _, _, err := cache.Synthesize(ctx, "one", SynthesizeOptions{Voice: "nova"}); err != nil {
+		t.Fatal(err)
+	}
+	if next.calls != 5 {
+		t.Error("cached audio was reused for another voice")
+	}
+}
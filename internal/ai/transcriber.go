@@ -0,0 +1,120 @@
+// internal/ai/transcriber.go
+package ai
+
+import (
+	"bytes"
+	"context"
+	"discord-rag-bot/internal/config"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TranscribeOptions tunes a single transcription request
+type TranscribeOptions struct {
+	// Language is an ISO-639-1 hint such as "en"; empty lets the provider detect it
+	Language string
+	// Prompt biases recognition toward expected vocabulary
+	Prompt string
+}
+
+// Transcription is the result of a speech-to-text request
+type Transcription struct {
+	Text string
+	// Language is the requested or detected language, in whatever form the
+	// provider reports it (e.g. "en" or "english"); empty if unknown
+	Language string
+}
+
+// Transcriber converts WAV audio to text
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio io.Reader, opts TranscribeOptions) (Transcription, error)
+}
+
+// NewTranscriber returns the speech-to-text provider selected in config.
+// The OpenAI Whisper API is the default.
+func NewTranscriber(cfg config.AIConfig, service *AIService) (Transcriber, error) {
+	switch strings.ToLower(cfg.TranscriptionProvider) {
+	case "", "openai":
+		return service, nil
+	case "whisper-cpp":
+		if cfg.WhisperURL == "" {
+			return nil, fmt.Errorf("WHISPER_URL is required for the whisper-cpp transcription provider")
+		}
+		return NewWhisperCppTranscriber(cfg.WhisperURL), nil
+	case "deepgram":
+		if cfg.DeepgramAPIKey == "" {
+			return nil, fmt.Errorf("DEEPGRAM_API_KEY is required for the deepgram transcription provider")
+		}
+		return NewDeepgramTranscriber(cfg.DeepgramAPIKey), nil
+	default:
+		return nil, fmt.Errorf("unknown transcription provider %q", cfg.TranscriptionProvider)
+	}
+}
+
+// WhisperCppTranscriber talks to a whisper.cpp server's /inference endpoint
+type WhisperCppTranscriber struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewWhisperCppTranscriber(baseURL string) *WhisperCppTranscriber {
+	return &WhisperCppTranscriber{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (w *WhisperCppTranscriber) Transcribe(ctx context.Context, audio io.Reader, opts TranscribeOptions) (Transcription, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	part, err := form.CreateFormFile("file", "speech.wav")
+	if err != nil {
+		return Transcription{}, fmt.Errorf("failed to create form file: %v", err)
+	}
+	if _, err := io.Copy(part, audio); err != nil {
+		return Transcription{}, fmt.Errorf("failed to write audio data: %v", err)
+	}
+
+	form.WriteField("response_format", "json")
+	if opts.Language != "" {
+		form.WriteField("language", opts.Language)
+	}
+	if opts.Prompt != "" {
+		form.WriteField("prompt", opts.Prompt)
+	}
+	if err := form.Close(); err != nil {
+		return Transcription{}, fmt.Errorf("failed to finalize form: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.baseURL+"/inference", &body)
+	if err != nil {
+		return Transcription{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return Transcription{}, fmt.Errorf("failed to transcribe audio: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return Transcription{}, fmt.Errorf("whisper.cpp returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Transcription{}, fmt.Errorf("failed to decode transcription: %v", err)
+	}
+
+	return Transcription{Text: strings.TrimSpace(result.Text), Language: opts.Language}, nil
+}
@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewTranscriber(t *testing.T) {
+	service := &AIService{}
+
+	tests := []struct {
+		cfg     config.AIConfig
+		want    string
+		wantErr bool
+	}{
+		{cfg: config.AIConfig{}, want: "*ai.AIService"},
+		{cfg: config.AIConfig{TranscriptionProvider: "OpenAI"}, want: "*ai.AIService"},
+		{cfg: config.AIConfig{TranscriptionProvider: "whisper-cpp", WhisperURL: "http://localhost:8080"}, want: "*ai.WhisperCppTranscriber"},
+		{cfg: config.AIConfig{TranscriptionProvider: "whisper-cpp"}, wantErr: true},
+		{cfg: config.AIConfig{TranscriptionProvider: "deepgram", DeepgramAPIKey: "key"}, want: "*ai.DeepgramTranscriber"},
+		{cfg: config.AIConfig{TranscriptionProvider: "deepgram"}, wantErr: true},
+		{cfg: config.AIConfig{TranscriptionProvider: "vosk"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		transcriber, err := NewTranscriber(tt.cfg, service)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewTranscriber(%q) succeeded, want an error", tt.cfg.TranscriptionProvider)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewTranscriber(%q): %v", tt.cfg.TranscriptionProvider, err)
+			continue
+		}
+		if got := typeName(transcriber); got != tt.want {
+			t.Errorf("NewTranscriber(%q) = %s, want %s", tt.cfg.TranscriptionProvider, got, tt.want)
+		}
+	}
+}
+
+func TestWhisperCppTranscriber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inference" {
+			http.NotFound(w, r)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audio, _ := io.ReadAll(file)
+		if string(audio) != "RIFF audio" || r.FormValue("language") != "en" || r.FormValue("prompt") != "Discord" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"text": "  hello there \n"}`))
+	}))
+	defer server.Close()
+
+	transcriber := NewWhisperCppTranscriber(server.URL + "/")
+	transcription, err := transcriber.Transcribe(context.Background(), strings.NewReader("RIFF audio"), TranscribeOptions{Language: "en", Prompt: "Discord"})
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if transcription.Text != "hello there" || transcription.Language != "en" {
+		t.Errorf("transcription = %+v", transcription)
+	}
+}
+
+func TestWhisperCppTranscriberError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := NewWhisperCppTranscriber(server.URL).Transcribe(context.Background(), strings.NewReader("RIFF audio"), TranscribeOptions{})
+	if err == nil || !strings.Contains(err.Error(), "model not loaded") {
+		t.Errorf("Transcribe error = %v, want the server's message", err)
+	}
+}
+
+func typeName(v any) string {
+	return fmt.Sprintf("%T", v)
+}
+
+// The upload is staged in the configured directory and removed afterwards,
+// whether or not the API call succeeds
+func TestTranscribeTempFile(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		dir := t.TempDir()
+		var staged []string
+		service := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			staged, _ = filepath.Glob(filepath.Join(dir, "speech-*.wav"))
+			if fail {
+				http.Error(w, `{"error": {"message": "unavailable"}}`, http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"text": "hello", "language": "english"}`))
+		}))
+		service.SetTempDir(dir)
+
+		_, err := service.Transcribe(context.Background(), strings.NewReader("RIFF audio"), TranscribeOptions{})
+		if fail != (err != nil) {
+			t.Errorf("fail=%v: Transcribe error = %v", fail, err)
+		}
+		if len(staged) != 1 {
+			t.Errorf("fail=%v: staged files = %v, want one in the temp dir", fail, staged)
+		}
+		if left, _ := os.ReadDir(dir); len(left) != 0 {
+			t.Errorf("fail=%v: %d files left in the temp dir", fail, len(left))
+		}
+	}
+}
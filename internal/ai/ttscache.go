@@ -0,0 +1,73 @@
+// internal/ai/ttscache.go
+package ai
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+)
+
+// CachingSynthesizer remembers recently synthesized audio so repeated
+// phrases, like canned replies, play without another synthesis request.
+// The least recently used entries are evicted past maxEntries.
+type CachingSynthesizer struct {
+	next       Synthesizer
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type ttsCacheEntry struct {
+	key    string
+	audio  []byte
+	format AudioFormat
+}
+
+func NewCachingSynthesizer(next Synthesizer, maxEntries int) *CachingSynthesizer {
+	return &CachingSynthesizer{
+		next:       next,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func ttsCacheKey(text string, opts SynthesizeOptions) string {
+	return opts.Voice + "\x00" + strconv.FormatFloat(opts.Speed, 'g', -1, 64) + "\x00" + text
+}
+
+func (c *CachingSynthesizer) Synthesize(ctx context.Context, text string, opts SynthesizeOptions) ([]byte, AudioFormat, error) {
+	key := ttsCacheKey(text, opts)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		entry := elem.Value.(*ttsCacheEntry)
+		c.mu.Unlock()
+		return entry.audio, entry.format, nil
+	}
+	c.mu.Unlock()
+
+	audio, format, err := c.next.Synthesize(ctx, text, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return audio, format, nil
+	}
+	c.entries[key] = c.order.PushFront(&ttsCacheEntry{key: key, audio: audio, format: format})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*ttsCacheEntry).key)
+	}
+	return audio, format, nil
+}
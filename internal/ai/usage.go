@@ -0,0 +1,97 @@
+// internal/ai/usage.go
+package ai
+
+import (
+	"context"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Usage is the token usage reported for a single API call
+type Usage struct {
+	GuildID          string
+	UserID           string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// TotalTokens is the sum of prompt and completion tokens
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// UsageFunc receives the usage of every chat and embedding call
+type UsageFunc func(usage Usage)
+
+// modelPrice is the price in USD per million tokens
+type modelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// modelPrices are list prices used to estimate spend. They are estimates
+// only; check OpenAI's pricing page for current figures.
+var modelPrices = map[string]modelPrice{
+	openai.GPT4oMini:               {Input: 0.15, Output: 0.60},
+	openai.GPT4o:                   {Input: 2.50, Output: 10.00},
+	openai.GPT4Dot1Mini:            {Input: 0.40, Output: 1.60},
+	openai.GPT4Dot1:                {Input: 2.00, Output: 8.00},
+	openai.GPT4Turbo:               {Input: 10.00, Output: 30.00},
+	openai.GPT3Dot5Turbo:           {Input: 0.50, Output: 1.50},
+	string(openai.AdaEmbeddingV2):  {Input: 0.10},
+	string(openai.SmallEmbedding3): {Input: 0.02},
+	string(openai.LargeEmbedding3): {Input: 0.13},
+}
+
+// EstimateCost returns the estimated cost in USD of the given token counts
+// for a model, or 0 if the model's price is unknown
+func EstimateCost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := modelPrices[model]
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
+
+type guildIDKey struct{}
+
+// WithGuildID attributes API usage made with ctx to a guild
+func WithGuildID(ctx context.Context, guildID string) context.Context {
+	return context.WithValue(ctx, guildIDKey{}, guildID)
+}
+
+func guildIDFromContext(ctx context.Context) string {
+	guildID, _ := ctx.Value(guildIDKey{}).(string)
+	return guildID
+}
+
+type userIDKey struct{}
+
+// WithUserID attributes API usage made with ctx to the user who asked
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+func userIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey{}).(string)
+	return userID
+}
+
+// SetUsageFunc registers a callback for token usage
+func (ai *AIService) SetUsageFunc(fn UsageFunc) {
+	ai.onUsage = fn
+}
+
+func (ai *AIService) recordUsage(ctx context.Context, model string, usage openai.Usage) {
+	if ai.onUsage == nil {
+		return
+	}
+	ai.onUsage(Usage{
+		GuildID:          guildIDFromContext(ctx),
+		UserID:           userIDFromContext(ctx),
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	})
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// usageServer answers chat completions and embeddings, reporting fixed
+// token usage for each
+func usageServer(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/embeddings" {
+		json.NewEncoder(w).Encode(openai.EmbeddingResponse{
+			Object: "list",
+			Data:   []openai.Embedding{{Object: "embedding", Embedding: []float32{1, 0}}},
+			Usage:  openai.Usage{PromptTokens: 7, TotalTokens: 7},
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "answer"}}},
+		Usage:   openai.Usage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120},
+	})
+}
+
+func TestUsageReported(t *testing.T) {
+	ai := newTestService(t, http.HandlerFunc(usageServer))
+	var mu sync.Mutex
+	var reported []Usage
+	ai.SetUsageFunc(func(usage Usage) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, usage)
+	})
+
+	ctx := WithUserID(WithGuildID(context.Background(), "g1"), "u1")
+	if _, err := ai.GenerateResponseWithModel(ctx, openai.GPT4o, "system", "question"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.GenerateEmbeddings(WithGuildID(context.Background(), "g2"), []string{"text"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Usage{
+		{GuildID: "g1", UserID: "u1", Model: openai.GPT4o, PromptTokens: 100, CompletionTokens: 20},
+		{GuildID: "g2", Model: string(openai.AdaEmbeddingV2), PromptTokens: 7},
+	}
+	if !slices.Equal(reported, want) {
+		t.Errorf("usage reported = %+v, want %+v", reported, want)
+	}
+
+	var total int
+	for _, usage := range reported {
+		total += usage.TotalTokens()
+	}
+	if total != 127 {
+		t.Errorf("total tokens = %d, want 127", total)
+	}
+}
+
+func TestUsageWithoutCallback(t *testing.T) {
+	ai := newTestService(t, http.HandlerFunc(usageServer))
+	if _, err := ai.GenerateResponseWithModel(context.Background(), openai.GPT4oMini, "system", "question"); err != nil {
+		t.Errorf("GenerateResponseWithModel without a usage callback: %v", err)
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	tests := []struct {
+		model              string
+		prompt, completion int
+		want               float64
+	}{
+		{openai.GPT4oMini, 1_000_000, 1_000_000, 0.75},
+		{openai.GPT4o, 2000, 500, 0.01},
+		{string(openai.SmallEmbedding3), 1_000_000, 0, 0.02},
+		{"unknown-model", 1000, 1000, 0},
+	}
+	for _, tt := range tests {
+		if got := EstimateCost(tt.model, tt.prompt, tt.completion); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("EstimateCost(%s, %d, %d) = %v, want %v", tt.model, tt.prompt, tt.completion, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// internal/bot/admin.go
+package bot
+
+import (
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/rag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// adminPermissions is the default permission required to see admin commands
+var adminPermissions int64 = discordgo.PermissionManageServer
+
+// isAdmin checks the invoking member's permissions server-side, since guilds
+// can override the default command permissions
+func isAdmin(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		return false
+	}
+	return i.Member.Permissions&discordgo.PermissionManageServer != 0 ||
+		i.Member.Permissions&discordgo.PermissionAdministrator != 0
+}
+
+// deferEphemeral acknowledges an interaction with a private "thinking" state
+func deferEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// editInteraction fills in an ephemeral deferred response. If the
+// interaction expired, the content is sent to the user by DM instead so it
+// stays private.
+func (h *BotHandler) editInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	if !interactionExpired(i, time.Now()) {
+		_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+		if err == nil {
+			return
+		}
+		log.Printf("Error editing interaction response: %v", err)
+		if !isExpiredInteractionError(err) {
+			return
+		}
+	}
+
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+	dm, err := s.UserChannelCreate(user.ID)
+	if err == nil {
+		_, err = h.sendMessage(s, dm.ID, &discordgo.MessageSend{Content: content})
+	}
+	if err != nil {
+		log.Printf("Error sending expired interaction response to user %s: %v", user.ID, err)
+	}
+}
+
+func voiceResetCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "voice-reset",
+		Description:              "Force-drop the bot's voice connection in this server",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+	}
+}
+
+func (h *BotHandler) handleVoiceResetInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	if h.voiceManager == nil {
+		h.editInteraction(s, i, "🔇 Voice is disabled for this bot.")
+		return
+	}
+
+	if !h.voiceManager.ResetVoiceConnection(i.GuildID) {
+		h.editInteraction(s, i, "There was no voice connection to reset.")
+		return
+	}
+
+	log.Printf("Voice connection for guild %s reset by %s", i.GuildID, interactionUsername(i))
+	h.editInteraction(s, i, "♻️ Voice connection reset. Use `/join` to bring me back.")
+}
+
+func modelCommand() *discordgo.ApplicationCommand {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(ai.SupportedChatModels))
+	for _, model := range ai.SupportedChatModels {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  model,
+			Value: model,
+		})
+	}
+
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "model",
+		Description:              "View or switch the chat model used in this server",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "name",
+				Description: "The model to use (leave empty to list models)",
+				Required:    false,
+				Choices:     choices,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleModelInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var requested string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "name" {
+			requested = opt.StringValue()
+		}
+	}
+
+	if requested == "" {
+		current := h.rag.ChatModel(i.GuildID)
+		var lines []string
+		for _, model := range ai.SupportedChatModels {
+			marker := "•"
+			if model == current {
+				marker = "▶"
+			}
+			lines = append(lines, fmt.Sprintf("%s `%s`", marker, model))
+		}
+		h.editInteraction(s, i, fmt.Sprintf("Current model: `%s`\nSupported models:\n%s",
+			current, strings.Join(lines, "\n")))
+		return
+	}
+
+	if err := h.rag.SetChatModel(i.GuildID, requested); err != nil {
+		log.Printf("Error setting chat model for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, fmt.Sprintf("❌ Could not switch model: %v", err))
+		return
+	}
+
+	log.Printf("Chat model for guild %s set to %s by %s", i.GuildID, requested, interactionUsername(i))
+	h.editInteraction(s, i, fmt.Sprintf("✅ Chat model set to `%s`", requested))
+}
+
+// maxBotNameLength keeps custom names to a sensible nickname length
+const maxBotNameLength = 32
+
+func botNameCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "bot-name",
+		Description:              "View or set the name the bot uses for itself in this server",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "name",
+				Description: "The name to use (\"reset\" restores the default)",
+				Required:    false,
+				MaxLength:   maxBotNameLength,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleBotNameInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var requested string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "name" {
+			requested = strings.TrimSpace(opt.StringValue())
+		}
+	}
+
+	if requested == "" {
+		current := h.rag.BotName(i.GuildID)
+		if current == "" {
+			h.editInteraction(s, i, "I don't have a name here yet.")
+			return
+		}
+		h.editInteraction(s, i, fmt.Sprintf("My name here is **%s**.", current))
+		return
+	}
+
+	if strings.EqualFold(requested, "reset") {
+		requested = ""
+	}
+
+	if err := h.rag.SetGuildBotName(i.GuildID, requested); err != nil {
+		log.Printf("Error setting bot name for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, fmt.Sprintf("❌ Could not set the name: %v", err))
+		return
+	}
+
+	log.Printf("Bot name for guild %s set to %q by %s", i.GuildID, requested, interactionUsername(i))
+	if requested == "" {
+		h.editInteraction(s, i, "✅ Name reset to the default.")
+		return
+	}
+	h.editInteraction(s, i, fmt.Sprintf("✅ I'll go by **%s** here.", requested))
+}
+
+func authorNamesCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "author-names",
+		Description:              "View or set how message authors are named to the AI in this server",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "mode",
+				Description: "How to name authors (leave empty to see the current mode)",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Usernames", Value: rag.AuthorNamesReal},
+					{Name: "Anonymize (User A, User B, ...)", Value: rag.AuthorNamesAnonymize},
+					{Name: "Pseudonymize (stable hashed IDs)", Value: rag.AuthorNamesPseudonymize},
+					{Name: "Reset to default", Value: "reset"},
+				},
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleAuthorNamesInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var requested string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "mode" {
+			requested = opt.StringValue()
+		}
+	}
+
+	if requested == "" {
+		h.editInteraction(s, i, fmt.Sprintf("Authors are named by mode `%s`.", h.rag.AuthorNames(i.GuildID)))
+		return
+	}
+
+	if requested == "reset" {
+		requested = ""
+	}
+	if err := h.rag.SetAuthorNames(i.GuildID, requested); err != nil {
+		log.Printf("Error setting author names for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, fmt.Sprintf("❌ Could not set the mode: %v", err))
+		return
+	}
+
+	log.Printf("Author names for guild %s set to %q by %s", i.GuildID, requested, interactionUsername(i))
+	h.editInteraction(s, i, fmt.Sprintf("✅ Authors are now named by mode `%s`.", h.rag.AuthorNames(i.GuildID)))
+}
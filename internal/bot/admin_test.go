@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/ai"
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// /model only offers the allowlisted models
+func TestModelCommandChoices(t *testing.T) {
+	options := modelCommand().Options
+	if len(options) != 1 || options[0].Required {
+		t.Fatalf("options = %+v, want one optional model name", options)
+	}
+
+	var choices []string
+	for _, choice := range options[0].Choices {
+		choices = append(choices, choice.Value.(string))
+	}
+	if !slices.Equal(choices, ai.SupportedChatModels) {
+		t.Errorf("choices = %v, want %v", choices, ai.SupportedChatModels)
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	for name, tt := range map[string]struct {
+		member *discordgo.Member
+		want   bool
+	}{
+		"direct message": {nil, false},
+		"member":         {&discordgo.Member{Permissions: discordgo.PermissionSendMessages}, false},
+		"manage server":  {&discordgo.Member{Permissions: discordgo.PermissionManageServer}, true},
+		"administrator":  {&discordgo.Member{Permissions: discordgo.PermissionAdministrator}, true},
+	} {
+		i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{Member: tt.member}}
+		if got := isAdmin(i); got != tt.want {
+			t.Errorf("%s: isAdmin = %v, want %v", name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// internal/bot/budget.go
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// budgetReset returns when the daily token budget in effect at now resets,
+// which is the next midnight UTC
+func budgetReset(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// budgetExceeded reports whether used tokens exhaust a daily budget; a
+// budget of 0 or less is unlimited
+func budgetExceeded(used int64, budget int) bool {
+	return budget > 0 && used >= int64(budget)
+}
+
+// budgetReply tells a user their budget is used up and when it resets
+func budgetReply(now time.Time) string {
+	reset := budgetReset(now)
+	wait := reset.Sub(now).Round(time.Minute)
+	return fmt.Sprintf("⏳ You've reached your daily AI usage limit. It resets at %s (<t:%d:R>, in %dh %02dm).",
+		reset.Format("15:04 MST"), reset.Unix(), int(wait.Hours()), int(wait.Minutes())%60)
+}
+
+// overBudget checks a user's daily token budget, returning the reply to
+// send if they are out of tokens. Errors loading usage don't block anyone.
+func (h *BotHandler) overBudget(userID string) (string, bool) {
+	budget := h.cfg.Bot.DailyTokenBudget
+	if budget <= 0 || userID == "" {
+		return "", false
+	}
+
+	now := time.Now()
+	used, err := h.db.GetUserTokens(userID, now)
+	if err != nil {
+		log.Printf("Error loading token usage for user %s: %v", userID, err)
+		return "", false
+	}
+	if !budgetExceeded(used, budget) {
+		return "", false
+	}
+
+	log.Printf("User %s is over the daily token budget (%d/%d)", userID, used, budget)
+	return budgetReply(now), true
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudgetReset(t *testing.T) {
+	midnight := time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"evening", time.Date(2024, 3, 15, 18, 30, 0, 0, time.UTC), midnight},
+		{"just after midnight", time.Date(2024, 3, 15, 0, 0, 1, 0, time.UTC), midnight},
+		{"at midnight", midnight, midnight.AddDate(0, 0, 1)},
+		{"just before midnight", midnight.Add(-time.Nanosecond), midnight},
+		// Resets follow UTC, not the local day
+		{"ahead of UTC", time.Date(2024, 3, 16, 0, 30, 0, 0, time.FixedZone("CET", 3600)), midnight},
+		{"behind UTC", time.Date(2024, 3, 15, 20, 0, 0, 0, time.FixedZone("EDT", -4*3600)), midnight.AddDate(0, 0, 1)},
+		{"end of month", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := budgetReset(tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s: budgetReset(%v) = %v, want %v", tt.name, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	tests := []struct {
+		used   int64
+		budget int
+		want   bool
+	}{
+		{0, 1000, false},
+		{999, 1000, false},
+		{1000, 1000, true},
+		{5000, 1000, true},
+		{1_000_000, 0, false},
+		{1_000_000, -1, false},
+	}
+	for _, tt := range tests {
+		if got := budgetExceeded(tt.used, tt.budget); got != tt.want {
+			t.Errorf("budgetExceeded(%d, %d) = %v, want %v", tt.used, tt.budget, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetReply(t *testing.T) {
+	now := time.Date(2024, 3, 15, 18, 29, 40, 0, time.UTC)
+	reply := budgetReply(now)
+	for _, want := range []string{"00:00 UTC", "<t:1710547200:R>", "in 5h 30m"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("budgetReply = %q, want it to contain %q", reply, want)
+		}
+	}
+}
+
+// Without a budget, or a user to charge, usage isn't looked up; the
+// handler has no database, so doing so would panic
+func TestOverBudgetUnlimited(t *testing.T) {
+	h := &BotHandler{cfg: &config.Config{}}
+	if reply, over := h.overBudget("u1"); over {
+		t.Errorf("overBudget without a budget = %q", reply)
+	}
+
+	h.cfg.Bot.DailyTokenBudget = 1000
+	if reply, over := h.overBudget(""); over {
+		t.Errorf("overBudget without a user = %q", reply)
+	}
+}
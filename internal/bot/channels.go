@@ -0,0 +1,126 @@
+// internal/bot/channels.go
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// channelAllowed applies a guild's channel gating rules: an explicit channel
+// setting always wins, otherwise channels are enabled unless the guild is in
+// allowlist mode
+func channelAllowed(allowlist bool, setting *models.ChannelSetting) bool {
+	if setting != nil {
+		return setting.Enabled
+	}
+	return !allowlist
+}
+
+// channelEnabled reports whether the bot may respond in a channel. DMs are
+// always enabled, and lookup errors fail open so a DB blip doesn't mute the bot.
+func (h *BotHandler) channelEnabled(guildID, channelID string) bool {
+	if guildID == "" {
+		return true
+	}
+
+	settings, err := h.db.GetGuildSettings(guildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+		return true
+	}
+
+	setting, err := h.db.GetChannelSetting(channelID)
+	if err != nil {
+		log.Printf("Error loading channel setting for %s: %v", channelID, err)
+		return true
+	}
+
+	return channelAllowed(settings.ChannelAllowlist, setting)
+}
+
+func channelCommands() []*discordgo.ApplicationCommand {
+	dmPermission := false
+	return []*discordgo.ApplicationCommand{
+		{
+			Name:                     "enable-here",
+			Description:              "Let the bot respond in this channel",
+			DefaultMemberPermissions: &adminPermissions,
+			DMPermission:             &dmPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "only",
+					Description: "Only respond in channels enabled with this command",
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:                     "disable-here",
+			Description:              "Stop the bot from responding in this channel",
+			DefaultMemberPermissions: &adminPermissions,
+			DMPermission:             &dmPermission,
+		},
+	}
+}
+
+func (h *BotHandler) handleChannelToggleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, enabled bool) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	if err := h.db.SetChannelEnabled(i.GuildID, i.ChannelID, enabled); err != nil {
+		log.Printf("Error updating channel setting for %s: %v", i.ChannelID, err)
+		h.editInteraction(s, i, "❌ Could not update this channel's settings.")
+		return
+	}
+
+	if !enabled {
+		log.Printf("Bot disabled in channel %s of guild %s", i.ChannelID, i.GuildID)
+		h.editInteraction(s, i, "🔇 I won't respond in this channel anymore.")
+		return
+	}
+
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "only" {
+			settings, err := h.db.GetGuildSettings(i.GuildID)
+			if err == nil {
+				settings.ChannelAllowlist = opt.BoolValue()
+				err = h.db.SaveGuildSettings(settings)
+			}
+			if err != nil {
+				log.Printf("Error updating allowlist mode for guild %s: %v", i.GuildID, err)
+				h.editInteraction(s, i, "❌ Enabled this channel, but could not update allowlist mode.")
+				return
+			}
+		}
+	}
+
+	log.Printf("Bot enabled in channel %s of guild %s", i.ChannelID, i.GuildID)
+	h.editInteraction(s, i, "🔊 I'll respond in this channel.")
+}
+
+// rejectDisabledChannel replies privately when an interaction comes from a
+// channel the bot is disabled in. Returns true if the interaction was rejected.
+func (h *BotHandler) rejectDisabledChannel(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	if h.channelEnabled(i.GuildID, i.ChannelID) {
+		return false
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "🔇 I'm disabled in this channel.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	return true
+}
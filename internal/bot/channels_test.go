@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestChannelAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist bool
+		setting   *models.ChannelSetting
+		want      bool
+	}{
+		{"default", false, nil, true},
+		{"allowlist without setting", true, nil, false},
+		{"disabled", false, &models.ChannelSetting{Enabled: false}, false},
+		{"enabled in allowlist mode", true, &models.ChannelSetting{Enabled: true}, true},
+		{"disabled in allowlist mode", true, &models.ChannelSetting{Enabled: false}, false},
+	}
+	for _, tt := range tests {
+		if got := channelAllowed(tt.allowlist, tt.setting); got != tt.want {
+			t.Errorf("%s: channelAllowed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// DMs have no channel settings; the handler has no database, so looking
+// any up would panic
+func TestChannelEnabledInDMs(t *testing.T) {
+	h := &BotHandler{cfg: &config.Config{}}
+	if !h.channelEnabled("", "dm") {
+		t.Error("channelEnabled = false for a DM, want true")
+	}
+}
+
+func TestIngestChannel(t *testing.T) {
+	for _, ingestDisabled := range []bool{false, true} {
+		h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{IngestDisabledChannels: ingestDisabled}}}
+		if !h.ingestChannel(true) {
+			t.Errorf("IngestDisabledChannels=%v: enabled channel not ingested", ingestDisabled)
+		}
+		if got := h.ingestChannel(false); got != ingestDisabled {
+			t.Errorf("IngestDisabledChannels=%v: disabled channel ingested = %v", ingestDisabled, got)
+		}
+	}
+}
+
+func TestChannelToggleRequiresAdmin(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		s, fake := newFakeSession(t)
+		h := &BotHandler{cfg: &config.Config{}}
+
+		h.handleChannelToggleInteraction(s, commandInteraction("enable-here"), enabled)
+		if content := editedContent(t, fake); !strings.Contains(content, "Manage Server") {
+			t.Errorf("enabled=%v: response = %q, want a permission error", enabled, content)
+		}
+	}
+}
+
+func TestChannelCommandsGuildOnly(t *testing.T) {
+	for _, command := range channelCommands() {
+		if command.DMPermission == nil || *command.DMPermission {
+			t.Errorf("/%s is available in DMs", command.Name)
+		}
+		if command.DefaultMemberPermissions == nil || *command.DefaultMemberPermissions&discordgo.PermissionManageServer == 0 {
+			t.Errorf("/%s isn't limited to admins by default", command.Name)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// internal/bot/components.go
+package bot
+
+import (
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/models"
+	"discord-rag-bot/internal/rag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	componentRegenerate = "regenerate"
+	componentSources    = "sources"
+
+	// responseStateTTL matches Discord's interaction edit window
+	responseStateTTL = 15 * time.Minute
+)
+
+// responseState is what a response's buttons need to act on it later
+type responseState struct {
+	Query     string
+	Context   rag.RetrievedContext
+	GuildID   string
+	GuildName string
+	CreatedAt time.Time
+}
+
+// responseStore is a short-lived map from a button's state ID to the query
+// that produced the response it is attached to
+type responseStore struct {
+	mu      sync.Mutex
+	states  map[string]*responseState
+	counter atomic.Uint64
+}
+
+func newResponseStore() *responseStore {
+	return &responseStore{
+		states: make(map[string]*responseState),
+	}
+}
+
+func (rs *responseStore) put(state *responseState) string {
+	id := strconv.FormatUint(rs.counter.Add(1), 36)
+	state.CreatedAt = time.Now()
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for k, st := range rs.states {
+		if time.Since(st.CreatedAt) > responseStateTTL {
+			delete(rs.states, k)
+		}
+	}
+	rs.states[id] = state
+	return id
+}
+
+func (rs *responseStore) get(id string) (*responseState, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	state, ok := rs.states[id]
+	if !ok || time.Since(state.CreatedAt) > responseStateTTL {
+		return nil, false
+	}
+	return state, true
+}
+
+// parseComponentID splits a custom ID of the form "<action>:<stateID>"
+func parseComponentID(customID string) (action, stateID string, ok bool) {
+	action, stateID, ok = strings.Cut(customID, ":")
+	if !ok || action == "" || stateID == "" {
+		return "", "", false
+	}
+	return action, stateID, true
+}
+
+// responseComponents builds the button row attached to AI responses
+func responseComponents(stateID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Regenerate",
+					Style:    discordgo.SecondaryButton,
+					CustomID: componentRegenerate + ":" + stateID,
+					Emoji:    discordgo.ComponentEmoji{Name: "🔄"},
+				},
+				discordgo.Button{
+					Label:    "Show sources",
+					Style:    discordgo.SecondaryButton,
+					CustomID: componentSources + ":" + stateID,
+					Emoji:    discordgo.ComponentEmoji{Name: "📚"},
+				},
+			},
+		},
+	}
+}
+
+// interactionUser returns the invoking user for both guild and DM interactions
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// unknownUserReply answers an interaction that carries no user, which
+// Discord shouldn't send but the handlers mustn't panic on
+const unknownUserReply = "❌ Sorry, I couldn't tell who used this command."
+
+// interactionUsername returns the invoking user's name, for logs
+func interactionUsername(i *discordgo.InteractionCreate) string {
+	if user := interactionUser(i); user != nil {
+		return user.Username
+	}
+	return "an unknown user"
+}
+
+func (h *BotHandler) handleComponentInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action, stateID, ok := parseComponentID(i.MessageComponentData().CustomID)
+	if !ok {
+		log.Printf("Ignoring unknown component ID: %s", i.MessageComponentData().CustomID)
+		return
+	}
+
+	// History pages carry their own state in the ID
+	if action == componentHistory {
+		h.handleHistoryComponent(s, i, stateID)
+		return
+	}
+
+	state, found := h.responses.get(stateID)
+	if !found {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "⌛ This response has expired, please ask again.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+
+	switch action {
+	case componentRegenerate:
+		h.handleRegenerateComponent(s, i, state)
+	case componentSources:
+		h.handleSourcesComponent(s, i, state)
+	default:
+		log.Printf("Ignoring unknown component action: %s", action)
+	}
+}
+
+func (h *BotHandler) handleRegenerateComponent(s *discordgo.Session, i *discordgo.InteractionCreate, state *responseState) {
+	user := interactionUser(i)
+	if user == nil {
+		log.Printf("Ignoring regenerate button without a user")
+		return
+	}
+
+	if reply, over := h.overBudget(user.ID); over {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: reply,
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	ctx, cancel := h.interactionContext(i)
+	defer cancel()
+	ctx = ai.WithTemperature(ctx, regenerateTemperature)
+
+	response, err := h.rag.GenerateResponse(ctx, state.Query, state.Context, user.Username, state.GuildID, state.GuildName)
+	if err != nil {
+		log.Printf("Error regenerating response: %v", err)
+		return
+	}
+	response = h.finishResponse(response)
+
+	components := responseComponents(h.responses.put(&responseState{
+		Query:     state.Query,
+		Context:   state.Context,
+		GuildID:   state.GuildID,
+		GuildName: state.GuildName,
+	}))
+	content := appendFooter(response, h.responseFooter(state.GuildID))
+	h.editResponse(s, i, &discordgo.WebhookEdit{
+		Content:         &content,
+		Components:      &components,
+		AllowedMentions: noMassMentions(),
+	})
+
+	interaction := &models.BotInteraction{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Query:     state.Query,
+		Response:  response,
+		ChannelID: i.ChannelID,
+		GuildID:   state.GuildID,
+		Timestamp: time.Now(),
+	}
+
+	if err := h.rag.StoreInteraction(ctx, interaction); err != nil {
+		log.Printf("Error logging interaction: %v", err)
+	}
+}
+
+// Discord's embed limits, in characters
+const (
+	embedTitleLength = 256
+	embedFieldLength = 1024
+	embedMaxFields   = 25
+	embedTotalLength = 6000
+)
+
+// defaultSourceLength is how much of each source is shown if unconfigured
+const defaultSourceLength = 300
+
+func (h *BotHandler) handleSourcesComponent(s *discordgo.Session, i *discordgo.InteractionCreate, state *responseState) {
+	data := &discordgo.InteractionResponseData{
+		Content:         "I didn't find any relevant messages for this answer.",
+		Flags:           discordgo.MessageFlagsEphemeral,
+		AllowedMentions: noMassMentions(),
+	}
+	if len(state.Context.Sources) > 0 {
+		data.Content = ""
+		data.Embeds = []*discordgo.MessageEmbed{sourcesEmbed(state.Query, state.Context.Sources, h.cfg.Bot.SourcesShown, h.cfg.Bot.SourceMaxLength)}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+	}
+}
+
+// sourcesEmbed lists up to limit context entries, each cut to maxLength
+// characters, within Discord's embed limits. The footer says how many
+// entries were left out.
+func sourcesEmbed(query string, entries []string, limit, maxLength int) *discordgo.MessageEmbed {
+	if limit <= 0 || limit > embedMaxFields {
+		limit = embedMaxFields
+	}
+	if maxLength <= 0 {
+		maxLength = defaultSourceLength
+	}
+	if maxLength > embedFieldLength {
+		maxLength = embedFieldLength
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: truncateRunes("📚 Sources for: "+query, embedTitleLength),
+	}
+	// Leave room for the footer within the embed's total
+	total := utf8.RuneCountInString(embed.Title) + 100
+	for n, entry := range entries {
+		if n >= limit {
+			break
+		}
+		field := &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("#%d", n+1),
+			Value: truncateRunes(entry, maxLength),
+		}
+		size := utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+		if total+size > embedTotalLength {
+			break
+		}
+		total += size
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	if hidden := len(entries) - len(embed.Fields); hidden > 0 {
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Showing %d of %d sources", len(embed.Fields), len(entries)),
+		}
+	}
+	return embed
+}
+
+// truncateRunes shortens text to at most limit characters, marking the cut
+// with an ellipsis. Embed limits count characters, not bytes.
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	if limit <= 1 {
+		return string(runes[:limit])
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// truncateMessage shortens content to at most limit bytes without splitting
+// a UTF-8 character, marking the cut with an ellipsis
+func truncateMessage(content string, limit int) string {
+	if len(content) <= limit {
+		return content
+	}
+
+	const ellipsis = "..."
+	cut := limit - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + ellipsis
+}
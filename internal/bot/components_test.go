@@ -0,0 +1,202 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/rag"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"one over", 7, "one ov…"},
+		{"héllo wörld", 6, "héllo…"},
+		{"two", 1, "t"},
+		{"two", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateRunes(tt.text, tt.limit); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSourcesEmbedCapsSources(t *testing.T) {
+	entries := make([]string, 8)
+	for i := range entries {
+		entries[i] = fmt.Sprintf("source %d", i+1)
+	}
+
+	embed := sourcesEmbed("game night", entries, 5, 100)
+	if len(embed.Fields) != 5 {
+		t.Fatalf("%d sources shown, want 5", len(embed.Fields))
+	}
+	for i, field := range embed.Fields {
+		if field.Value != entries[i] {
+			t.Errorf("source %d = %q, want %q", i+1, field.Value, entries[i])
+		}
+	}
+	if embed.Footer == nil || embed.Footer.Text != "Showing 5 of 8 sources" {
+		t.Errorf("footer = %+v, want it to say 5 of 8 are shown", embed.Footer)
+	}
+
+	if embed := sourcesEmbed("game night", entries[:3], 5, 100); len(embed.Fields) != 3 || embed.Footer != nil {
+		t.Errorf("all 3 sources fit, but %d shown with footer %+v", len(embed.Fields), embed.Footer)
+	}
+}
+
+func TestSourcesEmbedFitsDiscordLimits(t *testing.T) {
+	long := strings.Repeat("ä", 5000)
+	entries := make([]string, 40)
+	for i := range entries {
+		entries[i] = long
+	}
+
+	// Unlimited settings fall back to what an embed can hold
+	embed := sourcesEmbed(strings.Repeat("q", 500), entries, 0, 0)
+	if n := utf8.RuneCountInString(embed.Title); n > embedTitleLength {
+		t.Errorf("title is %d characters, over %d", n, embedTitleLength)
+	}
+	if len(embed.Fields) > embedMaxFields {
+		t.Errorf("%d fields, over %d", len(embed.Fields), embedMaxFields)
+	}
+	total := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Footer.Text)
+	for _, field := range embed.Fields {
+		if n := utf8.RuneCountInString(field.Value); n != defaultSourceLength {
+			t.Errorf("source is %d characters, want the default %d", n, defaultSourceLength)
+		}
+		total += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if total > embedTotalLength {
+		t.Errorf("embed is %d characters, over %d", total, embedTotalLength)
+	}
+
+	// A configured length past a field's limit is capped to it
+	embed = sourcesEmbed("q", entries[:1], 1, 5000)
+	if n := utf8.RuneCountInString(embed.Fields[0].Value); n != embedFieldLength {
+		t.Errorf("source is %d characters, want the field limit %d", n, embedFieldLength)
+	}
+}
+
+func TestParseComponentID(t *testing.T) {
+	tests := []struct {
+		customID        string
+		action, stateID string
+		ok              bool
+	}{
+		{"regenerate:abc", componentRegenerate, "abc", true},
+		{"sources:1z", componentSources, "1z", true},
+		{"history:u1:2", componentHistory, "u1:2", true},
+		{"regenerate", "", "", false},
+		{"regenerate:", "", "", false},
+		{":abc", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		action, stateID, ok := parseComponentID(tt.customID)
+		if action != tt.action || stateID != tt.stateID || ok != tt.ok {
+			t.Errorf("parseComponentID(%q) = %q, %q, %v; want %q, %q, %v", tt.customID, action, stateID, ok, tt.action, tt.stateID, tt.ok)
+		}
+	}
+}
+
+// The buttons attached to a response route back to it
+func TestResponseComponentsRoundTrip(t *testing.T) {
+	row := responseComponents("42")[0].(discordgo.ActionsRow)
+	var actions []string
+	for _, component := range row.Components {
+		action, stateID, ok := parseComponentID(component.(discordgo.Button).CustomID)
+		if !ok || stateID != "42" {
+			t.Errorf("button ID %q doesn't carry the state ID", component.(discordgo.Button).CustomID)
+		}
+		actions = append(actions, action)
+	}
+	if !slices.Equal(actions, []string{componentRegenerate, componentSources}) {
+		t.Errorf("button actions = %v", actions)
+	}
+}
+
+func TestResponseStoreExpires(t *testing.T) {
+	store := newResponseStore()
+	id := store.put(&responseState{Query: "q"})
+	if state, ok := store.get(id); !ok || state.Query != "q" {
+		t.Fatalf("get(%q) = %+v, %v; want the stored state", id, state, ok)
+	}
+	if other := store.put(&responseState{}); other == id {
+		t.Error("two responses got the same state ID")
+	}
+
+	store.states[id].CreatedAt = time.Now().Add(-responseStateTTL - time.Second)
+	if _, ok := store.get(id); ok {
+		t.Error("expired state returned")
+	}
+}
+
+// callbackData decodes the response the bot gave to an interaction
+func callbackData(t *testing.T, fake *fakeDiscord) discordgo.InteractionResponseData {
+	t.Helper()
+	callbacks := fake.find(http.MethodPost, "/callback")
+	if len(callbacks) != 1 {
+		t.Fatalf("%d interaction responses, want 1", len(callbacks))
+	}
+	var response struct {
+		Data discordgo.InteractionResponseData `json:"data"`
+	}
+	callbacks[0].decode(t, &response)
+	return response.Data
+}
+
+func TestComponentRoutesToSources(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{}, responses: newResponseStore()}
+	id := h.responses.put(&responseState{Query: "game night", Context: rag.RetrievedContext{Sources: []string{"ann: friday", "bob: 21:00"}}})
+
+	h.handleComponentInteraction(s, componentInteraction(componentSources+":"+id))
+
+	data := callbackData(t, fake)
+	if data.Flags != discordgo.MessageFlagsEphemeral || len(data.Embeds) != 1 || len(data.Embeds[0].Fields) != 2 {
+		t.Fatalf("response = %+v, want a private embed of the 2 sources", data)
+	}
+	if data.Embeds[0].Fields[1].Value != "bob: 21:00" {
+		t.Errorf("second source = %q", data.Embeds[0].Fields[1].Value)
+	}
+}
+
+func TestComponentExpiredState(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{}, responses: newResponseStore()}
+
+	for _, action := range []string{componentRegenerate, componentSources} {
+		fake.reset()
+		h.handleComponentInteraction(s, componentInteraction(action+":gone"))
+		if data := callbackData(t, fake); !strings.Contains(data.Content, "expired") || data.Flags != discordgo.MessageFlagsEphemeral {
+			t.Errorf("%s on an expired response answered %+v, want a private expiry notice", action, data)
+		}
+	}
+}
+
+func TestComponentUnknownIgnored(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{}, responses: newResponseStore()}
+	id := h.responses.put(&responseState{Query: "q"})
+
+	for _, customID := range []string{"nonsense", "delete:" + id} {
+		h.handleComponentInteraction(s, componentInteraction(customID))
+	}
+	if calls := fake.calls(); len(calls) != 0 {
+		t.Errorf("unknown components made %d API calls, want none", len(calls))
+	}
+}
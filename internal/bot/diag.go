@@ -0,0 +1,111 @@
+// internal/bot/diag.go
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// diagTimeout bounds each subsystem check of /diag
+const diagTimeout = 10 * time.Second
+
+// diagMetrics is one measurement of each subsystem
+type diagMetrics struct {
+	Gateway      time.Duration
+	Database     time.Duration
+	DatabaseErr  error
+	OpenAI       time.Duration
+	OpenAIErr    error
+	Voice        int
+	VoiceEnabled bool
+}
+
+func diagCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "diag",
+		Description:              "Show gateway, database and OpenAI latency and voice connections",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+	}
+}
+
+func (h *BotHandler) handleDiagInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	metrics := h.measureDiag(s)
+	h.editResponse(s, i, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{diagEmbed(metrics)},
+	})
+}
+
+// measureDiag times a database ping and an OpenAI round trip, alongside
+// the gateway heartbeat latency Discord already tracks
+func (h *BotHandler) measureDiag(s *discordgo.Session) diagMetrics {
+	metrics := diagMetrics{
+		Gateway:      s.HeartbeatLatency(),
+		VoiceEnabled: h.voiceManager != nil,
+		Voice:        h.voiceManager.connectionCount(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagTimeout)
+	defer cancel()
+
+	start := time.Now()
+	metrics.DatabaseErr = h.db.Ping(ctx)
+	metrics.Database = time.Since(start)
+
+	start = time.Now()
+	metrics.OpenAIErr = h.rag.AI.Preflight(ctx)
+	metrics.OpenAI = time.Since(start)
+
+	return metrics
+}
+
+// diagEmbed formats metrics, coloring the embed by whether every check passed
+func diagEmbed(m diagMetrics) *discordgo.MessageEmbed {
+	color := 0x2ecc71
+	if m.DatabaseErr != nil || m.OpenAIErr != nil {
+		color = 0xe74c3c
+	}
+
+	voice := fmt.Sprintf("%d active", m.Voice)
+	if !m.VoiceEnabled {
+		voice = "disabled"
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: "🩺 Diagnostics",
+		Color: color,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Discord gateway", Value: formatLatency(m.Gateway), Inline: true},
+			{Name: "Database", Value: diagCheck(m.Database, m.DatabaseErr), Inline: true},
+			{Name: "OpenAI", Value: diagCheck(m.OpenAI, m.OpenAIErr), Inline: true},
+			{Name: "Voice connections", Value: voice, Inline: true},
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+}
+
+func diagCheck(latency time.Duration, err error) string {
+	if err != nil {
+		return truncateMessage(fmt.Sprintf("❌ %v", err), 1024)
+	}
+	return "✅ " + formatLatency(latency)
+}
+
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%d ms", d.Milliseconds())
+}
@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestDiagEmbed(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics diagMetrics
+		color   int
+		values  []string
+	}{
+		{
+			"healthy",
+			diagMetrics{Gateway: 42 * time.Millisecond, Database: 3 * time.Millisecond, OpenAI: 1500 * time.Millisecond, Voice: 2, VoiceEnabled: true},
+			0x2ecc71,
+			[]string{"42 ms", "✅ 3 ms", "✅ 1500 ms", "2 active"},
+		},
+		{
+			"database down",
+			diagMetrics{Gateway: 42 * time.Millisecond, Database: diagTimeout, DatabaseErr: errors.New("connection refused"), OpenAI: time.Second},
+			0xe74c3c,
+			[]string{"42 ms", "❌ connection refused", "✅ 1000 ms", "disabled"},
+		},
+		{
+			"OpenAI down",
+			diagMetrics{OpenAIErr: errors.New("invalid API key"), VoiceEnabled: true},
+			0xe74c3c,
+			[]string{"0 ms", "✅ 0 ms", "❌ invalid API key", "0 active"},
+		},
+	}
+	for _, tt := range tests {
+		embed := diagEmbed(tt.metrics)
+		if embed.Color != tt.color {
+			t.Errorf("%s: color = %#x, want %#x", tt.name, embed.Color, tt.color)
+		}
+		var values []string
+		for _, field := range embed.Fields {
+			values = append(values, field.Value)
+		}
+		if strings.Join(values, "|") != strings.Join(tt.values, "|") {
+			t.Errorf("%s: fields = %q, want %q", tt.name, values, tt.values)
+		}
+	}
+}
+
+// Embed field values are limited to 1024 characters
+func TestDiagCheckLongError(t *testing.T) {
+	value := diagCheck(0, errors.New(strings.Repeat("é", 2000)))
+	if !strings.HasPrefix(value, "❌ ") || len(value) > 1024 || !utf8.ValidString(value) {
+		t.Errorf("diagCheck = %d bytes starting %q, want the error cut to fit a field", len(value), value[:10])
+	}
+}
+
+func TestDiagRequiresAdmin(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{}
+	h.handleDiagInteraction(s, commandInteraction("diag"))
+
+	if got := editedContent(t, fake); !strings.Contains(got, "Manage Server") {
+		t.Errorf("response = %q, want the permission error", got)
+	}
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeRequest is a Discord API call made by the bot
+type fakeRequest struct {
+	Method string
+	// Path is the URL path after the API version, e.g. "channels/c1/messages"
+	Path string
+	Body []byte
+}
+
+// decode unmarshals the request's JSON body into v
+func (r fakeRequest) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("%s %s body %q: %v", r.Method, r.Path, r.Body, err)
+	}
+}
+
+// fakeDiscord answers a session's API calls in process, recording them.
+// Calls succeed with a minimal object unless fail returns a status for them;
+// a 403 carries Discord's missing permissions error code and a 404 on a
+// webhook its unknown webhook code.
+type fakeDiscord struct {
+	mu       sync.Mutex
+	requests []fakeRequest
+	fail     func(req fakeRequest) int
+}
+
+func (f *fakeDiscord) RoundTrip(r *http.Request) (*http.Response, error) {
+	req := fakeRequest{Method: r.Method}
+	_, req.Path, _ = strings.Cut(r.URL.Path, "/api/v"+discordgo.APIVersion+"/")
+	if r.Body != nil {
+		req.Body, _ = io.ReadAll(r.Body)
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	fail := f.fail
+	f.mu.Unlock()
+
+	status, body := http.StatusOK, `{}`
+	if fail != nil {
+		if code := fail(req); code != 0 {
+			discordCode := 0
+			switch {
+			case code == http.StatusForbidden:
+				discordCode = discordgo.ErrCodeMissingPermissions
+			case code == http.StatusNotFound && strings.HasPrefix(req.Path, "webhooks/"):
+				discordCode = discordgo.ErrCodeUnknownWebhook
+			}
+			status, body = code, fmt.Sprintf(`{"code": %d, "message": "simulated %d"}`, discordCode, code)
+		}
+	}
+	if status == http.StatusOK {
+		switch {
+		case req.Method == http.MethodGet && req.Path == "users/@me":
+			body = `{"id": "bot", "username": "ragbot", "bot": true}`
+		case req.Method == http.MethodGet && strings.HasPrefix(req.Path, "guilds/") && strings.Count(req.Path, "/") == 1:
+			body = fmt.Sprintf(`{"id": %q, "name": "API guild"}`, strings.TrimPrefix(req.Path, "guilds/"))
+		case req.Method == http.MethodPost && req.Path == "users/@me/channels":
+			body = `{"id": "dm", "type": 1}`
+		case req.Method == http.MethodPost && strings.HasSuffix(req.Path, "/messages"):
+			channelID := strings.TrimSuffix(strings.TrimPrefix(req.Path, "channels/"), "/messages")
+			body = fmt.Sprintf(`{"id": "sent", "channel_id": %q}`, channelID)
+		case strings.HasSuffix(req.Path, "/callback"):
+			status, body = http.StatusNoContent, ""
+		}
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+		Request:    r,
+	}, nil
+}
+
+// calls returns the requests made so far
+func (f *fakeDiscord) calls() []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeRequest(nil), f.requests...)
+}
+
+// reset forgets the requests made so far
+func (f *fakeDiscord) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = nil
+}
+
+// find returns the requests with the method whose path has the suffix
+func (f *fakeDiscord) find(method, pathSuffix string) []fakeRequest {
+	var found []fakeRequest
+	for _, req := range f.calls() {
+		if req.Method == method && strings.HasSuffix(req.Path, pathSuffix) {
+			found = append(found, req)
+		}
+	}
+	return found
+}
+
+// newFakeSession returns a session whose API calls go to a fakeDiscord
+func newFakeSession(t *testing.T) (*discordgo.Session, *fakeDiscord) {
+	t.Helper()
+
+	s, err := discordgo.New("Bot test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeDiscord{}
+	s.Client = &http.Client{Transport: fake}
+	s.State.User = &discordgo.User{ID: "bot", Username: "ragbot", Bot: true}
+	return s, fake
+}
+
+// componentInteraction returns a button click on customID
+func componentInteraction(customID string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        "i1",
+		Token:     "token",
+		Type:      discordgo.InteractionMessageComponent,
+		GuildID:   "g1",
+		ChannelID: "c1",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: "u1", Username: "ann"}},
+		Data:      discordgo.MessageComponentInteractionData{CustomID: customID},
+	}}
+}
+
+// commandInteraction returns a slash command invocation in guild g1
+func commandInteraction(name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        "i1",
+		Token:     "token",
+		Type:      discordgo.InteractionApplicationCommand,
+		GuildID:   "g1",
+		ChannelID: "c1",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: "u1", Username: "ann"}},
+		Data:      discordgo.ApplicationCommandInteractionData{Name: name, Options: options},
+	}}
+}
+
+// editedContent returns the content of the bot's last edit to an
+// interaction's deferred response
+func editedContent(t *testing.T, fake *fakeDiscord) string {
+	t.Helper()
+	edits := fake.find(http.MethodPatch, "/messages/@original")
+	if len(edits) == 0 {
+		t.Fatalf("requests = %+v, want an interaction response edit", fake.calls())
+	}
+	var edit discordgo.WebhookEdit
+	edits[len(edits)-1].decode(t, &edit)
+	if edit.Content == nil {
+		return ""
+	}
+	return *edit.Content
+}
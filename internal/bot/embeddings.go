@@ -0,0 +1,210 @@
+// internal/bot/embeddings.go
+package bot
+
+import (
+	"context"
+	"discord-rag-bot/internal/rag"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func embeddingVersionCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "embedding-version",
+		Description:              "View stored embedding versions or switch the one searched in this server",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "version",
+				Description: "The version to search (leave empty to list versions)",
+				Required:    false,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleEmbeddingVersionInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var requested string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "version" {
+			requested = strings.TrimSpace(opt.StringValue())
+		}
+	}
+
+	counts, err := h.rag.CountMessagesByVersion(context.Background(), i.GuildID)
+	if err != nil {
+		log.Printf("Error counting embeddings for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not load embedding versions.")
+		return
+	}
+
+	if requested == "" {
+		current := h.rag.EmbeddingVersion(i.GuildID)
+		versions := make([]string, 0, len(counts))
+		for version := range counts {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
+
+		var lines []string
+		for _, version := range versions {
+			marker := "•"
+			if version == current {
+				marker = "▶"
+			}
+			lines = append(lines, fmt.Sprintf("%s `%s`: %d messages", marker, version, counts[version]))
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "No embedded messages yet.")
+		}
+		h.editInteraction(s, i, fmt.Sprintf("Searching version `%s`; new messages are embedded as `%s`.\n%s",
+			current, h.rag.WriteEmbeddingVersion(), strings.Join(lines, "\n")))
+		return
+	}
+
+	if counts[requested] == 0 {
+		h.editInteraction(s, i, fmt.Sprintf("❌ No messages are embedded under `%s` yet; build it before switching.", requested))
+		return
+	}
+
+	if _, running := h.backfills.Load(i.GuildID); running {
+		h.editInteraction(s, i, "⏳ A backfill is running in this server; switch once it has finished.")
+		return
+	}
+
+	ctx, cancel := h.requestContext()
+	defer cancel()
+
+	err = h.rag.SetEmbeddingVersion(ctx, i.GuildID, requested)
+	if errors.Is(err, rag.ErrBackfillIncomplete) {
+		h.editInteraction(s, i, fmt.Sprintf("❌ `%s` isn't fully built yet (%v). Run `/backfill version:%s` and switch once it has finished.", requested, err, requested))
+		return
+	}
+	if err != nil {
+		log.Printf("Error setting embedding version for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, fmt.Sprintf("❌ Could not switch embedding version: %v", err))
+		return
+	}
+
+	log.Printf("Embedding version for guild %s set to %s by %s", i.GuildID, requested, interactionUsername(i))
+	h.editInteraction(s, i, fmt.Sprintf("✅ Now searching embedding version `%s` (%d messages)", requested, counts[requested]))
+}
+
+// backfillReportInterval throttles edits of the backfill progress message
+const backfillReportInterval = 5 * time.Second
+
+func backfillCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "backfill",
+		Description:              "Re-embed this server's messages under a new embedding version",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "version",
+				Description: "The version to build (default: the configured version)",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "from",
+				Description: "The version to copy messages from (default: the one searched now)",
+				Required:    false,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleBackfillInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	if !h.rag.CanBackfill() {
+		h.editInteraction(s, i, "❌ Backfills need the pgvector store; the in-memory store (`RAG_VECTOR_STORE=memory`) only holds messages embedded since startup.")
+		return
+	}
+
+	to := h.rag.WriteEmbeddingVersion()
+	from := h.rag.EmbeddingVersion(i.GuildID)
+	for _, opt := range i.ApplicationCommandData().Options {
+		switch opt.Name {
+		case "version":
+			to = strings.TrimSpace(opt.StringValue())
+		case "from":
+			from = strings.TrimSpace(opt.StringValue())
+		}
+	}
+
+	if from == to {
+		h.editInteraction(s, i, fmt.Sprintf("❌ Messages are already searched under `%s`; pick a different version to build.", to))
+		return
+	}
+
+	if _, running := h.backfills.LoadOrStore(i.GuildID, true); running {
+		h.editInteraction(s, i, "⏳ A backfill is already running in this server.")
+		return
+	}
+
+	msg, err := h.sendMessage(s, i.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("🔁 Backfilling embeddings from `%s` to `%s`...", from, to),
+	})
+	if err != nil {
+		h.backfills.Delete(i.GuildID)
+		h.editInteraction(s, i, "❌ Could not post the progress message here.")
+		return
+	}
+	h.editInteraction(s, i, "✅ Backfill started, progress is posted in this channel.")
+
+	log.Printf("Backfill of guild %s from %s to %s started by %s", i.GuildID, from, to, interactionUsername(i))
+	go h.runBackfill(s, i.GuildID, msg.ChannelID, msg.ID, from, to)
+}
+
+// runBackfill runs a backfill to completion, editing the progress message
+func (h *BotHandler) runBackfill(s *discordgo.Session, guildID, channelID, messageID, from, to string) {
+	defer h.backfills.Delete(guildID)
+
+	var lastReport time.Time
+	err := h.rag.Backfill(context.Background(), guildID, from, to, func(p rag.BackfillProgress) {
+		if time.Since(lastReport) < backfillReportInterval && p.Processed < p.Total {
+			return
+		}
+		lastReport = time.Now()
+		h.editText(s, channelID, messageID, fmt.Sprintf("🔁 Backfilling embeddings from `%s` to `%s`: %d/%d messages", from, to, p.Processed, p.Total))
+	})
+	if err != nil {
+		log.Printf("Backfill of guild %s to %s failed: %v", guildID, to, err)
+		h.editText(s, channelID, messageID, fmt.Sprintf("❌ Backfill to `%s` stopped: %v\nRun `/backfill` again to resume.", to, err))
+		return
+	}
+
+	log.Printf("Backfill of guild %s to %s finished", guildID, to)
+	h.editText(s, channelID, messageID, fmt.Sprintf("✅ Backfill to `%s` finished. Use `/embedding-version %s` to switch searches over.", to, to))
+}
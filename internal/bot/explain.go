@@ -0,0 +1,113 @@
+// internal/bot/explain.go
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"discord-rag-bot/internal/rag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// explainSnippetLength bounds each message quoted in an explanation
+const explainSnippetLength = 80
+
+func explainCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "explain",
+		Description:              "Show how the context for a question is retrieved, with match distances",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "question",
+				Description: "The question to retrieve context for",
+				Required:    true,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleExplainInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var query string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "question" {
+			query = strings.TrimSpace(opt.StringValue())
+		}
+	}
+
+	ctx, cancel := h.interactionContext(i)
+	defer cancel()
+
+	explanation, err := h.rag.ExplainRetrieval(ctx, query, i.GuildID, i.ChannelID, h.channelCategory(s, i.ChannelID), 5)
+	if err != nil {
+		log.Printf("Error explaining retrieval: %v", err)
+		h.editInteraction(s, i, "❌ Could not run retrieval for that question.")
+		return
+	}
+
+	h.editResponse(s, i, &discordgo.WebhookEdit{
+		Embeds:          &[]*discordgo.MessageEmbed{explainEmbed(query, explanation)},
+		AllowedMentions: noMassMentions(),
+	})
+}
+
+// explainEmbed lays out a retrieval explanation
+func explainEmbed(query string, e *rag.RetrievalExplanation) *discordgo.MessageEmbed {
+	threshold := "none"
+	if e.MaxDistance > 0 {
+		threshold = fmt.Sprintf("%.3f", e.MaxDistance)
+	}
+
+	var matches []string
+	for _, match := range e.Matches {
+		mark := "✅"
+		if !match.Passed {
+			mark = "❌"
+		}
+		matches = append(matches, fmt.Sprintf("%s `%.3f` %s", mark, match.Distance, explainSnippet(match.Message)))
+	}
+	if len(matches) == 0 {
+		matches = append(matches, "None")
+	}
+
+	var recent []string
+	for _, msg := range e.Recent {
+		recent = append(recent, "• "+explainSnippet(msg))
+	}
+	if len(recent) == 0 {
+		recent = append(recent, "None")
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: truncateMessage("🔎 Retrieval for: "+query, 256),
+		Description: fmt.Sprintf("Mode `%s` · version `%s` · query norm `%.4f` · distance threshold %s",
+			e.Mode, e.Version, e.EmbeddingNorm, threshold),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Similar messages", Value: truncateMessage(strings.Join(matches, "\n"), 1024)},
+			{Name: "Recent messages", Value: truncateMessage(strings.Join(recent, "\n"), 1024)},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%d previous answers included · %d context characters", e.Interactions, len(e.Context)),
+		},
+	}
+}
+
+func explainSnippet(msg models.DiscordMessage) string {
+	content := strings.Join(strings.Fields(msg.Content), " ")
+	return fmt.Sprintf("**%s** in #%s: %s", msg.Username, msg.ChannelName, truncateMessage(content, explainSnippetLength))
+}
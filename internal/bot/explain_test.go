@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"discord-rag-bot/internal/rag"
+	"strings"
+	"testing"
+)
+
+func TestExplainEmbed(t *testing.T) {
+	e := &rag.RetrievalExplanation{
+		Mode:          "hybrid",
+		Version:       "v2",
+		EmbeddingNorm: 1,
+		MaxDistance:   0.4,
+		Matches: []rag.RetrievalMatch{
+			{Message: models.DiscordMessage{Username: "ann", ChannelName: "general", Content: "game night\n  is friday"}, Distance: 0.12, Passed: true},
+			{Message: models.DiscordMessage{Username: "bob", ChannelName: "food", Content: "lunch"}, Distance: 0.61},
+		},
+		Interactions: 2,
+		Context:      "ann: game night is friday",
+	}
+
+	embed := explainEmbed("when is game night?", e)
+	if embed.Title != "🔎 Retrieval for: when is game night?" {
+		t.Errorf("title = %q", embed.Title)
+	}
+	if want := "Mode `hybrid` · version `v2` · query norm `1.0000` · distance threshold 0.400"; embed.Description != want {
+		t.Errorf("description = %q, want %q", embed.Description, want)
+	}
+	if want := "✅ `0.120` **ann** in #general: game night is friday\n❌ `0.610` **bob** in #food: lunch"; embed.Fields[0].Value != want {
+		t.Errorf("matches = %q, want %q", embed.Fields[0].Value, want)
+	}
+	if embed.Fields[1].Value != "None" {
+		t.Errorf("recent = %q, want None", embed.Fields[1].Value)
+	}
+	if want := "2 previous answers included · 25 context characters"; embed.Footer.Text != want {
+		t.Errorf("footer = %q, want %q", embed.Footer.Text, want)
+	}
+}
+
+// Embed fields are limited to 1024 characters and titles to 256
+func TestExplainEmbedLimits(t *testing.T) {
+	e := &rag.RetrievalExplanation{Mode: "recent"}
+	for range 50 {
+		msg := models.DiscordMessage{Username: "ann", ChannelName: "general", Content: strings.Repeat("word ", 100)}
+		e.Matches = append(e.Matches, rag.RetrievalMatch{Message: msg})
+		e.Recent = append(e.Recent, msg)
+	}
+
+	embed := explainEmbed(strings.Repeat("why ", 100), e)
+	if len(embed.Title) > 256 {
+		t.Errorf("title is %d bytes", len(embed.Title))
+	}
+	if !strings.Contains(embed.Description, "distance threshold none") {
+		t.Errorf("description = %q, want no threshold", embed.Description)
+	}
+	for _, field := range embed.Fields {
+		if len(field.Value) > 1024 {
+			t.Errorf("%s field is %d bytes", field.Name, len(field.Value))
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// internal/bot/facts.go
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"discord-rag-bot/internal/rag"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// factPrefix marks the synthetic message IDs of facts, which are keyed
+	// by the ID of the interaction that added them
+	factPrefix = "fact:"
+	// factChannelName is the channel facts are shown as coming from in the
+	// context, since they weren't said anywhere
+	factChannelName = "facts"
+	// maxFactLength is the longest fact that can be added
+	maxFactLength = 2000
+	// factPreviewLength is how much of each fact /facts lists
+	factPreviewLength = 80
+)
+
+func addFactCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "addfact",
+		Description:              "Teach the bot a fact or FAQ answer it can retrieve like a message",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "text",
+				Description: "The fact, e.g. \"Game nights are on Fridays at 21:00 CET\"",
+				Required:    true,
+				MaxLength:   maxFactLength,
+			},
+		},
+	}
+}
+
+func factsCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "facts",
+		Description:              "List the facts added with /addfact, or delete one",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "delete",
+				Description: "ID of the fact to delete, as listed (leave empty to list facts)",
+				Required:    false,
+			},
+		},
+	}
+}
+
+// newFact turns an admin-provided text into a row for the store
+func newFact(i *discordgo.InteractionCreate, text string) *models.DiscordMessage {
+	fact := &models.DiscordMessage{
+		MessageID:   factPrefix + i.ID,
+		Content:     text,
+		ChannelName: factChannelName,
+		GuildID:     i.GuildID,
+		Timestamp:   time.Now(),
+		IsFact:      true,
+	}
+	if user := interactionUser(i); user != nil {
+		fact.Author = user.ID
+		fact.Username = user.Username
+	}
+	return fact
+}
+
+func (h *BotHandler) handleAddFactInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var text string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "text" {
+			text = strings.TrimSpace(opt.StringValue())
+		}
+	}
+	if text == "" {
+		h.editInteraction(s, i, "❌ The fact can't be empty.")
+		return
+	}
+
+	ctx, cancel := h.requestContext()
+	defer cancel()
+
+	fact := newFact(i, text)
+	err := h.rag.StoreMessageWithEmbedding(ctx, fact)
+	if errors.Is(err, rag.ErrEmbeddingRetrying) {
+		log.Printf("Fact %s for guild %s is waiting on its embedding: %v", fact.MessageID, i.GuildID, err)
+		h.editInteraction(s, i, fmt.Sprintf("⏳ Fact `%s` couldn't be embedded yet. It will be added once a retry succeeds; check `/facts` in a few minutes.", strings.TrimPrefix(fact.MessageID, factPrefix)))
+		return
+	}
+	if err != nil {
+		log.Printf("Error storing fact for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not store the fact.")
+		return
+	}
+
+	log.Printf("Fact %s added to guild %s by %s", fact.MessageID, i.GuildID, interactionUsername(i))
+	h.editInteraction(s, i, fmt.Sprintf("✅ Fact `%s` added. It will be used to answer related questions.", strings.TrimPrefix(fact.MessageID, factPrefix)))
+}
+
+func (h *BotHandler) handleFactsInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var target string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "delete" {
+			target = strings.TrimSpace(opt.StringValue())
+		}
+	}
+
+	ctx, cancel := h.requestContext()
+	defer cancel()
+
+	if target != "" {
+		id := factPrefix + strings.TrimPrefix(target, factPrefix)
+		deleted, err := h.rag.DeleteFact(ctx, i.GuildID, id)
+		if err != nil {
+			log.Printf("Error deleting fact %s from guild %s: %v", id, i.GuildID, err)
+			h.editInteraction(s, i, "❌ Could not delete the fact.")
+			return
+		}
+		if !deleted {
+			h.editInteraction(s, i, fmt.Sprintf("❌ There is no fact `%s` in this server. Use `/facts` to list them.", target))
+			return
+		}
+
+		log.Printf("Fact %s deleted from guild %s by %s", id, i.GuildID, interactionUsername(i))
+		h.editInteraction(s, i, fmt.Sprintf("✅ Fact `%s` deleted.", strings.TrimPrefix(id, factPrefix)))
+		return
+	}
+
+	facts, err := h.rag.ListFacts(ctx, i.GuildID)
+	if err != nil {
+		log.Printf("Error listing facts for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not load the facts.")
+		return
+	}
+	h.editInteraction(s, i, factList(facts, maxMessageLength))
+}
+
+// factList describes facts one per line with their IDs, leaving out those
+// that don't fit in limit characters
+func factList(facts []models.DiscordMessage, limit int) string {
+	if len(facts) == 0 {
+		return "No facts yet. Add one with `/addfact`."
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d facts:", len(facts))
+	for n, fact := range facts {
+		preview := strings.Join(strings.Fields(fact.Content), " ")
+		line := fmt.Sprintf("\n• `%s` %s", strings.TrimPrefix(fact.MessageID, factPrefix), truncateRunes(preview, factPreviewLength))
+		// Leave room to say how many were left out if later ones don't fit
+		more, reserve := fmt.Sprintf("\n… and %d more", len(facts)-n), 0
+		if n < len(facts)-1 {
+			reserve = len(more)
+		}
+		if b.Len()+len(line)+reserve > limit {
+			b.WriteString(more)
+			break
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFactList(t *testing.T) {
+	if got := factList(nil, maxMessageLength); !strings.Contains(got, "No facts yet") {
+		t.Errorf("factList of no facts = %q", got)
+	}
+
+	facts := []models.DiscordMessage{
+		{MessageID: "fact:1", Content: "Game nights are on\nFridays"},
+		{MessageID: "fact:2", Content: strings.Repeat("long ", 50)},
+	}
+	got := factList(facts, maxMessageLength)
+	lines := strings.Split(got, "\n")
+	if len(lines) != 3 || lines[0] != "2 facts:" {
+		t.Fatalf("factList = %q, want a header and a line per fact", got)
+	}
+	if lines[1] != "• `1` Game nights are on Fridays" {
+		t.Errorf("first fact listed as %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "• `2` long") || !strings.HasSuffix(lines[2], "…") {
+		t.Errorf("long fact listed as %q, want it previewed", lines[2])
+	}
+}
+
+func TestFactListLimit(t *testing.T) {
+	facts := make([]models.DiscordMessage, 100)
+	for i := range facts {
+		facts[i] = models.DiscordMessage{MessageID: fmt.Sprintf("fact:%d", i), Content: strings.Repeat("x", 60)}
+	}
+
+	got := factList(facts, 500)
+	if len(got) > 500 {
+		t.Errorf("list is %d characters, over the 500 limit", len(got))
+	}
+	listed := strings.Count(got, "\n•")
+	if want := fmt.Sprintf("\n… and %d more", len(facts)-listed); !strings.HasSuffix(got, want) {
+		t.Errorf("list of %d facts ends %q, want %q", listed, got[strings.LastIndex(got, "\n"):], want)
+	}
+}
@@ -0,0 +1,68 @@
+// internal/bot/feedback.go
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxFeedbackLength bounds stored feedback text
+const maxFeedbackLength = 1000
+
+func feedbackCommand() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "feedback",
+		Description: "Tell us what you thought of the bot's last answer",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "text",
+				Description: "Your feedback",
+				Required:    true,
+				MaxLength:   maxFeedbackLength,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleFeedbackInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	var text string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "text" {
+			text = strings.TrimSpace(opt.StringValue())
+		}
+	}
+	if text == "" {
+		h.editInteraction(s, i, "Please include some feedback text.")
+		return
+	}
+
+	user := interactionUser(i)
+	if user == nil {
+		h.editInteraction(s, i, unknownUserReply)
+		return
+	}
+	feedback := &models.Feedback{
+		UserID:    user.ID,
+		Username:  user.Username,
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		Text:      truncateMessage(text, maxFeedbackLength),
+	}
+
+	if err := h.db.CreateFeedback(feedback); err != nil {
+		log.Printf("Error storing feedback: %v", err)
+		h.editInteraction(s, i, "❌ Sorry, I couldn't save your feedback.")
+		return
+	}
+
+	h.editInteraction(s, i, "🙏 Thanks, your feedback has been recorded.")
+}
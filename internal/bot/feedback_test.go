@@ -0,0 +1,31 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Blank feedback is refused before anything is stored; the handler has no
+// database, so storing it would panic
+func TestFeedbackRequiresText(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{}}
+
+	h.handleFeedbackInteraction(s, commandInteraction("feedback", &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  "text",
+		Type:  discordgo.ApplicationCommandOptionString,
+		Value: "   ",
+	}))
+	if content := editedContent(t, fake); content != "Please include some feedback text." {
+		t.Errorf("response = %q, want a request for text", content)
+	}
+}
+
+func TestFeedbackCommandLimitsLength(t *testing.T) {
+	option := feedbackCommand().Options[0]
+	if !option.Required || option.MaxLength != maxFeedbackLength {
+		t.Errorf("text option = %+v, want it required and at most %d characters", option, maxFeedbackLength)
+	}
+}
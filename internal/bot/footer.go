@@ -0,0 +1,109 @@
+// internal/bot/footer.go
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxFooterLength leaves most of a message for the answer itself
+const maxFooterLength = 200
+
+func footerCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "footer",
+		Description:              "View or set the footer appended to AI answers in this server",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "text",
+				Description: "The footer (\"none\" removes it, \"reset\" restores the default)",
+				Required:    false,
+				MaxLength:   maxFooterLength,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleFooterInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	requested, _, err := stringOption(i.ApplicationCommandData().Options, "text")
+	if err != nil {
+		log.Printf("Invalid /footer options from %s: %v", interactionUsername(i), err)
+		h.editInteraction(s, i, "❌ Those command options don't look right. Discord may still be updating the command; please try again in a minute.")
+		return
+	}
+	requested = strings.TrimSpace(requested)
+
+	if requested == "" {
+		current := h.responseFooter(i.GuildID)
+		if current == "" {
+			h.editInteraction(s, i, "Answers here have no footer.")
+			return
+		}
+		h.editInteraction(s, i, fmt.Sprintf("Answers here end with:\n> %s", current))
+		return
+	}
+
+	settings, err := h.db.GetGuildSettings(i.GuildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not load this server's settings.")
+		return
+	}
+
+	switch strings.ToLower(requested) {
+	case "reset":
+		settings.ResponseFooter = nil
+	case "none":
+		settings.ResponseFooter = &[]string{""}[0]
+	default:
+		settings.ResponseFooter = &requested
+	}
+
+	if err := h.db.SaveGuildSettings(settings); err != nil {
+		log.Printf("Error saving footer for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not save the footer.")
+		return
+	}
+
+	log.Printf("Response footer for guild %s set to %q by %s", i.GuildID, requested, interactionUsername(i))
+	if current := h.responseFooter(i.GuildID); current != "" {
+		h.editInteraction(s, i, fmt.Sprintf("✅ Answers here now end with:\n> %s", current))
+		return
+	}
+	h.editInteraction(s, i, "✅ Answers here no longer have a footer.")
+}
+
+// responseFooter is the footer for answers in a guild: its override if it
+// has one, otherwise the configured default
+func (h *BotHandler) responseFooter(guildID string) string {
+	if guildID == "" {
+		return h.cfg.Bot.ResponseFooter
+	}
+
+	settings, err := h.db.GetGuildSettings(guildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+		return h.cfg.Bot.ResponseFooter
+	}
+	if settings.ResponseFooter != nil {
+		return *settings.ResponseFooter
+	}
+	return h.cfg.Bot.ResponseFooter
+}
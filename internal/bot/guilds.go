@@ -0,0 +1,67 @@
+// internal/bot/guilds.go
+package bot
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const welcomeMessage = "👋 Thanks for adding me! Mention me or use `/ai` to ask questions about this server's conversations, " +
+	"and `/join` to talk to me in voice. Admins can use `/enable-here`, `/disable-here`, `/model` and `/threads` to set me up."
+
+// newGuildWindow separates a genuine join from a guild seen for the first
+// time after upgrading, so existing guilds aren't welcomed on startup
+const newGuildWindow = 10 * time.Minute
+
+// onGuildCreate fires for every guild on startup and when the bot joins a
+// new one. Only newly joined guilds without a settings row get the welcome.
+func (h *BotHandler) onGuildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
+	if g.Unavailable {
+		return
+	}
+
+	created, err := h.db.InitGuildSettings(g.ID)
+	if err != nil {
+		log.Printf("Error initializing settings for guild %s: %v", g.ID, err)
+		return
+	}
+	if !created {
+		return
+	}
+
+	log.Printf("Joined guild %s (%s)", g.Name, g.ID)
+
+	if h.cfg.Bot.WelcomeMessage && g.SystemChannelID != "" && time.Since(g.JoinedAt) < newGuildWindow {
+		h.sendText(s, g.SystemChannelID, welcomeMessage)
+	}
+}
+
+// onGuildDelete fires when the bot is removed from a guild or the guild
+// becomes unavailable during an outage; only the former touches stored data
+func (h *BotHandler) onGuildDelete(s *discordgo.Session, g *discordgo.GuildDelete) {
+	if g.Unavailable {
+		log.Printf("Guild %s is temporarily unavailable", g.ID)
+		return
+	}
+
+	log.Printf("Removed from guild %s", g.ID)
+
+	// Not being in voice there is the common case
+	if h.voiceManager != nil {
+		h.voiceManager.LeaveVoiceChannel(g.ID, "")
+	}
+
+	if h.cfg.Bot.PurgeOnLeave {
+		if err := h.db.PurgeGuild(g.ID); err != nil {
+			log.Printf("Error purging data for guild %s: %v", g.ID, err)
+		}
+		h.rag.ForgetGuild(g.ID)
+		return
+	}
+
+	if err := h.db.MarkGuildLeft(g.ID); err != nil {
+		log.Printf("Error marking guild %s as left: %v", g.ID, err)
+	}
+}
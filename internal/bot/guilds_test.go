@@ -0,0 +1,18 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// An outage reports guilds as unavailable; that must never initialize or
+// mark anything. The handler has no database, so touching it would panic.
+func TestUnavailableGuildIgnored(t *testing.T) {
+	h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{WelcomeMessage: true, PurgeOnLeave: true}}}
+	guild := &discordgo.Guild{ID: "g1", Unavailable: true}
+
+	h.onGuildCreate(nil, &discordgo.GuildCreate{Guild: guild})
+	h.onGuildDelete(nil, &discordgo.GuildDelete{Guild: guild})
+}
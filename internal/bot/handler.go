@@ -2,61 +2,153 @@
 package bot
 
 import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/config"
 	"discord-rag-bot/internal/database"
 	"discord-rag-bot/internal/models"
 	"discord-rag-bot/internal/rag"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 type BotHandler struct {
+	cfg          *config.Config
 	db           *database.DB
 	rag          *rag.RAGRetriever
+	transcriber  ai.Transcriber
+	synthesizer  ai.Synthesizer
 	session      *discordgo.Session
 	botID        string
+	botIDMu      sync.RWMutex
 	voiceManager *VoiceManager
+	responses    *responseStore
+	ingest       *ingestFilter
+	backfills    sync.Map // guild ID -> true while a backfill runs
+	sends        *sendQueue
 }
 
-func NewBotHandler(db *database.DB, rag *rag.RAGRetriever) *BotHandler {
+func NewBotHandler(db *database.DB, rag *rag.RAGRetriever, transcriber ai.Transcriber, synthesizer ai.Synthesizer, cfg *config.Config) *BotHandler {
 	handler := &BotHandler{
-		db:  db,
-		rag: rag,
+		cfg:         cfg,
+		db:          db,
+		rag:         rag,
+		transcriber: transcriber,
+		synthesizer: synthesizer,
+		responses:   newResponseStore(),
+		ingest:      newIngestFilter(cfg.Ingest),
+		sends:       newSendQueue(cfg.Bot.SendInterval),
+	}
+	if cfg.Voice.Enabled {
+		handler.voiceManager = NewVoiceManager(handler)
 	}
-	handler.voiceManager = NewVoiceManager(handler)
 	return handler
 }
 
+// Intents returns the gateway intents the bot needs for its enabled features
+func Intents(cfg *config.Config) discordgo.Intent {
+	intents := discordgo.IntentsGuilds |
+		discordgo.IntentsGuildMessages |
+		discordgo.IntentsDirectMessages
+	if cfg.Voice.Enabled {
+		intents |= discordgo.IntentsGuildVoiceStates
+	}
+	return intents
+}
+
 func (h *BotHandler) SetSession(s *discordgo.Session) {
 	h.session = s
+
+	// Resolve the bot's ID before any handler is registered so events never
+	// observe an empty ID. If this fails, the Ready handler fills it in.
 	user, err := s.User("@me")
 	if err != nil {
 		log.Printf("Error getting bot user: %v", err)
-		return
+	} else {
+		h.setBotID(user.ID)
 	}
-	h.botID = user.ID
+
+	s.AddHandler(h.onReady)
 
 	// Add voice state update handler
-	s.AddHandler(h.voiceManager.HandleVoiceStateUpdate)
+	if h.voiceManager != nil {
+		s.AddHandler(h.voiceManager.HandleVoiceStateUpdate)
+	}
 
 	// Add interaction handler for slash commands
 	s.AddHandler(h.handleInteraction)
+
+	// Track guild membership
+	s.AddHandler(h.onGuildCreate)
+	s.AddHandler(h.onGuildDelete)
+
+	// Optional ingestion sources besides new messages
+	if h.cfg.Ingest.Threads {
+		s.AddHandler(h.onThreadCreate)
+	}
+	if h.cfg.Ingest.Pins {
+		s.AddHandler(h.onChannelPinsUpdate)
+	}
+	if h.cfg.Ingest.Messages || h.cfg.Ingest.Pins {
+		s.AddHandler(h.onMessageUpdate)
+	}
+}
+
+func (h *BotHandler) onReady(s *discordgo.Session, r *discordgo.Ready) {
+	if r.User != nil {
+		h.setBotID(r.User.ID)
+	}
+}
+
+func (h *BotHandler) setBotID(id string) {
+	h.botIDMu.Lock()
+	defer h.botIDMu.Unlock()
+	h.botID = id
+}
+
+// currentBotID returns the bot's user ID, falling back to the session state
+// if it wasn't resolved in SetSession. Returns "" if it is still unknown.
+func (h *BotHandler) currentBotID(s *discordgo.Session) string {
+	h.botIDMu.RLock()
+	id := h.botID
+	h.botIDMu.RUnlock()
+
+	if id == "" && s != nil && s.State != nil && s.State.User != nil {
+		id = s.State.User.ID
+		h.setBotID(id)
+	}
+	return id
 }
 
 // RegisterCommands registers slash commands for the bot
 func (h *BotHandler) RegisterCommands() error {
-	commands := []*discordgo.ApplicationCommand{
-		{
-			Name:        "join",
-			Description: "Join your current voice channel",
-		},
-		{
-			Name:        "leave",
-			Description: "Leave the current voice channel",
-		},
+	var commands []*discordgo.ApplicationCommand
+	if h.voiceManager != nil {
+		commands = append(commands,
+			&discordgo.ApplicationCommand{
+				Name:        "join",
+				Description: "Join your current voice channel",
+			},
+			&discordgo.ApplicationCommand{
+				Name:        "leave",
+				Description: "Leave the current voice channel",
+			},
+			voiceResetCommand(),
+			voiceModeCommand(),
+			voicePromptCommand(),
+			quietHoursCommand(),
+			listenCommand(),
+		)
+	}
+	commands = append(commands, []*discordgo.ApplicationCommand{
 		{
 			Name:        "ai",
 			Description: "Ask the AI a question",
@@ -67,9 +159,36 @@ func (h *BotHandler) RegisterCommands() error {
 					Description: "The question to ask the AI",
 					Required:    true,
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "since",
+					Description: "Only use messages from this recent period",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Last 24 hours", Value: "day"},
+						{Name: "Last 7 days", Value: "week"},
+						{Name: "Last 30 days", Value: "month"},
+					},
+				},
 			},
 		},
-	}
+		modelCommand(),
+		botNameCommand(),
+		authorNamesCommand(),
+		threadsCommand(),
+		usageCommand(),
+		embeddingVersionCommand(),
+		backfillCommand(),
+		feedbackCommand(),
+		historyCommand(),
+		diagCommand(),
+		explainCommand(),
+		footerCommand(),
+		regenerateCommand(),
+		addFactCommand(),
+		factsCommand(),
+	}...)
+	commands = append(commands, channelCommands()...)
 
 	for _, cmd := range commands {
 		_, err := h.session.ApplicationCommandCreate(h.session.State.User.ID, "", cmd)
@@ -82,59 +201,279 @@ func (h *BotHandler) RegisterCommands() error {
 	return nil
 }
 
-// handleInteraction handles slash command interactions
+// handleInteraction handles slash command and message component interactions
 func (h *BotHandler) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionMessageComponent {
+		if h.rejectDisabledChannel(s, i) {
+			return
+		}
+		h.handleComponentInteraction(s, i)
+		return
+	}
+
 	if i.Type != discordgo.InteractionApplicationCommand {
 		return
 	}
 
+	// Admin commands work everywhere so a channel can be re-enabled
 	switch i.ApplicationCommandData().Name {
-	case "join":
-		h.handleJoinInteraction(s, i)
-	case "leave":
-		h.handleLeaveInteraction(s, i)
+	case "model":
+		h.handleModelInteraction(s, i)
+		return
+	case "bot-name":
+		h.handleBotNameInteraction(s, i)
+		return
+	case "author-names":
+		h.handleAuthorNamesInteraction(s, i)
+		return
+	case "threads":
+		h.handleThreadsInteraction(s, i)
+		return
+	case "voice-reset":
+		h.handleVoiceResetInteraction(s, i)
+		return
+	case "voice-mode":
+		h.handleVoiceModeInteraction(s, i)
+		return
+	case "voice-prompt":
+		h.handleVoicePromptInteraction(s, i)
+		return
+	case "quiet-hours":
+		h.handleQuietHoursInteraction(s, i)
+		return
+	case "usage":
+		h.handleUsageInteraction(s, i)
+		return
+	case "embedding-version":
+		h.handleEmbeddingVersionInteraction(s, i)
+		return
+	case "backfill":
+		h.handleBackfillInteraction(s, i)
+		return
+	case "diag":
+		h.handleDiagInteraction(s, i)
+		return
+	case "explain":
+		h.handleExplainInteraction(s, i)
+		return
+	case "footer":
+		h.handleFooterInteraction(s, i)
+		return
+	case "addfact":
+		h.handleAddFactInteraction(s, i)
+		return
+	case "facts":
+		h.handleFactsInteraction(s, i)
+		return
+	case "enable-here":
+		h.handleChannelToggleInteraction(s, i, true)
+		return
+	case "disable-here":
+		h.handleChannelToggleInteraction(s, i, false)
+		return
+	}
+
+	if h.rejectDisabledChannel(s, i) {
+		return
+	}
+
+	switch i.ApplicationCommandData().Name {
+	case "join", "leave", "listen":
+		// Commands registered before voice was disabled may still be invoked
+		if h.voiceManager == nil {
+			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: "🔇 Voice is disabled for this bot.",
+					Flags:   discordgo.MessageFlagsEphemeral,
+				},
+			})
+			return
+		}
+		switch i.ApplicationCommandData().Name {
+		case "join":
+			h.handleJoinInteraction(s, i)
+		case "leave":
+			h.handleLeaveInteraction(s, i)
+		default:
+			h.handleListenInteraction(s, i)
+		}
 	case "ai":
 		h.handleAIInteraction(s, i)
+	case "feedback":
+		h.handleFeedbackInteraction(s, i)
+	case "history":
+		h.handleHistoryInteraction(s, i)
+	case "regenerate":
+		h.handleRegenerateInteraction(s, i)
 	}
 }
 
 // Keeping the existing message handlers for backward compatibility
 
 func (h *BotHandler) OnMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	// Without our own ID we can't tell our messages or mentions apart
+	botID := h.currentBotID(s)
+	if botID == "" {
+		log.Printf("Bot user not resolved yet, ignoring message %s", m.ID)
+		return
+	}
+
 	// Ignore bot messages
-	if m.Author.ID == h.botID {
+	if ownMessage(m.Message, botID) {
 		return
 	}
 
-	// Store message for RAG
-	go h.storeMessage(m)
+	enabled := h.channelEnabled(m.GuildID, m.ChannelID)
 
-	// Check for voice commands
-	if strings.HasPrefix(m.Content, "/join") || strings.Contains(m.Content, "join voice") {
-		h.handleJoinVoiceCommand(s, m)
-		return
+	// Store message for RAG, leaving out automated noise from other bots
+	if h.cfg.Ingest.Messages && h.ingestChannel(enabled) && !h.ingest.skipAuthor(m.Author) {
+		go h.storeMessage(m)
 	}
 
-	if strings.HasPrefix(m.Content, "/leave") || strings.Contains(m.Content, "leave voice") {
-		h.handleLeaveVoiceCommand(s, m)
+	if !enabled {
 		return
 	}
 
-	// Check if bot is mentioned or DM for text chat
-	botMentioned := strings.Contains(m.Content, "<@"+h.botID+">") ||
-		strings.HasPrefix(m.Content, "/ai ") ||
-		m.GuildID == "" // DM
+	// Check for voice commands
+	if h.voiceManager != nil {
+		if strings.HasPrefix(m.Content, "/join") || strings.Contains(m.Content, "join voice") {
+			h.handleJoinVoiceCommand(s, m)
+			return
+		}
 
-	if botMentioned {
+		if strings.HasPrefix(m.Content, "/leave") || strings.Contains(m.Content, "leave voice") {
+			h.handleLeaveVoiceCommand(s, m)
+			return
+		}
+	}
+
+	// Check if bot is mentioned or DM for text chat
+	var name string
+	if h.cfg.Bot.RespondToName {
+		name = h.rag.BotName(m.GuildID)
+	}
+	if shouldAnswer(m, botID, name, h.cfg.Bot.DMMode) {
 		go h.handleAIQuery(s, m)
 	}
 }
 
+// dmModeMention requires DMs to address the bot explicitly
+const dmModeMention = "mention"
+
+// shouldAnswer reports whether a message asks the bot something: it mentions
+// the bot, says its name (if name is set) or uses the /ai prefix, or it is a
+// DM and DMs are always answered
+func shouldAnswer(m *discordgo.MessageCreate, botID, name, dmMode string) bool {
+	if mentionsBot(m, botID) || mentionsName(m.Content, name) || strings.HasPrefix(m.Content, "/ai ") {
+		return true
+	}
+	return m.GuildID == "" && dmMode != dmModeMention
+}
+
+// stringOption looks up a string option by name, so options can be added or
+// reordered without being misread. An option of another type, e.g. from a
+// stale command registration, is an error instead of the panic StringValue
+// would raise.
+func stringOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) (value string, found bool, err error) {
+	for _, opt := range options {
+		if opt.Name != name {
+			continue
+		}
+		if opt.Type != discordgo.ApplicationCommandOptionString {
+			return "", true, fmt.Errorf("option %q has type %s, expected %s", name, opt.Type, discordgo.ApplicationCommandOptionString)
+		}
+		value, ok := opt.Value.(string)
+		if !ok {
+			return "", true, fmt.Errorf("option %q has a non-string value %T", name, opt.Value)
+		}
+		return value, true, nil
+	}
+	return "", false, nil
+}
+
+// requestContext bounds the work done for a message-triggered request
+func (h *BotHandler) requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), h.cfg.Bot.ResponseTimeout)
+}
+
+// interactionContext bounds the work done for an interaction by the
+// configured response timeout. It may outlast the interaction's edit
+// window; editResponse then delivers the answer as a regular message.
+func (h *BotHandler) interactionContext(i *discordgo.InteractionCreate) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if user := interactionUser(i); user != nil {
+		ctx = ai.WithUserID(ctx, user.ID)
+	}
+	return context.WithTimeout(ctx, h.cfg.Bot.ResponseTimeout)
+}
+
+// shortQueryReply is the canned answer for queries too short to be worth a
+// model call
+const shortQueryReply = "👋 Could you tell me a bit more about what you'd like to know?"
+
+// queryTooShort reports whether a cleaned query has fewer than minLength
+// characters. This is independent of the ingestion length filter.
+func queryTooShort(query string, minLength int) bool {
+	return utf8.RuneCountInString(strings.TrimSpace(query)) < minLength
+}
+
+// mentionsBot reports whether a message mentions the bot, using the parsed
+// mentions list and falling back to both the <@ID> and <@!ID> formats
+func mentionsBot(m *discordgo.MessageCreate, botID string) bool {
+	for _, user := range m.Mentions {
+		if user != nil && user.ID == botID {
+			return true
+		}
+	}
+	return strings.Contains(m.Content, "<@"+botID+">") ||
+		strings.Contains(m.Content, "<@!"+botID+">")
+}
+
+// mentionsName reports whether content contains name as a whole word,
+// ignoring case
+func mentionsName(content, name string) bool {
+	if name == "" {
+		return false
+	}
+
+	content = strings.ToLower(content)
+	name = strings.ToLower(name)
+	for offset := 0; ; {
+		idx := strings.Index(content[offset:], name)
+		if idx < 0 {
+			return false
+		}
+		start := offset + idx
+		end := start + len(name)
+		if !isWordRuneBefore(content, start) && !isWordRuneAfter(content, end) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isWordRuneBefore(s string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return i > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func isWordRuneAfter(s string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return i < len(s) && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// stripBotMention removes every mention of the bot from content
+func stripBotMention(content, botID string) string {
+	content = strings.ReplaceAll(content, "<@!"+botID+">", "")
+	return strings.ReplaceAll(content, "<@"+botID+">", "")
+}
+
 func (h *BotHandler) handleJoinVoiceCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 	// Find the user's voice channel
 	guild, err := s.State.Guild(m.GuildID)
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, "Error finding your voice channel.")
+		h.sendText(s, m.ChannelID, "Error finding your voice channel.")
 		return
 	}
 
@@ -147,30 +486,141 @@ func (h *BotHandler) handleJoinVoiceCommand(s *discordgo.Session, m *discordgo.M
 	}
 
 	if voiceChannelID == "" {
-		s.ChannelMessageSend(m.ChannelID, "You need to be in a voice channel for me to join!")
+		h.sendText(s, m.ChannelID, "You need to be in a voice channel for me to join!")
 		return
 	}
 
 	err = h.voiceManager.JoinVoiceChannel(s, m.GuildID, voiceChannelID, m.Author.ID)
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error joining voice channel: %v", err))
+		h.sendText(s, m.ChannelID, joinErrorMessage(err))
 		return
 	}
 
-	s.ChannelMessageSend(m.ChannelID, "🎤 Joined voice channel! You can now talk to me. I'm listening...")
+	h.sendText(s, m.ChannelID, "🎤 Joined voice channel! You can now talk to me. I'm listening...")
 }
 
 func (h *BotHandler) handleLeaveVoiceCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
-	err := h.voiceManager.LeaveVoiceChannel(m.GuildID)
+	err := h.voiceManager.LeaveVoiceChannel(m.GuildID, "")
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error leaving voice channel: %v", err))
+		h.sendText(s, m.ChannelID, fmt.Sprintf("Error leaving voice channel: %v", err))
 		return
 	}
 
-	s.ChannelMessageSend(m.ChannelID, "👋 Left voice channel!")
+	h.sendText(s, m.ChannelID, "👋 Left voice channel!")
 }
 
-func (h *BotHandler) logVoiceInteraction(guildID, channelID, userID, username, query, response string) {
+// joinErrorMessage explains a failed voice join to the user
+func joinErrorMessage(err error) string {
+	var busy *VoiceBusyError
+	if errors.As(err, &busy) {
+		return fmt.Sprintf("❌ I'm already in <#%s> and can only be in one voice channel per server. Use `/leave` first.", busy.ChannelID)
+	}
+	return fmt.Sprintf("Error joining voice channel: %v", err)
+}
+
+// speechClip is one synthesized piece of a response
+type speechClip struct {
+	audio  []byte
+	format ai.AudioFormat
+}
+
+// guildName resolves a guild's name from the state cache, then the API, and
+// falls back to the configured placeholder so a lookup failure never aborts
+// a response
+func (h *BotHandler) guildName(s *discordgo.Session, guildID string) string {
+	if guildID == "" {
+		return h.cfg.Bot.FallbackGuildName
+	}
+
+	if s.State != nil {
+		if guild, err := s.State.Guild(guildID); err == nil && guild.Name != "" {
+			return guild.Name
+		}
+	}
+
+	guild, err := s.Guild(guildID)
+	if err != nil || guild.Name == "" {
+		log.Printf("Error getting guild %s, using placeholder name: %v", guildID, err)
+		return h.cfg.Bot.FallbackGuildName
+	}
+	return guild.Name
+}
+
+// lookupChannel fetches a channel from the state cache or the API
+func lookupChannel(s *discordgo.Session, channelID string) (*discordgo.Channel, error) {
+	if s.State != nil {
+		if channel, err := s.State.Channel(channelID); err == nil {
+			return channel, nil
+		}
+	}
+	return s.Channel(channelID)
+}
+
+// categoryOf returns the category a channel sits in. Threads belong to
+// their parent channel's category.
+func (h *BotHandler) categoryOf(s *discordgo.Session, channel *discordgo.Channel) string {
+	if !channel.IsThread() {
+		return channel.ParentID
+	}
+
+	parent, err := lookupChannel(s, channel.ParentID)
+	if err != nil {
+		log.Printf("Error getting parent of thread %s: %v", channel.ID, err)
+		return ""
+	}
+	return parent.ParentID
+}
+
+// channelCategory is categoryOf by channel ID; empty if it can't be found
+func (h *BotHandler) channelCategory(s *discordgo.Session, channelID string) string {
+	channel, err := lookupChannel(s, channelID)
+	if err != nil {
+		log.Printf("Error getting channel %s: %v", channelID, err)
+		return ""
+	}
+	return h.categoryOf(s, channel)
+}
+
+// synthesize converts a response to speech with the configured voice
+// settings. Text over the TTS input limit is split at sentence boundaries
+// and returned as several clips to play in order.
+func (h *BotHandler) synthesize(ctx context.Context, text, language string) ([]speechClip, error) {
+	opts := ai.SynthesizeOptions{
+		Voice: h.ttsVoice(language),
+		Speed: h.cfg.AI.TTSSpeed,
+	}
+
+	var clips []speechClip
+	var invalid error
+	for _, chunk := range ai.SplitSpeechText(text, ai.MaxSpeechChars) {
+		audio, format, err := h.synthesizer.Synthesize(ctx, chunk, opts)
+		if errors.Is(err, ai.ErrInvalidAudio) {
+			// Leave out the unplayable part rather than the whole answer
+			log.Printf("Skipping speech for part of a response: %v", err)
+			invalid = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		clips = append(clips, speechClip{audio: audio, format: format})
+	}
+	if len(clips) == 0 && invalid != nil {
+		return nil, invalid
+	}
+	return clips, nil
+}
+
+// ttsVoice picks the configured voice for a language, falling back to the
+// default voice
+func (h *BotHandler) ttsVoice(language string) string {
+	if voice, ok := h.cfg.AI.TTSLanguageVoices[strings.ToLower(language)]; ok && language != "" {
+		return voice
+	}
+	return h.cfg.AI.TTSVoice
+}
+
+func (h *BotHandler) logVoiceInteraction(ctx context.Context, guildID, channelID, userID, username, query, response string) {
 	interaction := &models.BotInteraction{
 		UserID:    userID,
 		Username:  username,
@@ -181,14 +631,14 @@ func (h *BotHandler) logVoiceInteraction(guildID, channelID, userID, username, q
 		Timestamp: time.Now(),
 	}
 
-	if err := h.db.Create(interaction).Error; err != nil {
+	if err := h.rag.StoreInteraction(ctx, interaction); err != nil {
 		log.Printf("Error logging voice interaction: %v", err)
 	}
 }
 
 func (h *BotHandler) storeMessage(m *discordgo.MessageCreate) {
-	if m.Content == "" || len(m.Content) < 10 {
-		return // Skip empty or very short messages
+	if h.ingest.skipReason(m.Content) != "" {
+		return // Skip messages that would pollute retrieval
 	}
 
 	// Get channel and guild info
@@ -198,27 +648,29 @@ func (h *BotHandler) storeMessage(m *discordgo.MessageCreate) {
 		return
 	}
 
-	guild, err := h.session.Guild(m.GuildID)
-	if err != nil {
-		log.Printf("Error getting guild info: %v", err)
+	h.persistMessage(h.normalizeMessage(channel, m.Message, ""))
+}
+
+// ownMessage reports whether the bot posted m. Interaction responses and
+// their follow-ups are authored by the bot user too.
+func ownMessage(m *discordgo.Message, botID string) bool {
+	return m.Author != nil && m.Author.ID == botID
+}
+
+// persistMessage embeds and stores a normalized message. The bot's own
+// messages are dropped whatever path they came from: retrieving its past
+// answers as server history would feed its mistakes back to it.
+func (h *BotHandler) persistMessage(message *models.DiscordMessage) {
+	if message.Author != "" && message.Author == h.currentBotID(h.session) {
+		log.Printf("Not storing message %s: it was posted by the bot", message.MessageID)
 		return
 	}
 
-	message := &models.DiscordMessage{
-		MessageID:   m.ID,
-		Content:     m.Content,
-		Author:      m.Author.ID,
-		Username:    m.Author.Username,
-		ChannelID:   m.ChannelID,
-		ChannelName: channel.Name,
-		GuildID:     m.GuildID,
-		GuildName:   guild.Name,
-		Timestamp:   m.Timestamp,
-	}
+	ctx, cancel := h.requestContext()
+	defer cancel()
 
-	// Use the new method that handles embeddings
-	err = h.rag.StoreMessageWithEmbedding(message)
-	if err != nil {
+	// A message still being retried is stored once its embedding succeeds
+	if err := h.rag.StoreMessageWithEmbedding(ctx, message); err != nil && !errors.Is(err, rag.ErrEmbeddingRetrying) {
 		log.Printf("Error storing message with embedding: %v", err)
 	}
 }
@@ -227,8 +679,8 @@ func (h *BotHandler) handleAIQuery(s *discordgo.Session, m *discordgo.MessageCre
 	// Clean the query - extract just the actual question from the message
 	query := m.Content
 
-	// Remove the bot mention
-	query = strings.ReplaceAll(query, "<@"+h.botID+">", "")
+	// Remove the bot mention (both plain and nickname forms)
+	query = stripBotMention(query, h.currentBotID(s))
 
 	// Remove the /ai prefix if present
 	query = strings.ReplaceAll(query, "/ai ", "")
@@ -237,54 +689,66 @@ func (h *BotHandler) handleAIQuery(s *discordgo.Session, m *discordgo.MessageCre
 	query = strings.TrimSpace(query)
 
 	if query == "" {
-		s.ChannelMessageSend(m.ChannelID, "Hi! How can I help you?")
+		h.sendText(s, m.ChannelID, "Hi! How can I help you?")
 		return
 	}
 
-	// Show typing indicator
-	s.ChannelTyping(m.ChannelID)
+	if queryTooShort(query, h.cfg.Bot.MinQueryLength) {
+		h.sendText(s, m.ChannelID, shortQueryReply)
+		return
+	}
 
-	// Get guild info
-	guild, err := s.Guild(m.GuildID)
-	if err != nil {
-		log.Printf("Error getting guild: %v", err)
+	if reply, over := h.overBudget(m.Author.ID); over {
+		h.sendText(s, m.ChannelID, reply)
 		return
 	}
 
+	// Show typing indicator
+	h.sendTyping(s, m.ChannelID)
+
+	ctx, cancel := h.requestContext()
+	defer cancel()
+	ctx = ai.WithUserID(ctx, m.Author.ID)
+
+	// Get guild info
+	guildName := h.guildName(s, m.GuildID)
+
 	// Get relevant context using RAG
-	context, err := h.rag.SearchRelevantContext(query, m.GuildID, 5)
+	timeRange := resolveTimeRange(query, "", time.Now())
+	retrieved, err := h.rag.SearchContextInRange(ctx, query, m.GuildID, m.ChannelID, h.channelCategory(s, m.ChannelID), 5, timeRange)
 	if err != nil {
 		log.Printf("Error getting context: %v", err)
-		s.ChannelMessageSend(m.ChannelID, "Sorry, I encountered an error while searching for context.")
+		h.sendText(s, m.ChannelID, "Sorry, I encountered an error while searching for context.")
 		return
 	}
 
 	// Generate AI response
-	response, err := h.rag.GenerateResponse(query, context, m.Author.Username, guild.Name)
+	response, err := h.rag.GenerateResponse(ctx, query, retrieved, m.Author.Username, m.GuildID, guildName)
 	if err != nil {
 		log.Printf("Error generating response: %v", err)
-		s.ChannelMessageSend(m.ChannelID, "Sorry, I encountered an error while generating a response.")
+		h.sendText(s, m.ChannelID, "Sorry, I encountered an error while generating a response.")
 		return
 	}
-
-	// Send text response (only once)
-	s.ChannelMessageSend(m.ChannelID, response)
+	response = h.replyWithAnswer(s, m, query, response, &responseState{
+		Query:     query,
+		Context:   retrieved,
+		GuildID:   m.GuildID,
+		GuildName: guildName,
+	})
 
 	// Check if we have a voice connection for this guild
-	h.voiceManager.mu.RLock()
-	vc, hasVoiceConnection := h.voiceManager.connections[m.GuildID]
-	h.voiceManager.mu.RUnlock()
+	vc, hasVoiceConnection := h.voiceManager.connection(m.GuildID)
 
-	// Generate and send voice response if in a voice channel
-	if hasVoiceConnection && vc != nil {
+	// Generate and send voice response if in a voice channel, outside quiet hours
+	if hasVoiceConnection && vc != nil && !h.inQuietHours(m.GuildID, time.Now()) {
 		// Generate TTS audio and send to voice channel
-		ttsAudio, err := h.rag.AI.TextToSpeech(response)
+		clips, err := h.synthesize(ctx, response, "")
 		if err != nil {
 			log.Printf("Error generating TTS audio: %v", err)
 		} else {
 			// Send the TTS audio to the voice channel in a goroutine
 			go func() {
-				if err := h.voiceManager.SendAudio(vc, ttsAudio); err != nil {
+				if err := h.voiceManager.speakResponse(vc, response, clips); err != nil {
 					log.Printf("Error sending audio: %v", err)
 				}
 			}()
@@ -302,11 +766,29 @@ func (h *BotHandler) handleAIQuery(s *discordgo.Session, m *discordgo.MessageCre
 		Timestamp: time.Now(),
 	}
 
-	if err := h.db.Create(interaction).Error; err != nil {
+	if err := h.rag.StoreInteraction(ctx, interaction); err != nil {
 		log.Printf("Error logging interaction: %v", err)
 	}
 }
 
+// replyWithAnswer finishes a generated answer to m and posts it once, with
+// regenerate and sources buttons. It returns the answer as sent, which is
+// the fallback reply if the model's answer came back empty.
+func (h *BotHandler) replyWithAnswer(s *discordgo.Session, m *discordgo.MessageCreate, query, response string, state *responseState) string {
+	response = h.finishResponse(response)
+
+	reply := &discordgo.MessageSend{
+		Content:    appendFooter(response, h.responseFooter(m.GuildID)),
+		Components: responseComponents(h.responses.put(state)),
+	}
+	targetChannelID, reference := h.replyTarget(s, m, query)
+	if reference {
+		reply.Reference = m.Reference()
+	}
+	h.sendMessageFor(s, targetChannelID, m.Author.ID, reply)
+	return response
+}
+
 // Add these missing functions to handler.go
 
 func (h *BotHandler) handleJoinInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
@@ -319,10 +801,18 @@ func (h *BotHandler) handleJoinInteraction(s *discordgo.Session, i *discordgo.In
 		return
 	}
 
+	user := interactionUser(i)
+	if user == nil {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{unknownUserReply}[0],
+		})
+		return
+	}
+
 	// Find user's voice channel
 	guild, err := s.State.Guild(i.GuildID)
 	if err != nil {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		h.editResponse(s, i, &discordgo.WebhookEdit{
 			Content: &[]string{"Error: Could not find guild"}[0],
 		})
 		return
@@ -330,29 +820,29 @@ func (h *BotHandler) handleJoinInteraction(s *discordgo.Session, i *discordgo.In
 
 	var voiceChannelID string
 	for _, vs := range guild.VoiceStates {
-		if vs.UserID == i.Member.User.ID {
+		if vs.UserID == user.ID {
 			voiceChannelID = vs.ChannelID
 			break
 		}
 	}
 
 	if voiceChannelID == "" {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		h.editResponse(s, i, &discordgo.WebhookEdit{
 			Content: &[]string{"❌ You need to be in a voice channel first!"}[0],
 		})
 		return
 	}
 
 	// Join voice channel
-	err = h.voiceManager.JoinVoiceChannel(s, i.GuildID, voiceChannelID, i.Member.User.ID)
+	err = h.voiceManager.JoinVoiceChannel(s, i.GuildID, voiceChannelID, user.ID)
 	if err != nil {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &[]string{fmt.Sprintf("Error joining voice channel: %v", err)}[0],
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{joinErrorMessage(err)}[0],
 		})
 		return
 	}
 
-	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+	h.editResponse(s, i, &discordgo.WebhookEdit{
 		Content: &[]string{"🎤 Joined voice channel! You can now talk to me. I'm listening..."}[0],
 	})
 }
@@ -367,15 +857,15 @@ func (h *BotHandler) handleLeaveInteraction(s *discordgo.Session, i *discordgo.I
 		return
 	}
 
-	err = h.voiceManager.LeaveVoiceChannel(i.GuildID)
+	err = h.voiceManager.LeaveVoiceChannel(i.GuildID, "")
 	if err != nil {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		h.editResponse(s, i, &discordgo.WebhookEdit{
 			Content: &[]string{fmt.Sprintf("Error leaving voice channel: %v", err)}[0],
 		})
 		return
 	}
 
-	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+	h.editResponse(s, i, &discordgo.WebhookEdit{
 		Content: &[]string{"👋 Left voice channel!"}[0],
 	})
 }
@@ -390,72 +880,101 @@ func (h *BotHandler) handleAIInteraction(s *discordgo.Session, i *discordgo.Inte
 		return
 	}
 
+	user := interactionUser(i)
+	if user == nil {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{unknownUserReply}[0],
+		})
+		return
+	}
+
+	ctx, cancel := h.interactionContext(i)
+	defer cancel()
+
 	options := i.ApplicationCommandData().Options
-	if len(options) == 0 {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+	query, found, err := stringOption(options, "question")
+	if err == nil && !found {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
 			Content: &[]string{"Please provide a question!"}[0],
 		})
 		return
 	}
+	since, _, sinceErr := stringOption(options, "since")
+	if err == nil {
+		err = sinceErr
+	}
+	if err != nil {
+		log.Printf("Invalid /ai options from %s: %v", user.ID, err)
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{"❌ Those command options don't look right. Discord may still be updating the command; please try again in a minute."}[0],
+		})
+		return
+	}
 
-	query := options[0].StringValue()
 	if query == "" {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		h.editResponse(s, i, &discordgo.WebhookEdit{
 			Content: &[]string{"Hi! How can I help you?"}[0],
 		})
 		return
 	}
 
-	// Get guild info
-	guild, err := s.Guild(i.GuildID)
-	if err != nil {
-		log.Printf("Error getting guild: %v", err)
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &[]string{"Sorry, I encountered an error."}[0],
+	if queryTooShort(query, h.cfg.Bot.MinQueryLength) {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{shortQueryReply}[0],
+		})
+		return
+	}
+
+	if reply, over := h.overBudget(user.ID); over {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &reply,
 		})
 		return
 	}
 
+	// Get guild info
+	guildName := h.guildName(s, i.GuildID)
+
 	// Get relevant context using RAG
-	context, err := h.rag.SearchRelevantContext(query, i.GuildID, 5)
+	timeRange := resolveTimeRange(query, since, time.Now())
+	retrieved, err := h.rag.SearchContextInRange(ctx, query, i.GuildID, i.ChannelID, h.channelCategory(s, i.ChannelID), 5, timeRange)
 	if err != nil {
 		log.Printf("Error getting context: %v", err)
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		h.editResponse(s, i, &discordgo.WebhookEdit{
 			Content: &[]string{"Sorry, I encountered an error while searching for context."}[0],
 		})
 		return
 	}
 
 	// Generate AI response
-	response, err := h.rag.GenerateResponse(query, context, i.Member.User.Username, guild.Name)
+	response, err := h.rag.GenerateResponse(ctx, query, retrieved, user.Username, i.GuildID, guildName)
 	if err != nil {
 		log.Printf("Error generating response: %v", err)
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		h.editResponse(s, i, &discordgo.WebhookEdit{
 			Content: &[]string{"Sorry, I encountered an error while generating a response."}[0],
 		})
 		return
 	}
-
-	// Send text response
-	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-		Content: &response,
+	response = h.answerInteraction(s, i, query, response, &responseState{
+		Query:     query,
+		Context:   retrieved,
+		GuildID:   i.GuildID,
+		GuildName: guildName,
 	})
 
 	// Check if we have a voice connection for this guild
-	h.voiceManager.mu.RLock()
-	vc, hasVoiceConnection := h.voiceManager.connections[i.GuildID]
-	h.voiceManager.mu.RUnlock()
+	vc, hasVoiceConnection := h.voiceManager.connection(i.GuildID)
 
-	// Generate and send voice response if in a voice channel
-	if hasVoiceConnection && vc != nil {
+	// Generate and send voice response if in a voice channel, outside quiet hours
+	if hasVoiceConnection && vc != nil && !h.inQuietHours(i.GuildID, time.Now()) {
 		// Generate TTS audio and send to voice channel
-		ttsAudio, err := h.rag.AI.TextToSpeech(response)
+		clips, err := h.synthesize(ctx, response, "")
 		if err != nil {
 			log.Printf("Error generating TTS audio: %v", err)
 		} else {
 			// Send the TTS audio to the voice channel in a goroutine
 			go func() {
-				if err := h.voiceManager.SendAudio(vc, ttsAudio); err != nil {
+				if err := h.voiceManager.speakResponse(vc, response, clips); err != nil {
 					log.Printf("Error sending audio: %v", err)
 				}
 			}()
@@ -464,8 +983,8 @@ func (h *BotHandler) handleAIInteraction(s *discordgo.Session, i *discordgo.Inte
 
 	// Log interaction
 	interaction := &models.BotInteraction{
-		UserID:    i.Member.User.ID,
-		Username:  i.Member.User.Username,
+		UserID:    user.ID,
+		Username:  user.Username,
 		Query:     query,
 		Response:  response,
 		ChannelID: i.ChannelID,
@@ -473,7 +992,38 @@ func (h *BotHandler) handleAIInteraction(s *discordgo.Session, i *discordgo.Inte
 		Timestamp: time.Now(),
 	}
 
-	if err := h.db.Create(interaction).Error; err != nil {
+	if err := h.rag.StoreInteraction(ctx, interaction); err != nil {
 		log.Printf("Error logging interaction: %v", err)
 	}
 }
+
+// answerInteraction finishes a generated answer to an /ai question and
+// posts it with regenerate and sources buttons, in a new thread if thread
+// replies are enabled and otherwise as the interaction response. It returns
+// the answer as sent, which is the fallback reply if the model's answer
+// came back empty.
+func (h *BotHandler) answerInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, query, response string, state *responseState) string {
+	response = h.finishResponse(response)
+
+	components := responseComponents(h.responses.put(state))
+	content := appendFooter(response, h.responseFooter(i.GuildID))
+	threadID := h.interactionThread(s, i, query)
+	var err error
+	if threadID != "" {
+		_, err = h.sendMessage(s, threadID, &discordgo.MessageSend{
+			Content:    content,
+			Components: components,
+		})
+		if err != nil {
+			log.Printf("Error sending answer to thread %s: %v", threadID, err)
+		}
+	}
+	if threadID == "" || err != nil {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content:         &content,
+			Components:      &components,
+			AllowedMentions: noMassMentions(),
+		})
+	}
+	return response
+}
@@ -0,0 +1,614 @@
+package bot
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/config"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func newTestSpeechHandler(synthesizer ai.Synthesizer) *BotHandler {
+	return &BotHandler{
+		cfg: &config.Config{AI: config.AIConfig{
+			TTSVoice:          "alloy",
+			TTSSpeed:          1.25,
+			TTSLanguageVoices: map[string]string{"fr": "nova"},
+		}},
+		synthesizer: synthesizer,
+	}
+}
+
+func TestSynthesizeUsesProviderFormat(t *testing.T) {
+	synthesizer := &mockSynthesizer{format: ai.AudioFormatWAV}
+	h := newTestSpeechHandler(synthesizer)
+
+	clips, err := h.synthesize(context.Background(), "Bonjour tout le monde.", "FR")
+	if err != nil {
+		t.Fatalf("synthesize: %v", err)
+	}
+	if len(clips) != 1 || clips[0].format != ai.AudioFormatWAV || string(clips[0].audio) != "Bonjour tout le monde." {
+		t.Errorf("clips = %+v, want one WAV clip", clips)
+	}
+
+	want := ai.SynthesizeOptions{Voice: "nova", Speed: 1.25}
+	if len(synthesizer.opts) != 1 || synthesizer.opts[0] != want {
+		t.Errorf("options = %+v, want %+v", synthesizer.opts, want)
+	}
+}
+
+func TestSynthesizeDefaultVoice(t *testing.T) {
+	synthesizer := &mockSynthesizer{format: ai.AudioFormatMP3}
+	h := newTestSpeechHandler(synthesizer)
+
+	if _, err := h.synthesize(context.Background(), "Hello.", "de"); err != nil {
+		t.Fatalf("synthesize: %v", err)
+	}
+	if synthesizer.opts[0].Voice != "alloy" {
+		t.Errorf("voice = %q, want the default", synthesizer.opts[0].Voice)
+	}
+}
+
+func TestSynthesizeSplitsLongText(t *testing.T) {
+	synthesizer := &mockSynthesizer{format: ai.AudioFormatOpus}
+	h := newTestSpeechHandler(synthesizer)
+	text := strings.Repeat("This sentence is one of many. ", 300)
+
+	clips, err := h.synthesize(context.Background(), text, "")
+	if err != nil {
+		t.Fatalf("synthesize: %v", err)
+	}
+	if len(clips) < 2 {
+		t.Fatalf("got %d clips, want the text split", len(clips))
+	}
+
+	var joined []string
+	for _, clip := range clips {
+		if len(clip.audio) > ai.MaxSpeechChars {
+			t.Errorf("clip of %d chars is over the limit", len(clip.audio))
+		}
+		joined = append(joined, strings.TrimSpace(string(clip.audio)))
+	}
+	if got := strings.Join(joined, " "); got != strings.TrimSpace(text) {
+		t.Error("clips don't hold the text in order")
+	}
+}
+
+func TestSynthesizeSkipsInvalidAudio(t *testing.T) {
+	text := strings.Repeat("First part of the answer. ", 200) + strings.Repeat("Second part of the answer. ", 200)
+	chunks := ai.SplitSpeechText(text, ai.MaxSpeechChars)
+	if len(chunks) < 2 {
+		t.Fatalf("test text split into %d chunks, want several", len(chunks))
+	}
+
+	synthesizer := &mockSynthesizer{format: ai.AudioFormatMP3, invalid: map[string]bool{chunks[0]: true}}
+	clips, err := newTestSpeechHandler(synthesizer).synthesize(context.Background(), text, "")
+	if err != nil {
+		t.Fatalf("synthesize: %v", err)
+	}
+	if len(clips) != len(chunks)-1 {
+		t.Errorf("got %d clips, want %d without the invalid one", len(clips), len(chunks)-1)
+	}
+
+	synthesizer = &mockSynthesizer{format: ai.AudioFormatMP3, invalid: map[string]bool{"Hi.": true}}
+	if _, err := newTestSpeechHandler(synthesizer).synthesize(context.Background(), "Hi.", ""); !errors.Is(err, ai.ErrInvalidAudio) {
+		t.Errorf("synthesize error = %v, want ErrInvalidAudio when nothing is playable", err)
+	}
+}
+
+func TestSynthesizeError(t *testing.T) {
+	synthesizer := &mockSynthesizer{err: errors.New("provider down")}
+	if _, err := newTestSpeechHandler(synthesizer).synthesize(context.Background(), "Hello.", ""); err == nil {
+		t.Error("synthesize succeeded although the provider failed")
+	}
+}
+
+func TestSetSessionResolvesBotID(t *testing.T) {
+	s, fake := newFakeSession(t)
+	s.State.User = nil
+	h := &BotHandler{cfg: &config.Config{}}
+
+	h.SetSession(s)
+	if len(fake.find(http.MethodGet, "users/@me")) != 1 {
+		t.Fatalf("requests = %+v, want the bot user to be fetched", fake.calls())
+	}
+	if id := h.currentBotID(nil); id != "bot" {
+		t.Errorf("currentBotID = %q, want it resolved before any event", id)
+	}
+}
+
+func TestCurrentBotIDFallsBackToState(t *testing.T) {
+	h := &BotHandler{}
+	if id := h.currentBotID(nil); id != "" {
+		t.Errorf("currentBotID without a session = %q, want \"\"", id)
+	}
+	if id := h.currentBotID(&discordgo.Session{State: discordgo.NewState()}); id != "" {
+		t.Errorf("currentBotID without a state user = %q, want \"\"", id)
+	}
+
+	s, _ := newFakeSession(t)
+	if id := h.currentBotID(s); id != "bot" {
+		t.Errorf("currentBotID = %q, want the state user", id)
+	}
+	if id := h.currentBotID(nil); id != "bot" {
+		t.Errorf("currentBotID after the fallback = %q, want it remembered", id)
+	}
+
+	h.onReady(s, &discordgo.Ready{User: &discordgo.User{ID: "renamed"}})
+	if id := h.currentBotID(s); id != "renamed" {
+		t.Errorf("currentBotID after Ready = %q, want the Ready user", id)
+	}
+}
+
+// Until the bot's ID is known, messages are dropped before anything reads
+// the database: the handler has none, so touching it would panic.
+func TestMessageBeforeBotIDIgnored(t *testing.T) {
+	s, fake := newFakeSession(t)
+	s.State.User = nil
+	h := &BotHandler{cfg: &config.Config{Ingest: config.IngestConfig{Messages: true}}}
+
+	h.OnMessageCreate(s, &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "m1",
+		ChannelID: "c1",
+		Content:   "hello?",
+		Author:    &discordgo.User{ID: "u1"},
+	}})
+	if calls := fake.calls(); len(calls) != 0 {
+		t.Errorf("requests = %+v, want none", calls)
+	}
+}
+
+// Events may arrive while Ready fills in the ID; run with -race
+func TestBotIDConcurrentAccess(t *testing.T) {
+	s, _ := newFakeSession(t)
+	h := &BotHandler{}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if id := h.currentBotID(s); id != "bot" {
+				t.Errorf("currentBotID = %q, want \"bot\"", id)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			h.onReady(s, &discordgo.Ready{User: &discordgo.User{ID: "bot"}})
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMentionsBot(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		mentions []*discordgo.User
+		want     bool
+	}{
+		{"user mention", "<@123> hi", nil, true},
+		{"nickname mention", "hi <@!123>", nil, true},
+		{"parsed mention", "hi there", []*discordgo.User{nil, {ID: "123"}}, true},
+		{"other user", "<@1234> hi", []*discordgo.User{{ID: "1234"}}, false},
+		{"role mention", "<@&123> hi", nil, false},
+		{"no mention", "123 hi", nil, false},
+	}
+	for _, tt := range tests {
+		m := &discordgo.MessageCreate{Message: &discordgo.Message{Content: tt.content, Mentions: tt.mentions}}
+		if got := mentionsBot(m, "123"); got != tt.want {
+			t.Errorf("%s: mentionsBot = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStripBotMention(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"<@123> what's up?", " what's up?"},
+		{"<@!123> what's up?", " what's up?"},
+		{"<@123> and <@!123> again", " and  again"},
+		{"ask <@1234> and <@&123>", "ask <@1234> and <@&123>"},
+	}
+	for _, tt := range tests {
+		if got := stripBotMention(tt.content, "123"); got != tt.want {
+			t.Errorf("stripBotMention(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestMentionsName(t *testing.T) {
+	tests := []struct {
+		content string
+		name    string
+		want    bool
+	}{
+		{"hey Robo, what's up?", "Robo", true},
+		{"ROBO what's up", "robo", true},
+		{"what do you think robo?", "Robo", true},
+		{"robo", "Robo", true},
+		{"the robot is broken", "Robo", false},
+		{"ask turbo", "Robo", false},
+		{"robo2 is a different bot", "Robo", false},
+		{"turbo robo", "Robo", true},
+		{"hey Éclair!", "éclair", true},
+		{"hey Éclaire", "éclair", false},
+		{"hey Robo", "", false},
+	}
+	for _, tt := range tests {
+		if got := mentionsName(tt.content, tt.name); got != tt.want {
+			t.Errorf("mentionsName(%q, %q) = %v, want %v", tt.content, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestShouldAnswerName(t *testing.T) {
+	tests := []struct {
+		content string
+		name    string
+		want    bool
+	}{
+		{"Robo, when is game night?", "Robo", true},
+		{"the robot said game night is friday", "Robo", false},
+		{"Robo, when is game night?", "", false},
+	}
+	for _, tt := range tests {
+		m := &discordgo.MessageCreate{Message: &discordgo.Message{GuildID: "g1", Content: tt.content}}
+		if got := shouldAnswer(m, "123", tt.name, dmModeMention); got != tt.want {
+			t.Errorf("shouldAnswer(%q) with name %q = %v, want %v", tt.content, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTooShort(t *testing.T) {
+	tests := []struct {
+		query     string
+		minLength int
+		want      bool
+	}{
+		{"hi", 4, true},
+		{"  hi  ", 4, true},
+		{"why?", 4, false},
+		{"où?", 4, true},
+		{"où est", 4, false},
+		{"🤔🤔🤔", 4, true},
+		{"🤔🤔🤔🤔", 4, false},
+		{"", 0, false},
+		{"?", 1, false},
+	}
+	for _, tt := range tests {
+		if got := queryTooShort(tt.query, tt.minLength); got != tt.want {
+			t.Errorf("queryTooShort(%q, %d) = %v, want %v", tt.query, tt.minLength, got, tt.want)
+		}
+	}
+}
+
+// A short query gets the canned reply without any model call; the handler
+// has no retriever, so reaching one would panic
+func TestShortQueryReply(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{MinQueryLength: 4}}, sends: newSendQueue(time.Millisecond)}
+
+	h.handleAIQuery(s, &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "m1",
+		ChannelID: "c1",
+		Content:   "<@!bot> ok?",
+		Author:    &discordgo.User{ID: "u1"},
+	}})
+
+	sends := fake.find(http.MethodPost, "channels/c1/messages")
+	if len(sends) != 1 {
+		t.Fatalf("%d messages sent, want 1", len(sends))
+	}
+	var sent discordgo.MessageSend
+	sends[0].decode(t, &sent)
+	if sent.Content != shortQueryReply {
+		t.Errorf("reply = %q, want the short query reply", sent.Content)
+	}
+}
+
+func TestIntents(t *testing.T) {
+	for _, voice := range []bool{false, true} {
+		intents := Intents(&config.Config{Voice: config.VoiceConfig{Enabled: voice}})
+		for _, required := range []discordgo.Intent{discordgo.IntentsGuilds, discordgo.IntentsGuildMessages, discordgo.IntentsDirectMessages} {
+			if intents&required == 0 {
+				t.Errorf("voice=%v: intents %b lack %b", voice, intents, required)
+			}
+		}
+		if got := intents&discordgo.IntentsGuildVoiceStates != 0; got != voice {
+			t.Errorf("voice=%v: voice state intent requested = %v", voice, got)
+		}
+	}
+}
+
+// registeredCommands returns the names of the commands RegisterCommands
+// creates
+func registeredCommands(t *testing.T, h *BotHandler) []string {
+	t.Helper()
+
+	s, fake := newFakeSession(t)
+	h.session = s
+	if err := h.RegisterCommands(); err != nil {
+		t.Fatalf("RegisterCommands: %v", err)
+	}
+	var names []string
+	for _, req := range fake.find(http.MethodPost, "/commands") {
+		var cmd discordgo.ApplicationCommand
+		req.decode(t, &cmd)
+		names = append(names, cmd.Name)
+	}
+	return names
+}
+
+func TestVoiceFeatureFlag(t *testing.T) {
+	voiceCommands := []string{"join", "leave", "voice-reset", "voice-mode", "voice-prompt", "quiet-hours", "listen"}
+	for _, voice := range []bool{false, true} {
+		h := NewBotHandler(nil, nil, nil, nil, &config.Config{Voice: config.VoiceConfig{Enabled: voice}})
+		if got := h.voiceManager != nil; got != voice {
+			t.Errorf("voice=%v: voice manager created = %v", voice, got)
+		}
+
+		names := registeredCommands(t, h)
+		if !slices.Contains(names, "ai") {
+			t.Errorf("voice=%v: /ai isn't registered: %v", voice, names)
+		}
+		for _, name := range voiceCommands {
+			if got := slices.Contains(names, name); got != voice {
+				t.Errorf("voice=%v: /%s registered = %v", voice, name, got)
+			}
+		}
+	}
+}
+
+func TestVoiceCommandsWhenDisabled(t *testing.T) {
+	h := NewBotHandler(nil, nil, nil, nil, &config.Config{})
+	for _, name := range []string{"join", "leave", "listen"} {
+		s, fake := newFakeSession(t)
+		i := commandInteraction(name)
+		i.GuildID = ""
+		h.handleInteraction(s, i)
+
+		responses := fake.find(http.MethodPost, "/callback")
+		if len(responses) != 1 {
+			t.Fatalf("/%s: %d responses, want 1", name, len(responses))
+		}
+		var response discordgo.InteractionResponse
+		responses[0].decode(t, &response)
+		if response.Data == nil || !strings.Contains(response.Data.Content, "Voice is disabled") {
+			t.Errorf("/%s with voice disabled answered %+v", name, response.Data)
+		}
+	}
+	if vc, ok := h.voiceManager.connection("g1"); ok || vc != nil {
+		t.Error("a nil voice manager reported a connection")
+	}
+}
+
+func TestShouldAnswerDMMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		guildID string
+		content string
+		dmMode  string
+		want    bool
+	}{
+		{"DM", "", "what's up?", "always", true},
+		{"DM with mode unset", "", "what's up?", "", true},
+		{"DM in mention mode", "", "what's up?", dmModeMention, false},
+		{"DM mention in mention mode", "", "<@123> what's up?", dmModeMention, true},
+		{"DM /ai prefix in mention mode", "", "/ai what's up?", dmModeMention, true},
+		{"guild message", "g1", "what's up?", "always", false},
+		{"guild mention", "g1", "<@123> what's up?", dmModeMention, true},
+		{"guild /ai prefix", "g1", "/ai what's up?", "always", true},
+		{"bare /ai in mention mode", "", "/ai", dmModeMention, false},
+	}
+	for _, tt := range tests {
+		m := &discordgo.MessageCreate{Message: &discordgo.Message{GuildID: tt.guildID, Content: tt.content}}
+		if got := shouldAnswer(m, "123", "", tt.dmMode); got != tt.want {
+			t.Errorf("%s: shouldAnswer = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGuildNameFallback(t *testing.T) {
+	h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{FallbackGuildName: "this server"}}}
+	tests := []struct {
+		name     string
+		guildID  string
+		state    *discordgo.Guild
+		apiFails bool
+		want     string
+		apiCalls int
+	}{
+		{"direct message", "", nil, false, "this server", 0},
+		{"cached", "g1", &discordgo.Guild{ID: "g1", Name: "Game Club"}, false, "Game Club", 0},
+		{"cached without a name", "g1", &discordgo.Guild{ID: "g1"}, false, "API guild", 1},
+		{"not cached", "g1", nil, false, "API guild", 1},
+		{"lookup fails", "g1", nil, true, "this server", 1},
+	}
+	for _, tt := range tests {
+		s, fake := newFakeSession(t)
+		if tt.state != nil {
+			s.State.GuildAdd(tt.state)
+		}
+		if tt.apiFails {
+			fake.fail = func(fakeRequest) int { return http.StatusNotFound }
+		}
+
+		if got := h.guildName(s, tt.guildID); got != tt.want {
+			t.Errorf("%s: guildName = %q, want %q", tt.name, got, tt.want)
+		}
+		if calls := len(fake.find(http.MethodGet, "guilds/g1")); calls != tt.apiCalls {
+			t.Errorf("%s: %d guild lookups, want %d", tt.name, calls, tt.apiCalls)
+		}
+	}
+}
+
+func TestChannelCategory(t *testing.T) {
+	s, fake := newFakeSession(t)
+	s.State.GuildAdd(&discordgo.Guild{ID: "g1", Channels: []*discordgo.Channel{
+		{ID: "games", GuildID: "g1", Type: discordgo.ChannelTypeGuildCategory},
+		{ID: "c1", GuildID: "g1", Type: discordgo.ChannelTypeGuildText, ParentID: "games"},
+		{ID: "c2", GuildID: "g1", Type: discordgo.ChannelTypeGuildText},
+	}})
+	s.State.ChannelAdd(&discordgo.Channel{ID: "t1", GuildID: "g1", Type: discordgo.ChannelTypeGuildPublicThread, ParentID: "c1"})
+	s.State.ChannelAdd(&discordgo.Channel{ID: "t2", GuildID: "g1", Type: discordgo.ChannelTypeGuildPublicThread, ParentID: "gone"})
+	fake.fail = func(fakeRequest) int { return http.StatusNotFound }
+	h := &BotHandler{}
+
+	tests := []struct {
+		channelID string
+		want      string
+	}{
+		{"c1", "games"},
+		{"c2", ""},
+		// Threads take their parent channel's category
+		{"t1", "games"},
+		{"t2", ""},
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		if got := h.channelCategory(s, tt.channelID); got != tt.want {
+			t.Errorf("channelCategory(%s) = %q, want %q", tt.channelID, got, tt.want)
+		}
+	}
+}
+
+// commandOption returns a slash command option as Discord sends it
+func commandOption(name string, kind discordgo.ApplicationCommandOptionType, value interface{}) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: kind, Value: value}
+}
+
+func TestStringOption(t *testing.T) {
+	question := commandOption("question", discordgo.ApplicationCommandOptionString, "when is game night")
+	since := commandOption("since", discordgo.ApplicationCommandOptionString, "last week")
+	tests := []struct {
+		name      string
+		options   []*discordgo.ApplicationCommandInteractionDataOption
+		want      string
+		wantFound bool
+		wantErr   bool
+	}{
+		{"only option", []*discordgo.ApplicationCommandInteractionDataOption{question}, "when is game night", true, false},
+		{"out of order", []*discordgo.ApplicationCommandInteractionDataOption{since, question}, "when is game night", true, false},
+		{"missing", []*discordgo.ApplicationCommandInteractionDataOption{since}, "", false, false},
+		{"no options", nil, "", false, false},
+		{"renamed", []*discordgo.ApplicationCommandInteractionDataOption{
+			commandOption("query", discordgo.ApplicationCommandOptionString, "when is game night"),
+		}, "", false, false},
+		{"wrong type", []*discordgo.ApplicationCommandInteractionDataOption{
+			commandOption("question", discordgo.ApplicationCommandOptionInteger, float64(3)),
+		}, "", true, true},
+		{"non-string value", []*discordgo.ApplicationCommandInteractionDataOption{
+			commandOption("question", discordgo.ApplicationCommandOptionString, float64(3)),
+		}, "", true, true},
+	}
+	for _, tt := range tests {
+		got, found, err := stringOption(tt.options, "question")
+		if got != tt.want || found != tt.wantFound || (err != nil) != tt.wantErr {
+			t.Errorf("%s: stringOption = %q, %v, %v, want %q, %v (error %v)", tt.name, got, found, err, tt.want, tt.wantFound, tt.wantErr)
+		}
+	}
+}
+
+// /ai reads its options by name and refuses ones it can't read before any
+// lookup; the handler has no database or retriever, so reaching one would
+// panic
+func TestAIInteractionOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		want    string
+	}{
+		{"missing", nil, "Please provide a question!"},
+		{"renamed", []*discordgo.ApplicationCommandInteractionDataOption{
+			commandOption("query", discordgo.ApplicationCommandOptionString, "when is game night"),
+		}, "Please provide a question!"},
+		{"wrong type", []*discordgo.ApplicationCommandInteractionDataOption{
+			commandOption("question", discordgo.ApplicationCommandOptionInteger, float64(3)),
+		}, "don't look right"},
+		{"wrong type since", []*discordgo.ApplicationCommandInteractionDataOption{
+			commandOption("question", discordgo.ApplicationCommandOptionString, "when is game night"),
+			commandOption("since", discordgo.ApplicationCommandOptionBoolean, true),
+		}, "don't look right"},
+		{"out of order", []*discordgo.ApplicationCommandInteractionDataOption{
+			commandOption("since", discordgo.ApplicationCommandOptionString, "a very long time ago"),
+			commandOption("question", discordgo.ApplicationCommandOptionString, "ok?"),
+		}, shortQueryReply},
+	}
+	for _, tt := range tests {
+		s, fake := newFakeSession(t)
+		h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{MinQueryLength: 4}}}
+		h.handleAIInteraction(s, commandInteraction("ai", tt.options...))
+
+		if got := editedContent(t, fake); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: reply = %q, want it to contain %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Commands that act for the invoking user refuse an interaction without
+// one instead of panicking
+func TestInteractionWithoutUser(t *testing.T) {
+	text := commandOption("text", discordgo.ApplicationCommandOptionString, "nice bot")
+	question := commandOption("question", discordgo.ApplicationCommandOptionString, "when is game night")
+	h := &BotHandler{cfg: &config.Config{}}
+	tests := []struct {
+		name   string
+		handle func(*discordgo.Session, *discordgo.InteractionCreate)
+		i      *discordgo.InteractionCreate
+	}{
+		{"ai", h.handleAIInteraction, commandInteraction("ai", question)},
+		{"feedback", h.handleFeedbackInteraction, commandInteraction("feedback", text)},
+		{"history", h.handleHistoryInteraction, commandInteraction("history")},
+		{"regenerate", h.handleRegenerateInteraction, commandInteraction("regenerate")},
+		{"join", h.handleJoinInteraction, commandInteraction("join")},
+	}
+	for _, tt := range tests {
+		s, fake := newFakeSession(t)
+		tt.i.Member = nil
+		tt.handle(s, tt.i)
+
+		if got := editedContent(t, fake); got != unknownUserReply {
+			t.Errorf("%s: reply = %q, want the unknown user reply", tt.name, got)
+		}
+	}
+}
+
+func TestInteractionUsername(t *testing.T) {
+	i := commandInteraction("footer")
+	if got := interactionUsername(i); got != "ann" {
+		t.Errorf("guild interactionUsername = %q, want ann", got)
+	}
+	i.Member = nil
+	i.User = &discordgo.User{ID: "u1", Username: "bob"}
+	if got := interactionUsername(i); got != "bob" {
+		t.Errorf("DM interactionUsername = %q, want bob", got)
+	}
+	i.User = nil
+	if got := interactionUsername(i); got == "" {
+		t.Error("interactionUsername without a user is empty")
+	}
+}
+
+// A /footer text of the wrong type is refused before the settings are
+// loaded rather than panicking in StringValue
+func TestFooterInteractionWrongType(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{}}
+	i := commandInteraction("footer", commandOption("text", discordgo.ApplicationCommandOptionInteger, float64(3)))
+	i.Member.Permissions = discordgo.PermissionManageServer
+
+	h.handleFooterInteraction(s, i)
+	if got := editedContent(t, fake); !strings.Contains(got, "don't look right") {
+		t.Errorf("reply = %q, want the invalid options reply", got)
+	}
+}
@@ -0,0 +1,174 @@
+// internal/bot/history.go
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	componentHistory = "history"
+
+	// historyPageSize is how many interactions one history page shows
+	historyPageSize = 5
+)
+
+func historyCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:         "history",
+		Description:  "Show your recent questions to the bot in this server",
+		DMPermission: &dmPermission,
+	}
+}
+
+// historyPageID encodes the owner and page of a history button as the part
+// after "history:" in its custom ID
+func historyPageID(userID string, page int) string {
+	return userID + ":" + strconv.Itoa(page)
+}
+
+// parseHistoryPageID reverses historyPageID
+func parseHistoryPageID(id string) (userID string, page int, ok bool) {
+	userID, pageText, ok := strings.Cut(id, ":")
+	if !ok || userID == "" {
+		return "", 0, false
+	}
+	page, err := strconv.Atoi(pageText)
+	if err != nil || page < 0 {
+		return "", 0, false
+	}
+	return userID, page, true
+}
+
+// historyPageCount is how many pages total interactions span, at least one
+func historyPageCount(total int64) int {
+	pages := int((total + historyPageSize - 1) / historyPageSize)
+	if pages < 1 {
+		return 1
+	}
+	return pages
+}
+
+func (h *BotHandler) handleHistoryInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	user := interactionUser(i)
+	if user == nil {
+		h.editInteraction(s, i, unknownUserReply)
+		return
+	}
+	embed, components, err := h.historyPage(i.GuildID, user, 0)
+	if err != nil {
+		log.Printf("Error loading history for user %s: %v", user.ID, err)
+		h.editInteraction(s, i, "❌ Sorry, I couldn't load your history.")
+		return
+	}
+
+	h.editResponse(s, i, &discordgo.WebhookEdit{
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+	})
+}
+
+// handleHistoryComponent turns the page of a history message
+func (h *BotHandler) handleHistoryComponent(s *discordgo.Session, i *discordgo.InteractionCreate, id string) {
+	userID, page, ok := parseHistoryPageID(id)
+	user := interactionUser(i)
+	if !ok || user == nil || user.ID != userID {
+		log.Printf("Ignoring history button %q", id)
+		return
+	}
+
+	embed, components, err := h.historyPage(i.GuildID, user, page)
+	if err != nil {
+		log.Printf("Error loading history for user %s: %v", user.ID, err)
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+	}
+}
+
+// historyPage renders one page of a user's history with prev/next buttons.
+// Pages past the end show the last page.
+func (h *BotHandler) historyPage(guildID string, user *discordgo.User, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent, error) {
+	interactions, total, err := h.db.GetUserInteractions(guildID, user.ID, page*historyPageSize, historyPageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pages := historyPageCount(total)
+	if page >= pages {
+		page = pages - 1
+		interactions, total, err = h.db.GetUserInteractions(guildID, user.ID, page*historyPageSize, historyPageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:  fmt.Sprintf("📜 %s's questions", user.Username),
+		Footer: &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d · %d total", page+1, pages, total)},
+	}
+	if len(interactions) == 0 {
+		embed.Description = "You haven't asked me anything here yet."
+	}
+	for _, interaction := range interactions {
+		embed.Fields = append(embed.Fields, historyField(interaction))
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: componentHistory + ":" + historyPageID(user.ID, page-1),
+					Disabled: page == 0,
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: componentHistory + ":" + historyPageID(user.ID, page+1),
+					Disabled: page+1 >= pages,
+				},
+			},
+		},
+	}
+	return embed, components, nil
+}
+
+// historyField renders one interaction. Text redacted by the interaction
+// logging mode is shown as not stored.
+func historyField(interaction models.BotInteraction) *discordgo.MessageEmbedField {
+	query, response := interaction.Query, interaction.Response
+	if query == "" || strings.HasPrefix(query, "sha256:") {
+		query = "(not stored)"
+	}
+	if response == "" || strings.HasPrefix(response, "sha256:") {
+		response = "(not stored)"
+	}
+
+	return &discordgo.MessageEmbedField{
+		Name:  truncateMessage(fmt.Sprintf("%s · %s", interaction.Timestamp.Format(time.DateTime), query), 256),
+		Value: truncateMessage(response, 1024),
+	}
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestHistoryPageIDRoundTrip(t *testing.T) {
+	for _, page := range []int{0, 1, 12} {
+		userID, got, ok := parseHistoryPageID(historyPageID("u1", page))
+		if !ok || userID != "u1" || got != page {
+			t.Errorf("parseHistoryPageID(historyPageID(u1, %d)) = %q, %d, %v", page, userID, got, ok)
+		}
+	}
+}
+
+func TestParseHistoryPageIDInvalid(t *testing.T) {
+	// A "previous" button on the first page encodes page -1
+	for _, id := range []string{"", "u1", ":1", "u1:", "u1:next", "u1:-1"} {
+		if _, _, ok := parseHistoryPageID(id); ok {
+			t.Errorf("parseHistoryPageID(%q) succeeded, want it rejected", id)
+		}
+	}
+}
+
+func TestHistoryPageCount(t *testing.T) {
+	tests := []struct {
+		total int64
+		want  int
+	}{
+		{0, 1},
+		{1, 1},
+		{historyPageSize, 1},
+		{historyPageSize + 1, 2},
+		{3 * historyPageSize, 3},
+	}
+	for _, tt := range tests {
+		if got := historyPageCount(tt.total); got != tt.want {
+			t.Errorf("historyPageCount(%d) = %d, want %d", tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryFieldRedacted(t *testing.T) {
+	at := time.Date(2024, 3, 15, 18, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		interaction models.BotInteraction
+		wantName    string
+		wantValue   string
+	}{
+		{"stored", models.BotInteraction{Query: "when?", Response: "friday", Timestamp: at}, "2024-03-15 18:30:00 · when?", "friday"},
+		{"hashed", models.BotInteraction{Query: "sha256:abc", Response: "sha256:def", Timestamp: at}, "2024-03-15 18:30:00 · (not stored)", "(not stored)"},
+		{"dropped", models.BotInteraction{Timestamp: at}, "2024-03-15 18:30:00 · (not stored)", "(not stored)"},
+	}
+	for _, tt := range tests {
+		field := historyField(tt.interaction)
+		if field.Name != tt.wantName || field.Value != tt.wantValue {
+			t.Errorf("%s: historyField = %q: %q, want %q: %q", tt.name, field.Name, field.Value, tt.wantName, tt.wantValue)
+		}
+	}
+}
+
+// History buttons only turn the page for the user whose history it is,
+// and are rejected before the database is queried
+func TestHistoryComponentIgnoresOthers(t *testing.T) {
+	for _, id := range []string{historyPageID("u2", 1), "u1:-1", "garbage"} {
+		s, fake := newFakeSession(t)
+		h := &BotHandler{}
+		h.handleHistoryComponent(s, componentInteraction(componentHistory+":"+id), id)
+		if calls := fake.find(http.MethodPost, "/callback"); len(calls) != 0 {
+			t.Errorf("history button %q by u1 answered with %+v, want it ignored", id, calls)
+		}
+	}
+
+	// A click without a user can't be matched to the history's owner
+	s, _ := newFakeSession(t)
+	i := componentInteraction(componentHistory + ":" + historyPageID("u1", 1))
+	i.Member = &discordgo.Member{}
+	(&BotHandler{}).handleHistoryComponent(s, i, historyPageID("u1", 1))
+}
@@ -0,0 +1,155 @@
+// internal/bot/ingest.go
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	urlPattern         = regexp.MustCompile(`https?://\S+`)
+	customEmojiPattern = regexp.MustCompile(`<a?:\w+:\d+>`)
+	invitePattern      = regexp.MustCompile(`(?i)(discord\.gg|discord(app)?\.com/invite)/\w+`)
+	spamPhrasePattern  = regexp.MustCompile(`(?i)free\s+nitro|steam\s*gift|claim\s+your\s+(prize|reward|gift)`)
+)
+
+// ingestFilter decides which messages are worth storing for retrieval
+type ingestFilter struct {
+	cfg config.IngestConfig
+}
+
+func newIngestFilter(cfg config.IngestConfig) *ingestFilter {
+	return &ingestFilter{cfg: cfg}
+}
+
+// skipReason returns why content should not be ingested, or "" to keep it
+func (f *ingestFilter) skipReason(content string) string {
+	trimmed := strings.TrimSpace(content)
+
+	if len(trimmed) < f.cfg.MinLength {
+		return "too short"
+	}
+
+	if f.cfg.SkipCommands && isBotCommand(trimmed, f.cfg.CommandPrefixes) {
+		return "bot command"
+	}
+
+	if f.cfg.SkipURLOnly && isURLOnly(trimmed) {
+		return "URL only"
+	}
+
+	if f.cfg.SkipEmojiOnly && isEmojiOnly(trimmed) {
+		return "emoji only"
+	}
+
+	if f.cfg.SkipSpam && isSpam(trimmed) {
+		return "spam"
+	}
+
+	return ""
+}
+
+// skipAuthor reports whether messages by author should not be ingested
+// because it is an untrusted bot
+func (f *ingestFilter) skipAuthor(author *discordgo.User) bool {
+	if !f.cfg.SkipBots || author == nil || !author.Bot {
+		return false
+	}
+	for _, trusted := range f.cfg.TrustedBots {
+		if author.ID == trusted {
+			return false
+		}
+	}
+	return true
+}
+
+// storedContent is a message's content as stored for retrieval. Role and
+// channel mentions are resolved to names, if configured, so the model sees
+// "#general" rather than a raw ID it can't interpret. User mentions stay
+// raw: the context names them at query time under the guild's author
+// naming mode, which a stored username would bypass.
+func (f *ingestFilter) storedContent(s *discordgo.Session, m *discordgo.Message) string {
+	if !f.cfg.ResolveMentions {
+		return m.Content
+	}
+	withoutUsers := *m
+	withoutUsers.Mentions = nil
+	content, _ := withoutUsers.ContentWithMoreMentionsReplaced(s)
+	return content
+}
+
+// isBotCommand reports whether content starts with a command prefix directly
+// followed by a letter (so "?!" or "... anyway" are not treated as commands)
+func isBotCommand(content string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		rest, ok := strings.CutPrefix(content, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if r := []rune(rest)[0]; unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isURLOnly(content string) bool {
+	if !urlPattern.MatchString(content) {
+		return false
+	}
+	return strings.TrimSpace(urlPattern.ReplaceAllString(content, "")) == ""
+}
+
+func isEmojiOnly(content string) bool {
+	stripped := customEmojiPattern.ReplaceAllString(content, "")
+	for _, r := range stripped {
+		switch {
+		case unicode.IsSpace(r):
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Sk, r):
+		case r == '\u200d', r == '\ufe0f', unicode.Is(unicode.Mn, r):
+			// Zero-width joiners, variation selectors and skin tone modifiers
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isSpam(content string) bool {
+	if invitePattern.MatchString(content) || spamPhrasePattern.MatchString(content) {
+		return true
+	}
+
+	// Long runs of the same character ("aaaaaaaaaaaa", "!!!!!!!!!!!!")
+	run := 1
+	var prev rune
+	for i, r := range content {
+		if i > 0 && r == prev {
+			run++
+			if run >= 10 {
+				return true
+			}
+		} else {
+			run = 1
+		}
+		prev = r
+	}
+
+	// The same word repeated over and over
+	words := strings.Fields(strings.ToLower(content))
+	if len(words) >= 5 {
+		counts := make(map[string]int)
+		for _, w := range words {
+			counts[w]++
+			if counts[w]*10 >= len(words)*7 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
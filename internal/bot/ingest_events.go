@@ -0,0 +1,192 @@
+// internal/bot/ingest_events.go
+package bot
+
+import (
+	"discord-rag-bot/internal/models"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// pinnedPrefix marks stored messages that were ingested because they were
+// pinned, which usually makes them more authoritative
+const pinnedPrefix = "(pinned) "
+
+// ingestChannel reports whether messages from a channel are stored, given
+// whether the bot is enabled there
+func (h *BotHandler) ingestChannel(enabled bool) bool {
+	return enabled || h.cfg.Bot.IngestDisabledChannels
+}
+
+// normalizeMessage turns a Discord message into a row for the store, with
+// prefix prepended to its content
+func (h *BotHandler) normalizeMessage(channel *discordgo.Channel, m *discordgo.Message, prefix string) *models.DiscordMessage {
+	guildID := m.GuildID
+	if guildID == "" {
+		// Messages fetched over REST don't carry their guild
+		guildID = channel.GuildID
+	}
+	return &models.DiscordMessage{
+		MessageID:   m.ID,
+		Content:     prefix + h.ingest.storedContent(h.session, m),
+		Author:      m.Author.ID,
+		Username:    m.Author.Username,
+		ChannelID:   channel.ID,
+		ChannelName: channel.Name,
+		CategoryID:  h.categoryOf(h.session, channel),
+		GuildID:     guildID,
+		GuildName:   h.guildName(h.session, guildID),
+		Timestamp:   m.Timestamp,
+	}
+}
+
+// normalizeThread turns a new thread or forum post into a row holding its
+// title. The row is keyed by the thread ID, which is distinct from the ID
+// of its first message, so both are kept.
+func (h *BotHandler) normalizeThread(thread *discordgo.Channel, owner *discordgo.User) *models.DiscordMessage {
+	message := &models.DiscordMessage{
+		MessageID:   "thread:" + thread.ID,
+		Content:     thread.Name,
+		ChannelID:   thread.ID,
+		ChannelName: thread.Name,
+		CategoryID:  h.categoryOf(h.session, thread),
+		GuildID:     thread.GuildID,
+		GuildName:   h.guildName(h.session, thread.GuildID),
+		Timestamp:   time.Now(),
+	}
+	if created, err := discordgo.SnowflakeTimestamp(thread.ID); err == nil {
+		message.Timestamp = created
+	}
+	if owner != nil {
+		message.Author = owner.ID
+		message.Username = owner.Username
+	}
+	return message
+}
+
+// onThreadCreate stores the titles of newly created threads and forum posts
+func (h *BotHandler) onThreadCreate(s *discordgo.Session, t *discordgo.ThreadCreate) {
+	if !t.NewlyCreated || t.Channel == nil {
+		return // Threads the bot just gained access to aren't new
+	}
+	if h.ingest.skipReason(t.Name) != "" {
+		return
+	}
+	if !h.ingestChannel(h.channelEnabled(t.GuildID, t.ParentID)) {
+		return
+	}
+
+	if t.OwnerID == h.currentBotID(s) {
+		return // Threads the bot opens for its answers
+	}
+	owner := lookupUser(s, t.GuildID, t.OwnerID)
+	if h.ingest.skipAuthor(owner) {
+		return
+	}
+
+	go h.persistMessage(h.normalizeThread(t.Channel, owner))
+}
+
+// onChannelPinsUpdate stores a message again when it is pinned, marked as
+// pinned. The event doesn't say which message changed, so the most
+// recently pinned one is fetched; unpinning re-stores it unchanged.
+func (h *BotHandler) onChannelPinsUpdate(s *discordgo.Session, p *discordgo.ChannelPinsUpdate) {
+	if p.GuildID == "" || p.LastPinTimestamp == "" {
+		return // DMs, or the last pin was removed
+	}
+	if !h.ingestChannel(h.channelEnabled(p.GuildID, p.ChannelID)) {
+		return
+	}
+
+	go func() {
+		pins, err := s.ChannelMessagesPinned(p.ChannelID)
+		if err != nil {
+			log.Printf("Error fetching pinned messages in %s: %v", p.ChannelID, err)
+			return
+		}
+		if len(pins) == 0 {
+			return
+		}
+
+		pinned := pins[0]
+		if pinned.Author == nil || ownMessage(pinned, h.currentBotID(s)) || h.ingest.skipAuthor(pinned.Author) {
+			return
+		}
+		if h.ingest.skipReason(pinned.Content) != "" {
+			return
+		}
+
+		channel, err := lookupChannel(s, p.ChannelID)
+		if err != nil {
+			log.Printf("Error getting channel info: %v", err)
+			return
+		}
+		h.persistMessage(h.normalizeMessage(channel, pinned, pinnedPrefix))
+	}()
+}
+
+// onMessageUpdate keeps a stored message in step with its edits. Content
+// edited so it no longer meets the ingestion criteria deletes the stored
+// row, so the embedding of the old content stops being retrieved.
+func (h *BotHandler) onMessageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	if m.Message == nil || m.Author == nil || m.EditedTimestamp == nil {
+		return // Embeds being unfurled, not an edit
+	}
+	if ownMessage(m.Message, h.currentBotID(s)) || h.ingest.skipAuthor(m.Author) {
+		return
+	}
+	if !h.ingestChannel(h.channelEnabled(m.GuildID, m.ChannelID)) {
+		return
+	}
+
+	prefix := ""
+	if m.Pinned && h.cfg.Ingest.Pins {
+		prefix = pinnedPrefix
+	} else if !h.cfg.Ingest.Messages {
+		return
+	}
+
+	go h.updateMessage(s, m.Message, prefix)
+}
+
+// updateMessage re-stores an edited message, or deletes it if the edit
+// made it too short or otherwise not worth keeping
+func (h *BotHandler) updateMessage(s *discordgo.Session, m *discordgo.Message, prefix string) {
+	if reason := h.ingest.skipReason(m.Content); reason != "" {
+		ctx, cancel := h.requestContext()
+		defer cancel()
+
+		if err := h.rag.DeleteMessages(ctx, m.ID); err != nil {
+			log.Printf("Error deleting message %s after an edit: %v", m.ID, err)
+			return
+		}
+		log.Printf("Deleted stored message %s: edited to be %s", m.ID, reason)
+		return
+	}
+
+	channel, err := lookupChannel(s, m.ChannelID)
+	if err != nil {
+		log.Printf("Error getting channel info: %v", err)
+		return
+	}
+	h.persistMessage(h.normalizeMessage(channel, m, prefix))
+}
+
+// lookupUser finds a guild member's user, preferring the state cache
+func lookupUser(s *discordgo.Session, guildID, userID string) *discordgo.User {
+	if userID == "" {
+		return nil
+	}
+	if s.State != nil {
+		if member, err := s.State.Member(guildID, userID); err == nil && member.User != nil {
+			return member.User
+		}
+	}
+	user, err := s.User(userID)
+	if err != nil {
+		log.Printf("Error getting user %s: %v", userID, err)
+		return nil
+	}
+	return user
+}
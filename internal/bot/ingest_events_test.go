@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/models"
+	"discord-rag-bot/internal/rag"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// newIngestHandler returns a handler with a guild g1 in its session state
+// holding category "games", text channel c1 in it and thread t1 of c1
+func newIngestHandler(t *testing.T, ingest config.IngestConfig) (*BotHandler, *fakeDiscord) {
+	t.Helper()
+	s, fake := newFakeSession(t)
+	s.State.GuildAdd(&discordgo.Guild{ID: "g1", Name: "Game Club", Channels: []*discordgo.Channel{
+		{ID: "games", GuildID: "g1", Type: discordgo.ChannelTypeGuildCategory},
+		{ID: "c1", GuildID: "g1", Name: "general", Type: discordgo.ChannelTypeGuildText, ParentID: "games"},
+	}})
+	s.State.ChannelAdd(&discordgo.Channel{ID: "t1", GuildID: "g1", Name: "Friday plans", Type: discordgo.ChannelTypeGuildPublicThread, ParentID: "c1"})
+	return &BotHandler{
+		cfg:     &config.Config{Ingest: ingest},
+		session: s,
+		ingest:  newIngestFilter(ingest),
+	}, fake
+}
+
+func TestNormalizeMessage(t *testing.T) {
+	h, _ := newIngestHandler(t, config.IngestConfig{})
+	channel, _ := h.session.State.Channel("c1")
+	at := time.Date(2024, 3, 15, 18, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		guildID string
+		prefix  string
+		content string
+	}{
+		{"message", "g1", "", "game night is friday"},
+		// Messages fetched over REST don't carry their guild
+		{"fetched message", "", "", "game night is friday"},
+		{"pinned message", "g1", pinnedPrefix, pinnedPrefix + "game night is friday"},
+	}
+	for _, tt := range tests {
+		m := &discordgo.Message{
+			ID:        "m1",
+			GuildID:   tt.guildID,
+			ChannelID: "c1",
+			Content:   "game night is friday",
+			Author:    &discordgo.User{ID: "u1", Username: "ann"},
+			Timestamp: at,
+		}
+		got := h.normalizeMessage(channel, m, tt.prefix)
+		want := models.DiscordMessage{
+			MessageID:   "m1",
+			Content:     tt.content,
+			Author:      "u1",
+			Username:    "ann",
+			ChannelID:   "c1",
+			ChannelName: "general",
+			CategoryID:  "games",
+			GuildID:     "g1",
+			GuildName:   "Game Club",
+			Timestamp:   at,
+		}
+		if *got != want {
+			t.Errorf("%s: normalizeMessage = %+v, want %+v", tt.name, *got, want)
+		}
+	}
+}
+
+func TestNormalizeThread(t *testing.T) {
+	h, _ := newIngestHandler(t, config.IngestConfig{})
+	created := time.Date(2024, 3, 15, 18, 30, 0, 0, time.UTC)
+	thread := &discordgo.Channel{ID: snowflakeAt(created), GuildID: "g1", Name: "Friday plans", Type: discordgo.ChannelTypeGuildPublicThread, ParentID: "c1"}
+
+	got := h.normalizeThread(thread, &discordgo.User{ID: "u1", Username: "ann"})
+	want := models.DiscordMessage{
+		MessageID:   "thread:" + thread.ID,
+		Content:     "Friday plans",
+		Author:      "u1",
+		Username:    "ann",
+		ChannelID:   thread.ID,
+		ChannelName: "Friday plans",
+		CategoryID:  "games",
+		GuildID:     "g1",
+		GuildName:   "Game Club",
+		Timestamp:   created,
+	}
+	if !got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("thread timestamp = %v, want its creation time %v", got.Timestamp, want.Timestamp)
+	}
+	got.Timestamp = want.Timestamp
+	if *got != want {
+		t.Errorf("normalizeThread = %+v, want %+v", *got, want)
+	}
+
+	// A thread whose owner couldn't be found is stored without an author
+	if got := h.normalizeThread(thread, nil); got.Author != "" || got.Username != "" {
+		t.Errorf("normalizeThread without an owner = %+v, want no author", got)
+	}
+}
+
+func TestLookupUser(t *testing.T) {
+	h, fake := newIngestHandler(t, config.IngestConfig{})
+	h.session.State.MemberAdd(&discordgo.Member{GuildID: "g1", User: &discordgo.User{ID: "u1", Username: "ann"}})
+
+	if user := lookupUser(h.session, "g1", "u1"); user == nil || user.Username != "ann" || len(fake.calls()) != 0 {
+		t.Errorf("lookupUser of a cached member = %+v after %d calls, want it from the state", user, len(fake.calls()))
+	}
+	if user := lookupUser(h.session, "g1", ""); user != nil {
+		t.Errorf("lookupUser without an ID = %+v, want nil", user)
+	}
+
+	fake.fail = func(fakeRequest) int { return http.StatusNotFound }
+	if user := lookupUser(h.session, "g1", "u2"); user != nil || len(fake.find(http.MethodGet, "users/u2")) != 1 {
+		t.Errorf("lookupUser of an unknown user = %+v, want nil after asking the API", user)
+	}
+}
+
+// Threads that aren't new or whose titles wouldn't be ingested are dropped
+// before the database is read; the handler has none, so touching it would
+// panic
+func TestThreadCreateFiltered(t *testing.T) {
+	h, fake := newIngestHandler(t, config.IngestConfig{Threads: true, MinLength: 5})
+	for _, thread := range []*discordgo.ThreadCreate{
+		{Channel: &discordgo.Channel{ID: "t2", GuildID: "g1", Name: "Friday plans", ParentID: "c1"}},
+		{Channel: &discordgo.Channel{ID: "t3", GuildID: "g1", Name: "hi", ParentID: "c1"}, NewlyCreated: true},
+		{NewlyCreated: true},
+	} {
+		h.onThreadCreate(h.session, thread)
+	}
+	if calls := fake.calls(); len(calls) != 0 {
+		t.Errorf("requests = %+v, want none", calls)
+	}
+}
+
+// The bot's own messages, its text answers and the replies it posts for
+// voice questions alike, never enter the store whichever path they arrive
+// by. The handler has no database or AI service: reaching the channel
+// allowlist or embedding would panic.
+func TestSelfMessagesNotStored(t *testing.T) {
+	h, _ := newIngestHandler(t, config.IngestConfig{Messages: true})
+	h.cfg.Bot.ResponseTimeout = time.Minute
+	store := rag.NewMemoryStore()
+	h.rag = rag.NewRAGRetrieverWithStore(nil, store, nil, h.cfg.RAG)
+	edited := time.Now()
+	own := &discordgo.Message{
+		ID:              "m1",
+		GuildID:         "g1",
+		ChannelID:       "c1",
+		Content:         "🎙️ ann asked: when is game night? It's on friday.",
+		Author:          &discordgo.User{ID: "bot", Username: "ragbot", Bot: true},
+		EditedTimestamp: &edited,
+	}
+
+	h.OnMessageCreate(h.session, &discordgo.MessageCreate{Message: own})
+	h.onMessageUpdate(h.session, &discordgo.MessageUpdate{Message: own})
+	h.updateMessage(h.session, own, "")
+	channel, _ := h.session.State.Channel("c1")
+	h.persistMessage(h.normalizeMessage(channel, own, pinnedPrefix))
+
+	ctx := context.Background()
+	if stored, _ := store.Recent(ctx, "g1", "", "", -1); len(stored) != 0 {
+		t.Fatalf("stored %d of the bot's own messages", len(stored))
+	}
+
+	// A member's message down the same path is stored; without content it
+	// needs no embedding
+	h.persistMessage(&models.DiscordMessage{MessageID: "m2", Author: "u1", GuildID: "g1", ChannelID: "c1"})
+	if stored, _ := store.Recent(ctx, "g1", "", "", -1); len(stored) != 1 {
+		t.Errorf("stored %d messages, want the member's", len(stored))
+	}
+}
+
+// An edit taking a message under INGEST_MIN_LENGTH deletes it under every
+// embedding version. Deleting needs no session, which the handler doesn't
+// have.
+func TestShrinkingEditDeletesMessage(t *testing.T) {
+	store := rag.NewMemoryStore()
+	cfg := &config.Config{
+		Bot:    config.BotConfig{ResponseTimeout: time.Minute},
+		Ingest: config.IngestConfig{MinLength: 10},
+	}
+	h := &BotHandler{
+		cfg:    cfg,
+		rag:    rag.NewRAGRetrieverWithStore(nil, store, nil, cfg.RAG),
+		ingest: newIngestFilter(cfg.Ingest),
+	}
+
+	ctx := context.Background()
+	for _, msg := range []models.DiscordMessage{
+		{MessageID: "1", GuildID: "g1", Content: "game night is on friday", EmbeddingVersion: "v1"},
+		{MessageID: "1", GuildID: "g1", Content: "game night is on friday", EmbeddingVersion: "v2"},
+		{MessageID: "2", GuildID: "g1", Content: "bring snacks and drinks", EmbeddingVersion: "v1"},
+	} {
+		if err := store.Upsert(ctx, &msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Embeds being unfurled aren't edits
+	h.onMessageUpdate(nil, &discordgo.MessageUpdate{Message: &discordgo.Message{
+		ID: "1", GuildID: "g1", Content: "nvm", Author: &discordgo.User{ID: "u1"},
+	}})
+	if recent, _ := store.Recent(ctx, "g1", "", "v2", -1); len(recent) != 1 {
+		t.Fatal("an update without an edit timestamp deleted the message")
+	}
+
+	h.updateMessage(nil, &discordgo.Message{ID: "1", GuildID: "g1", Content: "  nvm  "}, "")
+
+	for version, want := range map[string][]string{"v1": {"2"}, "v2": nil} {
+		recent, err := store.Recent(ctx, "g1", "", version, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, msg := range recent {
+			ids = append(ids, msg.MessageID)
+		}
+		if !slices.Equal(ids, want) {
+			t.Errorf("%s: stored %v after the edit, want %v", version, ids, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func newTestIngestFilter() *ingestFilter {
+	return newIngestFilter(config.IngestConfig{
+		MinLength:       10,
+		SkipCommands:    true,
+		CommandPrefixes: []string{"!", "/", "?"},
+		SkipURLOnly:     true,
+		SkipEmojiOnly:   true,
+		SkipSpam:        true,
+	})
+}
+
+func TestIngestSkipReason(t *testing.T) {
+	f := newTestIngestFilter()
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"ok thanks", "too short"},
+		{"   hi there   ", "too short"},
+		{"the deploy finished at noon", ""},
+		{"!play some music please", "bot command"},
+		{"/remind me tomorrow at 9", "bot command"},
+		{"?! what just happened here", ""},
+		{"... anyway, where were we", ""},
+		{"https://example.com/some/page", "URL only"},
+		{"https://a.example https://b.example", "URL only"},
+		{"see https://example.com/docs for details", ""},
+		{"😀 😂 👍🏽 ❤️ 👨‍👩‍👧", "emoji only"},
+		{"<:pepe:123456789> <a:dance:987654321>", "emoji only"},
+		{"nice one 👍 that worked", ""},
+		{"join us at discord.gg/abcdef now", "spam"},
+		{"FREE NITRO for everyone who clicks", "spam"},
+		{"aaaaaaaaaaaaaaaaaaaa", "spam"},
+		{"spam spam spam spam spam spam", "spam"},
+		{"we should really meet again soon", ""},
+	}
+	for _, tt := range tests {
+		if got := f.skipReason(tt.content); got != tt.want {
+			t.Errorf("skipReason(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestIngestSkipReasonDisabledChecks(t *testing.T) {
+	f := newIngestFilter(config.IngestConfig{CommandPrefixes: []string{"!"}})
+	for _, content := range []string{
+		"!play some music please",
+		"https://example.com/some/page",
+		"😀 😂 👍",
+		"aaaaaaaaaaaaaaaaaaaa",
+	} {
+		if got := f.skipReason(content); got != "" {
+			t.Errorf("skipReason(%q) = %q with all checks disabled, want \"\"", content, got)
+		}
+	}
+}
+
+func TestIsBotCommand(t *testing.T) {
+	prefixes := []string{"!", "$$"}
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"!help", true},
+		{"$$balance", true},
+		{"$balance", false},
+		{"!", false},
+		{"!!!", false},
+		{"! help", false},
+		{"!éclair", true},
+		{"help!", false},
+	}
+	for _, tt := range tests {
+		if got := isBotCommand(tt.content, prefixes); got != tt.want {
+			t.Errorf("isBotCommand(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestSkipAuthor(t *testing.T) {
+	f := newIngestFilter(config.IngestConfig{SkipBots: true, TrustedBots: []string{"trusted"}})
+	tests := []struct {
+		name   string
+		author *discordgo.User
+		want   bool
+	}{
+		{"nil author", nil, false},
+		{"human", &discordgo.User{ID: "u1"}, false},
+		{"bot", &discordgo.User{ID: "b1", Bot: true}, true},
+		{"trusted bot", &discordgo.User{ID: "trusted", Bot: true}, false},
+	}
+	for _, tt := range tests {
+		if got := f.skipAuthor(tt.author); got != tt.want {
+			t.Errorf("%s: skipAuthor = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	f = newIngestFilter(config.IngestConfig{})
+	if f.skipAuthor(&discordgo.User{ID: "b1", Bot: true}) {
+		t.Error("skipAuthor dropped a bot with SkipBots off")
+	}
+}
+
+// Edits by skipped bots are dropped before the database is read; the
+// handler has none, so touching it would panic
+func TestSkipAuthorOnEdit(t *testing.T) {
+	s, _ := newFakeSession(t)
+	h := &BotHandler{
+		cfg:    &config.Config{Ingest: config.IngestConfig{Messages: true, SkipBots: true}},
+		ingest: newIngestFilter(config.IngestConfig{SkipBots: true}),
+	}
+	edited := time.Now()
+	h.onMessageUpdate(s, &discordgo.MessageUpdate{Message: &discordgo.Message{
+		ID:              "m1",
+		GuildID:         "g1",
+		ChannelID:       "c1",
+		Content:         "status: all green",
+		Author:          &discordgo.User{ID: "b1", Bot: true},
+		EditedTimestamp: &edited,
+	}})
+}
+
+func TestStoredContentResolvesMentions(t *testing.T) {
+	s, fake := newFakeSession(t)
+	s.State.GuildAdd(&discordgo.Guild{
+		ID:       "g1",
+		Roles:    []*discordgo.Role{{ID: "r1", Name: "Organizers", Mentionable: true}},
+		Channels: []*discordgo.Channel{{ID: "c1", GuildID: "g1", Name: "general"}, {ID: "c2", GuildID: "g1", Name: "events"}},
+	})
+	m := &discordgo.Message{
+		ChannelID:    "c1",
+		GuildID:      "g1",
+		Content:      "<@&r1> see <#c2>, ping <@u2> or <@!u2>",
+		Mentions:     []*discordgo.User{{ID: "u2", Username: "bob"}},
+		MentionRoles: []string{"r1"},
+	}
+
+	// User mentions stay raw for the context's author naming mode
+	f := newIngestFilter(config.IngestConfig{ResolveMentions: true})
+	if got, want := f.storedContent(s, m), "@Organizers see #events, ping <@u2> or <@!u2>"; got != want {
+		t.Errorf("storedContent = %q, want %q", got, want)
+	}
+	if len(m.Mentions) != 1 {
+		t.Error("storedContent changed the message's mentions")
+	}
+
+	f = newIngestFilter(config.IngestConfig{})
+	if got := f.storedContent(s, m); got != m.Content {
+		t.Errorf("storedContent without ResolveMentions = %q, want the raw content", got)
+	}
+
+	// Mentions of roles and channels that can't be found are left as is
+	m = &discordgo.Message{ChannelID: "c1", GuildID: "g1", Content: "<@&r9> in <#c9>", MentionRoles: []string{"r9"}}
+	fake.fail = func(fakeRequest) int { return 404 }
+	if got := newIngestFilter(config.IngestConfig{ResolveMentions: true}).storedContent(s, m); got != m.Content {
+		t.Errorf("storedContent with unknown mentions = %q, want %q", got, m.Content)
+	}
+}
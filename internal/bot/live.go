@@ -0,0 +1,53 @@
+// internal/bot/live.go
+package bot
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// UserName returns a user's username, for naming mentioned users in the
+// context. It implements rag.UserNameSource.
+func (h *BotHandler) UserName(guildID, userID string) string {
+	if user := lookupUser(h.session, guildID, userID); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+// RecentChannelMessages fetches the newest messages in a channel straight
+// from Discord, oldest first, so answers can use conversation that hasn't
+// been stored yet. It implements rag.LiveMessageSource.
+func (h *BotHandler) RecentChannelMessages(ctx context.Context, channelID string, limit int) ([]models.DiscordMessage, error) {
+	msgs, err := h.session.ChannelMessages(channelID, limit, "", "", "", discordgo.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var channelName string
+	if channel, err := lookupChannel(h.session, channelID); err == nil {
+		channelName = channel.Name
+	}
+
+	// Discord returns newest first
+	messages := make([]models.DiscordMessage, 0, len(msgs))
+	for i := len(msgs) - 1; i >= 0; i-- {
+		m := msgs[i]
+		if m.Author == nil || m.Content == "" {
+			continue
+		}
+		messages = append(messages, models.DiscordMessage{
+			MessageID:   m.ID,
+			Content:     h.ingest.storedContent(h.session, m),
+			Author:      m.Author.ID,
+			Username:    m.Author.Username,
+			ChannelID:   m.ChannelID,
+			ChannelName: channelName,
+			GuildID:     m.GuildID,
+			Timestamp:   m.Timestamp,
+		})
+	}
+	return messages, nil
+}
@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// mockTranscriber is an ai.StreamingTranscriber returning canned results.
+// It records the options and audio size of every batch request.
+type mockTranscriber struct {
+	mu     sync.Mutex
+	result ai.Transcription
+	err    error
+	calls  []ai.TranscribeOptions
+	sizes  []int
+	stream *mockStream
+}
+
+func (m *mockTranscriber) Transcribe(ctx context.Context, audio io.Reader, opts ai.TranscribeOptions) (ai.Transcription, error) {
+	data, err := io.ReadAll(audio)
+	if err != nil {
+		return ai.Transcription{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, opts)
+	m.sizes = append(m.sizes, len(data))
+	return m.result, m.err
+}
+
+func (m *mockTranscriber) StartStream(ctx context.Context, opts ai.StreamOptions) (ai.TranscriptionStream, error) {
+	if m.stream == nil {
+		m.stream = &mockStream{}
+	}
+	return m.stream, nil
+}
+
+func (m *mockTranscriber) batchCalls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.calls)
+}
+
+// mockStream is an ai.TranscriptionStream that collects what is written
+// and returns a canned result when closed
+type mockStream struct {
+	mu      sync.Mutex
+	written []byte
+	result  ai.Transcription
+	err     error
+	closed  bool
+	aborted bool
+}
+
+func (s *mockStream) Write(pcm []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = append(s.written, pcm...)
+	return nil
+}
+
+func (s *mockStream) Close(ctx context.Context) (ai.Transcription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.result, s.err
+}
+
+func (s *mockStream) Abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aborted = true
+}
+
+// mockSynthesizer is an ai.Synthesizer returning audio in a fixed format.
+// Texts listed in invalid fail with ai.ErrInvalidAudio.
+type mockSynthesizer struct {
+	mu      sync.Mutex
+	format  ai.AudioFormat
+	invalid map[string]bool
+	err     error
+	texts   []string
+	opts    []ai.SynthesizeOptions
+}
+
+func (m *mockSynthesizer) Synthesize(ctx context.Context, text string, opts ai.SynthesizeOptions) ([]byte, ai.AudioFormat, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.texts = append(m.texts, text)
+	m.opts = append(m.opts, opts)
+
+	if m.err != nil {
+		return nil, "", m.err
+	}
+	if m.invalid[text] {
+		return nil, "", fmt.Errorf("%w: empty clip", ai.ErrInvalidAudio)
+	}
+	return []byte(text), m.format, nil
+}
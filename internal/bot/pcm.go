@@ -0,0 +1,214 @@
+// internal/bot/pcm.go
+package bot
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	pcmSampleRate     = 48000
+	pcmChannels       = 2
+	pcmBytesPerSample = 2
+	// pcmFrameBytes is the size of one sample across all channels
+	pcmFrameBytes = pcmChannels * pcmBytesPerSample
+
+	defaultOpusFrameSize = 960
+	// opusMaxFrameSize is the longest Opus frame (120ms), so decoding never
+	// fails whatever frame size the speaker's client uses
+	opusMaxFrameSize = 5760
+	// opusMaxPacketBytes is the recommended encode buffer size
+	opusMaxPacketBytes = 4000
+)
+
+// opusFrameSizes are the playback frame sizes allowed, in samples per
+// channel. Opus supports 120 to 2880 (2.5ms to 60ms) at 48kHz, but
+// discordgo sends a packet every 20ms whatever it holds, so any other size
+// plays too fast or too slow.
+var opusFrameSizes = []int{960}
+
+// validOpusFrameSize reports whether size is a supported Opus frame size
+func validOpusFrameSize(size int) bool {
+	for _, allowed := range opusFrameSizes {
+		if size == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// opusFrameBytes is the PCM buffer size holding one frame of frameSize
+// samples per channel
+func opusFrameBytes(frameSize int) int {
+	return frameSize * pcmFrameBytes
+}
+
+// alignPCM drops any trailing partial frame so the data always holds whole
+// stereo 16-bit samples
+func alignPCM(data []byte) []byte {
+	return data[:len(data)-len(data)%pcmFrameBytes]
+}
+
+// pcmBytesToSamples converts little-endian 16-bit PCM to samples, ignoring
+// any trailing partial frame
+func pcmBytesToSamples(data []byte) []int16 {
+	data = alignPCM(data)
+	samples := make([]int16, len(data)/pcmBytesPerSample)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2 : i*2+2]))
+	}
+	return samples
+}
+
+// samplesToPCMBytes converts samples to little-endian 16-bit PCM
+func samplesToPCMBytes(samples []int16) []byte {
+	data := make([]byte, len(samples)*pcmBytesPerSample)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	return data
+}
+
+// tonePCM generates a stereo sine tone with short fades at both ends so it
+// doesn't click
+func tonePCM(frequency float64, duration time.Duration, amplitude float64) []byte {
+	frames := int(int64(duration) * pcmSampleRate / int64(time.Second))
+	fade := pcmSampleRate / 100 // 10ms
+	samples := make([]int16, frames*pcmChannels)
+	for i := 0; i < frames; i++ {
+		gain := amplitude
+		if i < fade {
+			gain *= float64(i) / float64(fade)
+		} else if frames-i < fade {
+			gain *= float64(frames-i) / float64(fade)
+		}
+		value := int16(gain * math.MaxInt16 * math.Sin(2*math.Pi*frequency*float64(i)/pcmSampleRate))
+		for c := 0; c < pcmChannels; c++ {
+			samples[i*pcmChannels+c] = value
+		}
+	}
+	return samplesToPCMBytes(samples)
+}
+
+// pcmPeak is the largest absolute sample value
+func pcmPeak(samples []int16) int {
+	peak := 0
+	for _, sample := range samples {
+		v := int(sample)
+		if v < 0 {
+			v = -v
+		}
+		if v > peak {
+			peak = v
+		}
+	}
+	return peak
+}
+
+// pcmGain picks the factor to amplify samples by. "auto" brings the peak
+// to target (a fraction of full scale) but by no more than maxGain, so
+// near-silence isn't blown up into noise; "fixed" uses fixed. Either way
+// the gain is capped so the peak doesn't clip, and audio is never made
+// quieter.
+func pcmGain(samples []int16, mode string, target, maxGain, fixed float64) float64 {
+	peak := pcmPeak(samples)
+	if peak == 0 {
+		return 1
+	}
+
+	var gain float64
+	switch mode {
+	case "auto":
+		gain = target * math.MaxInt16 / float64(peak)
+		if maxGain > 0 && gain > maxGain {
+			gain = maxGain
+		}
+	case "fixed":
+		gain = fixed
+	default:
+		return 1
+	}
+
+	if headroom := math.MaxInt16 / float64(peak); gain > headroom {
+		gain = headroom
+	}
+	if gain < 1 {
+		return 1
+	}
+	return gain
+}
+
+// applyGain multiplies PCM audio by gain, saturating any sample that would
+// overflow
+func applyGain(data []byte, gain float64) []byte {
+	if gain == 1 {
+		return data
+	}
+	samples := pcmBytesToSamples(data)
+	for i, sample := range samples {
+		v := math.Round(float64(sample) * gain)
+		samples[i] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, v)))
+	}
+	return samplesToPCMBytes(samples)
+}
+
+// quietestCut picks where to split PCM audio: the end of the quietest 20ms
+// stretch within the last searchBytes, so a cut lands in a pause rather
+// than mid-word. Data shorter than the search span is cut at its end.
+func quietestCut(data []byte, searchBytes int) int {
+	data = alignPCM(data)
+	step := pcmBytesForDuration(20 * time.Millisecond)
+	start := len(data) - searchBytes
+	if start < 0 || step <= 0 {
+		return len(data)
+	}
+	start -= start % pcmFrameBytes
+
+	best, bestEnergy := len(data), math.MaxFloat64
+	for offset := start; offset+step <= len(data); offset += step {
+		var energy float64
+		for _, sample := range pcmBytesToSamples(data[offset : offset+step]) {
+			energy += float64(sample) * float64(sample)
+		}
+		if energy < bestEnergy {
+			best, bestEnergy = offset+step, energy
+		}
+	}
+	return best
+}
+
+// splitPCM splits PCM audio into consecutive segments of at most maxBytes,
+// in order. Each cut is placed with quietestCut in the last searchBytes of
+// the segment so words aren't split between them.
+func splitPCM(data []byte, maxBytes, searchBytes int) [][]byte {
+	data = alignPCM(data)
+	maxBytes -= maxBytes % pcmFrameBytes
+	if maxBytes <= 0 {
+		return [][]byte{data}
+	}
+
+	var segments [][]byte
+	for len(data) > maxBytes {
+		cut := quietestCut(data[:maxBytes], searchBytes)
+		if cut <= 0 {
+			cut = maxBytes
+		}
+		segments = append(segments, data[:cut])
+		data = data[cut:]
+	}
+	return append(segments, data)
+}
+
+// pcmDuration returns how long the given amount of PCM audio plays for
+func pcmDuration(byteLen int) time.Duration {
+	frames := int64(byteLen / pcmFrameBytes)
+	return time.Duration(frames) * time.Second / pcmSampleRate
+}
+
+// pcmBytesForDuration returns the size of d worth of PCM audio, rounded down
+// to whole frames
+func pcmBytesForDuration(d time.Duration) int {
+	frames := int64(d) * pcmSampleRate / int64(time.Second)
+	return int(frames) * pcmFrameBytes
+}
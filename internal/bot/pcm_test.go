@@ -0,0 +1,329 @@
+package bot
+
+import (
+	"bytes"
+	"discord-rag-bot/internal/config"
+	"encoding/binary"
+	"math"
+	"os/exec"
+	"slices"
+	"testing"
+	"time"
+
+	"layeh.com/gopus"
+)
+
+// misalignedPCM returns whole stereo frames of a ramp followed by extra
+// trailing bytes that don't make up a frame
+func misalignedPCM(frames, extra int) []byte {
+	samples := make([]int16, frames*pcmChannels)
+	for i := range samples {
+		samples[i] = int16(i)
+	}
+	data := samplesToPCMBytes(samples)
+	for i := 0; i < extra; i++ {
+		data = append(data, 0x7f)
+	}
+	return data
+}
+
+func TestAlignPCM(t *testing.T) {
+	for extra := 0; extra < pcmFrameBytes; extra++ {
+		data := misalignedPCM(10, extra)
+		if got := len(alignPCM(data)); got != 10*pcmFrameBytes {
+			t.Errorf("alignPCM with %d extra bytes = %d bytes, want %d", extra, got, 10*pcmFrameBytes)
+		}
+	}
+
+	if got := alignPCM([]byte{1, 2, 3}); len(got) != 0 {
+		t.Errorf("alignPCM of a partial frame = %d bytes, want 0", len(got))
+	}
+}
+
+func TestPCMBytesToSamplesMisaligned(t *testing.T) {
+	for extra := 0; extra < pcmFrameBytes; extra++ {
+		samples := pcmBytesToSamples(misalignedPCM(10, extra))
+		if len(samples) != 10*pcmChannels {
+			t.Fatalf("%d extra bytes: got %d samples, want %d", extra, len(samples), 10*pcmChannels)
+		}
+		for i, sample := range samples {
+			if sample != int16(i) {
+				t.Fatalf("%d extra bytes: sample %d = %d, want %d", extra, i, sample, i)
+			}
+		}
+	}
+}
+
+func TestPCMProcessingMisaligned(t *testing.T) {
+	data := misalignedPCM(4800, 3)
+
+	if got := len(applyGain(data, 2)); got != 4800*pcmFrameBytes {
+		t.Errorf("applyGain returned %d bytes, want %d", got, 4800*pcmFrameBytes)
+	}
+	if cut := quietestCut(data, len(data)/2); cut%pcmFrameBytes != 0 || cut > len(data) {
+		t.Errorf("quietestCut = %d, want a frame boundary within the data", cut)
+	}
+
+	total := 0
+	for _, segment := range splitPCM(data, 1001, 400) {
+		if len(segment)%pcmFrameBytes != 0 {
+			t.Errorf("splitPCM segment of %d bytes isn't whole frames", len(segment))
+		}
+		total += len(segment)
+	}
+	if total != 4800*pcmFrameBytes {
+		t.Errorf("splitPCM segments hold %d bytes, want %d", total, 4800*pcmFrameBytes)
+	}
+}
+
+func TestPCMToWavMisaligned(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	vm := &VoiceManager{handler: &BotHandler{cfg: &config.Config{Voice: config.VoiceConfig{TempDir: t.TempDir()}}}}
+	// One second of stereo 48kHz audio plus a partial sample
+	wav, err := vm.pcmToWav(misalignedPCM(48000, 3))
+	if err != nil {
+		t.Fatalf("pcmToWav: %v", err)
+	}
+	if len(wav) < 12 || string(wav[0:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		t.Fatalf("pcmToWav didn't return a WAV file")
+	}
+
+	dataSize, ok := wavDataSize(wav)
+	if !ok {
+		t.Fatal("WAV has no data chunk")
+	}
+	samples := int(dataSize) / pcmBytesPerSample
+	if samples < 15900 || samples > 16100 {
+		t.Errorf("WAV holds %d samples, want about 16000", samples)
+	}
+}
+
+// wavDataSize walks a WAV file's chunks to the size of its data chunk;
+// FFmpeg may add others, such as LIST, before it
+func wavDataSize(wav []byte) (uint32, bool) {
+	for offset := 12; offset+8 <= len(wav); {
+		size := binary.LittleEndian.Uint32(wav[offset+4:])
+		if string(wav[offset:offset+4]) == "data" {
+			return size, true
+		}
+		offset += 8 + int(size) + int(size%2)
+	}
+	return 0, false
+}
+
+func TestPCMDuration(t *testing.T) {
+	if got := pcmDuration(pcmBytesForDuration(time.Second) + 3); got != time.Second {
+		t.Errorf("pcmDuration = %v, want 1s", got)
+	}
+}
+
+func TestOpusFrameSizing(t *testing.T) {
+	if got := opusFrameBytes(defaultOpusFrameSize); got != 3840 {
+		t.Errorf("opusFrameBytes(%d) = %d, want 3840", defaultOpusFrameSize, got)
+	}
+	// A playback frame must last as long as discordgo's 20ms send interval
+	for _, size := range opusFrameSizes {
+		if got := pcmDuration(opusFrameBytes(size)); got != 20*time.Millisecond {
+			t.Errorf("frame of %d samples plays for %v, want 20ms", size, got)
+		}
+	}
+	if got := pcmDuration(opusFrameBytes(opusMaxFrameSize)); got != 120*time.Millisecond {
+		t.Errorf("largest decodable frame plays for %v, want 120ms", got)
+	}
+}
+
+func TestValidOpusFrameSize(t *testing.T) {
+	for size, want := range map[int]bool{960: true, 0: false, 480: false, 1920: false, 1000: false} {
+		if got := validOpusFrameSize(size); got != want {
+			t.Errorf("validOpusFrameSize(%d) = %v, want %v", size, got, want)
+		}
+	}
+}
+
+func TestVoiceManagerFrameSizeFallback(t *testing.T) {
+	for _, size := range []int{0, 2880, 1234} {
+		vm := NewVoiceManager(&BotHandler{cfg: &config.Config{Voice: config.VoiceConfig{FrameSize: size}}})
+		if vm.frameSize != defaultOpusFrameSize {
+			t.Errorf("frame size %d configured: using %d, want %d", size, vm.frameSize, defaultOpusFrameSize)
+		}
+	}
+}
+
+func TestOpusFrameRoundTrip(t *testing.T) {
+	encoder, err := gopus.NewEncoder(pcmSampleRate, pcmChannels, gopus.Audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := gopus.NewDecoder(pcmSampleRate, pcmChannels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pcm := tonePCM(440, 20*time.Millisecond, 0.5)
+	if len(pcm) != opusFrameBytes(defaultOpusFrameSize) {
+		t.Fatalf("20ms of audio is %d bytes, want one frame of %d", len(pcm), opusFrameBytes(defaultOpusFrameSize))
+	}
+
+	packet, err := encoder.Encode(pcmBytesToSamples(pcm), defaultOpusFrameSize, opusMaxPacketBytes)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	samples, err := decoder.Decode(packet, opusMaxFrameSize, false)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(samples) != defaultOpusFrameSize*pcmChannels {
+		t.Errorf("decoded %d samples, want %d", len(samples), defaultOpusFrameSize*pcmChannels)
+	}
+}
+
+func TestSplitPCMBoundaries(t *testing.T) {
+	frame := pcmFrameBytes
+	tests := []struct {
+		name     string
+		dataLen  int
+		maxBytes int
+		want     int
+	}{
+		{"under the limit", 99 * frame, 100 * frame, 1},
+		{"exactly the limit", 100 * frame, 100 * frame, 1},
+		{"one frame over", 101 * frame, 100 * frame, 2},
+		{"several segments", 350 * frame, 100 * frame, 4},
+		{"unaligned limit", 101 * frame, 100*frame + 3, 2},
+		{"no limit", 500 * frame, 0, 1},
+	}
+	for _, tt := range tests {
+		// Silence, so every cut can land at the end of the segment
+		data := make([]byte, tt.dataLen)
+		segments := splitPCM(data, tt.maxBytes, 0)
+		if len(segments) != tt.want {
+			t.Errorf("%s: %d segments, want %d", tt.name, len(segments), tt.want)
+		}
+
+		total := 0
+		for _, segment := range segments {
+			if tt.maxBytes > 0 && len(segment) > tt.maxBytes {
+				t.Errorf("%s: segment of %d bytes is over the %d byte limit", tt.name, len(segment), tt.maxBytes)
+			}
+			if len(segment) == 0 {
+				t.Errorf("%s: empty segment", tt.name)
+			}
+			total += len(segment)
+		}
+		if total != tt.dataLen {
+			t.Errorf("%s: segments hold %d bytes, want %d", tt.name, total, tt.dataLen)
+		}
+	}
+}
+
+func TestSplitPCMCutsInPause(t *testing.T) {
+	var data []byte
+	data = append(data, tonePCM(300, 2500*time.Millisecond, 0.5)...)
+	pauseStart := len(data)
+	data = append(data, make([]byte, pcmBytesForDuration(200*time.Millisecond))...)
+	pauseEnd := len(data)
+	data = append(data, tonePCM(300, 2*time.Second, 0.5)...)
+
+	segments := splitPCM(data, pcmBytesForDuration(3*time.Second), pcmBytesForDuration(time.Second))
+	if len(segments) != 2 {
+		t.Fatalf("%d segments, want 2", len(segments))
+	}
+	if cut := len(segments[0]); cut <= pauseStart || cut > pauseEnd {
+		t.Errorf("cut at %v, want inside the pause from %v to %v", pcmDuration(cut), pcmDuration(pauseStart), pcmDuration(pauseEnd))
+	}
+	if !bytes.Equal(append(bytes.Clone(segments[0]), segments[1]...), data) {
+		t.Error("segments don't hold the audio in order")
+	}
+}
+
+// A segment of PCM audio converts to a WAV 6 times smaller: 48kHz stereo
+// to 16kHz mono, both 16-bit
+func TestWhisperSegmentsFitUploadLimit(t *testing.T) {
+	wavSize := func(pcmLen int) int {
+		return pcmLen/(pcmSampleRate*pcmFrameBytes/wavBytesPerSecond) + wavHeaderBytes
+	}
+
+	for _, duration := range []time.Duration{maxWhisperDuration + time.Second, 2 * maxWhisperDuration, 5 * maxWhisperDuration} {
+		pcmLen := pcmBytesForDuration(duration)
+		segmentBytes := whisperSegmentBytes(pcmLen, wavSize(pcmLen))
+		if size := wavSize(segmentBytes); size > whisperMaxFileBytes {
+			t.Errorf("%v recording: segments' WAVs are %d bytes, over the %d byte limit", duration, size, whisperMaxFileBytes)
+		}
+		// Still large enough not to split into needlessly many uploads
+		if segmentBytes < pcmLen/int(duration/maxWhisperDuration+2) {
+			t.Errorf("%v recording: segments of %d bytes are needlessly small", duration, segmentBytes)
+		}
+	}
+
+	if pcmLen := pcmBytesForDuration(maxWhisperDuration); wavSize(pcmLen) > whisperMaxFileBytes {
+		t.Errorf("a recording of maxWhisperDuration makes a %d byte WAV, over the limit", wavSize(pcmLen))
+	}
+}
+
+func TestPCMGain(t *testing.T) {
+	quiet := []int16{0, 1000, -2000, 500}
+	tests := []struct {
+		name    string
+		samples []int16
+		mode    string
+		fixed   float64
+		maxGain float64
+		want    float64
+	}{
+		{"auto to target", quiet, "auto", 1, 20, 0.9 * math.MaxInt16 / 2000},
+		{"auto capped", quiet, "auto", 1, 5, 5},
+		{"auto without a cap", []int16{100}, "auto", 1, 0, 0.9 * math.MaxInt16 / 100},
+		{"auto on loud audio", []int16{32000}, "auto", 1, 10, 1},
+		{"fixed", quiet, "fixed", 3, 10, 3},
+		{"fixed would clip", quiet, "fixed", 30, 10, math.MaxInt16 / 2000.0},
+		{"fixed below 1", quiet, "fixed", 0.5, 10, 1},
+		// A negative peak of -32768 has no headroom at all
+		{"full scale", []int16{math.MinInt16}, "fixed", 2, 10, 1},
+		{"silence", []int16{0, 0}, "auto", 1, 10, 1},
+		{"no samples", nil, "auto", 1, 10, 1},
+		{"off", quiet, "off", 3, 10, 1},
+	}
+	for _, tt := range tests {
+		if got := pcmGain(tt.samples, tt.mode, 0.9, tt.maxGain, tt.fixed); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: pcmGain = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyGain(t *testing.T) {
+	data := samplesToPCMBytes([]int16{100, -100, 20000, -20000})
+	got := pcmBytesToSamples(applyGain(data, 2))
+	if want := []int16{200, -200, math.MaxInt16, math.MinInt16}; !slices.Equal(got, want) {
+		t.Errorf("applyGain = %v, want %v with overflowing samples saturated", got, want)
+	}
+
+	if out := applyGain(data, 1); &out[0] != &data[0] {
+		t.Error("applyGain with a gain of 1 copied the audio")
+	}
+}
+
+func TestNormalizeGain(t *testing.T) {
+	quiet := tonePCM(440, 100*time.Millisecond, 0.05)
+	tests := []struct {
+		cfg  config.VoiceConfig
+		peak int
+	}{
+		{config.VoiceConfig{Gain: "off"}, pcmPeak(pcmBytesToSamples(quiet))},
+		{config.VoiceConfig{Gain: "auto", GainTarget: 0.5, MaxGain: 20}, math.MaxInt16 / 2},
+		{config.VoiceConfig{Gain: "auto", GainTarget: 0.9, MaxGain: 4}, 4 * pcmPeak(pcmBytesToSamples(quiet))},
+		{config.VoiceConfig{Gain: "fixed", FixedGain: 2}, 2 * pcmPeak(pcmBytesToSamples(quiet))},
+	}
+	for _, tt := range tests {
+		vm := newTestVoiceManager(tt.cfg, nil)
+		out := vm.normalizeGain(quiet)
+		if len(out) != len(quiet) {
+			t.Errorf("gain %s: %d bytes out of %d", tt.cfg.Gain, len(out), len(quiet))
+		}
+		if peak := pcmPeak(pcmBytesToSamples(out)); peak < tt.peak-2 || peak > tt.peak+2 {
+			t.Errorf("gain %s: peak = %d, want %d", tt.cfg.Gain, peak, tt.peak)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// internal/bot/postprocess.go
+package bot
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// maxMessageLength is Discord's limit on message content
+const maxMessageLength = 2000
+
+const (
+	markdownKeep      = "keep"
+	markdownNormalize = "normalize"
+	markdownStrip     = "strip"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`(?m)^#{1,6}\s+(.+?)\s*#*$`)
+	ruleLinePattern    = regexp.MustCompile(`(?m)^[ \t]*(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$\n?`)
+	mdLinkPattern      = regexp.MustCompile(`!?\[([^\]]+)\]\((\S+?)\)`)
+	emphasisPattern    = regexp.MustCompile(`\*\*|__|~~|` + "`{1,3}")
+	massMentionPattern = regexp.MustCompile(`@(everyone|here)\b`)
+)
+
+// escapeMassMentions puts a zero-width space after the @ of @everyone and
+// @here, so they read the same but render as plain text
+func escapeMassMentions(text string) string {
+	return massMentionPattern.ReplaceAllString(text, "@\u200b$1")
+}
+
+// postProcessResponse applies the configured markdown handling to model
+// output before it is sent to Discord
+func postProcessResponse(text, markdownMode string) string {
+	switch markdownMode {
+	case markdownNormalize:
+		text = headingPattern.ReplaceAllString(text, "**$1**")
+		text = ruleLinePattern.ReplaceAllString(text, "")
+		text = mdLinkPattern.ReplaceAllString(text, "$1 (<$2>)")
+	case markdownStrip:
+		text = headingPattern.ReplaceAllString(text, "$1")
+		text = ruleLinePattern.ReplaceAllString(text, "")
+		text = mdLinkPattern.ReplaceAllString(text, "$1 ($2)")
+		text = emphasisPattern.ReplaceAllString(text, "")
+	}
+	return strings.TrimSpace(text)
+}
+
+// finishResponse post-processes a generated answer, substituting the
+// configured reply when nothing is left to send, since Discord rejects
+// empty messages
+func (h *BotHandler) finishResponse(response string) string {
+	response = postProcessResponse(response, h.cfg.Bot.MarkdownMode)
+	if h.cfg.Bot.EscapeMassMentions {
+		response = escapeMassMentions(response)
+	}
+	if response == "" {
+		log.Printf("Model returned an empty answer, sending the fallback reply")
+		return h.cfg.Bot.EmptyResponseReply
+	}
+	return response
+}
+
+// appendFooter adds footer below text, shortening text if needed so the
+// footer always fits within the message limit
+func appendFooter(text, footer string) string {
+	footer = strings.TrimSpace(footer)
+	if footer == "" {
+		return text
+	}
+	suffix := "\n\n" + footer
+	if len(suffix) >= maxMessageLength {
+		return truncateMessage(footer, maxMessageLength)
+	}
+	return truncateMessage(text, maxMessageLength-len(suffix)) + suffix
+}
@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestFinishResponseEscapesMassMentions(t *testing.T) {
+	tests := []struct {
+		escape bool
+		want   string
+	}{
+		{true, "Hey @\u200beveryone and @\u200bhere, ping <@123>"},
+		{false, "Hey @everyone and @here, ping <@123>"},
+	}
+	for _, tt := range tests {
+		h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{EscapeMassMentions: tt.escape}}}
+		if got := h.finishResponse("  Hey @everyone and @here, ping <@123>  "); got != tt.want {
+			t.Errorf("EscapeMassMentions=%v: finishResponse = %q, want %q", tt.escape, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeMassMentions(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"@everyone", "@\u200beveryone"},
+		{"@here.", "@\u200bhere."},
+		{"(@here)", "(@\u200bhere)"},
+		{"@everyone@here", "@\u200beveryone@\u200bhere"},
+		{"@@everyone", "@@\u200beveryone"},
+		{"hi@here", "hi@\u200bhere"},
+		{"`@everyone`", "`@\u200beveryone`"},
+		{"@everyones and @hereafter", "@everyones and @hereafter"},
+		{"@Everyone", "@Everyone"},
+		{"@\u200beveryone", "@\u200beveryone"},
+		{"<@123> and <@&456>", "<@123> and <@&456>"},
+	}
+	for _, tt := range tests {
+		if got := escapeMassMentions(tt.text); got != tt.want {
+			t.Errorf("escapeMassMentions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// Escaping is cosmetic; what keeps generated text from pinging anyone is
+// that every send overrides the allowed mentions, whatever the caller set
+func TestSendSuppressesMentions(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{}, sends: newSendQueue(time.Millisecond)}
+
+	_, err := h.sendMessage(s, "c1", &discordgo.MessageSend{
+		Content:         "@everyone <@123> <@&456>",
+		AllowedMentions: &discordgo.MessageAllowedMentions{Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeEveryone}},
+	})
+	if err != nil {
+		t.Fatalf("sendMessage: %v", err)
+	}
+
+	sends := fake.find(http.MethodPost, "channels/c1/messages")
+	if len(sends) != 1 {
+		t.Fatalf("%d messages sent, want 1", len(sends))
+	}
+	var sent struct {
+		AllowedMentions *struct {
+			Parse []string `json:"parse"`
+			Users []string `json:"users"`
+			Roles []string `json:"roles"`
+		} `json:"allowed_mentions"`
+	}
+	sends[0].decode(t, &sent)
+	if sent.AllowedMentions == nil || sent.AllowedMentions.Parse == nil {
+		t.Fatal("message sent without an explicit empty parse list, Discord would ping everyone mentioned")
+	}
+	if m := sent.AllowedMentions; len(m.Parse) != 0 || len(m.Users) != 0 || len(m.Roles) != 0 {
+		t.Errorf("allowed mentions = %+v, want none", *m)
+	}
+}
+
+func TestAppendFooter(t *testing.T) {
+	long := strings.Repeat("é", maxMessageLength)
+	tests := []struct {
+		name   string
+		text   string
+		footer string
+		want   string
+	}{
+		{"footer", "Friday.", "_Answers may be wrong._", "Friday.\n\n_Answers may be wrong._"},
+		{"no footer", "Friday.", "", "Friday."},
+		{"blank footer", "Friday.", "  \n", "Friday."},
+		{"footer trimmed", "Friday.", " _AI_\n", "Friday.\n\n_AI_"},
+	}
+	for _, tt := range tests {
+		if got := appendFooter(tt.text, tt.footer); got != tt.want {
+			t.Errorf("%s: appendFooter = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// A long answer is shortened so the footer still fits
+	footer := "_Answers may be wrong._"
+	got := appendFooter(long, footer)
+	if len(got) > maxMessageLength || !strings.HasSuffix(got, "...\n\n"+footer) || !utf8.ValidString(got) {
+		t.Errorf("appendFooter on a long answer = %d bytes ending %q, want at most %d ending with the footer", len(got), got[len(got)-40:], maxMessageLength)
+	}
+
+	// A footer that can't fit alongside anything is cut itself
+	got = appendFooter("Friday.", long)
+	if len(got) > maxMessageLength || !utf8.ValidString(got) {
+		t.Errorf("appendFooter with an oversized footer = %d bytes, want at most %d", len(got), maxMessageLength)
+	}
+}
+
+func TestResponseFooterInDM(t *testing.T) {
+	h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{ResponseFooter: "_AI_"}}}
+	if got := h.responseFooter(""); got != "_AI_" {
+		t.Errorf("responseFooter in a DM = %q, want the configured default", got)
+	}
+}
+
+func TestFinishResponseEmpty(t *testing.T) {
+	h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{MarkdownMode: markdownStrip, EmptyResponseReply: "no answer"}}}
+	tests := []struct {
+		name, response, want string
+	}{
+		{"empty", "", "no answer"},
+		{"whitespace", " \n\t ", "no answer"},
+		{"only formatting", "---\n", "no answer"},
+		{"answer", " an answer ", "an answer"},
+	}
+	for _, tt := range tests {
+		if got := h.finishResponse(tt.response); got != tt.want {
+			t.Errorf("%s: finishResponse(%q) = %q, want %q", tt.name, tt.response, got, tt.want)
+		}
+	}
+}
+
+// An empty answer to a mention is replaced rather than sent, which Discord
+// would reject. The message is a DM so no guild settings are needed.
+func TestReplyWithEmptyAnswer(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{
+		cfg:       &config.Config{Bot: config.BotConfig{EmptyResponseReply: "no answer"}},
+		sends:     newSendQueue(time.Millisecond),
+		responses: newResponseStore(),
+	}
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ID: "m1", ChannelID: "c1", Author: &discordgo.User{ID: "u1"}}}
+
+	if got := h.replyWithAnswer(s, m, "hello?", "  ", &responseState{Query: "hello?"}); got != "no answer" {
+		t.Errorf("replyWithAnswer = %q, want the fallback reply", got)
+	}
+	sends := fake.find(http.MethodPost, "channels/c1/messages")
+	if len(sends) != 1 {
+		t.Fatalf("%d messages sent, want 1", len(sends))
+	}
+	var sent struct {
+		Content string `json:"content"`
+	}
+	sends[0].decode(t, &sent)
+	if sent.Content != "no answer" {
+		t.Errorf("reply = %q, want the fallback reply", sent.Content)
+	}
+}
+
+func TestAnswerInteractionEmpty(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{
+		cfg:       &config.Config{Bot: config.BotConfig{EmptyResponseReply: "no answer"}},
+		responses: newResponseStore(),
+	}
+	i := commandInteraction("ai")
+	i.GuildID = ""
+
+	if got := h.answerInteraction(s, i, "hello?", "", &responseState{Query: "hello?"}); got != "no answer" {
+		t.Errorf("answerInteraction = %q, want the fallback reply", got)
+	}
+	edits := fake.find(http.MethodPatch, "/messages/@original")
+	if len(edits) != 1 {
+		t.Fatalf("%d response edits, want 1", len(edits))
+	}
+	var edit struct {
+		Content string `json:"content"`
+	}
+	edits[0].decode(t, &edit)
+	if edit.Content != "no answer" {
+		t.Errorf("response = %q, want the fallback reply", edit.Content)
+	}
+}
@@ -0,0 +1,124 @@
+// internal/bot/regenerate.go
+package bot
+
+import (
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/models"
+	"discord-rag-bot/internal/rag"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// regenerateTemperature samples regenerated answers a little more freely
+// than the default, so they actually differ from the first one
+const regenerateTemperature = 1.0
+
+func regenerateCommand() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "regenerate",
+		Description: "Get a different answer to your last question in this channel",
+	}
+}
+
+// handleRegenerateInteraction answers the user's most recent question in
+// the channel again, with fresh context and a higher temperature
+func (h *BotHandler) handleRegenerateInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	user := interactionUser(i)
+	if user == nil {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{unknownUserReply}[0],
+		})
+		return
+	}
+	last, err := h.db.GetLatestInteraction(user.ID, i.ChannelID)
+	if err != nil {
+		log.Printf("Error loading last interaction of %s: %v", user.ID, err)
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{"❌ Could not load your last question."}[0],
+		})
+		return
+	}
+	if last == nil {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{"You haven't asked me anything in this channel yet."}[0],
+		})
+		return
+	}
+	if rag.QueryRedacted(last) {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{"Questions aren't stored here, so I can't regenerate the last answer. Please ask again."}[0],
+		})
+		return
+	}
+
+	if reply, over := h.overBudget(user.ID); over {
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &reply,
+		})
+		return
+	}
+
+	ctx, cancel := h.interactionContext(i)
+	defer cancel()
+	ctx = ai.WithTemperature(ctx, regenerateTemperature)
+
+	guildName := h.guildName(s, i.GuildID)
+	query := last.Query
+
+	timeRange := resolveTimeRange(query, "", time.Now())
+	retrieved, err := h.rag.SearchContextInRange(ctx, query, i.GuildID, i.ChannelID, h.channelCategory(s, i.ChannelID), 5, timeRange)
+	if err != nil {
+		log.Printf("Error getting context: %v", err)
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{"Sorry, I encountered an error while searching for context."}[0],
+		})
+		return
+	}
+
+	response, err := h.rag.GenerateResponse(ctx, query, retrieved, user.Username, i.GuildID, guildName)
+	if err != nil {
+		log.Printf("Error regenerating response: %v", err)
+		h.editResponse(s, i, &discordgo.WebhookEdit{
+			Content: &[]string{"Sorry, I encountered an error while generating a response."}[0],
+		})
+		return
+	}
+	response = h.finishResponse(response)
+
+	components := responseComponents(h.responses.put(&responseState{
+		Query:     query,
+		Context:   retrieved,
+		GuildID:   i.GuildID,
+		GuildName: guildName,
+	}))
+	content := appendFooter("🔁 **"+truncateMessage(query, 200)+"**\n"+response, h.responseFooter(i.GuildID))
+	h.editResponse(s, i, &discordgo.WebhookEdit{
+		Content:         &content,
+		Components:      &components,
+		AllowedMentions: noMassMentions(),
+	})
+
+	interaction := &models.BotInteraction{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Query:     query,
+		Response:  response,
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		Timestamp: time.Now(),
+	}
+
+	if err := h.rag.StoreInteraction(ctx, interaction); err != nil {
+		log.Printf("Error logging interaction: %v", err)
+	}
+}
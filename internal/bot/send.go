@@ -0,0 +1,219 @@
+// internal/bot/send.go
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// noMassMentions is attached to outbound messages so @everyone, @here, role
+// and user mentions in generated text never ping anyone
+func noMassMentions() *discordgo.MessageAllowedMentions {
+	return &discordgo.MessageAllowedMentions{
+		Parse: []discordgo.AllowedMentionType{},
+	}
+}
+
+// replyMentions only allows pinging the author of the message being replied to
+func replyMentions() *discordgo.MessageAllowedMentions {
+	return &discordgo.MessageAllowedMentions{
+		Parse:       []discordgo.AllowedMentionType{},
+		RepliedUser: true,
+	}
+}
+
+// sendMessage is the single path for outbound channel messages. It always
+// overrides AllowedMentions: replies may ping the invoker, nothing else pings.
+func (h *BotHandler) sendMessage(s *discordgo.Session, channelID string, msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	return h.sendMessageFor(s, channelID, "", msg)
+}
+
+// sendMessageFor is sendMessage on behalf of a user. If the bot may not post
+// in the channel, the message goes to the configured fallback channel or,
+// failing that, to the user's DMs.
+func (h *BotHandler) sendMessageFor(s *discordgo.Session, channelID, userID string, msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	if msg.Reference != nil {
+		msg.AllowedMentions = replyMentions()
+	} else {
+		msg.AllowedMentions = noMassMentions()
+	}
+
+	sent, err := h.queueSend(s, channelID, msg)
+	if err == nil {
+		return sent, nil
+	}
+	log.Printf("Error sending message to channel %s: %v", channelID, err)
+
+	if !isPermissionError(err) {
+		return nil, err
+	}
+
+	// The original channel can't be replied in or linked to, so say where
+	// the message was meant to go instead
+	fallback := *msg
+	fallback.Reference = nil
+	fallback.AllowedMentions = noMassMentions()
+	fallback.Content = truncateMessage(fmt.Sprintf("(I can't post in <#%s>)\n%s", channelID, msg.Content), 2000)
+
+	if fallbackChannel := h.fallbackChannel(s, channelID); fallbackChannel != "" {
+		sent, fbErr := h.queueSend(s, fallbackChannel, &fallback)
+		if fbErr == nil {
+			log.Printf("Missing permission in channel %s, sent to fallback channel %s", channelID, fallbackChannel)
+			return sent, nil
+		}
+		log.Printf("Error sending to fallback channel %s: %v", fallbackChannel, fbErr)
+	}
+
+	if userID != "" {
+		dm, dmErr := s.UserChannelCreate(userID)
+		if dmErr == nil {
+			sent, dmErr = h.queueSend(s, dm.ID, &fallback)
+		}
+		if dmErr == nil {
+			log.Printf("Missing permission in channel %s, sent to user %s by DM", channelID, userID)
+			return sent, nil
+		}
+		log.Printf("Error sending fallback DM to user %s: %v", userID, dmErr)
+	}
+
+	return nil, err
+}
+
+// fallbackChannel is the configured fallback channel for a message meant
+// for channelID, or "" if there is none. Answers are built from a guild's
+// stored messages, so a fallback channel in another guild is refused
+// rather than leaking them there.
+func (h *BotHandler) fallbackChannel(s *discordgo.Session, channelID string) string {
+	fallback := h.cfg.Bot.FallbackChannel
+	if fallback == "" || fallback == channelID {
+		return ""
+	}
+
+	source, err := lookupChannel(s, channelID)
+	if err != nil {
+		log.Printf("Error getting channel info: %v", err)
+		return ""
+	}
+	target, err := lookupChannel(s, fallback)
+	if err != nil {
+		log.Printf("Error getting fallback channel info: %v", err)
+		return ""
+	}
+	if source.GuildID == "" || source.GuildID != target.GuildID {
+		log.Printf("Not using fallback channel %s for channel %s: they are in different servers", fallback, channelID)
+		return ""
+	}
+	return fallback
+}
+
+// queueSend posts a message through the channel's send queue, after
+// anything queued for the channel before it
+func (h *BotHandler) queueSend(s *discordgo.Session, channelID string, msg *discordgo.MessageSend) (sent *discordgo.Message, err error) {
+	h.sends.do(channelID, func() {
+		sent, err = s.ChannelMessageSendComplex(channelID, msg)
+	})
+	return sent, err
+}
+
+// sendTyping shows the typing indicator once the channel's queued sends
+// are out, without waiting for it
+func (h *BotHandler) sendTyping(s *discordgo.Session, channelID string) {
+	h.sends.enqueue(channelID, func() {
+		s.ChannelTyping(channelID)
+	})
+}
+
+// isPermissionError reports whether a Discord API error means the bot can't
+// see or post in a channel
+func isPermissionError(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Message == nil {
+		return false
+	}
+	return restErr.Message.Code == discordgo.ErrCodeMissingPermissions ||
+		restErr.Message.Code == discordgo.ErrCodeMissingAccess
+}
+
+// isExpiredInteractionError reports whether an interaction response edit
+// failed because the interaction token is no longer valid, which happens
+// 15 minutes after the interaction was created
+func isExpiredInteractionError(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Message == nil {
+		return false
+	}
+	return restErr.Message.Code == discordgo.ErrCodeUnknownWebhook ||
+		restErr.Message.Code == discordgo.ErrCodeInvalidWebhookTokenProvided ||
+		restErr.Message.Code == discordgo.ErrCodeUnknownInteraction
+}
+
+// interactionTokenLifetime is how long Discord accepts edits to an
+// interaction's response
+const interactionTokenLifetime = 15 * time.Minute
+
+// interactionExpired reports whether an interaction's token has outlived
+// interactionTokenLifetime, so editing its response can only fail
+func interactionExpired(i *discordgo.InteractionCreate, now time.Time) bool {
+	created, err := discordgo.SnowflakeTimestamp(i.ID)
+	return err == nil && now.Sub(created) >= interactionTokenLifetime
+}
+
+// editResponse fills in an interaction's deferred response. If the
+// interaction expired before the answer was ready, it is sent to the
+// channel as a regular message instead.
+func (h *BotHandler) editResponse(s *discordgo.Session, i *discordgo.InteractionCreate, edit *discordgo.WebhookEdit) {
+	if !interactionExpired(i, time.Now()) {
+		_, err := s.InteractionResponseEdit(i.Interaction, edit)
+		if err == nil {
+			return
+		}
+		if !isExpiredInteractionError(err) {
+			log.Printf("Error editing interaction response: %v", err)
+			return
+		}
+	}
+
+	log.Printf("Interaction %s expired, sending response as a message", i.ID)
+	msg := &discordgo.MessageSend{}
+	if edit.Content != nil {
+		msg.Content = *edit.Content
+	}
+	if edit.Components != nil {
+		msg.Components = *edit.Components
+	}
+	if edit.Embeds != nil {
+		msg.Embeds = *edit.Embeds
+	}
+
+	var userID string
+	if user := interactionUser(i); user != nil {
+		userID = user.ID
+	}
+	h.sendMessageFor(s, i.ChannelID, userID, msg)
+}
+
+// editText replaces the content of a message the bot sent
+func (h *BotHandler) editText(s *discordgo.Session, channelID, messageID, content string) error {
+	var err error
+	h.sends.do(channelID, func() {
+		_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:              messageID,
+			Channel:         channelID,
+			Content:         &content,
+			AllowedMentions: noMassMentions(),
+		})
+	})
+	if err != nil {
+		log.Printf("Error editing message %s in channel %s: %v", messageID, channelID, err)
+	}
+	return err
+}
+
+// sendText sends plain content to a channel
+func (h *BotHandler) sendText(s *discordgo.Session, channelID, content string) {
+	h.sendMessage(s, channelID, &discordgo.MessageSend{Content: content})
+}
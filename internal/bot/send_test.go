@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAllowedMentionsJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		mentions *discordgo.MessageAllowedMentions
+		want     string
+	}{
+		// An omitted parse list would let Discord parse every mention
+		{"noMassMentions", noMassMentions(), `{"parse":[],"replied_user":false}`},
+		{"replyMentions", replyMentions(), `{"parse":[],"replied_user":true}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.mentions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, data, tt.want)
+		}
+	}
+}
+
+func TestAllowedMentionsNotShared(t *testing.T) {
+	m := noMassMentions()
+	m.Parse = append(m.Parse, discordgo.AllowedMentionTypeEveryone)
+	m.Users = []string{"123"}
+	if again := noMassMentions(); len(again.Parse) != 0 || len(again.Users) != 0 {
+		t.Errorf("noMassMentions = %+v after modifying an earlier result", *again)
+	}
+}
+
+func TestSendReplyMentionsAuthorOnly(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{}, sends: newSendQueue(time.Millisecond)}
+
+	_, err := h.sendMessage(s, "c1", &discordgo.MessageSend{
+		Content:         "@here see <@123>",
+		Reference:       &discordgo.MessageReference{MessageID: "m1", ChannelID: "c1"},
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{"123"}},
+	})
+	if err != nil {
+		t.Fatalf("sendMessage: %v", err)
+	}
+
+	sends := fake.find(http.MethodPost, "channels/c1/messages")
+	if len(sends) != 1 {
+		t.Fatalf("%d messages sent, want 1", len(sends))
+	}
+	var sent struct {
+		AllowedMentions json.RawMessage `json:"allowed_mentions"`
+	}
+	sends[0].decode(t, &sent)
+	if want := `{"parse":[],"replied_user":true}`; string(sent.AllowedMentions) != want {
+		t.Errorf("allowed mentions = %s, want %s", sent.AllowedMentions, want)
+	}
+}
+
+func TestSendWithoutPermissionFallsBack(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		status   int
+		want     string
+	}{
+		{"fallback channel", "c2", http.StatusForbidden, "channels/c2/messages"},
+		{"fallback channel in another server", "c3", http.StatusForbidden, "channels/dm/messages"},
+		{"no fallback channel", "", http.StatusForbidden, "channels/dm/messages"},
+		{"not a permission error", "c2", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		s, fake := newFakeSession(t)
+		s.State.GuildAdd(&discordgo.Guild{ID: "g1", Channels: []*discordgo.Channel{{ID: "c1", GuildID: "g1"}, {ID: "c2", GuildID: "g1"}}})
+		s.State.GuildAdd(&discordgo.Guild{ID: "g2", Channels: []*discordgo.Channel{{ID: "c3", GuildID: "g2"}}})
+		fake.fail = func(req fakeRequest) int {
+			if req.Path == "channels/c1/messages" {
+				return tt.status
+			}
+			return 0
+		}
+		h := &BotHandler{cfg: &config.Config{Bot: config.BotConfig{FallbackChannel: tt.fallback}}, sends: newSendQueue(time.Millisecond)}
+
+		sent, err := h.sendMessageFor(s, "c1", "u1", &discordgo.MessageSend{
+			Content:   "friday",
+			Reference: &discordgo.MessageReference{MessageID: "m1", ChannelID: "c1"},
+		})
+		if tt.want == "" {
+			if err == nil || len(fake.calls()) != 1 {
+				t.Errorf("%s: sendMessageFor = %v after %d calls, want the error without a fallback", tt.name, err, len(fake.calls()))
+			}
+			continue
+		}
+		if err != nil || sent == nil {
+			t.Errorf("%s: sendMessageFor = %v, want the fallback to succeed", tt.name, err)
+			continue
+		}
+
+		fallbacks := fake.find(http.MethodPost, tt.want)
+		if len(fallbacks) != 1 {
+			t.Errorf("%s: requests = %+v, want one send to %s", tt.name, fake.calls(), tt.want)
+			continue
+		}
+		var msg discordgo.MessageSend
+		fallbacks[0].decode(t, &msg)
+		if msg.Content != "(I can't post in <#c1>)\nfriday" || msg.Reference != nil {
+			t.Errorf("%s: fallback = %q replying to %+v, want a note about c1 and no reply", tt.name, msg.Content, msg.Reference)
+		}
+	}
+}
+
+func TestSendWithoutPermissionAnywhere(t *testing.T) {
+	s, fake := newFakeSession(t)
+	fake.fail = func(req fakeRequest) int {
+		if req.Method == http.MethodPost && strings.HasSuffix(req.Path, "/messages") {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+	h := &BotHandler{cfg: &config.Config{}, sends: newSendQueue(time.Millisecond)}
+
+	_, err := h.sendMessageFor(s, "c1", "u1", &discordgo.MessageSend{Content: "friday"})
+	if !isPermissionError(err) {
+		t.Errorf("sendMessageFor = %v, want the original permission error", err)
+	}
+	if dms := fake.find(http.MethodPost, "channels/dm/messages"); len(dms) != 1 {
+		t.Errorf("%d DMs attempted, want 1", len(dms))
+	}
+}
+
+func TestIsExpiredInteractionError(t *testing.T) {
+	restError := func(code int) error {
+		return fmt.Errorf("edit: %w", &discordgo.RESTError{Message: &discordgo.APIErrorMessage{Code: code}})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unknown webhook", restError(discordgo.ErrCodeUnknownWebhook), true},
+		{"invalid webhook token", restError(discordgo.ErrCodeInvalidWebhookTokenProvided), true},
+		{"unknown interaction", restError(discordgo.ErrCodeUnknownInteraction), true},
+		{"missing permissions", restError(discordgo.ErrCodeMissingPermissions), false},
+		{"REST error without a message", &discordgo.RESTError{}, false},
+		{"other error", errors.New("timeout"), false},
+	}
+	for _, tt := range tests {
+		if got := isExpiredInteractionError(tt.err); got != tt.want {
+			t.Errorf("%s: isExpiredInteractionError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// snowflakeAt returns a Discord ID created at the given time
+func snowflakeAt(at time.Time) string {
+	return strconv.FormatInt((at.UnixMilli()-1420070400000)<<22, 10)
+}
+
+func TestInteractionExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"fresh", snowflakeAt(now.Add(-time.Minute)), false},
+		{"about to expire", snowflakeAt(now.Add(-interactionTokenLifetime + time.Second)), false},
+		{"expired", snowflakeAt(now.Add(-interactionTokenLifetime)), true},
+		{"not a snowflake", "i1", false},
+	}
+	for _, tt := range tests {
+		i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{ID: tt.id}}
+		if got := interactionExpired(i, now); got != tt.want {
+			t.Errorf("%s: interactionExpired = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEditResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		status   int
+		edits    int
+		messages int
+	}{
+		{"edited", "i1", 0, 1, 0},
+		{"token rejected", "i1", http.StatusNotFound, 1, 1},
+		{"token too old to try", snowflakeAt(time.Now().Add(-time.Hour)), 0, 0, 1},
+		{"other error", "i1", http.StatusInternalServerError, 1, 0},
+	}
+	for _, tt := range tests {
+		s, fake := newFakeSession(t)
+		fake.fail = func(req fakeRequest) int {
+			if req.Method == http.MethodPatch {
+				return tt.status
+			}
+			return 0
+		}
+		h := &BotHandler{cfg: &config.Config{}, sends: newSendQueue(time.Millisecond)}
+		i := commandInteraction("ask")
+		i.ID = tt.id
+
+		content := "friday"
+		components := []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Sources", CustomID: "sources"},
+		}}}
+		h.editResponse(s, i, &discordgo.WebhookEdit{Content: &content, Components: &components})
+
+		edits := fake.find(http.MethodPatch, "/messages/@original")
+		messages := fake.find(http.MethodPost, "channels/c1/messages")
+		if len(edits) != tt.edits || len(messages) != tt.messages {
+			t.Errorf("%s: %d edits and %d messages, want %d and %d", tt.name, len(edits), len(messages), tt.edits, tt.messages)
+			continue
+		}
+		if tt.messages == 0 {
+			continue
+		}
+		var msg struct {
+			Content    string            `json:"content"`
+			Components []json.RawMessage `json:"components"`
+		}
+		messages[0].decode(t, &msg)
+		if msg.Content != content || len(msg.Components) != 1 {
+			t.Errorf("%s: message = %q with %d component rows, want the response with its buttons", tt.name, msg.Content, len(msg.Components))
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// internal/bot/sendqueue.go
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// sendQueueBuffer is how many sends can wait per channel before
+	// callers block on enqueueing
+	sendQueueBuffer = 32
+	// sendQueueIdle is how long a channel's worker waits for more sends
+	// before exiting
+	sendQueueIdle = time.Minute
+)
+
+// sendQueue serializes outbound requests per channel, running them in the
+// order they were queued and at least interval apart, so concurrent
+// handlers don't burst into rate limits or post out of order
+type sendQueue struct {
+	mu       sync.Mutex
+	channels map[string]*channelQueue
+	interval time.Duration
+}
+
+type channelQueue struct {
+	jobs    chan func()
+	pending int // Jobs queued or about to be; guarded by sendQueue.mu
+}
+
+func newSendQueue(interval time.Duration) *sendQueue {
+	return &sendQueue{
+		channels: make(map[string]*channelQueue),
+		interval: interval,
+	}
+}
+
+// do runs fn in the channel's queue and waits for it to finish
+func (q *sendQueue) do(channelID string, fn func()) {
+	done := make(chan struct{})
+	q.enqueue(channelID, func() {
+		defer close(done)
+		fn()
+	})
+	<-done
+}
+
+// enqueue queues fn for the channel without waiting for it to run
+func (q *sendQueue) enqueue(channelID string, fn func()) {
+	q.mu.Lock()
+	cq, ok := q.channels[channelID]
+	if !ok {
+		cq = &channelQueue{jobs: make(chan func(), sendQueueBuffer)}
+		q.channels[channelID] = cq
+		go q.run(channelID, cq)
+	}
+	// Counted before sending so the worker can't exit in between
+	cq.pending++
+	q.mu.Unlock()
+
+	cq.jobs <- fn
+}
+
+// run works through a channel's queue, exiting once it has been idle
+func (q *sendQueue) run(channelID string, cq *channelQueue) {
+	var last time.Time
+	idle := time.NewTimer(sendQueueIdle)
+	defer idle.Stop()
+
+	for {
+		select {
+		case fn := <-cq.jobs:
+			if wait := q.interval - time.Since(last); wait > 0 {
+				time.Sleep(wait)
+			}
+			fn()
+			last = time.Now()
+
+			q.mu.Lock()
+			cq.pending--
+			q.mu.Unlock()
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(sendQueueIdle)
+		case <-idle.C:
+			q.mu.Lock()
+			if cq.pending == 0 {
+				delete(q.channels, channelID)
+				q.mu.Unlock()
+				return
+			}
+			q.mu.Unlock()
+			idle.Reset(sendQueueIdle)
+		}
+	}
+}
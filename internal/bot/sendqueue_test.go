@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Sends queued one after another, whether waited for or not, run in that
+// order even when earlier ones are slow
+func TestSendQueueKeepsOrder(t *testing.T) {
+	q := newSendQueue(0)
+
+	var mu sync.Mutex
+	var got []string
+	record := func(name string, delay time.Duration) func() {
+		return func() {
+			time.Sleep(delay)
+			mu.Lock()
+			got = append(got, name)
+			mu.Unlock()
+		}
+	}
+
+	q.enqueue("c1", record("typing", 20*time.Millisecond))
+	q.enqueue("c1", record("voice message", 10*time.Millisecond))
+	q.do("c1", record("response", 0))
+
+	want := []string{"typing", "voice message", "response"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(got, want) {
+		t.Errorf("sends ran as %v, want %v", got, want)
+	}
+}
+
+func TestSendQueueOrderUnderLoad(t *testing.T) {
+	q := newSendQueue(0)
+
+	// Several senders each queue a sequence; each sequence must stay in
+	// order even though the senders interleave
+	var mu sync.Mutex
+	seen := make(map[int][]int)
+	var wg sync.WaitGroup
+	for sender := 0; sender < 5; sender++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 2*sendQueueBuffer; n++ {
+				q.enqueue("c1", func() {
+					mu.Lock()
+					seen[sender] = append(seen[sender], n)
+					mu.Unlock()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	q.do("c1", func() {})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for sender, sequence := range seen {
+		if len(sequence) != 2*sendQueueBuffer || !slices.IsSorted(sequence) {
+			t.Errorf("sender %d's sends ran as %v", sender, sequence)
+		}
+	}
+}
+
+func TestSendQueuePacesSends(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	q := newSendQueue(interval)
+
+	var times []time.Time
+	for i := 0; i < 4; i++ {
+		q.do("c1", func() { times = append(times, time.Now()) })
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < interval {
+			t.Errorf("send %d ran %v after the previous, want at least %v", i, gap, interval)
+		}
+	}
+}
+
+// A slow send in one channel doesn't hold up another
+func TestSendQueueChannelsIndependent(t *testing.T) {
+	q := newSendQueue(0)
+
+	release := make(chan struct{})
+	q.enqueue("slow", func() { <-release })
+	defer close(release)
+
+	done := make(chan struct{})
+	go func() {
+		q.do("fast", func() {})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("send in one channel waited on another channel's")
+	}
+}
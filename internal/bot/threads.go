@@ -0,0 +1,176 @@
+// internal/bot/threads.go
+package bot
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// threadArchiveMinutes is how long an answer thread stays open without activity
+const threadArchiveMinutes = 1440
+
+type threadTarget int
+
+const (
+	// threadTargetChannel replies in the channel itself
+	threadTargetChannel threadTarget = iota
+	// threadTargetExisting replies in the thread the question was asked in
+	threadTargetExisting
+	// threadTargetCreate starts a new thread off the question
+	threadTargetCreate
+)
+
+// selectThreadTarget decides where an answer goes when thread replies are
+// enabled. Only text and announcement channels can have threads started from
+// a message; DMs, voice text chats and forums fall back to the channel.
+func selectThreadTarget(enabled bool, channelType discordgo.ChannelType) threadTarget {
+	if !enabled {
+		return threadTargetChannel
+	}
+
+	switch channelType {
+	case discordgo.ChannelTypeGuildPublicThread, discordgo.ChannelTypeGuildPrivateThread, discordgo.ChannelTypeGuildNewsThread:
+		return threadTargetExisting
+	case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews:
+		return threadTargetCreate
+	default:
+		return threadTargetChannel
+	}
+}
+
+// threadName derives a thread title from the question, within Discord's
+// 100 character limit
+func threadName(query string) string {
+	name := strings.Join(strings.Fields(query), " ")
+	if name == "" {
+		return "AI answer"
+	}
+	if len([]rune(name)) > 100 {
+		name = string([]rune(name)[:97]) + "..."
+	}
+	return name
+}
+
+// threadTargetFor is selectThreadTarget for a guild channel, reading the
+// guild's setting. Failures fall back to replying in the channel.
+func (h *BotHandler) threadTargetFor(s *discordgo.Session, guildID, channelID string) threadTarget {
+	if guildID == "" {
+		return threadTargetChannel
+	}
+
+	settings, err := h.db.GetGuildSettings(guildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+		return threadTargetChannel
+	}
+	if !settings.ReplyInThread {
+		return threadTargetChannel
+	}
+
+	channel, err := lookupChannel(s, channelID)
+	if err != nil {
+		log.Printf("Error getting channel %s: %v", channelID, err)
+		return threadTargetChannel
+	}
+	return selectThreadTarget(settings.ReplyInThread, channel.Type)
+}
+
+// replyTarget returns the channel an answer to m should be posted in and
+// whether it should reference m. Failures fall back to replying in place.
+func (h *BotHandler) replyTarget(s *discordgo.Session, m *discordgo.MessageCreate, query string) (channelID string, reference bool) {
+	if h.threadTargetFor(s, m.GuildID, m.ChannelID) != threadTargetCreate {
+		return m.ChannelID, true
+	}
+
+	thread, err := s.MessageThreadStart(m.ChannelID, m.ID, threadName(query), threadArchiveMinutes)
+	if err != nil {
+		log.Printf("Error creating thread in channel %s: %v", m.ChannelID, err)
+		return m.ChannelID, true
+	}
+	// The question is the thread's starter message, so no reply reference
+	return thread.ID, false
+}
+
+// interactionThread opens a thread for the answer to an /ai question when
+// thread replies are enabled. A slash command has no message of its own to
+// start one from, so the deferred response becomes the starter, naming the
+// question. It returns "" if the answer should fill in the response as
+// usual, including when the question was asked in a thread already.
+func (h *BotHandler) interactionThread(s *discordgo.Session, i *discordgo.InteractionCreate, query string) string {
+	if h.threadTargetFor(s, i.GuildID, i.ChannelID) != threadTargetCreate {
+		return ""
+	}
+
+	starter := "🧵 " + truncateMessage(query, 200)
+	msg, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &starter,
+		AllowedMentions: noMassMentions(),
+	})
+	if err != nil {
+		log.Printf("Error editing interaction response: %v", err)
+		return ""
+	}
+	thread, err := s.MessageThreadStart(i.ChannelID, msg.ID, threadName(query), threadArchiveMinutes)
+	if err != nil {
+		log.Printf("Error creating thread in channel %s: %v", i.ChannelID, err)
+		return ""
+	}
+	return thread.ID
+}
+
+func threadsCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "threads",
+		Description:              "Post AI answers to mentions and /ai in threads",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "enabled",
+				Description: "Whether answers should go in threads",
+				Required:    true,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleThreadsInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var enabled bool
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "enabled" {
+			enabled = opt.BoolValue()
+		}
+	}
+
+	settings, err := h.db.GetGuildSettings(i.GuildID)
+	if err == nil {
+		settings.ReplyInThread = enabled
+		err = h.db.SaveGuildSettings(settings)
+	}
+	if err != nil {
+		log.Printf("Error updating thread replies for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not update thread replies.")
+		return
+	}
+
+	log.Printf("Thread replies for guild %s set to %t by %s", i.GuildID, enabled, interactionUsername(i))
+	if enabled {
+		h.editInteraction(s, i, "🧵 I'll answer mentions and `/ai` in threads.")
+	} else {
+		h.editInteraction(s, i, "💬 I'll answer mentions and `/ai` in the channel.")
+	}
+}
@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSelectThreadTarget(t *testing.T) {
+	tests := []struct {
+		enabled     bool
+		channelType discordgo.ChannelType
+		want        threadTarget
+	}{
+		{false, discordgo.ChannelTypeGuildText, threadTargetChannel},
+		{false, discordgo.ChannelTypeGuildPublicThread, threadTargetChannel},
+		{true, discordgo.ChannelTypeGuildText, threadTargetCreate},
+		{true, discordgo.ChannelTypeGuildNews, threadTargetCreate},
+		{true, discordgo.ChannelTypeGuildPublicThread, threadTargetExisting},
+		{true, discordgo.ChannelTypeGuildPrivateThread, threadTargetExisting},
+		{true, discordgo.ChannelTypeGuildNewsThread, threadTargetExisting},
+		{true, discordgo.ChannelTypeDM, threadTargetChannel},
+		{true, discordgo.ChannelTypeGuildVoice, threadTargetChannel},
+		{true, discordgo.ChannelTypeGuildForum, threadTargetChannel},
+	}
+	for _, tt := range tests {
+		if got := selectThreadTarget(tt.enabled, tt.channelType); got != tt.want {
+			t.Errorf("selectThreadTarget(%v, %d) = %d, want %d", tt.enabled, tt.channelType, got, tt.want)
+		}
+	}
+}
+
+func TestThreadName(t *testing.T) {
+	if got := threadName("  what   happened\nyesterday? "); got != "what happened yesterday?" {
+		t.Errorf("threadName = %q, want the question on one line", got)
+	}
+	if got := threadName(" \n "); got != "AI answer" {
+		t.Errorf("threadName of a blank question = %q", got)
+	}
+
+	long := threadName(strings.Repeat("é", 150))
+	if n := utf8.RuneCountInString(long); n != 100 || !strings.HasSuffix(long, "...") {
+		t.Errorf("threadName of a long question has %d characters (%q), want 100 ending in ...", n, long)
+	}
+}
+
+// DMs never get threads, and deciding that reads no guild settings: the
+// handler has no database, so looking them up would panic
+func TestReplyTargetInDM(t *testing.T) {
+	s, fake := newFakeSession(t)
+	h := &BotHandler{cfg: &config.Config{}}
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ID: "m1", ChannelID: "dm"}}
+
+	channelID, reference := h.replyTarget(s, m, "what happened?")
+	if channelID != "dm" || !reference {
+		t.Errorf("replyTarget = %q, %v; want a reply in the DM", channelID, reference)
+	}
+	if threadID := h.interactionThread(s, &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{ChannelID: "dm"}}, "what happened?"); threadID != "" {
+		t.Errorf("interactionThread = %q in a DM, want none", threadID)
+	}
+	if calls := fake.calls(); len(calls) != 0 {
+		t.Errorf("requests = %+v, want none", calls)
+	}
+}
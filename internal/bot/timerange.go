@@ -0,0 +1,64 @@
+// internal/bot/timerange.go
+package bot
+
+import (
+	"discord-rag-bot/internal/database"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeRangeChoices are the values of the /ai "since" option
+var timeRangeChoices = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+var pastDaysPattern = regexp.MustCompile(`\b(?:past|last) (\d{1,3}) days?\b`)
+
+// startOfDay truncates t to midnight in its location
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// parseQueryTimeRange recognizes common relative time phrases in a question,
+// such as "today", "this week" or "past 3 days". The second result is false
+// if the question has none.
+func parseQueryTimeRange(query string, now time.Time) (database.TimeRange, bool) {
+	q := strings.ToLower(query)
+	today := startOfDay(now)
+
+	if match := pastDaysPattern.FindStringSubmatch(q); match != nil {
+		days, _ := strconv.Atoi(match[1])
+		if days > 0 {
+			return database.TimeRange{Since: now.AddDate(0, 0, -days).Truncate(time.Minute)}, true
+		}
+	}
+
+	switch {
+	case strings.Contains(q, "yesterday"):
+		return database.TimeRange{Since: today.AddDate(0, 0, -1), Until: today}, true
+	case strings.Contains(q, "today"):
+		return database.TimeRange{Since: today}, true
+	case strings.Contains(q, "last week"):
+		return database.TimeRange{Since: today.AddDate(0, 0, -14), Until: today.AddDate(0, 0, -7)}, true
+	case strings.Contains(q, "this week"):
+		return database.TimeRange{Since: today.AddDate(0, 0, -7)}, true
+	case strings.Contains(q, "this month"):
+		return database.TimeRange{Since: today.AddDate(0, 0, -30)}, true
+	}
+	return database.TimeRange{}, false
+}
+
+// resolveTimeRange picks the retrieval window for a question: an explicit
+// choice wins over phrases in the question itself
+func resolveTimeRange(query, choice string, now time.Time) database.TimeRange {
+	if window, ok := timeRangeChoices[choice]; ok {
+		return database.TimeRange{Since: now.Add(-window).Truncate(time.Minute)}
+	}
+	timeRange, _ := parseQueryTimeRange(query, now)
+	return timeRange
+}
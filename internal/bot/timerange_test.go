@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/database"
+	"testing"
+	"time"
+)
+
+func TestParseQueryTimeRange(t *testing.T) {
+	now := time.Date(2024, 3, 15, 18, 30, 45, 0, time.UTC)
+	today := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query string
+		want  database.TimeRange
+		found bool
+	}{
+		{"what happened today?", database.TimeRange{Since: today}, true},
+		{"What did Bob say YESTERDAY", database.TimeRange{Since: today.AddDate(0, 0, -1), Until: today}, true},
+		{"plans this week", database.TimeRange{Since: today.AddDate(0, 0, -7)}, true},
+		{"what did we decide last week", database.TimeRange{Since: today.AddDate(0, 0, -14), Until: today.AddDate(0, 0, -7)}, true},
+		{"news this month", database.TimeRange{Since: today.AddDate(0, 0, -30)}, true},
+		{"anything in the past 3 days", database.TimeRange{Since: time.Date(2024, 3, 12, 18, 30, 0, 0, time.UTC)}, true},
+		{"last 1 day", database.TimeRange{Since: time.Date(2024, 3, 14, 18, 30, 0, 0, time.UTC)}, true},
+		// An explicit day count wins over other phrases
+		{"today and the past 2 days", database.TimeRange{Since: time.Date(2024, 3, 13, 18, 30, 0, 0, time.UTC)}, true},
+		{"past 0 days", database.TimeRange{}, false},
+		{"when is game night?", database.TimeRange{}, false},
+		{"the weekend", database.TimeRange{}, false},
+	}
+	for _, tt := range tests {
+		got, found := parseQueryTimeRange(tt.query, now)
+		if found != tt.found || !got.Since.Equal(tt.want.Since) || !got.Until.Equal(tt.want.Until) {
+			t.Errorf("parseQueryTimeRange(%q) = %+v, %v, want %+v, %v", tt.query, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestParseQueryTimeRangeLocalMidnight(t *testing.T) {
+	paris := time.FixedZone("CET", 3600)
+	now := time.Date(2024, 3, 15, 0, 30, 0, 0, paris)
+
+	got, _ := parseQueryTimeRange("today", now)
+	if want := time.Date(2024, 3, 15, 0, 0, 0, 0, paris); !got.Since.Equal(want) {
+		t.Errorf("today starts at %v, want local midnight %v", got.Since, want)
+	}
+}
+
+func TestResolveTimeRange(t *testing.T) {
+	now := time.Date(2024, 3, 15, 18, 30, 45, 0, time.UTC)
+
+	// The "since" option wins over phrases in the question
+	got := resolveTimeRange("what happened today?", "week", now)
+	if want := time.Date(2024, 3, 8, 18, 30, 0, 0, time.UTC); !got.Since.Equal(want) || !got.Until.IsZero() {
+		t.Errorf("resolveTimeRange with since=week = %+v, want since %v", got, want)
+	}
+
+	got = resolveTimeRange("what happened today?", "", now)
+	if want := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC); !got.Since.Equal(want) {
+		t.Errorf("resolveTimeRange without a choice = %+v, want since %v", got, want)
+	}
+
+	if got := resolveTimeRange("when is game night?", "fortnight", now); !got.IsZero() {
+		t.Errorf("resolveTimeRange with an unknown choice = %+v, want no range", got)
+	}
+}
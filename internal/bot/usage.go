@@ -0,0 +1,76 @@
+// internal/bot/usage.go
+package bot
+
+import (
+	"discord-rag-bot/internal/ai"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func usageCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "usage",
+		Description:              "Show this server's OpenAI token usage and estimated spend",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "days",
+				Description: "How many days to include (default 30)",
+				Required:    false,
+				MinValue:    &[]float64{1}[0],
+				MaxValue:    365,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleUsageInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	days := 30
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "days" {
+			days = int(opt.IntValue())
+		}
+	}
+
+	since := time.Now().AddDate(0, 0, -(days - 1))
+	usage, err := h.db.GetUsageSince(i.GuildID, since)
+	if err != nil {
+		log.Printf("Error loading usage for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not load usage.")
+		return
+	}
+
+	if len(usage) == 0 {
+		h.editInteraction(s, i, fmt.Sprintf("No usage recorded in the last %d days.", days))
+		return
+	}
+
+	var lines []string
+	var totalCost float64
+	for _, u := range usage {
+		cost := ai.EstimateCost(u.Model, int(u.PromptTokens), int(u.CompletionTokens))
+		totalCost += cost
+		lines = append(lines, fmt.Sprintf("• `%s`: %d requests, %d prompt + %d completion tokens (~$%.4f)",
+			u.Model, u.Requests, u.PromptTokens, u.CompletionTokens, cost))
+	}
+
+	h.editInteraction(s, i, truncateMessage(fmt.Sprintf("📊 **Usage, last %d days**\n%s\n\nEstimated spend: **~$%.2f**",
+		days, strings.Join(lines, "\n"), totalCost), 2000))
+}
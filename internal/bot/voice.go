@@ -4,7 +4,8 @@ package bot
 import (
 	"bytes"
 	"context"
-	"encoding/binary"
+	"discord-rag-bot/internal/ai"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,12 +13,30 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"golang.org/x/sync/semaphore"
 	"layeh.com/gopus"
 )
 
+const (
+	// whisperMaxFileBytes is the transcription API's upload limit
+	whisperMaxFileBytes = 25 << 20
+	// wavBytesPerSecond is the data rate of the 16kHz mono WAV sent for
+	// transcription
+	wavBytesPerSecond = 16000 * 2
+	wavHeaderBytes    = 44
+)
+
+// voiceErrorReply replaces the processing status when answering fails
+const voiceErrorReply = "⚠️ Sorry, something went wrong while answering."
+
+// maxWhisperDuration is the longest recording whose WAV fits the upload limit
+// in one piece; longer ones are transcribed in segments
+const maxWhisperDuration = time.Duration(whisperMaxFileBytes-wavHeaderBytes) * time.Second / wavBytesPerSecond
+
 type VoiceConnection struct {
 	Connection   *discordgo.VoiceConnection
 	GuildID      string
@@ -31,38 +50,239 @@ type VoiceConnection struct {
 	mu           sync.RWMutex
 	ctx          context.Context
 	cancel       context.CancelFunc
+	ssrcUsers    map[uint32]string      // SSRC -> Discord user ID, from speaking updates
+	speakerSSRC  uint32                 // SSRC of the audio currently being recorded
+	playing      atomic.Bool            // Set while the bot is sending audio
+	stream       ai.TranscriptionStream // Live transcription of the current recording, if streaming
+	backlog      []byte                 // Audio recorded before stream opened, not yet sent to it
+	streamed     int                    // Bytes sent to stream, capped like batch recordings
+	lastSpoken   spokenResponse         // Last answer played, for echo suppression
+	users        sync.WaitGroup         // Playbacks holding the connection open
+	closing      bool                   // Set once teardown starts; guarded by mu
+	pushToTalk   bool                   // Record only armed users; guarded by mu
+	armedUser    string                 // User allowed to start a recording in push-to-talk mode
+	armedUntil   time.Time              // When armedUser's turn lapses
+	// transcriptions holds each speaker's transcription slots; guarded by mu
+	transcriptions map[string]*semaphore.Weighted
+}
+
+// conn returns the underlying Discord connection, which a reconnect may swap
+func (vc *VoiceConnection) conn() *discordgo.VoiceConnection {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	return vc.Connection
+}
+
+// closedPackets stands in for the receive channel of a connection that is
+// gone, so the listener reconnects rather than dereferencing it
+var closedPackets = func() chan *discordgo.Packet {
+	packets := make(chan *discordgo.Packet)
+	close(packets)
+	return packets
+}()
+
+// opusRecv is the channel the connection delivers received audio on
+func (vc *VoiceConnection) opusRecv() <-chan *discordgo.Packet {
+	conn := vc.conn()
+	if conn == nil || conn.OpusRecv == nil {
+		return closedPackets
+	}
+	return conn.OpusRecv
+}
+
+// acquire holds the connection open for playback until release is called.
+// It fails once the connection is being torn down.
+func (vc *VoiceConnection) acquire() bool {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if vc.closing {
+		return false
+	}
+	vc.users.Add(1)
+	return true
+}
+
+func (vc *VoiceConnection) release() {
+	vc.users.Done()
+}
+
+// close stops the connection's work, waits for in-flight playback to notice
+// and let go, then disconnects. Playback checks the cancelled context
+// between frames, so the wait is short.
+func (vc *VoiceConnection) close() error {
+	vc.mu.Lock()
+	vc.closing = true
+	vc.mu.Unlock()
+
+	if vc.cancel != nil {
+		vc.cancel()
+	}
+	vc.users.Wait()
+
+	if conn := vc.conn(); conn != nil {
+		return conn.Disconnect()
+	}
+	return nil
+}
+
+// trackSpeakers records SSRC to user mappings as members start speaking
+func (vc *VoiceConnection) trackSpeakers(conn *discordgo.VoiceConnection) {
+	conn.AddHandler(func(_ *discordgo.VoiceConnection, vs *discordgo.VoiceSpeakingUpdate) {
+		vc.mu.Lock()
+		vc.ssrcUsers[uint32(vs.SSRC)] = vs.UserID
+		vc.mu.Unlock()
+	})
+}
+
+// userForSSRC resolves the speaker of an SSRC, falling back to the user who
+// asked the bot to join
+func (vc *VoiceConnection) userForSSRC(ssrc uint32) string {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	if userID, ok := vc.ssrcUsers[ssrc]; ok {
+		return userID
+	}
+	return vc.UserId
+}
+
+// isSelfSSRC reports whether an SSRC belongs to the bot itself: either it is
+// mapped to the bot's user ID by a speaking update, or the bot is currently
+// playing audio and the SSRC was never announced by any member
+func (vc *VoiceConnection) isSelfSSRC(ssrc uint32, botID string) bool {
+	vc.mu.RLock()
+	userID, known := vc.ssrcUsers[ssrc]
+	vc.mu.RUnlock()
+
+	if known {
+		return botID != "" && userID == botID
+	}
+	return vc.playing.Load()
 }
 
 type VoiceManager struct {
+	// connections is keyed by guild ID: Discord gives a bot at most one
+	// voice connection per guild, so the bot can only be in one voice
+	// channel of a guild at a time. Under sharding each shard's session
+	// only sees its own guilds, so a manager per session needs no more.
 	connections map[string]*VoiceConnection
 	mu          sync.RWMutex
 	handler     *BotHandler
+	history     *voiceHistory
+	frameSize   int      // Opus frame size for playback, in samples per channel
+	glossaries  sync.Map // Guild ID -> *glossary, auto-built prompt terms
+	// joins serializes joins per guild, so two /join calls racing for the
+	// same guild can't tear down each other's connection. Guarded by mu.
+	joins map[string]*sync.Mutex
 }
 
 func NewVoiceManager(handler *BotHandler) *VoiceManager {
+	frameSize := handler.cfg.Voice.FrameSize
+	if !validOpusFrameSize(frameSize) {
+		log.Printf("Invalid Opus frame size %d, using %d", frameSize, defaultOpusFrameSize)
+		frameSize = defaultOpusFrameSize
+	}
+
 	return &VoiceManager{
 		connections: make(map[string]*VoiceConnection),
+		joins:       make(map[string]*sync.Mutex),
 		handler:     handler,
+		history:     newVoiceHistory(handler.cfg.Voice.HistoryTurns, handler.cfg.Voice.HistoryTTL),
+		frameSize:   frameSize,
 	}
 }
 
-// Replace the JoinVoiceChannel function in voice.go
-func (vm *VoiceManager) JoinVoiceChannel(s *discordgo.Session, guildID, channelID, userID string) error {
+// connection returns the guild's active voice connection. It is safe to call
+// on a nil manager, which has no connections.
+func (vm *VoiceManager) connection(guildID string) (*VoiceConnection, bool) {
+	if vm == nil {
+		return nil, false
+	}
+
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+
+	vc, ok := vm.connections[guildID]
+	return vc, ok
+}
+
+// connectionCount is how many guilds have an active voice connection. It is
+// safe to call on a nil manager.
+func (vm *VoiceManager) connectionCount() int {
+	if vm == nil {
+		return 0
+	}
+
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	return len(vm.connections)
+}
+
+// VoiceBusyError is returned when joining a voice channel while the bot is
+// in another channel of the same guild
+type VoiceBusyError struct {
+	ChannelID string
+}
+
+func (e *VoiceBusyError) Error() string {
+	return fmt.Sprintf("already in voice channel %s in this server", e.ChannelID)
+}
+
+// joinLock returns the lock serializing joins in a guild
+func (vm *VoiceManager) joinLock(guildID string) *sync.Mutex {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 
-	// Leave existing connection if any
-	if existingConn, exists := vm.connections[guildID]; exists {
-		if existingConn.cancel != nil {
-			existingConn.cancel()
-		}
-		if existingConn.Connection != nil {
-			existingConn.Connection.Disconnect()
-		}
-		delete(vm.connections, guildID)
+	lock, ok := vm.joins[guildID]
+	if !ok {
+		lock = &sync.Mutex{}
+		vm.joins[guildID] = lock
+	}
+	return lock
+}
+
+// JoinVoiceChannel connects to a voice channel and starts listening. Joins
+// in the same guild run one at a time: a join that waited on another one
+// reaching the same channel keeps that connection instead of reconnecting.
+func (vm *VoiceManager) JoinVoiceChannel(s *discordgo.Session, guildID, channelID, userID string) error {
+	seen, _ := vm.connection(guildID)
+
+	lock := vm.joinLock(guildID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	vm.mu.Lock()
+	existingConn, exists := vm.connections[guildID]
+
+	// The bot can't be in two channels of a guild, and moving it would cut
+	// off whoever is talking to it
+	if exists && existingConn.ChannelID != channelID {
+		vm.mu.Unlock()
+		return &VoiceBusyError{ChannelID: existingConn.ChannelID}
+	}
+
+	// A concurrent join got there first; its connection is as fresh as
+	// this one would be
+	if exists && existingConn != seen {
+		vm.mu.Unlock()
+		log.Printf("Voice channel %s in guild %s was joined concurrently, keeping that connection", channelID, guildID)
+		return nil
+	}
+
+	// Rejoining the same channel reconnects
+	delete(vm.connections, guildID)
+	vm.mu.Unlock()
+
+	if exists {
+		// Waits for playback to stop, so done outside the manager lock
+		existingConn.close()
 		time.Sleep(1 * time.Second) // Wait for cleanup
 	}
 
+	// Connecting can take several seconds, so the manager lock isn't held
+	// meanwhile; the guild's join lock keeps other joins out.
+
 	// Join voice channel with retry logic
 	var voiceConn *discordgo.VoiceConnection
 	var err error
@@ -133,9 +353,14 @@ ready:
 		encoder:      encoder,
 		ctx:          ctx,
 		cancel:       cancel,
+		ssrcUsers:    make(map[uint32]string),
+		pushToTalk:   vm.handler.voiceMode(guildID) == voiceModePushToTalk,
 	}
+	vc.trackSpeakers(voiceConn)
 
+	vm.mu.Lock()
 	vm.connections[guildID] = vc
+	vm.mu.Unlock()
 
 	// Start listening for voice data with context
 	go vm.listenForVoice(vc)
@@ -144,55 +369,101 @@ ready:
 	return nil
 }
 
-func (vm *VoiceManager) LeaveVoiceChannel(guildID string) error {
-	vm.mu.Lock()
-	defer vm.mu.Unlock()
+// LeaveVoiceChannel disconnects from a guild's voice channel. With a
+// channel ID, it only leaves if the bot is in that channel, so a stale
+// caller can't drop a newer connection; an empty channel ID leaves any.
+// A join in progress in the guild is finished first, so it can't reconnect
+// right after the leave.
+func (vm *VoiceManager) LeaveVoiceChannel(guildID, channelID string) error {
+	lock := vm.joinLock(guildID)
+	lock.Lock()
+	defer lock.Unlock()
 
+	vm.mu.Lock()
 	vc, exists := vm.connections[guildID]
+	if exists && channelID != "" && vc.ChannelID != channelID {
+		vm.mu.Unlock()
+		return fmt.Errorf("not connected to voice channel %s in guild %s", channelID, guildID)
+	}
+	delete(vm.connections, guildID)
+	vm.mu.Unlock()
+
 	if !exists {
 		return fmt.Errorf("not connected to voice channel in guild %s", guildID)
 	}
 
-	// Cancel context and disconnect
-	if vc.cancel != nil {
-		vc.cancel()
-	}
-	if vc.Connection != nil {
-		vc.Connection.Disconnect()
+	// Waits for playback to stop, so done outside the manager lock
+	if err := vc.close(); err != nil {
+		log.Printf("Error disconnecting voice in guild %s: %v", guildID, err)
 	}
-	delete(vm.connections, guildID)
 
 	log.Printf("Left voice channel in guild %s", guildID)
 	return nil
 }
 
+// ResetVoiceConnection forcibly drops a guild's voice connection state, even
+// if it never became ready. It reports whether there was anything to reset.
+func (vm *VoiceManager) ResetVoiceConnection(guildID string) bool {
+	vm.mu.Lock()
+	vc, exists := vm.connections[guildID]
+	delete(vm.connections, guildID)
+	vm.mu.Unlock()
+
+	if !exists {
+		return false
+	}
+
+	// A wedged connection may block on disconnect; don't hold up the caller
+	go func() {
+		if err := vc.close(); err != nil {
+			log.Printf("Error disconnecting reset voice connection in guild %s: %v", guildID, err)
+		}
+	}()
+
+	log.Printf("Reset voice connection state in guild %s", guildID)
+	return true
+}
+
 func (vm *VoiceManager) HandleVoiceStateUpdate(s *discordgo.Session, vsu *discordgo.VoiceStateUpdate) {
 	log.Printf("Voice state update: User %s in guild %s", vsu.UserID, vsu.GuildID)
 }
 
-func (vm *VoiceManager) SendAudio(vc *VoiceConnection, audioData []byte) error {
-	if vc.Connection == nil {
+func (vm *VoiceManager) SendAudio(vc *VoiceConnection, audioData []byte, format ai.AudioFormat) error {
+	if vc.conn() == nil {
 		return fmt.Errorf("no voice connection")
 	}
 
-	// Create temp files with unique names
-	tempID := time.Now().UnixNano()
-	tempFile := fmt.Sprintf("/tmp/tts_%d.mp3", tempID)
-	pcmFile := fmt.Sprintf("/tmp/pcm_%d.pcm", tempID)
+	// Already in the playback format, so there is nothing to convert
+	if format == ai.AudioFormatPCM {
+		return vm.playPCM(vc, bytes.NewReader(audioData))
+	}
 
-	// Cleanup
-	defer func() {
-		os.Remove(tempFile)
-		os.Remove(pcmFile)
-	}()
+	// Create temp files with unique names under the configured directory
+	audioFile, err := os.CreateTemp(vm.handler.cfg.Voice.TempDir, "tts-*"+format.Extension())
+	if err != nil {
+		return fmt.Errorf("failed to create temp audio file: %v", err)
+	}
+	defer os.Remove(audioFile.Name())
+	defer audioFile.Close()
+
+	pcmTemp, err := os.CreateTemp(vm.handler.cfg.Voice.TempDir, "tts-*.pcm")
+	if err != nil {
+		return fmt.Errorf("failed to create temp PCM file: %v", err)
+	}
+	defer os.Remove(pcmTemp.Name())
+	pcmTemp.Close()
+
+	tempFile := audioFile.Name()
+	pcmFile := pcmTemp.Name()
 
-	// Save MP3 file
-	if err := os.WriteFile(tempFile, audioData, 0644); err != nil {
+	// Save synthesized audio
+	if _, err := audioFile.Write(audioData); err != nil {
 		return fmt.Errorf("error saving audio file: %v", err)
 	}
+	audioFile.Close()
 
-	// Convert MP3 to PCM using FFmpeg
-	if err := vm.convertToPCM(tempFile, pcmFile); err != nil {
+	// Convert to PCM using FFmpeg
+	if err := vm.convertToPCM(tempFile, pcmFile, format); err != nil {
 		return fmt.Errorf("error converting to PCM: %v", err)
 	}
 
@@ -200,13 +471,16 @@ func (vm *VoiceManager) SendAudio(vc *VoiceConnection, audioData []byte) error {
 	return vm.playPCMFile(vc, pcmFile)
 }
 
-func (vm *VoiceManager) convertToPCM(inputFile, outputFile string) error {
-	log.Printf("Converting %s to PCM format", inputFile)
+// convertToPCM decodes a synthesized clip to raw 48kHz stereo PCM, telling
+// FFmpeg the input format rather than letting it probe
+func (vm *VoiceManager) convertToPCM(inputFile, outputFile string, format ai.AudioFormat) error {
+	log.Printf("Converting %s (%s) to PCM format", inputFile, format)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-f", format.Demuxer(),
 		"-i", inputFile,
 		"-f", "s16le", // 16-bit signed little-endian
 		"-ar", "48000", // 48kHz sample rate
@@ -228,23 +502,39 @@ func (vm *VoiceManager) convertToPCM(inputFile, outputFile string) error {
 func (vm *VoiceManager) playPCMFile(vc *VoiceConnection, filename string) error {
 	log.Printf("Playing PCM audio file: %s", filename)
 
-	// First check if connection is still valid
-	if vc.Connection == nil || !vc.Connection.Ready {
-		return fmt.Errorf("voice connection no longer valid")
-	}
-
 	file, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("error opening PCM file: %v", err)
 	}
 	defer file.Close()
 
+	return vm.playPCM(vc, file)
+}
+
+// playPCM encodes raw 48kHz stereo PCM to Opus and sends it to the channel.
+// The connection is held open until playback ends, so a concurrent leave
+// stops it between frames instead of disconnecting mid-send.
+func (vm *VoiceManager) playPCM(vc *VoiceConnection, pcm io.Reader) error {
+	if !vc.acquire() {
+		return fmt.Errorf("voice connection closed")
+	}
+	defer vc.release()
+
+	// First check if connection is still valid
+	conn := vc.conn()
+	if conn == nil || !conn.Ready {
+		return fmt.Errorf("voice connection no longer valid")
+	}
+
 	// Signal that we're speaking
-	vc.Connection.Speaking(true)
-	defer vc.Connection.Speaking(false)
+	conn.Speaking(true)
+	defer conn.Speaking(false)
+
+	vc.playing.Store(true)
+	defer vc.playing.Store(false)
 
 	// Read and encode PCM data in chunks
-	buffer := make([]byte, 3840) // 960 samples * 2 channels * 2 bytes per sample
+	buffer := make([]byte, opusFrameBytes(vm.frameSize))
 	framesSent := 0
 	timeoutCount := 0
 	maxTimeouts := 10 // Maximum consecutive timeouts before giving up
@@ -256,26 +546,25 @@ func (vm *VoiceManager) playPCMFile(vc *VoiceConnection, filename string) error
 		default:
 		}
 
-		n, err := file.Read(buffer)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+		n, err := io.ReadFull(pcm, buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
 			return fmt.Errorf("error reading PCM data: %v", err)
 		}
 
-		if n == 0 {
-			continue
+		// Pad a short final chunk with silence so the encoder always gets a
+		// whole frame, including when the file ends on a partial sample
+		if n < len(buffer) {
+			clear(buffer[n:])
 		}
 
 		// Convert bytes to int16 samples
-		samples := make([]int16, n/2)
-		for i := 0; i < len(samples); i++ {
-			samples[i] = int16(binary.LittleEndian.Uint16(buffer[i*2 : i*2+2]))
-		}
+		samples := pcmBytesToSamples(buffer)
 
 		// Encode to Opus
-		opusData, err := vc.encoder.Encode(samples, 960, 960)
+		opusData, err := vc.encoder.Encode(samples, vm.frameSize, opusMaxPacketBytes)
 		if err != nil {
 			log.Printf("Error encoding to Opus: %v", err)
 			continue
@@ -283,7 +572,7 @@ func (vm *VoiceManager) playPCMFile(vc *VoiceConnection, filename string) error
 
 		// Send to Discord with improved timeout handling
 		select {
-		case vc.Connection.OpusSend <- opusData:
+		case conn.OpusSend <- opusData:
 			framesSent++
 			timeoutCount = 0 // Reset timeout counter on success
 		case <-time.After(100 * time.Millisecond):
@@ -305,6 +594,10 @@ func (vm *VoiceManager) playPCMFile(vc *VoiceConnection, filename string) error
 	return nil
 }
 
+// voiceReconnectDelay is the wait before the first attempt to reconnect
+// a connection whose receive channel closed, growing with each attempt
+var voiceReconnectDelay = 2 * time.Second
+
 func (vm *VoiceManager) listenForVoice(vc *VoiceConnection) {
 	log.Printf("Started listening for voice in guild %s", vc.GuildID)
 
@@ -313,25 +606,35 @@ func (vm *VoiceManager) listenForVoice(vc *VoiceConnection) {
 
 	for {
 		select {
-		case packet, ok := <-vc.Connection.OpusRecv:
+		case packet, ok := <-vc.opusRecv():
 			if !ok {
-				// Channel closed, try to reconnect
+				// Channel closed: every further receive would return at
+				// once, so reconnect instead of spinning on it
 				reconnectAttempts++
 				if reconnectAttempts <= maxReconnectAttempts {
 					log.Printf("Voice receive channel closed, attempting reconnection %d/%d",
 						reconnectAttempts, maxReconnectAttempts)
 
-					// Wait a bit before trying to reconnect
-					time.Sleep(2 * time.Second)
+					// Wait a bit before trying to reconnect, unless the
+					// bot is leaving anyway
+					select {
+					case <-time.After(time.Duration(reconnectAttempts) * voiceReconnectDelay):
+					case <-vc.ctx.Done():
+						log.Printf("Voice listening stopped for guild %s", vc.GuildID)
+						return
+					}
 
 					// Attempt to reconnect
-					if err := vm.reconnectVoice(vc); err != nil {
+					if err := vm.reconnectVoice(vc); errors.Is(err, errVoiceReplaced) {
+						log.Printf("Voice listening stopped for guild %s: %v", vc.GuildID, err)
+						return
+					} else if err != nil {
 						log.Printf("Failed to reconnect: %v", err)
 						continue
 					}
 				} else {
 					log.Printf("Maximum reconnection attempts reached, giving up")
-					vm.LeaveVoiceChannel(vc.GuildID)
+					vm.LeaveVoiceChannel(vc.GuildID, vc.ChannelID)
 					return
 				}
 			} else if packet != nil && packet.Opus != nil {
@@ -349,7 +652,7 @@ func (vm *VoiceManager) listenForVoice(vc *VoiceConnection) {
 
 			if inactive {
 				log.Printf("Voice connection inactive, disconnecting from guild %s", vc.GuildID)
-				vm.LeaveVoiceChannel(vc.GuildID)
+				vm.LeaveVoiceChannel(vc.GuildID, vc.ChannelID)
 				return
 			}
 		}
@@ -362,13 +665,18 @@ func (vm *VoiceManager) processVoicePacket(vc *VoiceConnection, packet *discordg
 		return
 	}
 
-	// Skip packets from the bot itself
-	if packet.SSRC == 0 {
+	// Skip packets from the bot itself so it never transcribes its own TTS
+	if vc.isSelfSSRC(packet.SSRC, vm.handler.currentBotID(vm.handler.session)) {
+		return
+	}
+
+	// In push-to-talk mode nothing is recorded until someone asks to be heard
+	if !vc.listening(packet.SSRC, time.Now()) {
 		return
 	}
 
 	// Decode opus data to PCM
-	pcmData, err := vc.decoder.Decode(packet.Opus, 960, false)
+	pcmData, err := vc.decoder.Decode(packet.Opus, opusMaxFrameSize, false)
 	if err != nil {
 		if !strings.Contains(err.Error(), "invalid packet") {
 			log.Printf("Error decoding opus: %v", err)
@@ -381,31 +689,130 @@ func (vm *VoiceManager) processVoicePacket(vc *VoiceConnection, packet *discordg
 	}
 
 	// Convert int16 samples to bytes
-	pcmBytes := make([]byte, len(pcmData)*2)
-	for i, sample := range pcmData {
-		binary.LittleEndian.PutUint16(pcmBytes[i*2:], uint16(sample))
-	}
+	pcmBytes := samplesToPCMBytes(pcmData)
 
 	// Buffer the audio data
 	vc.mu.Lock()
 	vc.AudioBuffer.Write(pcmBytes)
 	vc.LastActivity = time.Now()
 
+	// Streaming happens after unlocking so a slow provider doesn't stall
+	// everything else waiting on the connection. Packets are handled one
+	// at a time, so writes stay in order.
+	stream, streamed := vc.stream, pcmBytes
+	if stream != nil {
+		if vc.backlog != nil {
+			streamed = append(vc.backlog, pcmBytes...)
+			vc.backlog = nil
+		}
+		streamed = vc.capStreamed(streamed, pcmBytesForDuration(vm.maxRecordingDuration()))
+	}
+
 	// Start recording if not already recording
 	if !vc.IsRecording {
 		vc.IsRecording = true
+		vc.speakerSSRC = packet.SSRC
 		go vm.handleVoiceRecording(vc)
 	}
 	vc.mu.Unlock()
+
+	if stream != nil && len(streamed) > 0 {
+		vc.writeTranscriptionStream(stream, streamed)
+	}
+}
+
+// capStreamed cuts audio about to be streamed so a stream never hears more
+// than limit bytes, the most a batch transcription is sent, and counts it
+// as sent. The caller holds mu.
+func (vc *VoiceConnection) capStreamed(pcm []byte, limit int) []byte {
+	remaining := max(limit-vc.streamed, 0)
+	if len(pcm) > remaining {
+		pcm = pcm[:remaining]
+	}
+	vc.streamed += len(pcm)
+	return pcm
+}
+
+// writeTranscriptionStream sends audio to the recording's stream. If that
+// fails, the stream is dropped and the buffer is transcribed in batch
+// instead, unless the recording already finished with it.
+func (vc *VoiceConnection) writeTranscriptionStream(stream ai.TranscriptionStream, pcm []byte) {
+	if err := stream.Write(pcm); err != nil {
+		vc.mu.Lock()
+		current := vc.stream == stream
+		if current {
+			vc.stream = nil
+			vc.backlog = nil
+		}
+		vc.mu.Unlock()
+
+		if current {
+			log.Printf("Error streaming audio for transcription: %v", err)
+			stream.Abort()
+		}
+	}
+}
+
+// startTranscriptionStream opens a streaming transcription for the recording
+// that just started, if enabled and supported by the provider. Audio buffered
+// so far is sent first, along with the next packet; processVoicePacket
+// streams the rest.
+func (vm *VoiceManager) startTranscriptionStream(vc *VoiceConnection) {
+	if !vm.handler.cfg.Voice.StreamingTranscription {
+		return
+	}
+	streamer, ok := vm.handler.transcriber.(ai.StreamingTranscriber)
+	if !ok {
+		return
+	}
+
+	stream, err := streamer.StartStream(vc.ctx, ai.StreamOptions{
+		TranscribeOptions: vm.transcribeOptions(vc.GuildID),
+		SampleRate:        48000,
+		Channels:          pcmChannels,
+		OnPartial: func(text string) {
+			log.Printf("Partial transcription from guild %s: %s", vc.GuildID, text)
+		},
+	})
+	if err != nil {
+		log.Printf("Error starting streaming transcription, using batch mode: %v", err)
+		return
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if !vc.IsRecording {
+		stream.Abort()
+		return
+	}
+	vc.backlog = alignPCM(bytes.Clone(vc.AudioBuffer.Bytes()))
+	vc.stream = stream
+	vc.streamed = 0
+}
+
+// takeTranscriptionStream detaches the current recording's stream, if any
+func (vc *VoiceConnection) takeTranscriptionStream() ai.TranscriptionStream {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	stream := vc.stream
+	vc.stream = nil
+	vc.backlog = nil
+	return stream
 }
 
 func (vm *VoiceManager) handleVoiceRecording(vc *VoiceConnection) {
+	vm.startTranscriptionStream(vc)
+	window := vm.newSlidingWindow(vc)
+
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
 
 	lastBufferSize := 0
 	silenceCount := 0
 	maxRecordingTime := 300 // 30 seconds max
+	minBytes := pcmBytesForDuration(vm.handler.cfg.Voice.MinDuration)
 
 	for {
 		select {
@@ -421,133 +828,325 @@ func (vm *VoiceManager) handleVoiceRecording(vc *VoiceConnection) {
 				lastBufferSize = currentSize
 			}
 
-			// 2 seconds of silence and sufficient audio data (at least 16KB)
-			if silenceCount >= 20 && currentSize > 16000 {
-				vm.processRecordedAudio(vc)
+			// 2 seconds of silence and sufficient audio data
+			if silenceCount >= 20 && currentSize >= minBytes {
+				vm.processRecordedAudio(vc, window)
 				return
 			}
 
 			// Maximum recording time reached
 			if silenceCount >= maxRecordingTime {
-				if currentSize > 16000 {
+				if currentSize >= minBytes || window.started() {
 					log.Printf("Max recording time reached, processing %d bytes", currentSize)
-					vm.processRecordedAudio(vc)
+					vm.processRecordedAudio(vc, window)
 				} else {
-					log.Printf("Max recording time reached but insufficient audio data (%d bytes), discarding", currentSize)
+					log.Printf("Max recording time reached but insufficient audio (%v), discarding", pcmDuration(currentSize))
 					vc.mu.Lock()
 					vc.AudioBuffer.Reset()
 					vc.IsRecording = false
 					vc.mu.Unlock()
+					if stream := vc.takeTranscriptionStream(); stream != nil {
+						stream.Abort()
+					}
 				}
 				return
 			}
 
+			// Trimming isn't new audio, so it mustn't count as speech
+			if silenceCount == 0 {
+				lastBufferSize -= window.advance(vc)
+			}
+
 		case <-vc.ctx.Done():
 			log.Printf("Voice recording cancelled for guild %s", vc.GuildID)
+			if stream := vc.takeTranscriptionStream(); stream != nil {
+				stream.Abort()
+			}
 			return
 		}
 	}
 }
 
-func (vm *VoiceManager) processRecordedAudio(vc *VoiceConnection) {
+// processRecordedAudio answers a finished recording. With a sliding window,
+// the buffer only holds the audio after the chunks already transcribed.
+func (vm *VoiceManager) processRecordedAudio(vc *VoiceConnection, window *slidingWindow) {
 	vc.mu.Lock()
 	audioData := make([]byte, vc.AudioBuffer.Len())
 	copy(audioData, vc.AudioBuffer.Bytes())
+	audioData = alignPCM(audioData)
 	vc.AudioBuffer.Reset()
 	vc.IsRecording = false
+	speakerSSRC := vc.speakerSSRC
+	stream, backlog := vc.stream, vc.backlog
+	if stream != nil && backlog != nil {
+		backlog = vc.capStreamed(backlog, pcmBytesForDuration(vm.maxRecordingDuration()))
+	}
+	vc.stream, vc.backlog = nil, nil
 	vc.mu.Unlock()
 
-	log.Printf("Processing recorded audio (%d bytes) from guild %s", len(audioData), vc.GuildID)
+	// Nothing was recorded after the stream opened, so it has yet to hear
+	// any of the audio
+	if stream != nil && backlog != nil {
+		if err := stream.Write(backlog); err != nil {
+			log.Printf("Error streaming audio for transcription: %v", err)
+			stream.Abort()
+			stream = nil
+		}
+	}
+
+	userID := vc.userForSSRC(speakerSSRC)
+
+	duration := pcmDuration(len(audioData))
+	log.Printf("Processing recorded audio (%v, %d bytes) from guild %s", duration, len(audioData), vc.GuildID)
 
-	if len(audioData) < 16000 {
-		log.Printf("Audio data too small (%d bytes), skipping", len(audioData))
+	if duration < vm.handler.cfg.Voice.MinDuration && !window.started() {
+		log.Printf("Audio too short (%v), skipping", duration)
+		if stream != nil {
+			stream.Abort()
+		}
 		return
 	}
 
-	// Convert PCM to WAV
-	wavData, err := vm.pcmToWav(audioData)
-	if err != nil {
-		log.Printf("Error converting PCM to WAV: %v", err)
-		return
+	// Bound the pipeline by the response timeout; leaving the channel cancels it
+	ctx, cancel := context.WithTimeout(vc.ctx, vm.handler.cfg.Bot.ResponseTimeout)
+	defer cancel()
+	ctx = ai.WithUserID(ctx, userID)
+
+	status := vm.startProcessingStatus(vc)
+
+	if maxDuration := vm.maxRecordingDuration(); duration > maxDuration {
+		log.Printf("Audio too long (%v), truncating to %v", duration, maxDuration)
+		audioData = audioData[:pcmBytesForDuration(maxDuration)]
 	}
 
-	// Transcribe audio to text
-	text, err := vm.handler.rag.AI.SpeechToText(bytes.NewReader(wavData))
+	transcription, err := vm.transcribeFor(ctx, vc, userID, audioData, stream)
 	if err != nil {
 		log.Printf("Error in speech-to-text: %v", err)
+		status.fail("⚠️ Sorry, I couldn't understand that.")
 		return
 	}
 
+	text := transcription.Text
+	if earlier := window.wait(); earlier != "" {
+		text = strings.TrimSpace(earlier + " " + text)
+	}
 	if strings.TrimSpace(text) == "" {
 		log.Printf("Empty transcription, skipping")
+		status.clear()
+		return
+	}
+
+	if vm.isEcho(vc, text) {
+		log.Printf("Discarding transcription in guild %s as echo of the last answer: %s", vc.GuildID, text)
+		status.clear()
 		return
 	}
 
 	log.Printf("Transcribed text from guild %s: %s", vc.GuildID, text)
 
-	// Get guild info
-	guild, err := vm.handler.session.Guild(vc.GuildID)
-	if err != nil {
-		log.Printf("Error getting guild info: %v", err)
+	if reply, over := vm.handler.overBudget(userID); over {
+		status.fail(reply)
 		return
 	}
 
+	// Get guild info
+	guildName := vm.handler.guildName(vm.handler.session, vc.GuildID)
+
 	// Get channel info
 	channel, err := vm.handler.session.Channel(vc.ChannelID)
 	if err != nil {
 		log.Printf("Error getting channel info: %v", err)
+		status.fail(voiceErrorReply)
 		return
 	}
 
 	// Get relevant context using RAG
-	context, err := vm.handler.rag.SearchRelevantContext(text, vc.GuildID, 5)
+	timeRange := resolveTimeRange(text, "", time.Now())
+	retrieved, err := vm.handler.rag.SearchContextInRange(ctx, text, vc.GuildID, vc.ChannelID, vm.handler.channelCategory(vm.handler.session, vc.ChannelID), 5, timeRange)
 	if err != nil {
 		log.Printf("Error getting context: %v", err)
+		status.fail(voiceErrorReply)
 		return
 	}
 
-	// Generate AI response
-	response, err := vm.handler.rag.GenerateResponse(text, context, "Voice User", guild.Name)
+	// Generate AI response, including this user's recent voice exchanges
+	history := formatVoiceHistory(vm.history.recent(vc.GuildID, userID))
+	response, err := vm.handler.rag.GenerateResponseWithHistory(ctx, text, retrieved, history, transcription.Language, "Voice User", vc.GuildID, guildName)
 	if err != nil {
 		log.Printf("Error generating response: %v", err)
+		status.fail(voiceErrorReply)
 		return
 	}
+	response = vm.handler.finishResponse(response)
+	vm.history.add(vc.GuildID, userID, text, response)
+
+	// Send text response to the channel, replacing the processing status
+	go status.finish(appendFooter("🎤 **Voice Message:** "+text+"\n\n"+response, vm.handler.responseFooter(vc.GuildID)))
+
+	// Generate and play TTS response, unless it's quiet hours
+	if vm.handler.inQuietHours(vc.GuildID, time.Now()) {
+		log.Printf("Quiet hours in guild %s, answering in text only", vc.GuildID)
+	} else {
+		go func() {
+			ttsCtx, cancel := context.WithTimeout(vc.ctx, vm.handler.cfg.Bot.ResponseTimeout)
+			defer cancel()
+
+			clips, err := vm.handler.synthesize(ttsCtx, response, transcription.Language)
+			if err != nil {
+				log.Printf("Error generating TTS: %v", err)
+				return
+			}
 
-	// Send text response to the channel
-	go func() {
-		_, err := vm.handler.session.ChannelMessageSend(channel.ID, "🎤 **Voice Message:** "+text+"\n\n"+response)
-		if err != nil {
-			log.Printf("Error sending message: %v", err)
+			if err := vm.speakResponse(vc, response, clips); err != nil {
+				log.Printf("Error playing TTS audio: %v", err)
+			}
+		}()
+	}
+
+	// Log the voice interaction
+	vm.handler.logVoiceInteraction(ctx, vc.GuildID, channel.ID, userID, "Voice User", text, response)
+}
+
+// maxRecordingDuration is the configured maximum, defaulting to what fits
+// the transcription upload limit in one piece
+func (vm *VoiceManager) maxRecordingDuration() time.Duration {
+	maxDuration := vm.handler.cfg.Voice.MaxDuration
+	if maxDuration <= 0 {
+		maxDuration = maxWhisperDuration
+	}
+	return maxDuration
+}
+
+// transcriptionSlots returns the semaphore limiting a user's concurrent
+// transcriptions to limit
+func (vc *VoiceConnection) transcriptionSlots(userID string, limit int) *semaphore.Weighted {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if vc.transcriptions == nil {
+		vc.transcriptions = make(map[string]*semaphore.Weighted)
+	}
+	slots, ok := vc.transcriptions[userID]
+	if !ok {
+		if limit < 1 {
+			limit = 1
 		}
-	}()
+		slots = semaphore.NewWeighted(int64(limit))
+		vc.transcriptions[userID] = slots
+	}
+	return slots
+}
 
-	// Generate and play TTS response
-	go func() {
-		ttsAudio, err := vm.handler.rag.AI.TextToSpeech(response)
-		if err != nil {
-			log.Printf("Error generating TTS: %v", err)
-			return
+// transcribeFor transcribes audio spoken by userID once a transcription
+// slot of theirs is free. Slots are handed out in the order requested, so
+// a user's queued segments are transcribed in the order they were spoken.
+func (vm *VoiceManager) transcribeFor(ctx context.Context, vc *VoiceConnection, userID string, audioData []byte, stream ai.TranscriptionStream) (ai.Transcription, error) {
+	slots := vc.transcriptionSlots(userID, vm.handler.cfg.Voice.MaxUserTranscriptions)
+	if !slots.TryAcquire(1) {
+		log.Printf("Queueing transcription for user %s in guild %s behind an earlier one", userID, vc.GuildID)
+		if err := slots.Acquire(ctx, 1); err != nil {
+			if stream != nil {
+				stream.Abort()
+			}
+			return ai.Transcription{}, fmt.Errorf("waiting for an earlier transcription: %w", err)
 		}
+	}
+	defer slots.Release(1)
 
-		if err := vm.SendAudio(vc, ttsAudio); err != nil {
-			log.Printf("Error playing TTS audio: %v", err)
+	return vm.transcribeRecording(ctx, audioData, stream, vm.transcribeOptions(vc.GuildID))
+}
+
+// transcribeRecording finalizes a streaming transcription if one is running,
+// falling back to batch transcription of the whole recording
+func (vm *VoiceManager) transcribeRecording(ctx context.Context, audioData []byte, stream ai.TranscriptionStream, opts ai.TranscribeOptions) (ai.Transcription, error) {
+	if stream != nil {
+		transcription, err := stream.Close(ctx)
+		if err == nil {
+			return transcription, nil
 		}
-	}()
+		log.Printf("Streaming transcription failed, retrying in batch mode: %v", err)
+	}
 
-	// Log the voice interaction
-	vm.handler.logVoiceInteraction(vc.GuildID, channel.ID, vc.UserId, "Voice User", text, response)
+	audioData = vm.normalizeGain(audioData)
+
+	// Convert PCM to WAV
+	wavData, err := vm.pcmToWav(audioData)
+	if err != nil {
+		return ai.Transcription{}, fmt.Errorf("failed to convert PCM to WAV: %v", err)
+	}
+
+	if len(wavData) > whisperMaxFileBytes {
+		return vm.transcribeSegments(ctx, audioData, len(wavData), opts)
+	}
+	return vm.handler.transcriber.Transcribe(ctx, bytes.NewReader(wavData), opts)
+}
+
+// whisperSegmentBytes is how much of pcmLen bytes of PCM audio, whose WAV
+// is wavSize bytes, goes in each segment uploaded. The PCM size is scaled
+// to the limit, with headroom for WAV headers and the cut landing early in
+// a pause.
+func whisperSegmentBytes(pcmLen, wavSize int) int {
+	return int(int64(pcmLen) * whisperMaxFileBytes / int64(wavSize) * 9 / 10)
+}
+
+// transcribeSegments transcribes PCM audio whose WAV of wavSize bytes is
+// over the upload limit, splitting it into pieces that fit and joining
+// their text in order
+func (vm *VoiceManager) transcribeSegments(ctx context.Context, audioData []byte, wavSize int, opts ai.TranscribeOptions) (ai.Transcription, error) {
+	segments := splitPCM(audioData, whisperSegmentBytes(len(audioData), wavSize), pcmBytesForDuration(2*time.Second))
+	log.Printf("Recording of %v is over the upload limit, transcribing it in %d segments", pcmDuration(len(audioData)), len(segments))
+
+	var result ai.Transcription
+	var texts []string
+	for n, segment := range segments {
+		wavData, err := vm.pcmToWav(segment)
+		if err != nil {
+			return ai.Transcription{}, fmt.Errorf("failed to convert segment %d to WAV: %v", n+1, err)
+		}
+		transcription, err := vm.handler.transcriber.Transcribe(ctx, bytes.NewReader(wavData), opts)
+		if err != nil {
+			return ai.Transcription{}, fmt.Errorf("failed to transcribe segment %d of %d: %v", n+1, len(segments), err)
+		}
+		if text := strings.TrimSpace(transcription.Text); text != "" {
+			texts = append(texts, text)
+		}
+		if result.Language == "" {
+			result.Language = transcription.Language
+		}
+	}
+
+	result.Text = strings.Join(texts, " ")
+	return result, nil
+}
+
+// normalizeGain amplifies a recording per the configured gain mode
+func (vm *VoiceManager) normalizeGain(audioData []byte) []byte {
+	cfg := vm.handler.cfg.Voice
+	if cfg.Gain == "off" {
+		return audioData
+	}
+
+	gain := pcmGain(pcmBytesToSamples(audioData), cfg.Gain, cfg.GainTarget, cfg.MaxGain, cfg.FixedGain)
+	if gain == 1 {
+		return audioData
+	}
+	log.Printf("Amplifying recording by %.2fx before transcription", gain)
+	return applyGain(audioData, gain)
 }
 
 func (vm *VoiceManager) pcmToWav(pcmData []byte) ([]byte, error) {
+	// FFmpeg reads raw s16le stereo, so it must only see whole frames
+	pcmData = alignPCM(pcmData)
+
 	// Create temporary files
-	pcmFile, err := os.CreateTemp("", "voice-*.pcm")
+	pcmFile, err := os.CreateTemp(vm.handler.cfg.Voice.TempDir, "voice-*.pcm")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp PCM file: %v", err)
 	}
 	defer os.Remove(pcmFile.Name())
 	defer pcmFile.Close()
 
-	wavFile, err := os.CreateTemp("", "voice-*.wav")
+	wavFile, err := os.CreateTemp(vm.handler.cfg.Voice.TempDir, "voice-*.wav")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp WAV file: %v", err)
 	}
@@ -594,8 +1193,23 @@ func (vm *VoiceManager) pcmToWav(pcmData []byte) ([]byte, error) {
 	return wavData, nil
 }
 
-// New helper method to reconnect a voice connection
+// errVoiceReplaced is returned by reconnectVoice when the connection was
+// left or rejoined while it waited, so there's nothing to reconnect
+var errVoiceReplaced = errors.New("voice connection was replaced")
+
+// reconnectVoice rejoins a connection's channel. It holds the guild's join
+// lock like JoinVoiceChannel and LeaveVoiceChannel, so it never races them;
+// if one of them replaced or dropped the connection meanwhile, it gives up.
 func (vm *VoiceManager) reconnectVoice(vc *VoiceConnection) error {
+	// Remember the original details
+	guildID := vc.GuildID
+	channelID := vc.ChannelID
+	// userID not needed for reconnection
+
+	lock := vm.joinLock(guildID)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// Don't attempt if context is already cancelled
 	select {
 	case <-vc.ctx.Done():
@@ -603,14 +1217,13 @@ func (vm *VoiceManager) reconnectVoice(vc *VoiceConnection) error {
 	default:
 	}
 
-	// Remember the original details
-	guildID := vc.GuildID
-	channelID := vc.ChannelID
-	// userID not needed for reconnection
+	if current, ok := vm.connection(guildID); !ok || current != vc {
+		return errVoiceReplaced
+	}
 
 	// First clean up the old connection
-	if vc.Connection != nil {
-		vc.Connection.Disconnect()
+	if conn := vc.conn(); conn != nil {
+		conn.Disconnect()
 	}
 
 	// Create a new voice connection
@@ -633,8 +1246,11 @@ func (vm *VoiceManager) reconnectVoice(vc *VoiceConnection) error {
 			if voiceConn.Ready {
 				log.Printf("Voice connection reconnected for guild %s", guildID)
 				// Update the connection
+				vc.mu.Lock()
 				vc.Connection = voiceConn
 				vc.LastActivity = time.Now()
+				vc.mu.Unlock()
+				vc.trackSpeakers(voiceConn)
 				return nil
 			}
 		case <-vc.ctx.Done():
@@ -0,0 +1,87 @@
+// internal/bot/voice_echo.go
+package bot
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// echoMinWords is the shortest transcript checked for echo; short replies
+// like "yes please" overlap any answer by chance
+const echoMinWords = 3
+
+// spokenResponse is the last answer the bot played in a voice channel
+type spokenResponse struct {
+	text string
+	at   time.Time
+}
+
+// echoWords splits text into lowercase words without punctuation
+func echoWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// echoSimilarity is the fraction of the transcript's words that appear in
+// the spoken response. An echo is usually a fragment of the response, so
+// containment works better than a symmetric measure.
+func echoSimilarity(transcript, spoken string) float64 {
+	words := echoWords(transcript)
+	if len(words) == 0 {
+		return 0
+	}
+
+	spokenWords := make(map[string]bool)
+	for _, word := range echoWords(spoken) {
+		spokenWords[word] = true
+	}
+
+	matches := 0
+	for _, word := range words {
+		if spokenWords[word] {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(words))
+}
+
+// isEcho reports whether a transcript heard within cooldown of the bot
+// finishing an answer is most likely that answer picked up by a microphone
+func isEcho(transcript string, last spokenResponse, now time.Time, cooldown time.Duration, threshold float64) bool {
+	if cooldown <= 0 || last.text == "" || now.Sub(last.at) > cooldown {
+		return false
+	}
+	if len(echoWords(transcript)) < echoMinWords {
+		return false
+	}
+	return echoSimilarity(transcript, last.text) >= threshold
+}
+
+// speakResponse plays a synthesized answer's clips in order and remembers it
+// for echo suppression once playback ends
+func (vm *VoiceManager) speakResponse(vc *VoiceConnection, text string, clips []speechClip) error {
+	var err error
+	for _, clip := range clips {
+		if err = vm.SendAudio(vc, clip.audio, clip.format); err != nil {
+			break
+		}
+	}
+
+	vc.mu.Lock()
+	vc.lastSpoken = spokenResponse{text: text, at: time.Now()}
+	vc.mu.Unlock()
+
+	return err
+}
+
+// isEcho checks a transcript against the connection's last spoken answer
+func (vm *VoiceManager) isEcho(vc *VoiceConnection, transcript string) bool {
+	vc.mu.RLock()
+	last := vc.lastSpoken
+	vc.mu.RUnlock()
+
+	cfg := vm.handler.cfg.Voice
+	return isEcho(transcript, last, time.Now(), cfg.EchoCooldown, cfg.EchoSimilarity)
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/config"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestEchoSimilarity(t *testing.T) {
+	tests := []struct {
+		transcript, spoken string
+		want               float64
+	}{
+		{"Game night is Friday", "Game night is on Friday at Bob's.", 1},
+		{"game NIGHT, is... friday?", "Game night is Friday.", 1},
+		{"is game night on Saturday", "Game night is Friday.", 0.6},
+		{"what about the weather", "Game night is Friday.", 0},
+		{"", "Game night is Friday.", 0},
+		{"?!", "Game night is Friday.", 0},
+	}
+	for _, tt := range tests {
+		if got := echoSimilarity(tt.transcript, tt.spoken); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("echoSimilarity(%q, %q) = %v, want %v", tt.transcript, tt.spoken, got, tt.want)
+		}
+	}
+}
+
+func TestIsEcho(t *testing.T) {
+	now := time.Now()
+	last := spokenResponse{text: "Game night is on Friday at Bob's place.", at: now.Add(-2 * time.Second)}
+	tests := []struct {
+		name       string
+		transcript string
+		last       spokenResponse
+		cooldown   time.Duration
+		want       bool
+	}{
+		{"fragment of the answer", "game night is on friday", last, 10 * time.Second, true},
+		{"new question", "what should I bring", last, 10 * time.Second, false},
+		{"too short to tell", "friday bob", last, 10 * time.Second, false},
+		{"after the cooldown", "game night is on friday", last, time.Second, false},
+		{"disabled", "game night is on friday", last, 0, false},
+		{"nothing spoken yet", "game night is on friday", spokenResponse{}, 10 * time.Second, false},
+	}
+	for _, tt := range tests {
+		if got := isEcho(tt.transcript, tt.last, now, tt.cooldown, 0.8); got != tt.want {
+			t.Errorf("%s: isEcho = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The answer is remembered even if playback fails partway, since some of it
+// may already have been heard
+func TestSpeakResponseRemembersAnswer(t *testing.T) {
+	vm := newTestVoiceManager(config.VoiceConfig{EchoCooldown: 10 * time.Second, EchoSimilarity: 0.8}, nil)
+	vc := &VoiceConnection{GuildID: "g1", Connection: &discordgo.VoiceConnection{}, closing: true}
+
+	if vm.isEcho(vc, "game night is on friday") {
+		t.Error("transcript treated as an echo before anything was spoken")
+	}
+	err := vm.speakResponse(vc, "Game night is on Friday.", []speechClip{{audio: make([]byte, 3840), format: ai.AudioFormatPCM}})
+	if err == nil {
+		t.Error("speakResponse succeeded on a closing connection")
+	}
+	if !vm.isEcho(vc, "game night is on friday") {
+		t.Error("transcript of the spoken answer not treated as an echo")
+	}
+	if vm.isEcho(vc, "what should I bring then") {
+		t.Error("new question treated as an echo")
+	}
+}
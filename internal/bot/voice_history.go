@@ -0,0 +1,103 @@
+// internal/bot/voice_history.go
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type voiceTurn struct {
+	Query    string
+	Response string
+}
+
+type voiceConversation struct {
+	turns      []voiceTurn
+	lastActive time.Time
+}
+
+// voiceHistory keeps the last few voice exchanges per guild and user so
+// follow-up questions can refer back to earlier ones
+type voiceHistory struct {
+	maxTurns int
+	ttl      time.Duration
+	mu       sync.Mutex
+	convos   map[string]*voiceConversation
+}
+
+func newVoiceHistory(maxTurns int, ttl time.Duration) *voiceHistory {
+	return &voiceHistory{
+		maxTurns: maxTurns,
+		ttl:      ttl,
+		convos:   make(map[string]*voiceConversation),
+	}
+}
+
+func voiceHistoryKey(guildID, userID string) string {
+	return guildID + ":" + userID
+}
+
+// recent returns the user's unexpired turns, oldest first
+func (vh *voiceHistory) recent(guildID, userID string) []voiceTurn {
+	if vh.maxTurns <= 0 {
+		return nil
+	}
+
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+
+	key := voiceHistoryKey(guildID, userID)
+	convo, ok := vh.convos[key]
+	if !ok {
+		return nil
+	}
+	if time.Since(convo.lastActive) > vh.ttl {
+		delete(vh.convos, key)
+		return nil
+	}
+
+	turns := make([]voiceTurn, len(convo.turns))
+	copy(turns, convo.turns)
+	return turns
+}
+
+// add records a turn, keeping only the most recent maxTurns
+func (vh *voiceHistory) add(guildID, userID, query, response string) {
+	if vh.maxTurns <= 0 {
+		return
+	}
+
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+
+	// Drop expired conversations while we hold the lock
+	for k, convo := range vh.convos {
+		if time.Since(convo.lastActive) > vh.ttl {
+			delete(vh.convos, k)
+		}
+	}
+
+	key := voiceHistoryKey(guildID, userID)
+	convo, ok := vh.convos[key]
+	if !ok {
+		convo = &voiceConversation{}
+		vh.convos[key] = convo
+	}
+
+	convo.turns = append(convo.turns, voiceTurn{Query: query, Response: response})
+	if len(convo.turns) > vh.maxTurns {
+		convo.turns = convo.turns[len(convo.turns)-vh.maxTurns:]
+	}
+	convo.lastActive = time.Now()
+}
+
+// formatVoiceHistory renders turns for inclusion in the prompt
+func formatVoiceHistory(turns []voiceTurn) string {
+	var parts []string
+	for _, turn := range turns {
+		parts = append(parts, fmt.Sprintf("User: %s\nAssistant: %s", turn.Query, turn.Response))
+	}
+	return strings.Join(parts, "\n")
+}
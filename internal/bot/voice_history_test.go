@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVoiceHistoryKeepsLastTurns(t *testing.T) {
+	vh := newVoiceHistory(2, time.Minute)
+	vh.add("g1", "u1", "one", "1")
+	vh.add("g1", "u1", "two", "2")
+	vh.add("g1", "u1", "three", "3")
+
+	want := []voiceTurn{{"two", "2"}, {"three", "3"}}
+	if got := vh.recent("g1", "u1"); !slices.Equal(got, want) {
+		t.Errorf("recent = %+v, want %+v", got, want)
+	}
+}
+
+func TestVoiceHistoryPerSpeaker(t *testing.T) {
+	vh := newVoiceHistory(3, time.Minute)
+	vh.add("g1", "u1", "mine", "a")
+	vh.add("g1", "u2", "theirs", "b")
+	vh.add("g2", "u1", "elsewhere", "c")
+
+	if got, want := vh.recent("g1", "u1"), []voiceTurn{{"mine", "a"}}; !slices.Equal(got, want) {
+		t.Errorf("recent(g1, u1) = %+v, want %+v", got, want)
+	}
+	if got, want := vh.recent("g2", "u1"), []voiceTurn{{"elsewhere", "c"}}; !slices.Equal(got, want) {
+		t.Errorf("recent(g2, u1) = %+v, want %+v", got, want)
+	}
+	if got := vh.recent("g1", "u3"); got != nil {
+		t.Errorf("recent for a new speaker = %+v, want none", got)
+	}
+}
+
+func TestVoiceHistoryExpires(t *testing.T) {
+	vh := newVoiceHistory(3, time.Minute)
+	vh.add("g1", "u1", "old", "a")
+	vh.add("g1", "u2", "stale", "b")
+	vh.convos[voiceHistoryKey("g1", "u1")].lastActive = time.Now().Add(-2 * time.Minute)
+	vh.convos[voiceHistoryKey("g1", "u2")].lastActive = time.Now().Add(-2 * time.Minute)
+
+	if got := vh.recent("g1", "u1"); got != nil {
+		t.Errorf("recent = %+v after the TTL, want none", got)
+	}
+
+	// A new turn starts over rather than continuing the expired exchange,
+	// and drops other expired conversations
+	vh.add("g1", "u3", "new", "c")
+	if _, ok := vh.convos[voiceHistoryKey("g1", "u2")]; ok {
+		t.Error("expired conversation kept after add")
+	}
+}
+
+func TestVoiceHistoryDisabled(t *testing.T) {
+	vh := newVoiceHistory(0, time.Minute)
+	vh.add("g1", "u1", "question", "answer")
+	if got := vh.recent("g1", "u1"); got != nil {
+		t.Errorf("recent = %+v with history disabled, want none", got)
+	}
+}
+
+func TestVoiceHistoryRecentIsCopy(t *testing.T) {
+	vh := newVoiceHistory(3, time.Minute)
+	vh.add("g1", "u1", "question", "answer")
+	vh.recent("g1", "u1")[0].Query = "changed"
+
+	if got := vh.recent("g1", "u1")[0].Query; got != "question" {
+		t.Errorf("stored query = %q after modifying a result, want it unchanged", got)
+	}
+}
+
+func TestFormatVoiceHistory(t *testing.T) {
+	got := formatVoiceHistory([]voiceTurn{{"what time is it", "noon"}, {"and tomorrow?", "also noon"}})
+	want := "User: what time is it\nAssistant: noon\nUser: and tomorrow?\nAssistant: also noon"
+	if got != want {
+		t.Errorf("formatVoiceHistory = %q, want %q", got, want)
+	}
+	if got := formatVoiceHistory(nil); got != "" {
+		t.Errorf("formatVoiceHistory(nil) = %q, want \"\"", got)
+	}
+}
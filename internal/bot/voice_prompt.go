@@ -0,0 +1,231 @@
+// internal/bot/voice_prompt.go
+package bot
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/models"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxPromptLength keeps the prompt well inside Whisper's 224 token
+	// prompt window
+	maxPromptLength = 600
+	// glossarySampleSize is how many recent messages the glossary is built from
+	glossarySampleSize = 500
+	// glossaryTerms caps the number of auto-built terms
+	glossaryTerms = 40
+	// glossaryTTL is how long an auto-built glossary is reused
+	glossaryTTL = 30 * time.Minute
+)
+
+// glossary is a guild's auto-built prompt terms
+type glossary struct {
+	terms   []string
+	builtAt time.Time
+}
+
+// transcribeOptions returns the speech recognition options for a guild:
+// its prompt override or the configured prompt, plus the auto-built
+// glossary if enabled
+func (vm *VoiceManager) transcribeOptions(guildID string) ai.TranscribeOptions {
+	var parts []string
+	if prompt := strings.TrimRight(vm.handler.transcriptionPrompt(guildID), ",. "); prompt != "" {
+		parts = append(parts, prompt)
+	}
+	if vm.handler.cfg.Voice.AutoPrompt {
+		parts = append(parts, vm.glossary(guildID)...)
+	}
+	return ai.TranscribeOptions{Prompt: truncatePrompt(strings.Join(parts, ", "), maxPromptLength)}
+}
+
+// transcriptionPrompt is the prompt a guild has set, or the configured one
+func (h *BotHandler) transcriptionPrompt(guildID string) string {
+	settings, err := h.db.GetGuildSettings(guildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+	} else if settings.TranscriptionPrompt != "" {
+		return settings.TranscriptionPrompt
+	}
+	return h.cfg.Voice.TranscriptionPrompt
+}
+
+// glossary returns the guild's auto-built terms, rebuilding them from its
+// recent messages once they are older than glossaryTTL
+func (vm *VoiceManager) glossary(guildID string) []string {
+	if cached, ok := vm.glossaries.Load(guildID); ok {
+		if g := cached.(*glossary); time.Since(g.builtAt) < glossaryTTL {
+			return g.terms
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	messages, err := vm.handler.rag.RecentMessages(ctx, guildID, vm.handler.rag.EmbeddingVersion(guildID), glossarySampleSize)
+	if err != nil {
+		log.Printf("Error loading messages for the transcription glossary of guild %s: %v", guildID, err)
+		return nil
+	}
+
+	terms := buildGlossary(messages, glossaryTerms)
+	vm.glossaries.Store(guildID, &glossary{terms: terms, builtAt: time.Now()})
+	return terms
+}
+
+// buildGlossary picks the terms speech recognition is most likely to get
+// wrong: the names of the most active authors and the capitalized words,
+// acronyms and identifiers used most often, excluding words capitalized
+// only because they start a sentence. Returns at most limit terms, most
+// frequent first.
+func buildGlossary(messages []models.DiscordMessage, limit int) []string {
+	counts := make(map[string]int)
+	for _, msg := range messages {
+		if msg.Username != "" {
+			counts[msg.Username]++
+		}
+
+		sentenceStart := true
+		for _, word := range strings.Fields(msg.Content) {
+			term := strings.TrimFunc(word, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})
+			if !sentenceStart && isJargon(term) {
+				counts[term]++
+			}
+			sentenceStart = strings.ContainsAny(word[len(word)-1:], ".!?")
+		}
+	}
+
+	terms := make([]string, 0, len(counts))
+	for term, count := range counts {
+		// A single use is as likely a typo as vocabulary
+		if count > 1 {
+			terms = append(terms, term)
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if counts[terms[i]] != counts[terms[j]] {
+			return counts[terms[i]] > counts[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+	return terms
+}
+
+// isJargon reports whether a word looks like a name, acronym or identifier
+// rather than ordinary vocabulary: it has an uppercase letter and is not
+// just a short word like "I" or "OK"
+func isJargon(word string) bool {
+	if len([]rune(word)) < 3 || strings.Contains(word, "://") {
+		return false
+	}
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncatePrompt shortens a prompt to at most limit bytes, cutting at a
+// separator so no term is left half-written
+func truncatePrompt(prompt string, limit int) string {
+	if len(prompt) <= limit {
+		return prompt
+	}
+	prompt = prompt[:limit]
+	if cut := strings.LastIndexAny(prompt, ", "); cut > 0 {
+		prompt = prompt[:cut]
+	}
+	return strings.TrimRight(prompt, ", ")
+}
+
+func voicePromptCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "voice-prompt",
+		Description:              "View or set the glossary that helps speech recognition in this server",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "text",
+				Description: "Names and terms, e.g. \"Grafana, Kubernetes, LFG\" (\"reset\" restores the default)",
+				Required:    false,
+				MaxLength:   maxPromptLength,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleVoicePromptInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var requested string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "text" {
+			requested = strings.TrimSpace(opt.StringValue())
+		}
+	}
+
+	if requested == "" {
+		h.showVoicePrompt(s, i, "")
+		return
+	}
+
+	settings, err := h.db.GetGuildSettings(i.GuildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not load this server's settings.")
+		return
+	}
+
+	if strings.EqualFold(requested, "reset") {
+		requested = ""
+	}
+	settings.TranscriptionPrompt = requested
+	if err := h.db.SaveGuildSettings(settings); err != nil {
+		log.Printf("Error saving transcription prompt for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not save the prompt.")
+		return
+	}
+
+	log.Printf("Transcription prompt for guild %s set to %q by %s", i.GuildID, requested, interactionUsername(i))
+	h.showVoicePrompt(s, i, "✅ ")
+}
+
+// showVoicePrompt shows the prompt speech recognition currently gets
+func (h *BotHandler) showVoicePrompt(s *discordgo.Session, i *discordgo.InteractionCreate, prefix string) {
+	var prompt string
+	if h.voiceManager != nil {
+		prompt = h.voiceManager.transcribeOptions(i.GuildID).Prompt
+	} else {
+		prompt = h.transcriptionPrompt(i.GuildID)
+	}
+	if prompt == "" {
+		h.editInteraction(s, i, prefix+"Speech recognition gets no prompt in this server.")
+		return
+	}
+	h.editInteraction(s, i, fmt.Sprintf("%sSpeech recognition is prompted with:\n> %s", prefix, prompt))
+}
@@ -0,0 +1,195 @@
+// internal/bot/voice_ptt.go
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// voiceModeAlways records and answers everything said in the channel
+	voiceModeAlways = "always"
+	// voiceModePushToTalk only records a user after they run /listen
+	voiceModePushToTalk = "push-to-talk"
+)
+
+// listening reports whether a packet from ssrc may be recorded. Outside
+// push-to-talk mode, and while a recording is running, everything is. In
+// push-to-talk mode a recording is only started by the armed user before
+// their turn lapses, which uses the turn up.
+func (vc *VoiceConnection) listening(ssrc uint32, now time.Time) bool {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if !vc.pushToTalk || vc.IsRecording {
+		return true
+	}
+	if vc.armedUser == "" || now.After(vc.armedUntil) {
+		return false
+	}
+
+	userID, known := vc.ssrcUsers[ssrc]
+	if !known {
+		userID = vc.UserId
+	}
+	if userID != vc.armedUser {
+		return false
+	}
+	vc.armedUser = ""
+	return true
+}
+
+// arm lets userID start one recording within window
+func (vc *VoiceConnection) arm(userID string, window time.Duration) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.armedUser = userID
+	vc.armedUntil = time.Now().Add(window)
+}
+
+// setPushToTalk switches a live connection's listening mode
+func (vc *VoiceConnection) setPushToTalk(enabled bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.pushToTalk = enabled
+	vc.armedUser = ""
+}
+
+func (vc *VoiceConnection) isPushToTalk() bool {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	return vc.pushToTalk
+}
+
+// validVoiceMode reports whether mode is a known voice listening mode
+func validVoiceMode(mode string) bool {
+	return mode == voiceModeAlways || mode == voiceModePushToTalk
+}
+
+// voiceMode is the listening mode in a guild: its override if it has one,
+// otherwise the configured default
+func (h *BotHandler) voiceMode(guildID string) string {
+	settings, err := h.db.GetGuildSettings(guildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+	} else if validVoiceMode(settings.VoiceMode) {
+		return settings.VoiceMode
+	}
+	if validVoiceMode(h.cfg.Voice.Mode) {
+		return h.cfg.Voice.Mode
+	}
+	return voiceModeAlways
+}
+
+func listenCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:         "listen",
+		Description:  "Ask the bot to listen to what you say next in voice (push-to-talk mode)",
+		DMPermission: &dmPermission,
+	}
+}
+
+func (h *BotHandler) handleListenInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	vc, ok := h.voiceManager.connection(i.GuildID)
+	if !ok || vc == nil {
+		h.editInteraction(s, i, "I'm not in a voice channel. Use `/join` first.")
+		return
+	}
+	if !vc.isPushToTalk() {
+		h.editInteraction(s, i, "👂 I'm already listening to everyone in the voice channel.")
+		return
+	}
+
+	window := h.cfg.Voice.ListenWindow
+	if window <= 0 {
+		window = 15 * time.Second
+	}
+	user := interactionUser(i)
+	if user == nil {
+		h.editInteraction(s, i, unknownUserReply)
+		return
+	}
+	vc.arm(user.ID, window)
+	h.editInteraction(s, i, fmt.Sprintf("🎙️ Listening, go ahead and speak within %v.", window))
+}
+
+func voiceModeCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "voice-mode",
+		Description:              "View or set whether the bot answers everything said in voice or only after /listen",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "mode",
+				Description: "The listening mode (leave empty to see the current mode)",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Always listening", Value: voiceModeAlways},
+					{Name: "Push-to-talk (/listen)", Value: voiceModePushToTalk},
+					{Name: "Reset to default", Value: "reset"},
+				},
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleVoiceModeInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var requested string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "mode" {
+			requested = opt.StringValue()
+		}
+	}
+
+	if requested == "" {
+		h.editInteraction(s, i, fmt.Sprintf("Voice mode is `%s`.", h.voiceMode(i.GuildID)))
+		return
+	}
+
+	settings, err := h.db.GetGuildSettings(i.GuildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not load this server's settings.")
+		return
+	}
+
+	if requested == "reset" {
+		requested = ""
+	}
+	settings.VoiceMode = requested
+	if err := h.db.SaveGuildSettings(settings); err != nil {
+		log.Printf("Error saving voice mode for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not save the voice mode.")
+		return
+	}
+
+	mode := h.voiceMode(i.GuildID)
+	if vc, ok := h.voiceManager.connection(i.GuildID); ok && vc != nil {
+		vc.setPushToTalk(mode == voiceModePushToTalk)
+	}
+
+	log.Printf("Voice mode for guild %s set to %q by %s", i.GuildID, requested, interactionUsername(i))
+	h.editInteraction(s, i, fmt.Sprintf("✅ Voice mode is now `%s`.", mode))
+}
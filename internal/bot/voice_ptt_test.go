@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"discord-rag-bot/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListeningPushToTalk(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		pushToTalk bool
+		recording  bool
+		armedUser  string
+		armedUntil time.Time
+		ssrc       uint32
+		want       bool
+	}{
+		{"always mode", false, false, "", time.Time{}, 2, true},
+		{"nobody armed", true, false, "", time.Time{}, 1, false},
+		{"armed user", true, false, "u1", now.Add(time.Minute), 1, true},
+		{"other user", true, false, "u1", now.Add(time.Minute), 2, false},
+		{"turn lapsed", true, false, "u1", now.Add(-time.Second), 1, false},
+		{"unknown SSRC falls back to the connection user", true, false, "u1", now.Add(time.Minute), 3, true},
+		{"during a recording", true, true, "", time.Time{}, 2, true},
+	}
+	for _, tt := range tests {
+		vc := &VoiceConnection{
+			UserId:      "u1",
+			ssrcUsers:   map[uint32]string{1: "u1", 2: "u2"},
+			pushToTalk:  tt.pushToTalk,
+			IsRecording: tt.recording,
+			armedUser:   tt.armedUser,
+			armedUntil:  tt.armedUntil,
+		}
+		if got := vc.listening(tt.ssrc, now); got != tt.want {
+			t.Errorf("%s: listening = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A /listen turn starts one recording; the next needs another /listen
+func TestListeningUsesTurnUp(t *testing.T) {
+	vc := &VoiceConnection{ssrcUsers: map[uint32]string{1: "u1"}, pushToTalk: true}
+	vc.arm("u1", time.Minute)
+
+	if !vc.listening(1, time.Now()) {
+		t.Fatal("armed user not heard")
+	}
+	if vc.listening(1, time.Now()) {
+		t.Error("armed user heard again without another /listen")
+	}
+
+	vc.arm("u1", time.Minute)
+	vc.setPushToTalk(false)
+	vc.setPushToTalk(true)
+	if vc.listening(1, time.Now()) {
+		t.Error("turn survived switching voice modes")
+	}
+}
+
+func TestListenInteraction(t *testing.T) {
+	h := &BotHandler{cfg: &config.Config{Voice: config.VoiceConfig{ListenWindow: time.Minute}}}
+	h.voiceManager = NewVoiceManager(h)
+
+	tests := []struct {
+		name       string
+		connected  bool
+		pushToTalk bool
+		want       string
+		armed      bool
+	}{
+		{"no connection", false, false, "not in a voice channel", false},
+		{"always mode", true, false, "already listening to everyone", false},
+		{"push-to-talk", true, true, "speak within 1m0s", true},
+	}
+	for _, tt := range tests {
+		vc := &VoiceConnection{GuildID: "g1", pushToTalk: tt.pushToTalk}
+		if tt.connected {
+			h.voiceManager.connections["g1"] = vc
+		}
+
+		s, fake := newFakeSession(t)
+		h.handleListenInteraction(s, commandInteraction("listen"))
+
+		if got := editedContent(t, fake); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: reply = %q, want it to contain %q", tt.name, got, tt.want)
+		}
+		if armed := vc.armedUser == "u1"; armed != tt.armed {
+			t.Errorf("%s: armed = %v, want %v", tt.name, armed, tt.armed)
+		}
+		delete(h.voiceManager.connections, "g1")
+	}
+}
+
+func TestValidVoiceMode(t *testing.T) {
+	for mode, want := range map[string]bool{
+		voiceModeAlways:     true,
+		voiceModePushToTalk: true,
+		"":                  false,
+		"reset":             false,
+		"Always":            false,
+	} {
+		if got := validVoiceMode(mode); got != want {
+			t.Errorf("validVoiceMode(%q) = %v, want %v", mode, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// internal/bot/voice_quiet.go
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// quietHoursOff stored as a guild's quiet hours turns off the configured
+// default there
+const quietHoursOff = "off"
+
+// quietHours is a daily window, in minutes after midnight, during which
+// answers aren't spoken. A window with end before start runs overnight.
+type quietHours struct {
+	start, end int
+}
+
+// parseQuietHours parses a window like "22:00-07:00"
+func parseQuietHours(spec string) (quietHours, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return quietHours{}, fmt.Errorf("quiet hours %q must look like 22:00-07:00", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return quietHours{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return quietHours{}, err
+	}
+	return quietHours{start: start, end: end}, nil
+}
+
+// parseClock parses a 24-hour "HH:MM" time into minutes after midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether now, read as wall-clock time in loc, falls in
+// the window. The start is inclusive and the end exclusive; a window that
+// starts and ends at the same time is empty.
+func (q quietHours) contains(now time.Time, loc *time.Location) bool {
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if q.start <= q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+func (q quietHours) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", q.start/60, q.start%60, q.end/60, q.end%60)
+}
+
+// quietHoursFor returns a guild's quiet hours spec and timezone: its
+// overrides if it has them, otherwise the configured defaults
+func (h *BotHandler) quietHoursFor(guildID string) (spec, timezone string) {
+	spec, timezone = h.cfg.Voice.QuietHours, h.cfg.Voice.QuietTimezone
+	settings, err := h.db.GetGuildSettings(guildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+		return spec, timezone
+	}
+	if settings.QuietHours != "" {
+		spec = settings.QuietHours
+	}
+	if settings.QuietTimezone != "" {
+		timezone = settings.QuietTimezone
+	}
+	return spec, timezone
+}
+
+// inQuietHours reports whether answers in a guild should currently be
+// text only. A malformed window or timezone is logged and ignored, so the
+// bot keeps speaking rather than going silent by mistake.
+func (h *BotHandler) inQuietHours(guildID string, now time.Time) bool {
+	spec, timezone := h.quietHoursFor(guildID)
+	if spec == "" || spec == quietHoursOff {
+		return false
+	}
+	window, err := parseQuietHours(spec)
+	if err != nil {
+		log.Printf("Ignoring quiet hours for guild %s: %v", guildID, err)
+		return false
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Printf("Ignoring quiet hours for guild %s: unknown timezone %q", guildID, timezone)
+		return false
+	}
+	return window.contains(now, loc)
+}
+
+func quietHoursCommand() *discordgo.ApplicationCommand {
+	dmPermission := false
+	return &discordgo.ApplicationCommand{
+		Name:                     "quiet-hours",
+		Description:              "View or set the hours when the bot answers in text only, without speaking",
+		DefaultMemberPermissions: &adminPermissions,
+		DMPermission:             &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "hours",
+				Description: "Daily window, e.g. 22:00-07:00 (\"off\" disables, \"reset\" restores the default)",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "timezone",
+				Description: "IANA timezone the hours are in, e.g. Europe/Paris (\"reset\" restores the default)",
+				Required:    false,
+			},
+		},
+	}
+}
+
+func (h *BotHandler) handleQuietHoursInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := deferEphemeral(s, i); err != nil {
+		log.Printf("Error responding to interaction: %v", err)
+		return
+	}
+
+	if !isAdmin(i) {
+		h.editInteraction(s, i, "❌ You need the Manage Server permission to use this command.")
+		return
+	}
+
+	var hours, timezone string
+	for _, opt := range i.ApplicationCommandData().Options {
+		switch opt.Name {
+		case "hours":
+			hours = strings.TrimSpace(opt.StringValue())
+		case "timezone":
+			timezone = strings.TrimSpace(opt.StringValue())
+		}
+	}
+
+	if hours == "" && timezone == "" {
+		h.showQuietHours(s, i, "")
+		return
+	}
+
+	settings, err := h.db.GetGuildSettings(i.GuildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not load this server's settings.")
+		return
+	}
+
+	switch {
+	case hours == "":
+	case strings.EqualFold(hours, "reset"):
+		settings.QuietHours = ""
+	case strings.EqualFold(hours, quietHoursOff):
+		settings.QuietHours = quietHoursOff
+	default:
+		window, err := parseQuietHours(hours)
+		if err != nil {
+			h.editInteraction(s, i, fmt.Sprintf("❌ %v.", err))
+			return
+		}
+		settings.QuietHours = window.String()
+	}
+
+	switch {
+	case timezone == "":
+	case strings.EqualFold(timezone, "reset"):
+		settings.QuietTimezone = ""
+	default:
+		if _, err := time.LoadLocation(timezone); err != nil {
+			h.editInteraction(s, i, fmt.Sprintf("❌ Unknown timezone `%s`. Use an IANA name like `Europe/Paris`.", timezone))
+			return
+		}
+		settings.QuietTimezone = timezone
+	}
+
+	if err := h.db.SaveGuildSettings(settings); err != nil {
+		log.Printf("Error saving quiet hours for guild %s: %v", i.GuildID, err)
+		h.editInteraction(s, i, "❌ Could not save the quiet hours.")
+		return
+	}
+
+	log.Printf("Quiet hours for guild %s set to %q (%q) by %s", i.GuildID, settings.QuietHours, settings.QuietTimezone, interactionUsername(i))
+	h.showQuietHours(s, i, "✅ ")
+}
+
+// showQuietHours describes the quiet hours in effect for the guild
+func (h *BotHandler) showQuietHours(s *discordgo.Session, i *discordgo.InteractionCreate, prefix string) {
+	spec, timezone := h.quietHoursFor(i.GuildID)
+	if spec == "" || spec == quietHoursOff {
+		h.editInteraction(s, i, prefix+"No quiet hours: answers are always spoken in voice.")
+		return
+	}
+
+	state := "not in effect"
+	if h.inQuietHours(i.GuildID, time.Now()) {
+		state = "in effect now"
+	}
+	h.editInteraction(s, i, fmt.Sprintf("%sQuiet hours are `%s` (%s), %s. Answers are text only during them.", prefix, spec, timezone, state))
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    quietHours
+		wantErr bool
+	}{
+		{"22:00-07:00", quietHours{start: 22 * 60, end: 7 * 60}, false},
+		{" 09:30 - 17:45 ", quietHours{start: 9*60 + 30, end: 17*60 + 45}, false},
+		{"00:00-00:00", quietHours{}, false},
+		{"22:00", quietHours{}, true},
+		{"22:00-25:00", quietHours{}, true},
+		{"10pm-7am", quietHours{}, true},
+		{"", quietHours{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseQuietHours(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseQuietHours(%q) = %+v, %v, want %+v (error %v)", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestQuietHoursString(t *testing.T) {
+	window, err := parseQuietHours("9:05-23:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := window.String(); got != "09:05-23:00" {
+		t.Errorf("String = %q, want 09:05-23:00", got)
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := quietHours{start: 22 * 60, end: 7 * 60}
+	daytime := quietHours{start: 9 * 60, end: 17 * 60}
+	tests := []struct {
+		name   string
+		window quietHours
+		clock  string
+		want   bool
+	}{
+		{"overnight, before start", overnight, "21:59", false},
+		{"overnight, at start", overnight, "22:00", true},
+		{"overnight, midnight", overnight, "00:00", true},
+		{"overnight, early morning", overnight, "06:59", true},
+		{"overnight, at end", overnight, "07:00", false},
+		{"overnight, midday", overnight, "12:00", false},
+		{"daytime, inside", daytime, "12:00", true},
+		{"daytime, at end", daytime, "17:00", false},
+		{"daytime, night", daytime, "23:00", false},
+		{"empty window", quietHours{start: 60, end: 60}, "01:00", false},
+	}
+	for _, tt := range tests {
+		clock, err := time.Parse("15:04", tt.clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Date(2026, 3, 10, clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+		if got := tt.window.contains(now, time.UTC); got != tt.want {
+			t.Errorf("%s: contains(%s) = %v, want %v", tt.name, tt.clock, got, tt.want)
+		}
+	}
+}
+
+// The window is wall-clock time in the guild's timezone, so the same
+// instant can be quiet in one guild and not in another
+func TestQuietHoursTimezones(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	overnight := quietHours{start: 22 * 60, end: 7 * 60}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		loc  *time.Location
+		want bool
+	}{
+		// 22:30 UTC is 23:30 in Paris in winter and 17:30 in New York
+		{"Paris in winter", time.Date(2026, 1, 15, 22, 30, 0, 0, time.UTC), paris, true},
+		{"New York in winter", time.Date(2026, 1, 15, 22, 30, 0, 0, time.UTC), newYork, false},
+		// 05:30 UTC is 06:30 in Paris and 00:30 in New York, past midnight
+		{"Paris past midnight", time.Date(2026, 1, 16, 5, 30, 0, 0, time.UTC), paris, true},
+		{"New York past midnight", time.Date(2026, 1, 16, 5, 30, 0, 0, time.UTC), newYork, true},
+		// 05:30 UTC is 07:30 in Paris in summer, after the window ends
+		{"Paris in summer", time.Date(2026, 7, 16, 5, 30, 0, 0, time.UTC), paris, false},
+		{"UTC", time.Date(2026, 7, 16, 5, 30, 0, 0, time.UTC), time.UTC, true},
+	}
+	for _, tt := range tests {
+		if got := overnight.contains(tt.now, tt.loc); got != tt.want {
+			t.Errorf("%s: contains(%s) = %v, want %v", tt.name, tt.now.In(tt.loc).Format("15:04"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// internal/bot/voice_status.go
+package bot
+
+import (
+	"bytes"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	processingStatusMessage = "message"
+	processingStatusTone    = "tone"
+
+	processingPlaceholder = "🎤 Processing…"
+)
+
+// processingStatus is the feedback shown while a voice utterance is answered.
+// In message mode it owns a placeholder message that is later replaced with
+// the result; in other modes finishing just posts the result.
+type processingStatus struct {
+	vm        *VoiceManager
+	channelID string
+	messageID string
+}
+
+// startProcessingStatus acknowledges that the bot heard an utterance
+func (vm *VoiceManager) startProcessingStatus(vc *VoiceConnection) *processingStatus {
+	status := &processingStatus{vm: vm, channelID: vc.ChannelID}
+
+	switch vm.handler.cfg.Voice.ProcessingStatus {
+	case processingStatusMessage:
+		msg, err := vm.handler.sendMessage(vm.handler.session, vc.ChannelID, &discordgo.MessageSend{
+			Content: processingPlaceholder,
+		})
+		if err == nil {
+			status.messageID = msg.ID
+		}
+	case processingStatusTone:
+		go func() {
+			tone := tonePCM(880, 150*time.Millisecond, 0.2)
+			if err := vm.playPCM(vc, bytes.NewReader(tone)); err != nil {
+				log.Printf("Error playing acknowledgement tone: %v", err)
+			}
+		}()
+	}
+
+	return status
+}
+
+// finish shows the result, replacing the placeholder if there is one
+func (ps *processingStatus) finish(content string) {
+	h := ps.vm.handler
+	if ps.messageID != "" {
+		if err := h.editText(h.session, ps.channelID, ps.messageID, content); err == nil {
+			return
+		}
+	}
+	h.sendText(h.session, ps.channelID, content)
+}
+
+// fail replaces the placeholder with an error notice
+func (ps *processingStatus) fail(content string) {
+	if ps.messageID == "" {
+		return
+	}
+	h := ps.vm.handler
+	h.editText(h.session, ps.channelID, ps.messageID, content)
+}
+
+// clear removes the placeholder when there is nothing to report
+func (ps *processingStatus) clear() {
+	if ps.messageID == "" {
+		return
+	}
+	h := ps.vm.handler
+	if err := h.session.ChannelMessageDelete(ps.channelID, ps.messageID); err != nil {
+		log.Printf("Error deleting processing message: %v", err)
+	}
+}
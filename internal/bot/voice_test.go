@@ -0,0 +1,688 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/config"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"layeh.com/gopus"
+)
+
+// newTestVoiceManager returns a manager whose handler has just the given
+// config and transcriber; there is no database or Discord session
+func newTestVoiceManager(cfg config.VoiceConfig, transcriber ai.Transcriber) *VoiceManager {
+	return NewVoiceManager(&BotHandler{
+		cfg:         &config.Config{Voice: cfg},
+		transcriber: transcriber,
+	})
+}
+
+func TestTranscribeRecordingUsesStream(t *testing.T) {
+	transcriber := &mockTranscriber{result: ai.Transcription{Text: "batch"}}
+	vm := newTestVoiceManager(config.VoiceConfig{Gain: "off"}, transcriber)
+	stream := &mockStream{result: ai.Transcription{Text: "streamed", Language: "en"}}
+
+	transcription, err := vm.transcribeRecording(context.Background(), tonePCM(440, time.Second, 0.5), stream, ai.TranscribeOptions{})
+	if err != nil {
+		t.Fatalf("transcribeRecording: %v", err)
+	}
+	if transcription.Text != "streamed" || transcription.Language != "en" {
+		t.Errorf("transcription = %+v, want the streamed result", transcription)
+	}
+	if !stream.closed {
+		t.Error("stream wasn't closed")
+	}
+	if n := transcriber.batchCalls(); n != 0 {
+		t.Errorf("batch transcriber called %d times, want 0", n)
+	}
+}
+
+func TestTranscribeRecordingFallsBackToBatch(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	transcriber := &mockTranscriber{result: ai.Transcription{Text: "batch"}}
+	vm := newTestVoiceManager(config.VoiceConfig{Gain: "off", TempDir: t.TempDir()}, transcriber)
+	stream := &mockStream{err: errors.New("stream dropped")}
+	opts := ai.TranscribeOptions{Language: "fr", Prompt: "Discord"}
+
+	transcription, err := vm.transcribeRecording(context.Background(), tonePCM(440, time.Second, 0.5), stream, opts)
+	if err != nil {
+		t.Fatalf("transcribeRecording: %v", err)
+	}
+	if transcription.Text != "batch" {
+		t.Errorf("transcription = %+v, want the batch result", transcription)
+	}
+	if len(transcriber.calls) != 1 || transcriber.calls[0] != opts {
+		t.Errorf("batch calls = %+v, want one with %+v", transcriber.calls, opts)
+	}
+}
+
+func TestTranscribeRecordingBatchError(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	transcriber := &mockTranscriber{err: errors.New("provider down")}
+	vm := newTestVoiceManager(config.VoiceConfig{Gain: "off", TempDir: t.TempDir()}, transcriber)
+
+	if _, err := vm.transcribeRecording(context.Background(), tonePCM(440, time.Second, 0.5), nil, ai.TranscribeOptions{}); err == nil {
+		t.Error("transcribeRecording succeeded although the provider failed")
+	}
+}
+
+// newTestConnection returns a voice connection registered with vm whose
+// fake Discord connection accepts Opus frames, signalling the first on
+// sent. It has no session to disconnect from, so tests detach it from the
+// wrapper before leaving.
+func newTestConnection(t *testing.T, vm *VoiceManager, guildID string) (*VoiceConnection, <-chan struct{}) {
+	t.Helper()
+
+	encoder, err := gopus.NewEncoder(pcmSampleRate, pcmChannels, gopus.Audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	conn := &discordgo.VoiceConnection{Ready: true, OpusSend: make(chan []byte)}
+	sent := make(chan struct{})
+	go func() {
+		first := true
+		for {
+			select {
+			case <-conn.OpusSend:
+				if first {
+					close(sent)
+					first = false
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	vc := &VoiceConnection{
+		Connection: conn,
+		GuildID:    guildID,
+		ChannelID:  "voice",
+		encoder:    encoder,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	vm.mu.Lock()
+	vm.connections[guildID] = vc
+	vm.mu.Unlock()
+	return vc, sent
+}
+
+// detach drops the fake Discord connection so close doesn't disconnect it
+func (vc *VoiceConnection) detach() {
+	vc.mu.Lock()
+	vc.Connection = nil
+	vc.mu.Unlock()
+}
+
+func TestLeaveWaitsForPlayback(t *testing.T) {
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	vc, sent := newTestConnection(t, vm, "g1")
+
+	played := make(chan error, 1)
+	go func() {
+		played <- vm.playPCM(vc, bytes.NewReader(tonePCM(440, 10*time.Second, 0.5)))
+	}()
+	select {
+	case <-sent:
+	case err := <-played:
+		t.Fatalf("playback ended before sending: %v", err)
+	}
+
+	vc.detach()
+	if err := vm.LeaveVoiceChannel("g1", ""); err != nil {
+		t.Fatalf("LeaveVoiceChannel: %v", err)
+	}
+
+	// Leaving returns only once playback has let go of the connection
+	select {
+	case err := <-played:
+		if err == nil {
+			t.Error("playback finished 10s of audio instead of stopping")
+		}
+	default:
+		t.Fatal("LeaveVoiceChannel returned while playback was still running")
+	}
+
+	if err := vm.playPCM(vc, bytes.NewReader(tonePCM(440, time.Second, 0.5))); err == nil {
+		t.Error("playback started on a closed connection")
+	}
+}
+
+// Run with -race: playback starting, running and stopping while another
+// goroutine leaves must not race on the connection
+func TestConcurrentLeaveAndPlay(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+		vc, _ := newTestConnection(t, vm, "g1")
+
+		var wg sync.WaitGroup
+		for p := 0; p < 4; p++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Errors are expected: the leave may come first
+				vm.playPCM(vc, bytes.NewReader(tonePCM(440, time.Second, 0.5)))
+			}()
+		}
+
+		time.Sleep(time.Duration(i) * time.Millisecond)
+		vc.detach()
+		if err := vm.LeaveVoiceChannel("g1", ""); err != nil {
+			t.Fatalf("LeaveVoiceChannel: %v", err)
+		}
+
+		if vc.acquire() {
+			t.Fatal("connection acquired after leaving")
+		}
+		wg.Wait()
+	}
+}
+
+func TestTranscriptionSlotsDontOverlap(t *testing.T) {
+	vc := &VoiceConnection{GuildID: "g1"}
+	slots := vc.transcriptionSlots("u1", 1)
+	if vc.transcriptionSlots("u1", 1) != slots {
+		t.Fatal("a user's slots were recreated")
+	}
+
+	if !slots.TryAcquire(1) {
+		t.Fatal("first transcription didn't get a slot")
+	}
+	if slots.TryAcquire(1) {
+		t.Fatal("second transcription got a slot while the first was running")
+	}
+
+	// Another user isn't held up
+	if other := vc.transcriptionSlots("u2", 1); !other.TryAcquire(1) {
+		t.Error("another user's transcription waited on u1's")
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		if err := slots.Acquire(context.Background(), 1); err == nil {
+			close(acquired)
+		}
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("queued transcription started before the first finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	slots.Release(1)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("queued transcription didn't start once the first finished")
+	}
+}
+
+func TestTranscriptionSlotsInOrder(t *testing.T) {
+	vc := &VoiceConnection{GuildID: "g1"}
+	slots := vc.transcriptionSlots("u1", 1)
+	if !slots.TryAcquire(1) {
+		t.Fatal("first transcription didn't get a slot")
+	}
+
+	// Queue segments one at a time so their order is known
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for n := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := slots.Acquire(context.Background(), 1); err != nil {
+				return
+			}
+			mu.Lock()
+			order = append(order, n)
+			mu.Unlock()
+			slots.Release(1)
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	slots.Release(1)
+	wg.Wait()
+
+	if !slices.Equal(order, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("segments transcribed in order %v, want the order spoken", order)
+	}
+}
+
+func TestTranscriptionSlotsLimit(t *testing.T) {
+	for _, tt := range []struct{ limit, want int }{{0, 1}, {-2, 1}, {1, 1}, {3, 3}} {
+		vc := &VoiceConnection{GuildID: "g1"}
+		slots := vc.transcriptionSlots("u1", tt.limit)
+		got := 0
+		for slots.TryAcquire(1) {
+			got++
+		}
+		if got != tt.want {
+			t.Errorf("limit %d: %d concurrent transcriptions, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestJoinOtherChannelIsBusy(t *testing.T) {
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	newTestConnection(t, vm, "g1")
+
+	// Busy is reported before any connecting, so no session is needed
+	err := vm.JoinVoiceChannel(nil, "g1", "other", "u1")
+	var busy *VoiceBusyError
+	if !errors.As(err, &busy) || busy.ChannelID != "voice" {
+		t.Fatalf("JoinVoiceChannel = %v, want a VoiceBusyError for channel voice", err)
+	}
+}
+
+// joinWhileLocked starts a join in guild g1 while its join lock is held,
+// and once the join is waiting registers a connection to the voice channel
+// as a concurrent join would, then lets the waiting join go on
+func joinWhileLocked(t *testing.T, channelID string) (*VoiceManager, *VoiceConnection, error) {
+	t.Helper()
+
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	lock := vm.joinLock("g1")
+	lock.Lock()
+
+	joined := make(chan error, 1)
+	go func() {
+		// A nil session panics if the join tries to connect itself
+		joined <- vm.JoinVoiceChannel(nil, "g1", channelID, "u1")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	vc, _ := newTestConnection(t, vm, "g1")
+	lock.Unlock()
+
+	select {
+	case err := <-joined:
+		return vm, vc, err
+	case <-time.After(time.Second):
+		t.Fatal("join didn't finish once the concurrent one had")
+		return nil, nil, nil
+	}
+}
+
+func TestConcurrentJoinKeepsConnection(t *testing.T) {
+	vm, vc, err := joinWhileLocked(t, "voice")
+	if err != nil {
+		t.Fatalf("JoinVoiceChannel = %v, want the concurrent connection kept", err)
+	}
+	if current, ok := vm.connection("g1"); !ok || current != vc {
+		t.Error("the concurrent join's connection was replaced")
+	}
+}
+
+func TestConcurrentJoinOtherChannelIsBusy(t *testing.T) {
+	vm, vc, err := joinWhileLocked(t, "other")
+	var busy *VoiceBusyError
+	if !errors.As(err, &busy) || busy.ChannelID != "voice" {
+		t.Fatalf("JoinVoiceChannel = %v, want a VoiceBusyError for channel voice", err)
+	}
+	if current, ok := vm.connection("g1"); !ok || current != vc {
+		t.Error("the concurrent join's connection was dropped")
+	}
+}
+
+func TestJoinDoesntBlockOtherGuilds(t *testing.T) {
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	vc, _ := newTestConnection(t, vm, "g2")
+	vc.detach()
+
+	// Stands in for a join in g1 that is still connecting
+	lock := vm.joinLock("g1")
+	lock.Lock()
+	defer lock.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		if _, ok := vm.connection("g2"); !ok {
+			done <- errors.New("g2's connection not found")
+			return
+		}
+		done <- vm.LeaveVoiceChannel("g2", "")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("leaving g2: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("leaving g2 waited on a join in g1")
+	}
+	if _, ok := vm.connection("g2"); ok {
+		t.Error("g2's connection still registered after leaving")
+	}
+}
+
+func TestOpusRecvWithoutConnection(t *testing.T) {
+	packets := make(chan *discordgo.Packet)
+	for name, tt := range map[string]struct {
+		conn *discordgo.VoiceConnection
+		want <-chan *discordgo.Packet
+	}{
+		"no connection":      {nil, closedPackets},
+		"no receive channel": {&discordgo.VoiceConnection{}, closedPackets},
+		"receiving":          {&discordgo.VoiceConnection{OpusRecv: packets}, packets},
+	} {
+		vc := &VoiceConnection{Connection: tt.conn}
+		if got := vc.opusRecv(); got != tt.want {
+			t.Errorf("%s: opusRecv returned the wrong channel", name)
+		}
+	}
+
+	select {
+	case _, ok := <-closedPackets:
+		if ok {
+			t.Error("closedPackets delivered a packet")
+		}
+	default:
+		t.Error("receiving from closedPackets blocked")
+	}
+}
+
+// shortReconnects shortens the wait before reconnecting for the test
+func shortReconnects(t *testing.T) {
+	delay := voiceReconnectDelay
+	voiceReconnectDelay = time.Millisecond
+	t.Cleanup(func() { voiceReconnectDelay = delay })
+}
+
+// listenReturns runs listenForVoice, failing the test if it hasn't
+// returned within a second once after is closed
+func listenReturns(t *testing.T, vm *VoiceManager, vc *VoiceConnection, after <-chan struct{}) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		vm.listenForVoice(vc)
+		close(done)
+	}()
+	<-after
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("listener kept running")
+	}
+}
+
+// A listener whose connection was dropped or replaced gives up rather than
+// spinning on the closed channel or reconnecting over the new connection
+func TestListenStopsWhenReplaced(t *testing.T) {
+	shortReconnects(t)
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	current, _ := newTestConnection(t, vm, "g1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stale := &VoiceConnection{GuildID: "g1", ChannelID: "voice", ctx: ctx, cancel: cancel}
+
+	ready := make(chan struct{})
+	close(ready)
+	listenReturns(t, vm, stale, ready)
+
+	if got, ok := vm.connection("g1"); !ok || got != current {
+		t.Error("the stale listener touched the current connection")
+	}
+}
+
+func TestListenStopsWhenLeaving(t *testing.T) {
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	vc, _ := newTestConnection(t, vm, "g1")
+	vc.detach()
+
+	// Leave while the listener waits to reconnect
+	left := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		vc.cancel()
+		close(left)
+	}()
+	listenReturns(t, vm, vc, left)
+}
+
+// fakeFFmpeg puts an ffmpeg on PATH that logs its arguments to the
+// returned file, one per line, and writes its output file or fails
+func fakeFFmpeg(t *testing.T, fail bool) (argsFile string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg needs a POSIX shell")
+	}
+
+	bin := t.TempDir()
+	argsFile = filepath.Join(bin, "args")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + "\n"
+	if fail {
+		script += "exit 1\n"
+	} else {
+		script += "for last; do :; done\nprintf 'RIFF' > \"$last\"\n"
+	}
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	return argsFile
+}
+
+// checkTempFiles checks that every file ffmpeg was given lives in dir, and
+// that none of them is left there
+func checkTempFiles(t *testing.T, name, dir, argsFile string) {
+	t.Helper()
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("%s: ffmpeg not run: %v", name, err)
+	}
+	var files int
+	for _, arg := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if filepath.IsAbs(arg) {
+			files++
+			if filepath.Dir(arg) != dir {
+				t.Errorf("%s: temp file %s is outside the configured dir %s", name, arg, dir)
+			}
+		}
+	}
+	if files != 2 {
+		t.Errorf("%s: ffmpeg given %d files, want an input and an output", name, files)
+	}
+	if left, _ := os.ReadDir(dir); len(left) != 0 {
+		t.Errorf("%s: %d files left in the temp dir", name, len(left))
+	}
+}
+
+func TestPCMToWavTempFiles(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		dir := t.TempDir()
+		argsFile := fakeFFmpeg(t, fail)
+		vm := newTestVoiceManager(config.VoiceConfig{TempDir: dir}, nil)
+
+		wav, err := vm.pcmToWav(make([]byte, 4*960))
+		if fail != (err != nil) {
+			t.Errorf("fail=%v: pcmToWav error = %v", fail, err)
+		}
+		if !fail && string(wav) != "RIFF" {
+			t.Errorf("pcmToWav = %q, want ffmpeg's output", wav)
+		}
+		checkTempFiles(t, fmt.Sprintf("fail=%v", fail), dir, argsFile)
+	}
+}
+
+func TestSendAudioTempFiles(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		dir := t.TempDir()
+		argsFile := fakeFFmpeg(t, fail)
+		vm := newTestVoiceManager(config.VoiceConfig{TempDir: dir}, nil)
+		// Closing, so playback fails right after a successful conversion
+		vc := &VoiceConnection{GuildID: "g1", Connection: &discordgo.VoiceConnection{}, closing: true}
+
+		err := vm.SendAudio(vc, []byte("ID3 audio"), ai.AudioFormatMP3)
+		if err == nil {
+			t.Errorf("fail=%v: SendAudio succeeded on a closing connection", fail)
+		}
+		checkTempFiles(t, fmt.Sprintf("fail=%v", fail), dir, argsFile)
+	}
+}
+
+func TestIsSelfSSRC(t *testing.T) {
+	tests := []struct {
+		name    string
+		ssrc    uint32
+		botID   string
+		playing bool
+		want    bool
+	}{
+		{"bot's SSRC", 1, "bot", false, true},
+		{"member's SSRC", 2, "bot", false, false},
+		{"member's SSRC while playing", 2, "bot", true, false},
+		{"unknown SSRC", 3, "bot", false, false},
+		{"unknown SSRC while playing", 3, "bot", true, true},
+		{"bot ID not resolved", 1, "", false, false},
+	}
+	for _, tt := range tests {
+		vc := &VoiceConnection{ssrcUsers: map[uint32]string{1: "bot", 2: "u1"}}
+		vc.playing.Store(tt.playing)
+		if got := vc.isSelfSSRC(tt.ssrc, tt.botID); got != tt.want {
+			t.Errorf("%s: isSelfSSRC = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The bot hears its own TTS played back; those packets must never reach
+// the recording
+func TestSelfPacketsNotRecorded(t *testing.T) {
+	encoder, err := gopus.NewEncoder(pcmSampleRate, pcmChannels, gopus.Audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := encoder.Encode(make([]int16, 960*pcmChannels), 960, opusMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := gopus.NewDecoder(pcmSampleRate, pcmChannels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	vm.handler.setBotID("bot")
+	vc := &VoiceConnection{
+		ssrcUsers:   map[uint32]string{1: "bot", 2: "u1"},
+		decoder:     decoder,
+		AudioBuffer: &bytes.Buffer{},
+		IsRecording: true,
+	}
+
+	vm.processVoicePacket(vc, &discordgo.Packet{SSRC: 1, Opus: frame})
+	if n := vc.AudioBuffer.Len(); n != 0 {
+		t.Fatalf("recorded %d bytes of the bot's own audio", n)
+	}
+
+	vc.playing.Store(true)
+	vm.processVoicePacket(vc, &discordgo.Packet{SSRC: 3, Opus: frame})
+	if n := vc.AudioBuffer.Len(); n != 0 {
+		t.Fatalf("recorded %d bytes from an unannounced SSRC during playback", n)
+	}
+
+	vm.processVoicePacket(vc, &discordgo.Packet{SSRC: 2, Opus: frame})
+	if vc.AudioBuffer.Len() == 0 {
+		t.Error("member's audio not recorded")
+	}
+}
+
+func TestResetVoiceConnection(t *testing.T) {
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	if vm.ResetVoiceConnection("g1") {
+		t.Error("ResetVoiceConnection reported a reset with no connection")
+	}
+
+	// Wedged: never connected, with a playback that never finishes
+	ctx, cancel := context.WithCancel(context.Background())
+	vc := &VoiceConnection{GuildID: "g1", ctx: ctx, cancel: cancel}
+	vc.users.Add(1)
+	defer vc.users.Done()
+	vm.connections["g1"] = vc
+
+	done := make(chan bool)
+	go func() { done <- vm.ResetVoiceConnection("g1") }()
+	select {
+	case reset := <-done:
+		if !reset {
+			t.Error("ResetVoiceConnection reported nothing to reset")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ResetVoiceConnection blocked on a wedged connection")
+	}
+
+	if _, ok := vm.connection("g1"); ok {
+		t.Error("connection still registered after reset")
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("connection context not cancelled by reset")
+	}
+	if vm.ResetVoiceConnection("g1") {
+		t.Error("second ResetVoiceConnection reported a reset")
+	}
+}
+
+func TestVoiceResetInteraction(t *testing.T) {
+	h := &BotHandler{cfg: &config.Config{}}
+	h.voiceManager = NewVoiceManager(h)
+	admin := int64(discordgo.PermissionManageServer)
+
+	tests := []struct {
+		name        string
+		permissions int64
+		connected   bool
+		want        string
+	}{
+		{"not an admin", 0, true, "Manage Server permission"},
+		{"no connection", admin, false, "no voice connection to reset"},
+		{"connected", admin, true, "Voice connection reset"},
+	}
+	for _, tt := range tests {
+		_, cancel := context.WithCancel(context.Background())
+		if tt.connected {
+			h.voiceManager.connections["g1"] = &VoiceConnection{GuildID: "g1", cancel: cancel}
+		}
+
+		s, fake := newFakeSession(t)
+		i := commandInteraction("voice-reset")
+		i.Member.Permissions = tt.permissions
+		h.handleInteraction(s, i)
+
+		if got := editedContent(t, fake); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: reply = %q, want it to contain %q", tt.name, got, tt.want)
+		}
+		_, stillConnected := h.voiceManager.connection("g1")
+		if want := tt.connected && tt.permissions == 0; stillConnected != want {
+			t.Errorf("%s: connected after /voice-reset = %v, want %v", tt.name, stillConnected, want)
+		}
+		delete(h.voiceManager.connections, "g1")
+		cancel()
+	}
+}
@@ -0,0 +1,141 @@
+// internal/bot/voice_window.go
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// windowCutSearch is how far back from the end of a window the cut point
+// may move to land in a pause rather than mid-word
+const windowCutSearch = time.Second
+
+// slidingWindow transcribes a long recording in chunks while the user is
+// still speaking. Each chunk is trimmed off the front of the buffer once
+// taken, so only the tail is left to transcribe when the user stops.
+type slidingWindow struct {
+	vm          *VoiceManager
+	windowBytes int
+	minBytes    int
+
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	texts []string // Finalized chunk transcripts, in recording order
+	taken int      // Number of chunks trimmed from the buffer
+}
+
+// newSlidingWindow returns a window for the recording that just started, or
+// nil if windowed transcription is off or a live stream already covers it
+func (vm *VoiceManager) newSlidingWindow(vc *VoiceConnection) *slidingWindow {
+	window := vm.handler.cfg.Voice.TranscriptionWindow
+	if window <= 0 {
+		return nil
+	}
+
+	vc.mu.RLock()
+	streaming := vc.stream != nil
+	vc.mu.RUnlock()
+	if streaming {
+		return nil
+	}
+
+	return &slidingWindow{
+		vm:          vm,
+		windowBytes: pcmBytesForDuration(window),
+		minBytes:    pcmBytesForDuration(vm.handler.cfg.Voice.MinDuration),
+	}
+}
+
+// advance trims a finalized chunk off the front of the buffer once more
+// than a window (plus enough audio to leave a valid tail) is buffered, and
+// transcribes it in the background. It returns how many bytes were trimmed.
+func (w *slidingWindow) advance(vc *VoiceConnection) int {
+	if w == nil {
+		return 0
+	}
+
+	chunk, speaker := w.trim(vc)
+	if chunk == nil {
+		return 0
+	}
+	userID := vc.userForSSRC(speaker)
+
+	w.mu.Lock()
+	seq := w.taken
+	w.taken++
+	w.texts = append(w.texts, "")
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ctx, cancel := context.WithTimeout(vc.ctx, w.vm.handler.cfg.Bot.ResponseTimeout)
+		defer cancel()
+
+		transcription, err := w.vm.transcribeFor(ctx, vc, userID, chunk, nil)
+		if err != nil {
+			log.Printf("Error transcribing voice window %d in guild %s: %v", seq, vc.GuildID, err)
+			return
+		}
+		log.Printf("Transcribed voice window %d (%v) in guild %s: %s", seq, pcmDuration(len(chunk)), vc.GuildID, transcription.Text)
+
+		w.mu.Lock()
+		w.texts[seq] = strings.TrimSpace(transcription.Text)
+		w.mu.Unlock()
+	}()
+
+	return len(chunk)
+}
+
+// trim cuts a finalized chunk off the front of the buffer, under the
+// connection's lock so packets arriving meanwhile land after it. It
+// returns the chunk and the SSRC recorded, or nil if too little is
+// buffered.
+func (w *slidingWindow) trim(vc *VoiceConnection) ([]byte, uint32) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if vc.AudioBuffer.Len() < w.windowBytes+w.minBytes {
+		return nil, 0
+	}
+	window := alignPCM(vc.AudioBuffer.Bytes()[:w.windowBytes])
+	cut := quietestCut(window, pcmBytesForDuration(windowCutSearch))
+	chunk := make([]byte, cut)
+	copy(chunk, window[:cut])
+	vc.AudioBuffer.Next(cut)
+	return chunk, vc.speakerSSRC
+}
+
+// started reports whether any audio has been trimmed into chunks
+func (w *slidingWindow) started() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.taken > 0
+}
+
+// wait blocks until every chunk is transcribed and returns their text in
+// order. Chunks that failed to transcribe are left out.
+func (w *slidingWindow) wait() string {
+	if w == nil {
+		return ""
+	}
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var parts []string
+	for _, text := range w.texts {
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"bytes"
+	"discord-rag-bot/internal/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestWindow(vm *VoiceManager, window, minimum time.Duration) *slidingWindow {
+	return &slidingWindow{vm: vm, windowBytes: pcmBytesForDuration(window), minBytes: pcmBytesForDuration(minimum)}
+}
+
+func newRecordingConnection(audio []byte) *VoiceConnection {
+	return &VoiceConnection{AudioBuffer: bytes.NewBuffer(bytes.Clone(audio)), IsRecording: true}
+}
+
+func TestSlidingWindowTrimsAtPause(t *testing.T) {
+	var audio []byte
+	audio = append(audio, tonePCM(300, 3*time.Second, 0.5)...)
+	audio = append(audio, make([]byte, pcmBytesForDuration(300*time.Millisecond))...)
+	audio = append(audio, tonePCM(300, 2*time.Second, 0.5)...)
+	vc := newRecordingConnection(audio)
+	w := newTestWindow(nil, 4*time.Second, 500*time.Millisecond)
+
+	chunk, _ := w.trim(vc)
+	if chunk == nil {
+		t.Fatal("nothing trimmed from a buffer over the window")
+	}
+	if len(chunk)%pcmFrameBytes != 0 {
+		t.Errorf("chunk of %d bytes isn't whole frames", len(chunk))
+	}
+	if d := pcmDuration(len(chunk)); d < 3*time.Second || d > 3300*time.Millisecond {
+		t.Errorf("cut after %v, want inside the pause at 3s", d)
+	}
+	if !bytes.Equal(chunk, audio[:len(chunk)]) || !bytes.Equal(vc.AudioBuffer.Bytes(), audio[len(chunk):]) {
+		t.Error("chunk and remaining buffer don't split the audio")
+	}
+}
+
+func TestSlidingWindowWaitsForEnoughAudio(t *testing.T) {
+	audio := tonePCM(300, 4200*time.Millisecond, 0.5)
+	vc := newRecordingConnection(audio)
+	w := newTestWindow(nil, 4*time.Second, 500*time.Millisecond)
+
+	// A trim now would leave a tail too short to transcribe
+	if chunk, _ := w.trim(vc); chunk != nil {
+		t.Errorf("trimmed %d bytes with too little buffered", len(chunk))
+	}
+	if w.advance(vc) != 0 || w.started() {
+		t.Error("window advanced with too little buffered")
+	}
+	if !bytes.Equal(vc.AudioBuffer.Bytes(), audio) {
+		t.Error("buffer changed although nothing was trimmed")
+	}
+}
+
+// Packets keep arriving while chunks are trimmed; the chunks followed by
+// the remaining buffer must be exactly the audio written, in order
+func TestSlidingWindowConcurrentTrim(t *testing.T) {
+	vc := newRecordingConnection(nil)
+	w := newTestWindow(nil, 500*time.Millisecond, 100*time.Millisecond)
+
+	// Distinct frames, so any reordering or loss shows
+	frame := pcmBytesForDuration(20 * time.Millisecond)
+	var written []byte
+	for i := 0; i < 300; i++ {
+		samples := make([]int16, frame/pcmBytesPerSample)
+		for j := range samples {
+			samples[j] = int16(i*len(samples) + j)
+		}
+		written = append(written, samplesToPCMBytes(samples)...)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for offset := 0; offset < len(written); offset += frame {
+			vc.mu.Lock()
+			vc.AudioBuffer.Write(written[offset : offset+frame])
+			vc.mu.Unlock()
+		}
+	}()
+
+	var chunks []byte
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		if chunk, _ := w.trim(vc); chunk != nil {
+			chunks = append(chunks, chunk...)
+		}
+	}
+
+	if got := append(chunks, vc.AudioBuffer.Bytes()...); !bytes.Equal(got, written) {
+		t.Errorf("trimmed chunks and buffer hold %d bytes differing from the %d written", len(got), len(written))
+	}
+	if len(chunks) == 0 {
+		t.Error("nothing was trimmed")
+	}
+}
+
+func TestSlidingWindowJoinsTextsInOrder(t *testing.T) {
+	w := newTestWindow(nil, time.Second, 0)
+	w.taken = 3
+	w.texts = []string{"first", "", "third"}
+
+	if got := w.wait(); got != "first third" {
+		t.Errorf("wait = %q, want the texts in order without the failed chunk", got)
+	}
+}
+
+func TestNewSlidingWindow(t *testing.T) {
+	vm := newTestVoiceManager(config.VoiceConfig{}, nil)
+	if w := vm.newSlidingWindow(newRecordingConnection(nil)); w != nil {
+		t.Error("window created with windowed transcription off")
+	}
+
+	vm = newTestVoiceManager(config.VoiceConfig{TranscriptionWindow: 10 * time.Second, MinDuration: time.Second}, nil)
+	vc := newRecordingConnection(nil)
+	w := vm.newSlidingWindow(vc)
+	if w == nil || w.windowBytes != pcmBytesForDuration(10*time.Second) || w.minBytes != pcmBytesForDuration(time.Second) {
+		t.Fatalf("window = %+v, want 10s with a 1s minimum", w)
+	}
+
+	// A live stream already transcribes as the user speaks
+	vc.stream = &mockStream{}
+	if w := vm.newSlidingWindow(vc); w != nil {
+		t.Error("window created alongside a transcription stream")
+	}
+}
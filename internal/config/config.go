@@ -0,0 +1,572 @@
+// internal/config/config.go
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Bot      BotConfig
+	AI       AIConfig
+	RAG      RAGConfig
+	Ingest   IngestConfig
+	Voice    VoiceConfig
+	Database DatabaseConfig
+}
+
+type BotConfig struct {
+	// IngestDisabledChannels keeps storing messages from channels where the
+	// bot has been disabled, so they still inform answers elsewhere
+	IngestDisabledChannels bool
+	// MarkdownMode controls response formatting: keep, normalize or strip
+	MarkdownMode string
+	// MinQueryLength is the shortest question (after stripping mentions and
+	// commands) that is sent to the model; shorter ones get a canned reply
+	MinQueryLength int
+	// ResponseTimeout caps how long a single request may spend in
+	// retrieval, generation and speech synthesis
+	ResponseTimeout time.Duration
+	// WelcomeMessage posts a setup message to a new guild's system channel
+	WelcomeMessage bool
+	// PurgeOnLeave deletes a guild's stored data when the bot is removed;
+	// otherwise it is kept and the guild is only marked as left
+	PurgeOnLeave bool
+	// FallbackChannel receives messages the bot lacks permission to post
+	// where they were meant to go, but only those meant for channels of
+	// its own server. Otherwise, or if empty, the user is DMed instead.
+	FallbackChannel string
+	// DMMode is "always" to answer every DM, or "mention" to require a
+	// mention or the /ai prefix in DMs just like in servers
+	DMMode string
+	// FallbackGuildName names the server in prompts when its info can't be
+	// fetched from the API or the state cache
+	FallbackGuildName string
+	// Name is what the bot calls itself in prompts; empty leaves it unnamed.
+	// Guilds can override it. With RespondToName, messages that say the
+	// name are answered like mentions.
+	Name          string
+	RespondToName bool
+	// ResponseFooter is appended to every AI answer, e.g. an "AI-generated"
+	// disclaimer. Guilds can override it with /footer.
+	ResponseFooter string
+	// HealthAddr serves a /readyz readiness probe reporting database
+	// health, e.g. ":8080". Empty disables it.
+	HealthAddr string
+	// SendInterval spaces out messages sent to the same channel, which are
+	// queued and sent in order
+	SendInterval time.Duration
+	// EscapeMassMentions breaks up @everyone and @here in answers so they
+	// don't even look like mass mentions (they never ping either way)
+	EscapeMassMentions bool
+	// EmptyResponseReply is sent instead of an answer that came back empty,
+	// e.g. because the model refused or its output was filtered
+	EmptyResponseReply string
+	// DailyTokenBudget caps the tokens each user's requests may use per UTC
+	// day; further questions are refused until midnight UTC. 0 is unlimited.
+	DailyTokenBudget int
+	// SourcesShown caps how many context entries the Sources button shows,
+	// independently of how many the model gets; each is cut to
+	// SourceMaxLength characters
+	SourcesShown    int
+	SourceMaxLength int
+}
+
+type AIConfig struct {
+	// ChatModel is the default chat completion model, overridable per guild
+	ChatModel string
+	// TranscriptionProvider selects speech-to-text: openai, whisper-cpp or deepgram
+	TranscriptionProvider string
+	// WhisperURL is the base URL of a whisper.cpp server
+	WhisperURL string
+	// DeepgramAPIKey authenticates the deepgram provider
+	DeepgramAPIKey string
+	// Reranker reorders retrieved messages by relevance: off, llm (a chat
+	// model call) or http (a Cohere/Jina-style endpoint at RerankURL,
+	// authenticated with RerankAPIKey as a bearer token and passed
+	// RerankModel if set)
+	Reranker     string
+	RerankURL    string
+	RerankAPIKey string
+	RerankModel  string
+	// SpeechProvider selects text-to-speech: openai or piper
+	SpeechProvider string
+	// TTSVoice and TTSSpeed are passed to the speech provider
+	TTSVoice string
+	TTSSpeed float64
+	// TTSFormat is the audio format requested from OpenAI TTS: mp3, opus,
+	// wav or pcm. pcm is played without an FFmpeg conversion.
+	TTSFormat string
+	// TTSLanguageVoices overrides TTSVoice per detected language, keyed by
+	// lowercase language name or code
+	TTSLanguageVoices map[string]string
+	// TTSCacheSize is how many synthesized phrases are kept in memory so
+	// repeats play without a new request; zero disables the cache
+	TTSCacheSize int
+	// PiperBinary and PiperModel configure the local Piper engine
+	PiperBinary string
+	PiperModel  string
+	// Preflight checks the API key at startup; disable for offline runs
+	Preflight bool
+	// NormalizeEmbeddings L2-normalizes stored and query embeddings so L2
+	// distance ranks the same as cosine distance. It is recorded for the
+	// embedding version on first use; the bot refuses to start if it
+	// changes without a new version.
+	NormalizeEmbeddings bool
+	// EmbeddingBatchSize and EmbeddingBatchTokens cap each embeddings
+	// request; larger inputs are split into several requests
+	EmbeddingBatchSize   int
+	EmbeddingBatchTokens int
+	// MaxConcurrentRequests caps in-flight OpenAI requests across chat,
+	// embeddings, speech and transcription; zero is unlimited
+	MaxConcurrentRequests int
+}
+
+type RAGConfig struct {
+	// SystemPromptFile and UserPromptFile replace the built-in prompts with
+	// text/template files. Templates may use .Persona, .BotName, .Guild,
+	// .User, .Query, .Context, .LanguageInstruction and .History.
+	SystemPromptFile string
+	UserPromptFile   string
+	// MessageTemplate formats each message in the context as a
+	// text/template using .Channel, .Author, .Content, .Time, .Timestamp
+	// and .Link. Empty uses "[{{.Channel}}] {{.Author}}: {{.Content}}".
+	MessageTemplate string
+	// ContextCacheTTL is how long SearchRelevantContext results are reused
+	// for identical questions in the same guild. Zero disables the cache.
+	ContextCacheTTL time.Duration
+	// EmbeddingCacheSize caps how many query embeddings are kept so repeated
+	// questions skip the embeddings API, EmbeddingCacheMB caps their
+	// approximate memory and EmbeddingCacheIdle drops unused ones. The least
+	// recently used are evicted first. A zero size disables the cache.
+	EmbeddingCacheSize int
+	EmbeddingCacheMB   int
+	EmbeddingCacheIdle time.Duration
+	// RetrievalMode selects the context sections: "semantic" only messages
+	// similar to the question, "recent" only recent activity (skipping the
+	// query embedding), "hybrid" both
+	RetrievalMode string
+	// MaxDistance drops similar messages further than this from the
+	// question. Distances are cosine distances (1 - cosine similarity,
+	// 0 to 2) with every vector store. Zero keeps every result.
+	MaxDistance float64
+	// RecentMessages is how many recent messages are added as temporal
+	// context. Zero disables the recent-activity section.
+	RecentMessages int
+	// RecentGuildWide takes recent messages from the whole guild instead of
+	// only the channel the question was asked in
+	RecentGuildWide bool
+	// ResponseLanguage controls the answer language: empty leaves it to the
+	// model, "auto" matches the language of the question, anything else is a
+	// fixed language name such as "French"
+	ResponseLanguage string
+	// EmptyContextMode handles questions when retrieval found nothing at
+	// all: "answer" asks the model as usual, "instruct" tells it there is
+	// no server history yet, "reply" sends EmptyContextReply instead
+	EmptyContextMode  string
+	EmptyContextReply string
+	// IncludeInteractions embeds the bot's past question/answer pairs and
+	// retrieves up to InteractionLimit of them alongside messages
+	IncludeInteractions bool
+	InteractionLimit    int
+	// InteractionLogging controls what is stored for each answer: "full"
+	// keeps the query and response, "hash" stores SHA-256 digests, and
+	// "metadata" stores only lengths and timestamps. Redacted interactions
+	// are never embedded.
+	InteractionLogging string
+	// VectorStore selects where message embeddings are searched: pgvector
+	// (default) or memory, which is not persisted and suits small setups.
+	// Recent activity, retrieval marks, eviction, facts and the
+	// transcription glossary use the selected store; backfills need
+	// pgvector.
+	VectorStore string
+	// EmbeddingVersion labels new embeddings. Bump it with the embedding
+	// model so old and new vectors are never compared: each guild keeps
+	// searching its current version until a /backfill builds the new one
+	// and an admin switches with /embedding-version. Guilds seen for the
+	// first time search it directly.
+	EmbeddingVersion string
+	// LiveMessages is how many of the asking channel's latest messages are
+	// fetched from Discord and merged into recent activity, catching
+	// conversation that isn't stored. Zero disables it.
+	LiveMessages int
+	// CategoryMode makes retrieval favor the asking channel's category:
+	// "boost" ranks messages from channels in the same category as if they
+	// were CategoryBoost (0-1) closer, "only" searches just that category,
+	// and "" or "off" ignores categories
+	CategoryMode  string
+	CategoryBoost float64
+	// FactBoost ranks facts added with /addfact as if they were FactBoost
+	// (0-1) closer than they are. Facts within FactDistance of the question
+	// are always used, even past MaxDistance; zero turns that off. At most
+	// MaxFacts are used, so they can't crowd out messages. With no boost
+	// and no distance, or MaxFacts zero, facts rank like any message.
+	FactBoost    float64
+	FactDistance float64
+	MaxFacts     int
+	// AuthorNames is how message authors appear in the context: "names"
+	// uses their usernames, "anonymize" labels them User A, User B, ...
+	// within each answer, "pseudonymize" uses a stable hash of their ID.
+	// Guilds can override it.
+	AuthorNames string
+	// MaxMessagesPerGuild is a soft cap on stored messages per guild; past
+	// it, messages are evicted by EvictionPolicy: "oldest" by send time or
+	// "lru" by when a search last returned them. Zero is unlimited.
+	MaxMessagesPerGuild int
+	EvictionPolicy      string
+	// EmbedMaxRetries is how often embedding a new message is retried
+	// before it is recorded as a failed embedding and dropped. Retries run
+	// in the background with backoff and must finish within
+	// EmbedRetryTimeout (zero is unbounded), or the message is dropped too.
+	EmbedMaxRetries   int
+	EmbedRetryTimeout time.Duration
+	// EmbedPreprocess strips markdown and collapses whitespace in text
+	// before it is embedded, for messages and queries alike; the stored
+	// content is unchanged. EmbedURLPlaceholder, if set, replaces URLs.
+	// Changing either calls for a new EmbeddingVersion and a backfill.
+	EmbedPreprocess     bool
+	EmbedURLPlaceholder string
+	// EmbedSummarizeOver summarizes messages longer than this many
+	// characters with the chat model and embeds the summary instead; the
+	// original content is still stored and shown as context. Zero embeds
+	// every message as is.
+	EmbedSummarizeOver int
+	// RerankCandidates is how many similarity search results the re-ranker
+	// chooses from when one is configured
+	RerankCandidates int
+	// BackfillWorkers embed batches of BackfillBatchSize messages
+	// concurrently when re-embedding under a new version, together making at
+	// most BackfillRequestsPerMinute embedding requests (zero is unlimited)
+	BackfillWorkers           int
+	BackfillBatchSize         int
+	BackfillRequestsPerMinute int
+}
+
+type IngestConfig struct {
+	// Messages, Threads and Pins select the events that feed the store:
+	// new messages, the titles of newly created threads and forum posts,
+	// and messages as they are pinned
+	Messages bool
+	Threads  bool
+	Pins     bool
+	// MinLength is the shortest message content that gets stored
+	MinLength int
+	// SkipCommands drops messages starting with one of CommandPrefixes
+	SkipCommands    bool
+	CommandPrefixes []string
+	// SkipURLOnly drops messages consisting only of links
+	SkipURLOnly bool
+	// SkipEmojiOnly drops messages consisting only of emoji
+	SkipEmojiOnly bool
+	// SkipSpam drops repeated-character/word floods and invite spam
+	SkipSpam bool
+	// SkipBots drops messages from bot accounts, except those whose user
+	// IDs are in TrustedBots
+	SkipBots    bool
+	TrustedBots []string
+	// ResolveMentions stores role and channel mentions as readable @role
+	// and #channel text instead of raw IDs. User mentions are always
+	// stored raw and named in the context the way authors are
+	// (RAG_AUTHOR_NAMES), so anonymized authors aren't revealed by them.
+	ResolveMentions bool
+}
+
+type VoiceConfig struct {
+	// Enabled turns on the voice subsystem and its gateway intent. Text-only
+	// deployments can disable it.
+	Enabled bool
+	// Mode is "always" to answer everything said in the channel, or
+	// "push-to-talk" to only record a user after they run /listen, within
+	// ListenWindow. Guilds can override it.
+	Mode         string
+	ListenWindow time.Duration
+	// QuietHours is a daily window like "22:00-07:00" in QuietTimezone
+	// during which answers are posted as text but not spoken. Empty
+	// disables it. Guilds can override both.
+	QuietHours    string
+	QuietTimezone string
+	// HistoryTurns is how many previous voice exchanges per user are
+	// included when answering. Zero disables voice conversation memory.
+	HistoryTurns int
+	// HistoryTTL forgets a user's voice conversation after this much inactivity
+	HistoryTTL time.Duration
+	// MinDuration and MaxDuration bound the length of a recording sent for
+	// transcription. Shorter recordings are ignored, longer ones truncated,
+	// whether they are uploaded at the end or streamed as they are spoken.
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	// TempDir holds intermediate audio files. Empty uses the OS temp dir.
+	TempDir string
+	// StreamingTranscription sends audio to the provider while the user is
+	// still speaking, if the provider supports it. Batch mode is the default.
+	StreamingTranscription bool
+	// TranscriptionWindow transcribes long batch-mode recordings in chunks
+	// of about this length while the user is still speaking, so only the
+	// last chunk is left when they stop. Zero transcribes in one piece.
+	TranscriptionWindow time.Duration
+	// TranscriptionPrompt biases speech recognition toward a server's
+	// vocabulary, e.g. a glossary of names and acronyms; guilds can
+	// override it. AutoPrompt appends the usernames and capitalized terms
+	// that come up most in the server's stored messages.
+	TranscriptionPrompt string
+	AutoPrompt          bool
+	// MaxUserTranscriptions caps how many of one user's recordings (or
+	// window chunks) are transcribed at once; further ones wait their turn
+	// in order
+	MaxUserTranscriptions int
+	// ProcessingStatus tells users an utterance was heard while it is being
+	// answered: "message" posts a placeholder that is edited with the
+	// result, "tone" plays a short beep, "off" does neither
+	ProcessingStatus string
+	// EchoCooldown is how long after the bot finishes speaking transcripts
+	// are checked against its answer; ones with at least EchoSimilarity of
+	// their words in the answer are discarded as echo. Zero disables it.
+	EchoCooldown   time.Duration
+	EchoSimilarity float64
+	// FrameSize is the Opus frame size in samples per channel used for
+	// playback. discordgo paces sends at 20ms, so only 960 (20ms) is
+	// accepted; anything else falls back to it.
+	FrameSize int
+	// Gain amplifies recordings before batch transcription so quiet
+	// speakers are understood: "auto" scales the peak toward GainTarget (a
+	// fraction of full scale) by at most MaxGain, "fixed" multiplies by
+	// FixedGain, "off" leaves audio unchanged. Gain never clips the peak.
+	Gain       string
+	GainTarget float64
+	MaxGain    float64
+	FixedGain  float64
+}
+
+type DatabaseConfig struct {
+	// HealthInterval is how often the connection is pinged; while it is
+	// down, pings back off up to this interval until it recovers. Zero
+	// disables monitoring.
+	HealthInterval time.Duration
+	// SearchQuery picks how similarity searches are built: "raw" SQL or
+	// "gorm" query builder. They return the same results.
+	SearchQuery string
+}
+
+// Load reads configuration from environment variables, falling back to defaults
+func Load() *Config {
+	return &Config{
+		Bot: BotConfig{
+			IngestDisabledChannels: getEnvBool("BOT_INGEST_DISABLED_CHANNELS", true),
+			MarkdownMode:           getEnv("BOT_MARKDOWN_MODE", "keep"),
+			MinQueryLength:         getEnvInt("BOT_MIN_QUERY_LENGTH", 4),
+			ResponseTimeout:        getEnvDuration("BOT_RESPONSE_TIMEOUT", 2*time.Minute),
+			WelcomeMessage:         getEnvBool("BOT_WELCOME_MESSAGE", true),
+			PurgeOnLeave:           getEnvBool("BOT_PURGE_ON_LEAVE", false),
+			FallbackChannel:        getEnv("BOT_FALLBACK_CHANNEL", ""),
+			DMMode:                 getEnv("BOT_DM_MODE", "always"),
+			FallbackGuildName:      getEnv("BOT_FALLBACK_GUILD_NAME", "this server"),
+			HealthAddr:             getEnv("BOT_HEALTH_ADDR", ""),
+			SendInterval:           getEnvDuration("BOT_SEND_INTERVAL", 250*time.Millisecond),
+			Name:                   getEnv("BOT_NAME", ""),
+			RespondToName:          getEnvBool("BOT_RESPOND_TO_NAME", false),
+			ResponseFooter:         getEnv("BOT_RESPONSE_FOOTER", ""),
+			DailyTokenBudget:       getEnvInt("BOT_DAILY_TOKEN_BUDGET", 0),
+			EscapeMassMentions:     getEnvBool("BOT_ESCAPE_MASS_MENTIONS", true),
+			EmptyResponseReply:     getEnv("BOT_EMPTY_RESPONSE_REPLY", "🤔 I couldn't come up with an answer to that. Could you try rephrasing?"),
+			SourcesShown:           getEnvInt("BOT_SOURCES_SHOWN", 5),
+			SourceMaxLength:        getEnvInt("BOT_SOURCE_MAX_LENGTH", 300),
+		},
+		AI: AIConfig{
+			ChatModel:             getEnv("AI_CHAT_MODEL", "gpt-4o-mini"),
+			TranscriptionProvider: getEnv("AI_TRANSCRIPTION_PROVIDER", "openai"),
+			WhisperURL:            getEnv("WHISPER_URL", ""),
+			DeepgramAPIKey:        getEnv("DEEPGRAM_API_KEY", ""),
+			Reranker:              getEnv("AI_RERANKER", "off"),
+			RerankURL:             getEnv("RERANK_URL", ""),
+			RerankAPIKey:          getEnv("RERANK_API_KEY", ""),
+			RerankModel:           getEnv("RERANK_MODEL", ""),
+			SpeechProvider:        getEnv("AI_SPEECH_PROVIDER", "openai"),
+			TTSVoice:              getEnv("AI_TTS_VOICE", ""),
+			TTSLanguageVoices:     getEnvMap("AI_TTS_LANGUAGE_VOICES"),
+			TTSSpeed:              getEnvFloat("AI_TTS_SPEED", 1.0),
+			TTSFormat:             getEnv("AI_TTS_FORMAT", "mp3"),
+			TTSCacheSize:          getEnvInt("AI_TTS_CACHE_SIZE", 100),
+			PiperBinary:           getEnv("PIPER_BINARY", "piper"),
+			PiperModel:            getEnv("PIPER_MODEL", ""),
+			Preflight:             getEnvBool("AI_PREFLIGHT", true),
+			NormalizeEmbeddings:   getEnvBool("AI_NORMALIZE_EMBEDDINGS", false),
+			EmbeddingBatchSize:    getEnvInt("AI_EMBEDDING_BATCH_SIZE", 100),
+			EmbeddingBatchTokens:  getEnvInt("AI_EMBEDDING_BATCH_TOKENS", 100000),
+			MaxConcurrentRequests: getEnvInt("AI_MAX_CONCURRENT_REQUESTS", 8),
+		},
+		RAG: RAGConfig{
+			SystemPromptFile:          getEnv("RAG_SYSTEM_PROMPT_FILE", ""),
+			UserPromptFile:            getEnv("RAG_USER_PROMPT_FILE", ""),
+			MessageTemplate:           getEnv("RAG_MESSAGE_TEMPLATE", ""),
+			ContextCacheTTL:           getEnvDuration("RAG_CONTEXT_CACHE_TTL", 2*time.Minute),
+			EmbeddingCacheSize:        getEnvInt("RAG_EMBEDDING_CACHE_SIZE", 1000),
+			EmbeddingCacheMB:          getEnvInt("RAG_EMBEDDING_CACHE_MB", 16),
+			EmbeddingCacheIdle:        getEnvDuration("RAG_EMBEDDING_CACHE_IDLE", time.Hour),
+			RetrievalMode:             getEnv("RAG_RETRIEVAL_MODE", "hybrid"),
+			MaxDistance:               getEnvFloat("RAG_MAX_DISTANCE", 0),
+			RecentMessages:            getEnvInt("RAG_RECENT_MESSAGES", 3),
+			RecentGuildWide:           getEnvBool("RAG_RECENT_GUILD_WIDE", false),
+			ResponseLanguage:          getEnv("RAG_RESPONSE_LANGUAGE", ""),
+			EmptyContextMode:          getEnv("RAG_EMPTY_CONTEXT_MODE", "answer"),
+			EmptyContextReply:         getEnv("RAG_EMPTY_CONTEXT_REPLY", "I don't have any history for this server yet, so I can't answer that from past conversations."),
+			IncludeInteractions:       getEnvBool("RAG_INCLUDE_INTERACTIONS", false),
+			InteractionLimit:          getEnvInt("RAG_INTERACTION_LIMIT", 2),
+			InteractionLogging:        getEnv("RAG_INTERACTION_LOGGING", "full"),
+			VectorStore:               getEnv("RAG_VECTOR_STORE", "pgvector"),
+			EmbeddingVersion:          getEnv("RAG_EMBEDDING_VERSION", "v1"),
+			LiveMessages:              getEnvInt("RAG_LIVE_MESSAGES", 0),
+			CategoryMode:              getEnv("RAG_CATEGORY_MODE", "off"),
+			CategoryBoost:             getEnvFloat("RAG_CATEGORY_BOOST", 0.2),
+			FactBoost:                 getEnvFloat("RAG_FACT_BOOST", 0.2),
+			FactDistance:              getEnvFloat("RAG_FACT_MAX_DISTANCE", 0),
+			MaxFacts:                  getEnvInt("RAG_MAX_FACTS", 2),
+			AuthorNames:               getEnv("RAG_AUTHOR_NAMES", "names"),
+			MaxMessagesPerGuild:       getEnvInt("RAG_MAX_MESSAGES_PER_GUILD", 0),
+			EvictionPolicy:            getEnv("RAG_EVICTION_POLICY", "oldest"),
+			EmbedMaxRetries:           getEnvInt("RAG_EMBED_MAX_RETRIES", 3),
+			EmbedRetryTimeout:         getEnvDuration("RAG_EMBED_RETRY_TIMEOUT", 5*time.Minute),
+			EmbedPreprocess:           getEnvBool("RAG_EMBED_PREPROCESS", false),
+			EmbedURLPlaceholder:       getEnv("RAG_EMBED_URL_PLACEHOLDER", ""),
+			EmbedSummarizeOver:        getEnvInt("RAG_EMBED_SUMMARIZE_OVER", 0),
+			RerankCandidates:          getEnvInt("RAG_RERANK_CANDIDATES", 20),
+			BackfillWorkers:           getEnvInt("RAG_BACKFILL_WORKERS", 4),
+			BackfillBatchSize:         getEnvInt("RAG_BACKFILL_BATCH_SIZE", 100),
+			BackfillRequestsPerMinute: getEnvInt("RAG_BACKFILL_REQUESTS_PER_MINUTE", 60),
+		},
+		Ingest: IngestConfig{
+			Messages:        getEnvBool("INGEST_MESSAGES", true),
+			Threads:         getEnvBool("INGEST_THREADS", false),
+			Pins:            getEnvBool("INGEST_PINS", false),
+			MinLength:       getEnvInt("INGEST_MIN_LENGTH", 10),
+			SkipCommands:    getEnvBool("INGEST_SKIP_COMMANDS", true),
+			CommandPrefixes: getEnvList("INGEST_COMMAND_PREFIXES", []string{"!", "/", "?", "$"}),
+			SkipURLOnly:     getEnvBool("INGEST_SKIP_URL_ONLY", true),
+			SkipEmojiOnly:   getEnvBool("INGEST_SKIP_EMOJI_ONLY", true),
+			SkipSpam:        getEnvBool("INGEST_SKIP_SPAM", true),
+			SkipBots:        getEnvBool("INGEST_SKIP_BOTS", true),
+			TrustedBots:     getEnvList("INGEST_TRUSTED_BOTS", nil),
+			ResolveMentions: getEnvBool("INGEST_RESOLVE_MENTIONS", true),
+		},
+		Voice: VoiceConfig{
+			Enabled:                getEnvBool("VOICE_ENABLED", true),
+			Mode:                   getEnv("VOICE_MODE", "always"),
+			ListenWindow:           getEnvDuration("VOICE_LISTEN_WINDOW", 15*time.Second),
+			QuietHours:             getEnv("VOICE_QUIET_HOURS", ""),
+			QuietTimezone:          getEnv("VOICE_QUIET_TIMEZONE", "UTC"),
+			HistoryTurns:           getEnvInt("VOICE_HISTORY_TURNS", 4),
+			HistoryTTL:             getEnvDuration("VOICE_HISTORY_TTL", 10*time.Minute),
+			MinDuration:            getEnvDuration("VOICE_MIN_DURATION", 500*time.Millisecond),
+			MaxDuration:            getEnvDuration("VOICE_MAX_DURATION", 2*time.Minute),
+			TempDir:                getEnv("VOICE_TEMP_DIR", ""),
+			StreamingTranscription: getEnvBool("VOICE_STREAMING_TRANSCRIPTION", false),
+			TranscriptionWindow:    getEnvDuration("VOICE_TRANSCRIPTION_WINDOW", 0),
+			TranscriptionPrompt:    getEnv("VOICE_TRANSCRIPTION_PROMPT", ""),
+			AutoPrompt:             getEnvBool("VOICE_AUTO_PROMPT", false),
+			MaxUserTranscriptions:  getEnvInt("VOICE_MAX_TRANSCRIPTIONS_PER_USER", 1),
+			ProcessingStatus:       getEnv("VOICE_PROCESSING_STATUS", "message"),
+			EchoCooldown:           getEnvDuration("VOICE_ECHO_COOLDOWN", 10*time.Second),
+			EchoSimilarity:         getEnvFloat("VOICE_ECHO_SIMILARITY", 0.8),
+			FrameSize:              getEnvInt("VOICE_FRAME_SIZE", 960),
+			Gain:                   getEnv("VOICE_GAIN", "auto"),
+			GainTarget:             getEnvFloat("VOICE_GAIN_TARGET", 0.9),
+			MaxGain:                getEnvFloat("VOICE_MAX_GAIN", 10),
+			FixedGain:              getEnvFloat("VOICE_FIXED_GAIN", 1),
+		},
+		Database: DatabaseConfig{
+			HealthInterval: getEnvDuration("DB_HEALTH_INTERVAL", 30*time.Second),
+			SearchQuery:    getEnv("DB_SEARCH_QUERY", "raw"),
+		},
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s (%q), using default %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s (%q), using default %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s (%q), using default %g", key, value, fallback)
+		return fallback
+	}
+	return f
+}
+
+// getEnvList reads a comma-separated list, dropping empty items
+func getEnvList(key string, fallback []string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvMap reads comma-separated key=value pairs, lowercasing keys
+func getEnvMap(key string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range getEnvList(key, nil) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			log.Printf("Ignoring malformed %s entry %q", key, item)
+			continue
+		}
+		pairs[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+	return pairs
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s (%q), using default %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,53 @@
+// internal/database/backfill.go
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// backfillSource selects a guild's messages embedded under from that have no
+// row under to yet
+func (db *DB) backfillSource(ctx context.Context, guildID, from, to string, afterID uint) *gorm.DB {
+	return db.WithContext(ctx).Model(&models.DiscordMessage{}).
+		Where("guild_id = ? AND embedding_version = ? AND id > ? AND content <> ''", guildID, from, afterID).
+		Where("NOT EXISTS (SELECT 1 FROM discord_messages newer WHERE newer.message_id = discord_messages.message_id AND newer.embedding_version = ?)", to)
+}
+
+// MessagesToBackfill returns up to limit messages still to be embedded under
+// to, in row ID order starting after afterID
+func (db *DB) MessagesToBackfill(ctx context.Context, guildID, from, to string, afterID uint, limit int) ([]models.DiscordMessage, error) {
+	var messages []models.DiscordMessage
+	err := db.withRetry(ctx, func() error {
+		return db.backfillSource(ctx, guildID, from, to, afterID).Order("id").Limit(limit).Find(&messages).Error
+	})
+	return messages, err
+}
+
+// CountMessagesToBackfill counts the messages MessagesToBackfill would return
+// without a limit
+func (db *DB) CountMessagesToBackfill(ctx context.Context, guildID, from, to string, afterID uint) (int64, error) {
+	var count int64
+	err := db.withRetry(ctx, func() error {
+		return db.backfillSource(ctx, guildID, from, to, afterID).Count(&count).Error
+	})
+	return count, err
+}
+
+// GetBackfillProgress returns the checkpoint for backfilling a guild to a
+// version. If none exists yet, an unsaved zero checkpoint is returned.
+func (db *DB) GetBackfillProgress(guildID, version string) (*models.BackfillProgress, error) {
+	progress := &models.BackfillProgress{}
+	err := db.Where(models.BackfillProgress{GuildID: guildID, Version: version}).FirstOrInit(progress).Error
+	if err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// SaveBackfillProgress inserts or updates a backfill checkpoint
+func (db *DB) SaveBackfillProgress(progress *models.BackfillProgress) error {
+	return db.Save(progress).Error
+}
@@ -2,16 +2,71 @@
 package database
 
 import (
+	"context"
 	"discord-rag-bot/internal/models"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/pgvector/pgvector-go"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// messageInsertBatchSize bounds rows per INSERT when bulk storing messages
+const messageInsertBatchSize = 100
+
 type DB struct {
 	*gorm.DB
+	healthy atomic.Bool
+	// searchQuery is SearchQueryRaw or SearchQueryGorm
+	searchQuery string
+}
+
+// TimeRange limits a search to messages sent within it. A zero Since or
+// Until leaves that side unbounded.
+type TimeRange struct {
+	Since time.Time
+	Until time.Time
+}
+
+// IsZero reports whether the range is unbounded on both sides
+func (tr TimeRange) IsZero() bool {
+	return tr.Since.IsZero() && tr.Until.IsZero()
+}
+
+// Contains reports whether t falls within the range
+func (tr TimeRange) Contains(t time.Time) bool {
+	if !tr.Since.IsZero() && t.Before(tr.Since) {
+		return false
+	}
+	if !tr.Until.IsZero() && t.After(tr.Until) {
+		return false
+	}
+	return true
+}
+
+// CategoryScope biases a search toward the asking channel's category
+type CategoryScope struct {
+	CategoryID string
+	// Only restricts results to the category. Otherwise messages in it
+	// rank as if their distance were Boost (0-1) times smaller.
+	Only  bool
+	Boost float64
+}
+
+// where appends the range's conditions on column to a WHERE clause
+func (tr TimeRange) where(column, conditions string, args []interface{}) (string, []interface{}) {
+	if !tr.Since.IsZero() {
+		conditions += " AND " + column + " >= ?"
+		args = append(args, tr.Since)
+	}
+	if !tr.Until.IsZero() {
+		conditions += " AND " + column + " <= ?"
+		args = append(args, tr.Until)
+	}
+	return conditions, args
 }
 
 func NewDB(host, user, password, dbname string, port int) (*DB, error) {
@@ -23,62 +78,306 @@ func NewDB(host, user, password, dbname string, port int) (*DB, error) {
 		return nil, err
 	}
 
-	// Enable pgvector extension
-	db.Exec("CREATE EXTENSION IF NOT EXISTS vector")
+	// Enable pgvector extension; without it the migration below fails with
+	// an unhelpful "type vector does not exist"
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error; err != nil {
+		return nil, pgvectorError(err)
+	}
+
+	// Message IDs used to be unique on their own; they are now unique per
+	// embedding version
+	if db.Migrator().HasIndex(&models.DiscordMessage{}, "idx_discord_messages_message_id") {
+		if err := db.Migrator().DropIndex(&models.DiscordMessage{}, "idx_discord_messages_message_id"); err != nil {
+			return nil, err
+		}
+	}
 
 	// Auto migrate
 	err = db.AutoMigrate(
 		&models.DiscordMessage{},
 		&models.BotInteraction{},
 		&models.ConversationContext{},
+		&models.GuildSettings{},
+		&models.ChannelSetting{},
+		&models.Feedback{},
+		&models.TokenUsage{},
+		&models.UserTokenUsage{},
+		&models.BackfillProgress{},
+		&models.FailedEmbedding{},
+		&models.EmbeddingSettings{},
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	d := &DB{DB: db, searchQuery: SearchQueryRaw}
+	d.healthy.Store(true)
+	return d, nil
 }
 
-// Fixed method signature and implementation
-func (db *DB) SearchSimilarMessages(embedding []float32, guildID string, limit int) ([]models.DiscordMessage, error) {
-	var messages []models.DiscordMessage
+// LabelEmbeddingVersion assigns version to messages and interactions
+// stored before embeddings were versioned. Their embeddings came from the
+// model in use then, which the configured version is taken to name.
+func (db *DB) LabelEmbeddingVersion(version string) error {
+	for _, model := range []interface{}{&models.DiscordMessage{}, &models.BotInteraction{}} {
+		err := db.Model(model).
+			Where("embedding_version IS NULL OR embedding_version = ''").
+			Update("embedding_version", version).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckEmbeddingSettings records the settings a version's embeddings are
+// made with the first time it is used, and fails if they differ from those
+// recorded before: normalized and raw vectors under one version would rank
+// inconsistently.
+func (db *DB) CheckEmbeddingSettings(version string, normalized bool) error {
+	recorded := &models.EmbeddingSettings{}
+	err := db.Where(models.EmbeddingSettings{Version: version}).
+		Attrs(models.EmbeddingSettings{Normalized: normalized}).
+		FirstOrCreate(recorded).Error
+	if err != nil {
+		return err
+	}
+	if recorded.Normalized != normalized {
+		return fmt.Errorf("embedding version %s was built with normalization %v, but it is now %v; bump the embedding version and backfill to change it", version, recorded.Normalized, normalized)
+	}
+	return nil
+}
+
+const (
+	// SearchQueryRaw runs similarity searches as hand-written SQL
+	SearchQueryRaw = "raw"
+	// SearchQueryGorm builds the same search with GORM's query builder
+	SearchQueryGorm = "gorm"
+)
+
+// SetSearchQuery selects how SearchSimilarMessages builds its query. Both
+// implementations run the same search and return the same results.
+func (db *DB) SetSearchQuery(mode string) error {
+	switch mode {
+	case SearchQueryRaw, SearchQueryGorm:
+		db.searchQuery = mode
+		return nil
+	}
+	return fmt.Errorf("unknown search query implementation %q (use %s or %s)", mode, SearchQueryRaw, SearchQueryGorm)
+}
+
+// similaritySearch is the filter and ordering of a message similarity
+// search. Both query implementations are built from it, so they can't
+// drift apart.
+type similaritySearch struct {
+	vector    pgvector.Vector
+	where     string
+	whereArgs []interface{}
+	order     string
+	orderArgs []interface{}
+	limit     int
+}
 
-	// Convert to pgvector format
+// newSimilaritySearch ranks by cosine distance (pgvector's <=>), the
+// metric every vector store reports
+func newSimilaritySearch(embedding []float32, guildID, version string, limit int, timeRange TimeRange, scope CategoryScope) similaritySearch {
 	vector := pgvector.NewVector(embedding)
 
-	// Use raw SQL for vector similarity search
+	// Rows whose embedding is still NULL (pending or failed) can't be
+	// ranked, so they are left out; the pointer Embedding field still
+	// scans NULL safely if one slips through.
+	where, args := timeRange.where("timestamp", "guild_id = ? AND embedding_version = ? AND embedding IS NOT NULL", []interface{}{guildID, version})
+	order := "embedding <=> ?"
+	orderArgs := []interface{}{vector}
+	switch {
+	case scope.CategoryID == "":
+	case scope.Only:
+		where += " AND category_id = ?"
+		args = append(args, scope.CategoryID)
+	case scope.Boost > 0:
+		order = "(embedding <=> ?) * CASE WHEN category_id = ? THEN ? ELSE 1 END"
+		orderArgs = append(orderArgs, scope.CategoryID, 1-scope.Boost)
+	}
+	// Break distance ties the same way every time
+	order += ", id"
+
+	return similaritySearch{
+		vector:    vector,
+		where:     where,
+		whereArgs: args,
+		order:     order,
+		orderArgs: orderArgs,
+		limit:     limit,
+	}
+}
+
+// SearchSimilarMessages returns the guild's messages closest to the
+// embedding, each with its distance, using the configured query
+// implementation
+func (db *DB) SearchSimilarMessages(ctx context.Context, embedding []float32, guildID, version string, limit int, timeRange TimeRange, scope CategoryScope) ([]models.DiscordMessage, error) {
+	if err := checkEmbeddingDimensions(embedding); err != nil {
+		return nil, err
+	}
+
+	return db.runSimilaritySearch(ctx, newSimilaritySearch(embedding, guildID, version, limit, timeRange, scope))
+}
+
+// runSimilaritySearch runs a search with the configured query implementation
+func (db *DB) runSimilaritySearch(ctx context.Context, search similaritySearch) ([]models.DiscordMessage, error) {
+	var messages []models.DiscordMessage
+	err := db.withRetry(ctx, func() error {
+		messages = nil
+		if db.searchQuery == SearchQueryGorm {
+			return db.searchSimilarGorm(ctx, search, &messages)
+		}
+		return db.searchSimilarRaw(ctx, search, &messages)
+	})
+	return messages, err
+}
+
+// searchSimilarRaw runs a similarity search as hand-written SQL
+func (db *DB) searchSimilarRaw(ctx context.Context, search similaritySearch, messages *[]models.DiscordMessage) error {
 	query := `
-        SELECT id, message_id, content, author, username, channel_id, channel_name, 
-               guild_id, guild_name, timestamp, embedding, created_at
-        FROM discord_messages 
-        WHERE guild_id = ? 
-        ORDER BY embedding <-> ? 
+        SELECT *, embedding <=> ? AS distance
+        FROM discord_messages
+        WHERE ` + search.where + `
+        ORDER BY ` + search.order + `
         LIMIT ?`
 
-	err := db.Raw(query, guildID, vector, limit).Scan(&messages).Error
-	return messages, err
+	args := append([]interface{}{search.vector}, search.whereArgs...)
+	args = append(args, search.orderArgs...)
+	args = append(args, search.limit)
+	return db.WithContext(ctx).Raw(query, args...).Scan(messages).Error
+}
+
+// searchSimilarGorm runs a similarity search through GORM's query builder
+func (db *DB) searchSimilarGorm(ctx context.Context, search similaritySearch, messages *[]models.DiscordMessage) error {
+	return db.WithContext(ctx).Model(&models.DiscordMessage{}).
+		Select("*, embedding <=> ? AS distance", search.vector).
+		Where(search.where, search.whereArgs...).
+		Clauses(clause.OrderBy{Expression: clause.Expr{SQL: search.order, Vars: search.orderArgs, WithoutParentheses: true}}).
+		Limit(search.limit).
+		Find(messages).Error
 }
 
-// Alternative method using GORM's native methods (if the above doesn't work)
-func (db *DB) SearchSimilarMessagesAlternative(embedding []float32, guildID string, limit int) ([]models.DiscordMessage, error) {
+// SearchSimilarInteractions finds past bot answers whose question and answer
+// are closest to the embedding. Interactions logged without an embedding are
+// skipped, as are ones embedded under another version.
+func (db *DB) SearchSimilarInteractions(ctx context.Context, embedding []float32, guildID, version string, limit int) ([]models.BotInteraction, error) {
+	if err := checkEmbeddingDimensions(embedding); err != nil {
+		return nil, err
+	}
+
+	var interactions []models.BotInteraction
+
+	err := db.withRetry(ctx, func() error {
+		return db.WithContext(ctx).
+			Where("guild_id = ? AND embedding_version = ? AND embedding IS NOT NULL", guildID, version).
+			Order(clause.Expr{SQL: "embedding <=> ?", Vars: []interface{}{pgvector.NewVector(embedding)}}).
+			Limit(limit).
+			Find(&interactions).Error
+	})
+	return interactions, err
+}
+
+// GetRecentMessages returns the newest messages in a guild stored under the
+// embedding version, oldest first. An empty channelID searches the whole guild.
+func (db *DB) GetRecentMessages(ctx context.Context, guildID, channelID, version string, limit int) ([]models.DiscordMessage, error) {
 	var messages []models.DiscordMessage
+	err := db.withRetry(ctx, func() error {
+		messages = nil
+		// Facts aren't activity, they only surface through similarity search
+		query := db.WithContext(ctx).Where("guild_id = ? AND embedding_version = ? AND NOT is_fact", guildID, version)
+		if channelID != "" {
+			query = query.Where("channel_id = ?", channelID)
+		}
+		return query.Order("timestamp DESC").Limit(limit).Find(&messages).Error
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	// Convert to pgvector format
-	vector := pgvector.NewVector(embedding)
+	// Present in chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
 
-	// Use DB.Raw for the vector operation
-	subQuery := db.Model(&models.DiscordMessage{}).
-		Where("guild_id = ?", guildID).
-		Select("*, embedding <-> ? as distance", vector).
-		Order("distance").
-		Limit(limit)
+// UpsertMessage stores a message, or on conflict with the same message and
+// embedding version updates the stored copy's content, summary and embedding
+func (db *DB) UpsertMessage(ctx context.Context, message *models.DiscordMessage) error {
+	return db.withRetry(ctx, func() error {
+		return db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "message_id"}, {Name: "embedding_version"}},
+			DoUpdates: clause.AssignmentColumns([]string{"content", "summary", "embedding"}),
+		}).Create(message).Error
+	})
+}
 
-	err := subQuery.Find(&messages).Error
-	return messages, err
+// DeleteMessages removes messages by Discord message ID, under every
+// embedding version
+func (db *DB) DeleteMessages(ctx context.Context, messageIDs ...string) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	return db.withRetry(ctx, func() error {
+		return db.WithContext(ctx).Where("message_id IN ?", messageIDs).Delete(&models.DiscordMessage{}).Error
+	})
+}
+
+// CountMessagesByVersion returns how many of a guild's messages have an
+// embedding under each embedding version
+func (db *DB) CountMessagesByVersion(guildID string) (map[string]int64, error) {
+	var rows []struct {
+		EmbeddingVersion string
+		Count            int64
+	}
+	err := db.Model(&models.DiscordMessage{}).
+		Select("embedding_version, COUNT(*) AS count").
+		Where("guild_id = ? AND embedding IS NOT NULL", guildID).
+		Group("embedding_version").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.EmbeddingVersion] = row.Count
+	}
+	return counts, nil
 }
 
 // Method to store message with embedding
 func (db *DB) CreateMessageWithEmbedding(message *models.DiscordMessage, embedding []float32) error {
-	message.Embedding = pgvector.NewVector(embedding)
-	return db.Create(message).Error
+	message.SetEmbedding(embedding)
+	return db.withRetry(context.Background(), func() error {
+		return db.Create(message).Error
+	})
+}
+
+// CreateMessagesWithEmbeddings bulk stores messages with their embeddings in a
+// single transaction. Messages whose MessageID already exists under their
+// embedding version are skipped.
+func (db *DB) CreateMessagesWithEmbeddings(messages []*models.DiscordMessage, embeddings [][]float32) error {
+	if len(messages) != len(embeddings) {
+		return fmt.Errorf("message/embedding count mismatch: %d messages, %d embeddings", len(messages), len(embeddings))
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	for i, message := range messages {
+		message.SetEmbedding(embeddings[i])
+	}
+
+	return db.withRetry(context.Background(), func() error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "message_id"}, {Name: "embedding_version"}},
+				DoNothing: true,
+			}).CreateInBatches(messages, messageInsertBatchSize).Error
+		})
+	})
 }
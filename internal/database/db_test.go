@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to the Postgres database named by the TEST_DB_*
+// variables, skipping the test if TEST_DB_HOST isn't set. The database
+// needs the pgvector extension and is migrated like the bot's.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	host := os.Getenv("TEST_DB_HOST")
+	if host == "" {
+		t.Skip("TEST_DB_HOST not set")
+	}
+	port, err := strconv.Atoi(os.Getenv("TEST_DB_PORT"))
+	if err != nil {
+		port = 5432
+	}
+
+	db, err := NewDB(host, os.Getenv("TEST_DB_USER"), os.Getenv("TEST_DB_PASSWORD"), os.Getenv("TEST_DB_NAME"), port)
+	if err != nil {
+		t.Fatalf("connecting to test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// testGuild returns a guild ID no other test run uses, whose data is
+// purged when the test ends
+func testGuild(t *testing.T, db *DB) string {
+	t.Helper()
+
+	guildID := fmt.Sprintf("test-%s-%d", t.Name(), time.Now().UnixNano())
+	t.Cleanup(func() {
+		if err := db.PurgeGuild(guildID); err != nil {
+			t.Errorf("purging %s: %v", guildID, err)
+		}
+	})
+	return guildID
+}
+
+func TestCreateMessagesWithEmbeddingsCountMismatch(t *testing.T) {
+	db := &DB{}
+	err := db.CreateMessagesWithEmbeddings([]*models.DiscordMessage{{MessageID: "m1"}}, nil)
+	if err == nil {
+		t.Error("CreateMessagesWithEmbeddings accepted a message without an embedding")
+	}
+	if err := db.CreateMessagesWithEmbeddings(nil, nil); err != nil {
+		t.Errorf("CreateMessagesWithEmbeddings with no messages: %v", err)
+	}
+}
+
+func TestCreateMessagesWithEmbeddingsSkipsExisting(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	createTestMessages(t, db, guildID, "v1", "m1", "m2")
+
+	// m1 and m2 are already stored; the batch must still store m3, and
+	// m1 under the new version, without touching the stored rows
+	messages := []*models.DiscordMessage{
+		{MessageID: guildID + "-m1", GuildID: guildID, ChannelID: "c1", Content: "edited", Timestamp: time.Now(), EmbeddingVersion: "v1"},
+		{MessageID: guildID + "-m2", GuildID: guildID, ChannelID: "c1", Content: "edited", Timestamp: time.Now(), EmbeddingVersion: "v1"},
+		{MessageID: guildID + "-m3", GuildID: guildID, ChannelID: "c1", Content: "new", Timestamp: time.Now(), EmbeddingVersion: "v1"},
+		{MessageID: guildID + "-m1", GuildID: guildID, ChannelID: "c1", Content: "re-embedded", Timestamp: time.Now(), EmbeddingVersion: "v2"},
+	}
+	embeddings := make([][]float32, len(messages))
+	for i := range embeddings {
+		embeddings[i] = make([]float32, EmbeddingDimensions)
+		embeddings[i][i] = 1
+	}
+	if err := db.CreateMessagesWithEmbeddings(messages, embeddings); err != nil {
+		t.Fatalf("CreateMessagesWithEmbeddings: %v", err)
+	}
+
+	if got := messageSuffixes(t, db, guildID, "v1"); !slices.Equal(got, []string{"m1", "m2", "m3"}) {
+		t.Errorf("stored %v under v1, want m1, m2 and m3", got)
+	}
+	if got := messageSuffixes(t, db, guildID, "v2"); !slices.Equal(got, []string{"m1"}) {
+		t.Errorf("stored %v under v2, want m1", got)
+	}
+
+	var content []string
+	if err := db.Model(&models.DiscordMessage{}).
+		Where("guild_id = ? AND embedding_version = ? AND message_id IN ?", guildID, "v1", []string{guildID + "-m1", guildID + "-m2"}).
+		Order("message_id").
+		Pluck("content", &content).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(content, []string{"message m1", "message m2"}) {
+		t.Errorf("existing rows have content %q, want them unchanged", content)
+	}
+}
+
+func TestGetRecentMessagesChannel(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	createTestMessages(t, db, guildID, "v1", "m1", "m2", "m3", "fact1")
+	if err := db.Model(&models.DiscordMessage{}).
+		Where("message_id = ?", guildID+"-m2").
+		Update("channel_id", "c2").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		channelID string
+		want      []string
+	}{
+		{"c1", []string{"m1", "m3"}},
+		{"c2", []string{"m2"}},
+		{"", []string{"m1", "m2", "m3"}},
+	}
+	for _, tt := range tests {
+		recent, err := db.GetRecentMessages(context.Background(), guildID, tt.channelID, "v1", 10)
+		if err != nil {
+			t.Fatalf("GetRecentMessages(%q): %v", tt.channelID, err)
+		}
+		var got []string
+		for _, msg := range recent {
+			got = append(got, strings.TrimPrefix(msg.MessageID, guildID+"-"))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GetRecentMessages(%q) = %v, want %v", tt.channelID, got, tt.want)
+		}
+	}
+}
+
+func TestSearchSimilarInteractions(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+
+	embedded := func(query, version string, axis int) *models.BotInteraction {
+		interaction := &models.BotInteraction{UserID: "u1", Username: "ann", Query: query, ChannelID: "c1", GuildID: guildID, Timestamp: time.Now(), EmbeddingVersion: version}
+		embedding := make([]float32, EmbeddingDimensions)
+		embedding[axis] = 1
+		interaction.SetEmbedding(embedding)
+		return interaction
+	}
+	for _, interaction := range []*models.BotInteraction{
+		embedded("close", "v1", 0),
+		embedded("far", "v1", 1),
+		embedded("other version", "v2", 0),
+		// Logged without an embedding, e.g. when redacted
+		{UserID: "u1", Username: "ann", Query: "redacted", ChannelID: "c1", GuildID: guildID, Timestamp: time.Now(), EmbeddingVersion: "v1"},
+	} {
+		if err := db.Create(interaction).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := make([]float32, EmbeddingDimensions)
+	query[0] = 1
+	found, err := db.SearchSimilarInteractions(context.Background(), query, guildID, "v1", 5)
+	if err != nil {
+		t.Fatalf("SearchSimilarInteractions: %v", err)
+	}
+	var queries []string
+	for _, interaction := range found {
+		queries = append(queries, interaction.Query)
+	}
+	if !slices.Equal(queries, []string{"close", "far"}) {
+		t.Errorf("found %v, want the embedded v1 interactions, closest first", queries)
+	}
+}
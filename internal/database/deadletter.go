@@ -0,0 +1,18 @@
+// internal/database/deadletter.go
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// RecordFailedEmbedding dead-letters a message that couldn't be embedded.
+// A message failing again replaces its earlier entry.
+func (db *DB) RecordFailedEmbedding(ctx context.Context, failed *models.FailedEmbedding) error {
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content", "attempts", "last_error", "updated_at"}),
+	}).Create(failed).Error
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"testing"
+)
+
+func TestRecordFailedEmbeddingReplacesEntry(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	messageID := guildID + "-m1"
+
+	for attempts, lastError := range []string{"first error", "second error"} {
+		err := db.RecordFailedEmbedding(context.Background(), &models.FailedEmbedding{
+			MessageID: messageID,
+			GuildID:   guildID,
+			Content:   "hello",
+			Attempts:  attempts + 1,
+			LastError: lastError,
+		})
+		if err != nil {
+			t.Fatalf("RecordFailedEmbedding: %v", err)
+		}
+	}
+
+	var entries []models.FailedEmbedding
+	if err := db.Where("message_id = ?", messageID).Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Attempts != 2 || entries[0].LastError != "second error" {
+		t.Errorf("entries = %+v, want one with the latest failure", entries)
+	}
+}
@@ -0,0 +1,40 @@
+// internal/database/errors.go
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EmbeddingDimensions is the size of the embedding vector columns
+const EmbeddingDimensions = 1536
+
+// ErrPGVectorMissing means the vector extension couldn't be enabled, so the
+// embedding columns can't be created
+var ErrPGVectorMissing = errors.New("pgvector not installed")
+
+// pgvectorError explains how to fix a failed CREATE EXTENSION
+func pgvectorError(err error) error {
+	return fmt.Errorf("%w: %v (install pgvector on the Postgres server, e.g. use the pgvector/pgvector image, "+
+		"or have a superuser run CREATE EXTENSION vector in this database)", ErrPGVectorMissing, err)
+}
+
+// EmbeddingDimensionError reports an embedding whose length doesn't match
+// the vector columns, typically after switching embedding models
+type EmbeddingDimensionError struct {
+	Got  int
+	Want int
+}
+
+func (e *EmbeddingDimensionError) Error() string {
+	return fmt.Sprintf("embedding has %d dimensions, but the database stores %d", e.Got, e.Want)
+}
+
+// checkEmbeddingDimensions validates an embedding before it reaches Postgres,
+// which would otherwise fail with an opaque operator error
+func checkEmbeddingDimensions(embedding []float32) error {
+	if len(embedding) != EmbeddingDimensions {
+		return &EmbeddingDimensionError{Got: len(embedding), Want: EmbeddingDimensions}
+	}
+	return nil
+}
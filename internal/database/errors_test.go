@@ -0,0 +1,38 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestPGVectorError(t *testing.T) {
+	cause := &pgconn.PgError{Code: "0A000", Message: `extension "vector" is not available`}
+	err := pgvectorError(cause)
+
+	if !errors.Is(err, ErrPGVectorMissing) {
+		t.Errorf("pgvectorError = %v, want it to match ErrPGVectorMissing", err)
+	}
+	for _, want := range []string{cause.Message, "pgvector/pgvector", "CREATE EXTENSION vector"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("pgvectorError = %q, want it to mention %q", err, want)
+		}
+	}
+}
+
+func TestEmbeddingDimensionError(t *testing.T) {
+	if err := checkEmbeddingDimensions(make([]float32, EmbeddingDimensions)); err != nil {
+		t.Errorf("checkEmbeddingDimensions with %d dimensions = %v", EmbeddingDimensions, err)
+	}
+
+	err := checkEmbeddingDimensions(make([]float32, 3072))
+	var dimErr *EmbeddingDimensionError
+	if !errors.As(err, &dimErr) || dimErr.Got != 3072 || dimErr.Want != EmbeddingDimensions {
+		t.Fatalf("checkEmbeddingDimensions with 3072 dimensions = %v, want an EmbeddingDimensionError", err)
+	}
+	if want := "embedding has 3072 dimensions, but the database stores 1536"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
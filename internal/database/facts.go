@@ -0,0 +1,47 @@
+// internal/database/facts.go
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+)
+
+// ListFacts returns the facts added to a guild that are stored under the
+// embedding version, oldest first
+func (db *DB) ListFacts(ctx context.Context, guildID, version string) ([]models.DiscordMessage, error) {
+	var facts []models.DiscordMessage
+	err := db.withRetry(ctx, func() error {
+		facts = nil
+		return db.WithContext(ctx).
+			Where("guild_id = ? AND embedding_version = ? AND is_fact", guildID, version).
+			Order("timestamp").
+			Find(&facts).Error
+	})
+	return facts, err
+}
+
+// SearchSimilarFacts returns the guild's facts closest to the embedding,
+// each with its distance. Facts are timeless, so no time range applies.
+func (db *DB) SearchSimilarFacts(ctx context.Context, embedding []float32, guildID, version string, limit int) ([]models.DiscordMessage, error) {
+	if err := checkEmbeddingDimensions(embedding); err != nil {
+		return nil, err
+	}
+
+	search := newSimilaritySearch(embedding, guildID, version, limit, TimeRange{}, CategoryScope{})
+	search.where += " AND is_fact"
+	return db.runSimilaritySearch(ctx, search)
+}
+
+// DeleteFact removes a guild's fact under every embedding version,
+// reporting whether there was one. Real messages are never deleted here.
+func (db *DB) DeleteFact(ctx context.Context, guildID, messageID string) (bool, error) {
+	var deleted int64
+	err := db.withRetry(ctx, func() error {
+		result := db.WithContext(ctx).
+			Where("guild_id = ? AND message_id = ? AND is_fact", guildID, messageID).
+			Delete(&models.DiscordMessage{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted > 0, err
+}
@@ -0,0 +1,44 @@
+// internal/database/feedback.go
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// GetLatestInteraction returns a user's most recent interaction in a channel,
+// or nil if there is none
+func (db *DB) GetLatestInteraction(userID, channelID string) (*models.BotInteraction, error) {
+	var interaction *models.BotInteraction
+	err := db.withRetry(context.Background(), func() error {
+		interaction = &models.BotInteraction{}
+		return db.Where("user_id = ? AND channel_id = ?", userID, channelID).
+			Order("timestamp DESC").
+			First(interaction).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return interaction, nil
+}
+
+// CreateFeedback stores feedback, linking it to the user's latest interaction
+// in the same channel when there is one
+func (db *DB) CreateFeedback(feedback *models.Feedback) error {
+	interaction, err := db.GetLatestInteraction(feedback.UserID, feedback.ChannelID)
+	if err != nil {
+		return err
+	}
+	if interaction != nil {
+		feedback.InteractionID = &interaction.ID
+	}
+	return db.withRetry(context.Background(), func() error {
+		return db.Create(feedback).Error
+	})
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"discord-rag-bot/internal/models"
+	"testing"
+	"time"
+)
+
+func TestCreateFeedbackLinksLatestInteraction(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+
+	var latest *models.BotInteraction
+	for i, channelID := range []string{"c1", "c1", "c2"} {
+		interaction := &models.BotInteraction{
+			UserID:    "u1",
+			Username:  "ann",
+			Query:     "question",
+			ChannelID: channelID,
+			GuildID:   guildID,
+			Timestamp: time.Now().Add(time.Duration(i) * time.Minute),
+		}
+		if err := db.Create(interaction).Error; err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			latest = interaction
+		}
+	}
+
+	feedback := &models.Feedback{UserID: "u1", Username: "ann", ChannelID: "c1", GuildID: guildID, Text: "good answer"}
+	if err := db.CreateFeedback(feedback); err != nil {
+		t.Fatalf("CreateFeedback: %v", err)
+	}
+	if feedback.InteractionID == nil || *feedback.InteractionID != latest.ID {
+		t.Errorf("feedback linked to interaction %v, want the latest one in the channel (%d)", feedback.InteractionID, latest.ID)
+	}
+
+	// Feedback without an interaction to refer to is still kept
+	unlinked := &models.Feedback{UserID: "u2", Username: "bob", ChannelID: "c1", GuildID: guildID, Text: "hello"}
+	if err := db.CreateFeedback(unlinked); err != nil {
+		t.Fatalf("CreateFeedback without an interaction: %v", err)
+	}
+	if unlinked.ID == 0 || unlinked.InteractionID != nil {
+		t.Errorf("unlinked feedback stored as %+v, want it saved without an interaction", unlinked)
+	}
+}
+
+func TestGetLatestInteraction(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	// Interactions are looked up by channel alone, so use channels no other
+	// run has
+	channel, other := guildID+"-c1", guildID+"-c2"
+
+	if latest, err := db.GetLatestInteraction("u1", channel); err != nil || latest != nil {
+		t.Fatalf("GetLatestInteraction with no interactions = %+v, %v, want nil", latest, err)
+	}
+
+	start := time.Now()
+	for i, interaction := range []models.BotInteraction{
+		{UserID: "u1", Query: "first", ChannelID: channel},
+		{UserID: "u1", Query: "second", ChannelID: channel},
+		{UserID: "u2", Query: "someone else's", ChannelID: channel},
+		{UserID: "u1", Query: "elsewhere", ChannelID: other},
+	} {
+		interaction.Username = interaction.UserID
+		interaction.GuildID = guildID
+		interaction.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		if err := db.Create(&interaction).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := db.GetLatestInteraction("u1", channel)
+	if err != nil || latest == nil || latest.Query != "second" {
+		t.Errorf("GetLatestInteraction = %+v, %v, want u1's second question in the channel", latest, err)
+	}
+}
@@ -0,0 +1,143 @@
+// internal/database/health.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// retryAttempts bounds how often a call that failed to reach the
+	// database is retried
+	retryAttempts = 3
+	// maxReconnectDelay caps the backoff between pings while the database
+	// is down
+	maxReconnectDelay = 30 * time.Second
+	// pingTimeout bounds a single health check
+	pingTimeout = 5 * time.Second
+)
+
+// retryBaseDelay is the first backoff delay, doubled per attempt. Tests
+// shorten it.
+var retryBaseDelay = 250 * time.Millisecond
+
+// Healthy reports whether the last health check or database call reached
+// the database
+func (db *DB) Healthy() bool {
+	return db.healthy.Load()
+}
+
+// Ping checks the connection, recording the result as the current health
+func (db *DB) Ping(ctx context.Context) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	return db.ping(ctx, sqlDB)
+}
+
+func (db *DB) ping(ctx context.Context, sqlDB *sql.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	err := sqlDB.PingContext(ctx)
+	db.healthy.Store(err == nil)
+	return err
+}
+
+// MonitorHealth pings the database every interval until ctx is cancelled.
+// When a ping fails it keeps pinging with backoff; the connection pool
+// dials fresh connections, so the first successful ping means the database
+// is reachable again.
+func (db *DB) MonitorHealth(ctx context.Context, interval time.Duration) {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		log.Printf("Database health monitor disabled: %v", err)
+		return
+	}
+
+	delay := interval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		wasHealthy := db.Healthy()
+		if err := db.ping(ctx, sqlDB); err != nil {
+			if wasHealthy {
+				log.Printf("Database connection lost: %v", err)
+			}
+			delay = reconnectDelay(delay, interval)
+			continue
+		}
+
+		if !wasHealthy {
+			log.Println("Database connection restored")
+		}
+		delay = interval
+	}
+}
+
+// reconnectDelay is the next backoff while the database is down: it starts
+// at retryBaseDelay and doubles up to maxReconnectDelay, or the normal
+// interval if that is shorter
+func reconnectDelay(current, interval time.Duration) time.Duration {
+	limit := maxReconnectDelay
+	if interval < limit {
+		limit = interval
+	}
+	if current >= limit {
+		return retryBaseDelay
+	}
+
+	next := current * 2
+	if next > limit {
+		next = limit
+	}
+	return next
+}
+
+// withRetry runs op, retrying with backoff when it fails to reach the
+// database. Errors from queries that ran are returned as is, since retrying
+// those could apply a write twice.
+func (db *DB) withRetry(ctx context.Context, op func() error) error {
+	delay := retryBaseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = op()
+		if err == nil || !isConnectionError(err) {
+			db.healthy.Store(true)
+			return err
+		}
+
+		db.healthy.Store(false)
+		if attempt == retryAttempts {
+			return err
+		}
+
+		log.Printf("Database unreachable (attempt %d/%d), retrying in %s: %v", attempt, retryAttempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isConnectionError reports whether err means the statement never reached
+// the database, so it is safe to retry
+func isConnectionError(err error) bool {
+	var connectErr *pgconn.ConnectError
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.As(err, &connectErr) ||
+		pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// shortRetries shortens the retry backoff for the test
+func shortRetries(t *testing.T) {
+	delay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = delay })
+}
+
+// flakyConnector is a database that refuses connections until up is set
+type flakyConnector struct {
+	up       atomic.Bool
+	attempts atomic.Int32
+}
+
+var errRefused = errors.New("connection refused")
+
+func (c *flakyConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.attempts.Add(1)
+	if !c.up.Load() {
+		return nil, errRefused
+	}
+	return flakyConn{}, nil
+}
+
+func (c *flakyConnector) Driver() driver.Driver { return nil }
+
+// flakyConn is a connection that can only be pinged
+type flakyConn struct{}
+
+func (flakyConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (flakyConn) Close() error                              { return nil }
+func (flakyConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+func (flakyConn) Ping(ctx context.Context) error            { return nil }
+
+// newFlakyDB returns a DB over a flakyConnector, starting out healthy
+func newFlakyDB(t *testing.T) (*DB, *flakyConnector) {
+	t.Helper()
+	connector := &flakyConnector{}
+	sqlDB := sql.OpenDB(connector)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db := &DB{DB: &gorm.DB{Config: &gorm.Config{ConnPool: sqlDB}}}
+	db.healthy.Store(true)
+	return db, connector
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad connection", driver.ErrBadConn, true},
+		{"wrapped bad connection", fmt.Errorf("query: %w", driver.ErrBadConn), true},
+		{"connect error", &pgconn.ConnectError{}, true},
+		{"query error", &pgconn.PgError{Code: "23505"}, false},
+		{"record not found", gorm.ErrRecordNotFound, false},
+		{"other error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := isConnectionError(tt.err); got != tt.want {
+			t.Errorf("%s: isConnectionError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetryRecovers(t *testing.T) {
+	shortRetries(t)
+	db := &DB{}
+
+	calls := 0
+	err := db.withRetry(context.Background(), func() error {
+		calls++
+		if calls < retryAttempts {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if err != nil || calls != retryAttempts {
+		t.Errorf("withRetry = %v after %d calls, want success on attempt %d", err, calls, retryAttempts)
+	}
+	if !db.Healthy() {
+		t.Error("database unhealthy after a call got through")
+	}
+}
+
+func TestWithRetryGivesUp(t *testing.T) {
+	shortRetries(t)
+	db := &DB{}
+
+	calls := 0
+	err := db.withRetry(context.Background(), func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+	if !errors.Is(err, driver.ErrBadConn) || calls != retryAttempts {
+		t.Errorf("withRetry = %v after %d calls, want the connection error after %d", err, calls, retryAttempts)
+	}
+	if db.Healthy() {
+		t.Error("database healthy after every attempt failed to connect")
+	}
+}
+
+// Errors from statements that reached the database aren't retried, since
+// a write could apply twice
+func TestWithRetryQueryError(t *testing.T) {
+	shortRetries(t)
+	db := &DB{}
+	queryErr := &pgconn.PgError{Code: "23505"}
+
+	calls := 0
+	err := db.withRetry(context.Background(), func() error {
+		calls++
+		return queryErr
+	})
+	if !errors.Is(err, queryErr) || calls != 1 {
+		t.Errorf("withRetry = %v after %d calls, want the query error after 1", err, calls)
+	}
+	if !db.Healthy() {
+		t.Error("database unhealthy after a query reached it")
+	}
+}
+
+func TestWithRetryCancelled(t *testing.T) {
+	db := &DB{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := db.withRetry(ctx, func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("withRetry = %v after %d calls, want to stop waiting once cancelled", err, calls)
+	}
+}
+
+// waitHealthy waits for the database health to become want
+func waitHealthy(t *testing.T, db *DB, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for db.Healthy() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("database health never became %v", want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMonitorHealthRecovers(t *testing.T) {
+	shortRetries(t)
+	db, connector := newFlakyDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		db.MonitorHealth(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+
+	waitHealthy(t, db, false)
+	failed := connector.attempts.Load()
+	connector.up.Store(true)
+	waitHealthy(t, db, true)
+	if connector.attempts.Load() <= failed {
+		t.Error("health restored without reconnecting")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("MonitorHealth didn't stop when cancelled")
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	shortRetries(t)
+	tests := []struct {
+		current, interval, want time.Duration
+	}{
+		{time.Millisecond, time.Minute, 2 * time.Millisecond},
+		{20 * time.Second, time.Minute, maxReconnectDelay},
+		{maxReconnectDelay, time.Minute, retryBaseDelay},
+		{4 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := reconnectDelay(tt.current, tt.interval); got != tt.want {
+			t.Errorf("reconnectDelay(%s, %s) = %s, want %s", tt.current, tt.interval, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// internal/database/history.go
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// GetUserInteractions returns one page of a user's interactions in a guild,
+// newest first, along with how many there are in total
+func (db *DB) GetUserInteractions(guildID, userID string, offset, limit int) ([]models.BotInteraction, int64, error) {
+	var total int64
+	var interactions []models.BotInteraction
+	err := db.withRetry(context.Background(), func() error {
+		interactions = nil
+		query := db.Model(&models.BotInteraction{}).
+			Where("guild_id = ? AND user_id = ?", guildID, userID).
+			Session(&gorm.Session{})
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
+		return query.Order("timestamp DESC").Offset(offset).Limit(limit).Find(&interactions).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return interactions, total, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"discord-rag-bot/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetUserInteractionsPages(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	start := time.Now()
+
+	for i, userID := range []string{"u1", "u1", "u1", "u2", "u1", "u1"} {
+		interaction := &models.BotInteraction{
+			UserID:    userID,
+			Username:  userID,
+			Query:     string(rune('a' + i)),
+			ChannelID: "c1",
+			GuildID:   guildID,
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		}
+		if err := db.Create(interaction).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pages []string
+	for offset := 0; offset < 6; offset += 2 {
+		interactions, total, err := db.GetUserInteractions(guildID, "u1", offset, 2)
+		if err != nil {
+			t.Fatalf("GetUserInteractions at %d: %v", offset, err)
+		}
+		if total != 5 {
+			t.Errorf("total at offset %d = %d, want 5", offset, total)
+		}
+		page := ""
+		for _, interaction := range interactions {
+			page += interaction.Query
+		}
+		pages = append(pages, page)
+	}
+	if want := []string{"fe", "cb", "a"}; !slices.Equal(pages, want) {
+		t.Errorf("pages = %q, want %q, newest first without other users' questions", pages, want)
+	}
+}
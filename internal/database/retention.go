@@ -0,0 +1,56 @@
+// internal/database/retention.go
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"time"
+)
+
+const (
+	// EvictOldest removes the messages sent longest ago
+	EvictOldest = "oldest"
+	// EvictLeastRetrieved removes the messages that have gone longest
+	// without being returned by a search, counting never-retrieved ones
+	// from when they were sent
+	EvictLeastRetrieved = "lru"
+)
+
+// MarkRetrieved records that messages were just returned by a search
+func (db *DB) MarkRetrieved(ctx context.Context, messageIDs []string, at time.Time) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	return db.withRetry(ctx, func() error {
+		return db.WithContext(ctx).Model(&models.DiscordMessage{}).
+			Where("message_id IN ?", messageIDs).
+			Update("last_retrieved_at", at).Error
+	})
+}
+
+// EvictGuildMessages trims a guild to its newest (or most recently
+// retrieved, under EvictLeastRetrieved) limit messages, returning how many
+// rows were deleted. A message's rows under every embedding version go
+// together. Facts added by admins are never evicted.
+func (db *DB) EvictGuildMessages(ctx context.Context, guildID string, limit int, policy string) (int64, error) {
+	rank := "MAX(timestamp)"
+	if policy == EvictLeastRetrieved {
+		rank = "MAX(COALESCE(last_retrieved_at, timestamp))"
+	}
+
+	var deleted int64
+	err := db.withRetry(ctx, func() error {
+		result := db.WithContext(ctx).Exec(`
+            DELETE FROM discord_messages
+            WHERE guild_id = ? AND message_id IN (
+                SELECT message_id FROM discord_messages
+                WHERE guild_id = ? AND NOT is_fact
+                GROUP BY message_id
+                ORDER BY `+rank+` DESC
+                OFFSET ?
+            )`, guildID, guildID, limit)
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createTestMessages stores embedded messages named by suffix, sent a
+// minute apart in the order given
+func createTestMessages(t *testing.T, db *DB, guildID, version string, suffixes ...string) {
+	t.Helper()
+
+	messages := make([]*models.DiscordMessage, len(suffixes))
+	embeddings := make([][]float32, len(suffixes))
+	for i, suffix := range suffixes {
+		messages[i] = &models.DiscordMessage{
+			MessageID:        guildID + "-" + suffix,
+			GuildID:          guildID,
+			ChannelID:        "c1",
+			Content:          "message " + suffix,
+			Timestamp:        time.Now().Add(time.Duration(i-len(suffixes)) * time.Minute),
+			EmbeddingVersion: version,
+			IsFact:           strings.HasPrefix(suffix, "fact"),
+		}
+		embeddings[i] = make([]float32, EmbeddingDimensions)
+		embeddings[i][i%EmbeddingDimensions] = 1
+	}
+	if err := db.CreateMessagesWithEmbeddings(messages, embeddings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// messageSuffixes lists the suffixes of the guild's stored messages under
+// version, sorted
+func messageSuffixes(t *testing.T, db *DB, guildID, version string) []string {
+	t.Helper()
+
+	var ids []string
+	if err := db.Model(&models.DiscordMessage{}).
+		Where("guild_id = ? AND embedding_version = ?", guildID, version).
+		Pluck("message_id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range ids {
+		ids[i] = strings.TrimPrefix(id, guildID+"-")
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestEvictGuildMessagesOldest(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	createTestMessages(t, db, guildID, "v1", "fact", "m1", "m2", "m3", "m4")
+	createTestMessages(t, db, guildID, "v2", "m1", "m2", "m3", "m4")
+
+	evicted, err := db.EvictGuildMessages(context.Background(), guildID, 2, EvictOldest)
+	if err != nil {
+		t.Fatalf("EvictGuildMessages: %v", err)
+	}
+	if evicted != 4 {
+		t.Errorf("evicted %d rows, want both versions of two messages", evicted)
+	}
+	if got := fmt.Sprint(messageSuffixes(t, db, guildID, "v1")); got != "[fact m3 m4]" {
+		t.Errorf("kept %s under v1, want the fact and the newest two", got)
+	}
+	if got := fmt.Sprint(messageSuffixes(t, db, guildID, "v2")); got != "[m3 m4]" {
+		t.Errorf("kept %s under v2, want the newest two", got)
+	}
+}
+
+func TestEvictGuildMessagesLeastRetrieved(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	createTestMessages(t, db, guildID, "v1", "m1", "m2", "m3")
+
+	if err := db.MarkRetrieved(context.Background(), []string{guildID + "-m1"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.EvictGuildMessages(context.Background(), guildID, 2, EvictLeastRetrieved); err != nil {
+		t.Fatalf("EvictGuildMessages: %v", err)
+	}
+	if got := fmt.Sprint(messageSuffixes(t, db, guildID, "v1")); got != "[m1 m3]" {
+		t.Errorf("kept %s, want the retrieved message and the newest", got)
+	}
+}
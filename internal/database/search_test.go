@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetSearchQuery(t *testing.T) {
+	db := &DB{searchQuery: SearchQueryRaw}
+	if err := db.SetSearchQuery(SearchQueryGorm); err != nil || db.searchQuery != SearchQueryGorm {
+		t.Errorf("SetSearchQuery(%q) = %v, mode %q", SearchQueryGorm, err, db.searchQuery)
+	}
+	if err := db.SetSearchQuery("orm"); err == nil {
+		t.Error("SetSearchQuery accepted an unknown implementation")
+	}
+	if db.searchQuery != SearchQueryGorm {
+		t.Errorf("unknown implementation changed the mode to %q", db.searchQuery)
+	}
+}
+
+func TestSearchQueryImplementationsAgree(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	createTestMessages(t, db, guildID, "v1", "a", "b", "c", "d", "e", "fact1", "g", "h")
+	if err := db.Model(&models.DiscordMessage{}).
+		Where("message_id IN ?", []string{guildID + "-b", guildID + "-e", guildID + "-h"}).
+		Update("category_id", "cat1").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Closest to the later messages, with distinct distances
+	embedding := make([]float32, EmbeddingDimensions)
+	for i := range 8 {
+		embedding[i] = float32(i + 1)
+	}
+
+	searches := map[string]struct {
+		timeRange TimeRange
+		scope     CategoryScope
+	}{
+		"whole guild":    {},
+		"time range":     {timeRange: TimeRange{Since: time.Now().Add(-6 * time.Minute), Until: time.Now().Add(-2 * time.Minute)}},
+		"category only":  {scope: CategoryScope{CategoryID: "cat1", Only: true}},
+		"category boost": {scope: CategoryScope{CategoryID: "cat1", Boost: 0.5}},
+	}
+	for name, search := range searches {
+		results := make(map[string][]models.DiscordMessage)
+		for _, mode := range []string{SearchQueryRaw, SearchQueryGorm} {
+			if err := db.SetSearchQuery(mode); err != nil {
+				t.Fatal(err)
+			}
+			found, err := db.SearchSimilarMessages(context.Background(), embedding, guildID, "v1", 5, search.timeRange, search.scope)
+			if err != nil {
+				t.Fatalf("%s with %s query: %v", name, mode, err)
+			}
+			results[mode] = found
+		}
+
+		raw, gorm := results[SearchQueryRaw], results[SearchQueryGorm]
+		if len(raw) == 0 {
+			t.Errorf("%s: no results", name)
+		}
+		if len(raw) != len(gorm) {
+			t.Errorf("%s: raw query found %d messages, GORM query %d", name, len(raw), len(gorm))
+			continue
+		}
+		for i := range raw {
+			if raw[i].MessageID != gorm[i].MessageID || raw[i].Distance != gorm[i].Distance {
+				t.Errorf("%s: result %d is %s at %v from the raw query, %s at %v from GORM's",
+					name, i, raw[i].MessageID, raw[i].Distance, gorm[i].MessageID, gorm[i].Distance)
+			}
+		}
+	}
+}
+
+// A message whose embedding is pending or failed has a NULL embedding; it
+// must neither break scanning a search's rows nor be returned by one
+func TestSearchSkipsNullEmbeddings(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	createTestMessages(t, db, guildID, "v1", "a", "b")
+	pending := &models.DiscordMessage{
+		MessageID:        guildID + "-pending",
+		GuildID:          guildID,
+		ChannelID:        "c1",
+		Content:          "message pending",
+		Timestamp:        time.Now(),
+		EmbeddingVersion: "v1",
+	}
+	if err := db.Create(pending).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	embedding := make([]float32, EmbeddingDimensions)
+	embedding[0] = 1
+	for _, mode := range []string{SearchQueryRaw, SearchQueryGorm} {
+		if err := db.SetSearchQuery(mode); err != nil {
+			t.Fatal(err)
+		}
+		found, err := db.SearchSimilarMessages(context.Background(), embedding, guildID, "v1", 10, TimeRange{}, CategoryScope{})
+		if err != nil {
+			t.Fatalf("%s query: %v", mode, err)
+		}
+		var ids []string
+		for _, msg := range found {
+			ids = append(ids, strings.TrimPrefix(msg.MessageID, guildID+"-"))
+			if msg.Embedding == nil {
+				t.Errorf("%s query: %s returned without its embedding", mode, msg.MessageID)
+			}
+		}
+		if !slices.Equal(ids, []string{"a", "b"}) {
+			t.Errorf("%s query found %v, want the embedded messages a and b", mode, ids)
+		}
+	}
+
+	// Recent activity doesn't need embeddings, so it keeps the message
+	recent, err := db.GetRecentMessages(context.Background(), guildID, "", "v1", 10)
+	if err != nil {
+		t.Fatalf("GetRecentMessages: %v", err)
+	}
+	if len(recent) != 3 || recent[2].MessageID != pending.MessageID || recent[2].Embedding != nil {
+		t.Errorf("recent messages = %d, want the pending message last without an embedding", len(recent))
+	}
+}
+
+// Mismatched embeddings are rejected before any query is issued, so this
+// needs no database
+func TestSearchRejectsEmbeddingDimensionMismatch(t *testing.T) {
+	db := &DB{}
+	embedding := make([]float32, EmbeddingDimensions/2)
+	searches := map[string]func() error{
+		"messages": func() error {
+			_, err := db.SearchSimilarMessages(context.Background(), embedding, "g1", "v1", 5, TimeRange{}, CategoryScope{})
+			return err
+		},
+		"interactions": func() error {
+			_, err := db.SearchSimilarInteractions(context.Background(), embedding, "g1", "v1", 5)
+			return err
+		},
+		"facts": func() error {
+			_, err := db.SearchSimilarFacts(context.Background(), embedding, "g1", "v1", 5)
+			return err
+		},
+	}
+	for name, search := range searches {
+		var dimErr *EmbeddingDimensionError
+		if err := search(); !errors.As(err, &dimErr) {
+			t.Errorf("%s: error = %v, want an EmbeddingDimensionError", name, err)
+			continue
+		}
+		if dimErr.Got != len(embedding) || dimErr.Want != EmbeddingDimensions {
+			t.Errorf("%s: error reports %d of %d dimensions, want %d of %d", name, dimErr.Got, dimErr.Want, len(embedding), EmbeddingDimensions)
+		}
+	}
+
+	if err := checkEmbeddingDimensions(make([]float32, EmbeddingDimensions)); err != nil {
+		t.Errorf("checkEmbeddingDimensions rejected a full-size embedding: %v", err)
+	}
+}
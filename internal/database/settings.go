@@ -0,0 +1,102 @@
+// internal/database/settings.go
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetGuildSettings returns the settings row for a guild. If none exists yet,
+// an unsaved row with default values is returned.
+func (db *DB) GetGuildSettings(guildID string) (*models.GuildSettings, error) {
+	var settings *models.GuildSettings
+	err := db.withRetry(context.Background(), func() error {
+		settings = &models.GuildSettings{}
+		return db.Where(models.GuildSettings{GuildID: guildID}).FirstOrInit(settings).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SaveGuildSettings inserts or updates a guild's settings row
+func (db *DB) SaveGuildSettings(settings *models.GuildSettings) error {
+	return db.Save(settings).Error
+}
+
+// GetChannelSetting returns the explicit enable/disable setting for a
+// channel, or nil if the channel has never been configured
+func (db *DB) GetChannelSetting(channelID string) (*models.ChannelSetting, error) {
+	setting := &models.ChannelSetting{}
+	err := db.Where("channel_id = ?", channelID).First(setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
+
+// SetChannelEnabled records whether the bot may respond in a channel
+func (db *DB) SetChannelEnabled(guildID, channelID string, enabled bool) error {
+	setting := &models.ChannelSetting{}
+	err := db.Where(models.ChannelSetting{ChannelID: channelID}).
+		Attrs(models.ChannelSetting{GuildID: guildID}).
+		FirstOrInit(setting).Error
+	if err != nil {
+		return err
+	}
+
+	setting.Enabled = enabled
+	return db.Save(setting).Error
+}
+
+// InitGuildSettings makes sure a guild has a settings row, clearing any
+// previous departure mark. created reports whether the row is new.
+func (db *DB) InitGuildSettings(guildID string) (created bool, err error) {
+	settings, err := db.GetGuildSettings(guildID)
+	if err != nil {
+		return false, err
+	}
+
+	created = settings.ID == 0
+	if !created && settings.LeftAt == nil {
+		return false, nil
+	}
+
+	settings.LeftAt = nil
+	return created, db.SaveGuildSettings(settings)
+}
+
+// MarkGuildLeft records that the bot was removed from a guild, keeping its data
+func (db *DB) MarkGuildLeft(guildID string) error {
+	return db.Model(&models.GuildSettings{}).
+		Where("guild_id = ?", guildID).
+		Update("left_at", time.Now()).Error
+}
+
+// PurgeGuild deletes everything stored for a guild
+func (db *DB) PurgeGuild(guildID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.DiscordMessage{},
+			&models.BotInteraction{},
+			&models.Feedback{},
+			&models.BackfillProgress{},
+			&models.FailedEmbedding{},
+			&models.ChannelSetting{},
+			&models.GuildSettings{},
+		} {
+			if err := tx.Where("guild_id = ?", guildID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"discord-rag-bot/internal/models"
+	"testing"
+)
+
+func TestInitGuildSettings(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+
+	created, err := db.InitGuildSettings(guildID)
+	if err != nil || !created {
+		t.Fatalf("first InitGuildSettings = %v, %v; want a new row", created, err)
+	}
+	created, err = db.InitGuildSettings(guildID)
+	if err != nil || created {
+		t.Fatalf("second InitGuildSettings = %v, %v; want the existing row", created, err)
+	}
+
+	var count int64
+	db.Model(&models.GuildSettings{}).Where("guild_id = ?", guildID).Count(&count)
+	if count != 1 {
+		t.Errorf("%d settings rows, want 1", count)
+	}
+}
+
+func TestInitGuildSettingsAfterLeaving(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+
+	if _, err := db.InitGuildSettings(guildID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkGuildLeft(guildID); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := db.GetGuildSettings(guildID)
+	if err != nil || settings.LeftAt == nil {
+		t.Fatalf("settings after leaving = %+v, %v; want LeftAt set", settings, err)
+	}
+
+	// Rejoining keeps the settings rather than starting over
+	created, err := db.InitGuildSettings(guildID)
+	if err != nil || created {
+		t.Fatalf("InitGuildSettings on rejoin = %v, %v; want the existing row", created, err)
+	}
+	settings, err = db.GetGuildSettings(guildID)
+	if err != nil || settings.LeftAt != nil {
+		t.Errorf("settings after rejoining = %+v, %v; want LeftAt cleared", settings, err)
+	}
+}
+
+func TestPurgeGuild(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+
+	if _, err := db.InitGuildSettings(guildID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.ChannelSetting{GuildID: guildID, ChannelID: guildID + "-channel", Enabled: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.PurgeGuild(guildID); err != nil {
+		t.Fatalf("PurgeGuild: %v", err)
+	}
+	for _, model := range []interface{}{&models.GuildSettings{}, &models.ChannelSetting{}} {
+		var count int64
+		db.Model(model).Where("guild_id = ?", guildID).Count(&count)
+		if count != 0 {
+			t.Errorf("%d %T rows left after purging", count, model)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// internal/database/usage.go
+package database
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddUsage adds one API call's token usage to the guild's daily total
+func (db *DB) AddUsage(guildID, model string, promptTokens, completionTokens int, at time.Time) error {
+	usage := &models.TokenUsage{
+		GuildID:          guildID,
+		Model:            model,
+		Day:              at.UTC().Truncate(24 * time.Hour),
+		Requests:         1,
+		PromptTokens:     int64(promptTokens),
+		CompletionTokens: int64(completionTokens),
+	}
+
+	return db.withRetry(context.Background(), func() error {
+		return db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "guild_id"}, {Name: "model"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"requests":          gorm.Expr("token_usages.requests + EXCLUDED.requests"),
+				"prompt_tokens":     gorm.Expr("token_usages.prompt_tokens + EXCLUDED.prompt_tokens"),
+				"completion_tokens": gorm.Expr("token_usages.completion_tokens + EXCLUDED.completion_tokens"),
+				"updated_at":        gorm.Expr("EXCLUDED.updated_at"),
+			}),
+		}).Create(usage).Error
+	})
+}
+
+// GetUsageSince returns a guild's usage per model since the given day
+func (db *DB) GetUsageSince(guildID string, since time.Time) ([]models.TokenUsage, error) {
+	var usage []models.TokenUsage
+	err := db.Model(&models.TokenUsage{}).
+		Select("model, SUM(requests) AS requests, SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens").
+		Where("guild_id = ? AND day >= ?", guildID, since.UTC().Truncate(24*time.Hour)).
+		Group("model").
+		Order("model").
+		Scan(&usage).Error
+	return usage, err
+}
+
+// AddUserUsage adds tokens spent on a user's request to their daily total
+func (db *DB) AddUserUsage(userID string, tokens int, at time.Time) error {
+	usage := &models.UserTokenUsage{
+		UserID: userID,
+		Day:    at.UTC().Truncate(24 * time.Hour),
+		Tokens: int64(tokens),
+	}
+
+	return db.withRetry(context.Background(), func() error {
+		return db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"tokens":     gorm.Expr("user_token_usages.tokens + EXCLUDED.tokens"),
+				"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+			}),
+		}).Create(usage).Error
+	})
+}
+
+// GetUserTokens returns the tokens spent on a user's requests on the UTC
+// day containing at
+func (db *DB) GetUserTokens(userID string, at time.Time) (int64, error) {
+	var tokens int64
+	err := db.Model(&models.UserTokenUsage{}).
+		Select("COALESCE(SUM(tokens), 0)").
+		Where("user_id = ? AND day = ?", userID, at.UTC().Truncate(24*time.Hour)).
+		Scan(&tokens).Error
+	return tokens, err
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"discord-rag-bot/internal/models"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAddUsageAccumulates(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+
+	for _, call := range []struct {
+		model              string
+		prompt, completion int
+		at                 time.Time
+	}{
+		{"gpt-4o", 100, 20, today},
+		{"gpt-4o", 50, 10, today},
+		{"gpt-4o", 1000, 1000, yesterday},
+		{"text-embedding-ada-002", 7, 0, today},
+	} {
+		if err := db.AddUsage(guildID, call.model, call.prompt, call.completion, call.at); err != nil {
+			t.Fatalf("AddUsage: %v", err)
+		}
+	}
+
+	var rows int64
+	db.Model(&models.TokenUsage{}).Where("guild_id = ?", guildID).Count(&rows)
+	if rows != 3 {
+		t.Errorf("%d usage rows, want one per model and day", rows)
+	}
+
+	usage, err := db.GetUsageSince(guildID, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.TokenUsage{
+		{Model: "gpt-4o", Requests: 2, PromptTokens: 150, CompletionTokens: 30},
+		{Model: "text-embedding-ada-002", Requests: 1, PromptTokens: 7},
+	}
+	if !slices.Equal(usage, want) {
+		t.Errorf("usage today = %+v, want %+v", usage, want)
+	}
+
+	usage, err = db.GetUsageSince(guildID, yesterday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) == 0 || usage[0].Requests != 3 || usage[0].PromptTokens != 1150 {
+		t.Errorf("usage since yesterday = %+v, want 3 gpt-4o requests and 1150 prompt tokens", usage)
+	}
+}
+
+func TestAddUserUsageAccumulates(t *testing.T) {
+	db := openTestDB(t)
+	userID := fmt.Sprintf("test-%s-%d", t.Name(), time.Now().UnixNano())
+	t.Cleanup(func() { db.Where("user_id = ?", userID).Delete(&models.UserTokenUsage{}) })
+	today := time.Now()
+
+	for _, tokens := range []int{120, 80} {
+		if err := db.AddUserUsage(userID, tokens, today); err != nil {
+			t.Fatalf("AddUserUsage: %v", err)
+		}
+	}
+	if err := db.AddUserUsage(userID, 1000, today.AddDate(0, 0, -1)); err != nil {
+		t.Fatalf("AddUserUsage: %v", err)
+	}
+
+	if tokens, err := db.GetUserTokens(userID, today); err != nil || tokens != 200 {
+		t.Errorf("GetUserTokens today = %d, %v, want 200", tokens, err)
+	}
+	if tokens, err := db.GetUserTokens(userID, today.AddDate(0, 0, -2)); err != nil || tokens != 0 {
+		t.Errorf("GetUserTokens with no usage = %d, %v, want 0", tokens, err)
+	}
+}
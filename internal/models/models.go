@@ -9,30 +9,135 @@ import (
 
 type DiscordMessage struct {
 	ID          uint   `gorm:"primaryKey"`
-	MessageID   string `gorm:"uniqueIndex;not null"`
+	MessageID   string `gorm:"uniqueIndex:idx_message_version;not null"`
 	Content     string `gorm:"type:text"`
 	Author      string `gorm:"not null"`
 	Username    string `gorm:"not null"`
 	ChannelID   string `gorm:"not null"`
 	ChannelName string
+	CategoryID  string `gorm:"index"` // Parent category of the channel (of the thread's channel for threads)
 	GuildID     string `gorm:"not null"`
 	GuildName   string
-	Timestamp   time.Time       `gorm:"not null"`
-	Embedding   pgvector.Vector `gorm:"type:vector(1536)"` // OpenAI embedding size
-	CreatedAt   time.Time
+	Timestamp   time.Time        `gorm:"not null"`
+	Embedding   *pgvector.Vector `gorm:"type:vector(1536)"` // OpenAI embedding size; nil while pending or failed
+	// Summary is what was embedded instead of a long message's content, if
+	// it was summarized
+	Summary string `gorm:"type:text"`
+	// IsFact marks an entry an admin added with /addfact rather than a
+	// Discord message; its MessageID is synthetic
+	IsFact bool `gorm:"not null;default:false"`
+	// EmbeddingVersion labels the embedding model. A message has one row per
+	// version so a new version can be built while the old one is searched.
+	// Rows stored before versioning are labelled with the configured version
+	// at startup.
+	EmbeddingVersion string `gorm:"uniqueIndex:idx_message_version"`
+	// LastRetrievedAt is when the message was last returned by a search,
+	// for evicting the least useful messages first
+	LastRetrievedAt *time.Time
+	CreatedAt       time.Time
+	// Distance is the cosine distance of the message from the query, set
+	// only on search results; lower is more similar
+	Distance float64 `gorm:"->;-:migration"`
+}
+
+// SetEmbedding stores an embedding on the message
+func (m *DiscordMessage) SetEmbedding(embedding []float32) {
+	vector := pgvector.NewVector(embedding)
+	m.Embedding = &vector
 }
 
 type BotInteraction struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    string `gorm:"not null"`
+	Username  string `gorm:"not null"`
+	Query     string `gorm:"type:text"`
+	Response  string `gorm:"type:text"`
+	ChannelID string `gorm:"not null"`
+	GuildID   string `gorm:"not null"`
+	// QueryLength and ResponseLength are kept even when the text is redacted
+	QueryLength      int
+	ResponseLength   int
+	IsVoice          bool             `gorm:"default:false"`
+	Timestamp        time.Time        `gorm:"not null"`
+	Embedding        *pgvector.Vector `gorm:"type:vector(1536)"` // Set only when interactions are indexed for retrieval
+	EmbeddingVersion string           `gorm:"index"`
+	CreatedAt        time.Time
+}
+
+// SetEmbedding stores an embedding on the interaction
+func (b *BotInteraction) SetEmbedding(embedding []float32) {
+	vector := pgvector.NewVector(embedding)
+	b.Embedding = &vector
+}
+
+// Feedback is free-text feedback a user left about an answer
+type Feedback struct {
+	ID            uint   `gorm:"primaryKey"`
+	InteractionID *uint  `gorm:"index"` // nil if the user had no prior interaction in the channel
+	UserID        string `gorm:"not null"`
+	Username      string `gorm:"not null"`
+	ChannelID     string `gorm:"not null"`
+	GuildID       string
+	Text          string `gorm:"type:text;not null"`
+	CreatedAt     time.Time
+}
+
+// TokenUsage accumulates API token usage per guild, model and day
+type TokenUsage struct {
+	ID               uint      `gorm:"primaryKey"`
+	GuildID          string    `gorm:"uniqueIndex:idx_token_usage_key"` // Empty for usage not tied to a guild
+	Model            string    `gorm:"uniqueIndex:idx_token_usage_key;not null"`
+	Day              time.Time `gorm:"uniqueIndex:idx_token_usage_key;type:date;not null"`
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	UpdatedAt        time.Time
+}
+
+// UserTokenUsage accumulates the tokens spent on a user's requests per
+// day, across guilds, for the daily budget
+type UserTokenUsage struct {
 	ID        uint      `gorm:"primaryKey"`
-	UserID    string    `gorm:"not null"`
-	Username  string    `gorm:"not null"`
-	Query     string    `gorm:"type:text"`
-	Response  string    `gorm:"type:text"`
-	ChannelID string    `gorm:"not null"`
-	GuildID   string    `gorm:"not null"`
-	IsVoice   bool      `gorm:"default:false"`
-	Timestamp time.Time `gorm:"not null"`
+	UserID    string    `gorm:"uniqueIndex:idx_user_token_usage_key;not null"`
+	Day       time.Time `gorm:"uniqueIndex:idx_user_token_usage_key;type:date;not null"`
+	Tokens    int64
+	UpdatedAt time.Time
+}
+
+// BackfillProgress checkpoints re-embedding a guild's messages under a new
+// embedding version so an interrupted backfill can resume
+type BackfillProgress struct {
+	ID        uint   `gorm:"primaryKey"`
+	GuildID   string `gorm:"uniqueIndex:idx_backfill_key;not null"`
+	Version   string `gorm:"uniqueIndex:idx_backfill_key;not null"`
+	LastID    uint   // Row ID of the last source message embedded, in order
+	Processed int64
+	Total     int64
+	UpdatedAt time.Time
+}
+
+// EmbeddingSettings records how the embeddings of a version were made, so
+// a version is never extended with vectors that aren't comparable to it
+type EmbeddingSettings struct {
+	ID         uint   `gorm:"primaryKey"`
+	Version    string `gorm:"uniqueIndex;not null"`
+	Normalized bool   `gorm:"not null"`
+	CreatedAt  time.Time
+}
+
+// FailedEmbedding dead-letters a message whose embedding kept failing, so
+// operators can see what content was never stored
+type FailedEmbedding struct {
+	ID        uint   `gorm:"primaryKey"`
+	MessageID string `gorm:"uniqueIndex;not null"`
+	GuildID   string `gorm:"index"`
+	ChannelID string
+	Author    string
+	Content   string `gorm:"type:text"`
+	Attempts  int
+	LastError string `gorm:"type:text"`
 	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type ConversationContext struct {
@@ -42,3 +147,45 @@ type ConversationContext struct {
 	Context   string `gorm:"type:jsonb"`
 	UpdatedAt time.Time
 }
+
+type GuildSettings struct {
+	ID        uint   `gorm:"primaryKey"`
+	GuildID   string `gorm:"uniqueIndex;not null"`
+	ChatModel string
+	// ChannelAllowlist restricts responses to explicitly enabled channels
+	ChannelAllowlist bool `gorm:"default:false"`
+	// ReplyInThread posts answers to mentions and /ai in a thread off the
+	// question. Voice answers stay in the voice channel's chat, which can't
+	// hold threads.
+	ReplyInThread bool `gorm:"default:false"`
+	// LeftAt is set while the bot is not a member of the guild
+	LeftAt *time.Time
+	// EmbeddingVersion is the embedding version searched; empty uses the
+	// configured default
+	EmbeddingVersion string
+	// BotName overrides the configured bot name in this guild
+	BotName string
+	// AuthorNames overrides how message authors are named in the context
+	AuthorNames string
+	// ResponseFooter overrides the configured answer footer in this guild;
+	// nil uses the default, empty disables it
+	ResponseFooter *string
+	// VoiceMode overrides the configured voice listening mode
+	VoiceMode string
+	// TranscriptionPrompt overrides the configured speech recognition prompt
+	TranscriptionPrompt string
+	// QuietHours and QuietTimezone override the configured quiet hours;
+	// QuietHours "off" disables them in this guild
+	QuietHours    string
+	QuietTimezone string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type ChannelSetting struct {
+	ID        uint   `gorm:"primaryKey"`
+	GuildID   string `gorm:"index;not null"`
+	ChannelID string `gorm:"uniqueIndex;not null"`
+	Enabled   bool   `gorm:"not null"`
+	UpdatedAt time.Time
+}
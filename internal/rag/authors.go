@@ -0,0 +1,167 @@
+// internal/rag/authors.go
+package rag
+
+import (
+	"crypto/sha256"
+	"discord-rag-bot/internal/models"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+)
+
+const (
+	// AuthorNamesReal shows authors' Discord usernames in the context
+	AuthorNamesReal = "names"
+	// AuthorNamesAnonymize labels authors "User A", "User B", ... in order
+	// of appearance, consistently within one context
+	AuthorNamesAnonymize = "anonymize"
+	// AuthorNamesPseudonymize labels authors by a hash of their user ID,
+	// stable across queries
+	AuthorNamesPseudonymize = "pseudonymize"
+)
+
+// ValidAuthorNames reports whether mode is a known author naming mode
+func ValidAuthorNames(mode string) bool {
+	switch mode {
+	case AuthorNamesReal, AuthorNamesAnonymize, AuthorNamesPseudonymize:
+		return true
+	}
+	return false
+}
+
+// userMentionPattern matches a raw Discord user mention, capturing the ID
+var userMentionPattern = regexp.MustCompile(`<@!?(\d+)>`)
+
+// UserNameSource looks up the usernames of mentioned users, so the context
+// can name them when authors are shown by name
+type UserNameSource interface {
+	// UserName returns the user's username, or "" if it is unknown
+	UserName(guildID, userID string) string
+}
+
+// SetUserNames enables naming mentioned users who aren't authors in the
+// context; without it such mentions are left raw when authors are shown
+// by name
+func (r *RAGRetriever) SetUserNames(source UserNameSource) {
+	r.users = source
+}
+
+// authorNamer decides how an author appears in one rendered context
+type authorNamer struct {
+	mode    string
+	guildID string
+	labels  map[string]string
+
+	// usernames caches the known usernames by user ID, learned from the
+	// authors named so far or looked up; lookup may be nil
+	usernames map[string]string
+	lookup    func(userID string) string
+}
+
+func newAuthorNamer(mode, guildID string) *authorNamer {
+	return &authorNamer{mode: mode, guildID: guildID, labels: make(map[string]string), usernames: make(map[string]string)}
+}
+
+// authorNamer returns a namer for one context in a guild that can look up
+// mentioned users
+func (r *RAGRetriever) authorNamer(mode, guildID string) *authorNamer {
+	names := newAuthorNamer(mode, guildID)
+	if r.users != nil {
+		names.lookup = func(userID string) string {
+			return r.users.UserName(guildID, userID)
+		}
+	}
+	return names
+}
+
+// name returns the label for an author, identified by user ID. The same
+// author always gets the same label from one namer, and different authors
+// different labels.
+func (n *authorNamer) name(authorID, username string) string {
+	switch n.mode {
+	case AuthorNamesAnonymize:
+		if label, ok := n.labels[authorID]; ok {
+			return label
+		}
+		label := "User " + letterLabel(len(n.labels))
+		n.labels[authorID] = label
+		return label
+	case AuthorNamesPseudonymize:
+		// Salted with the guild so labels can't be matched across servers
+		sum := sha256.Sum256([]byte(n.guildID + ":" + authorID))
+		return "User-" + hex.EncodeToString(sum[:4])
+	default:
+		if username != "" {
+			n.usernames[authorID] = username
+		}
+		return username
+	}
+}
+
+// mentions replaces the user mentions in text with the labels of the
+// mentioned users, so the naming mode covers message content too. In
+// names mode, a mention of a user whose name can't be found is left raw.
+func (n *authorNamer) mentions(text string) string {
+	return userMentionPattern.ReplaceAllStringFunc(text, func(mention string) string {
+		userID := userMentionPattern.FindStringSubmatch(mention)[1]
+		if n.mode == AuthorNamesAnonymize || n.mode == AuthorNamesPseudonymize {
+			return "@" + n.name(userID, "")
+		}
+		if username := n.username(userID); username != "" {
+			return "@" + username
+		}
+		return mention
+	})
+}
+
+// username returns a user's username, looking it up once if no author in
+// the context had it
+func (n *authorNamer) username(userID string) string {
+	if username, ok := n.usernames[userID]; ok {
+		return username
+	}
+	var username string
+	if n.lookup != nil {
+		username = n.lookup(userID)
+	}
+	n.usernames[userID] = username
+	return username
+}
+
+// letterLabel numbers labels A..Z, then AA, AB, ... like spreadsheet columns
+func letterLabel(i int) string {
+	label := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		label = string(rune('A'+(i-1)%26)) + label
+	}
+	return label
+}
+
+// AuthorNames returns how authors are named in a guild's context, honoring
+// its override
+func (r *RAGRetriever) AuthorNames(guildID string) string {
+	if guildID != "" {
+		settings, err := r.guildSettings(guildID)
+		if err != nil {
+			log.Printf("Error loading guild settings for %s: %v", guildID, err)
+		} else if ValidAuthorNames(settings.AuthorNames) {
+			return settings.AuthorNames
+		}
+	}
+	if ValidAuthorNames(r.cfg.AuthorNames) {
+		return r.cfg.AuthorNames
+	}
+	return AuthorNamesReal
+}
+
+// SetAuthorNames stores a guild's author naming override; empty clears it
+func (r *RAGRetriever) SetAuthorNames(guildID, mode string) error {
+	if mode != "" && !ValidAuthorNames(mode) {
+		return fmt.Errorf("unknown author naming mode %q", mode)
+	}
+
+	return r.updateGuildSettings(guildID, func(settings *models.GuildSettings) {
+		settings.AuthorNames = mode
+	})
+}
@@ -0,0 +1,133 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// An author is labelled the same in every section of one context, and in
+// mentions of them
+func TestAnonymizeConsistentAcrossContext(t *testing.T) {
+	similar := []models.DiscordMessage{
+		{MessageID: "1", Author: "111", Username: "ann", Content: "game night is friday, ask <@222>", Timestamp: baseTime},
+	}
+	recent := []models.DiscordMessage{
+		{MessageID: "2", Author: "222", Username: "bob", Content: "I'll bring snacks", Timestamp: baseTime},
+		{MessageID: "3", Author: "111", Username: "ann", Content: "thanks <@!222>", Timestamp: baseTime},
+	}
+	interactions := []models.BotInteraction{{UserID: "222", Username: "bob", Query: "who hosts?", Response: "<@111> does."}}
+
+	found := formatContext(similar, recent, interactions, newAuthorNamer(AuthorNamesAnonymize, "g1"), defaultPromptTemplates())
+	for _, name := range []string{"ann", "bob", "111", "222"} {
+		if strings.Contains(found.Text, name) {
+			t.Errorf("anonymized context contains %q:\n%s", name, found.Text)
+		}
+	}
+	for _, want := range []string{
+		"User A: game night is friday, ask @User B",
+		"User B: I'll bring snacks",
+		"User A: thanks @User B",
+		"User B asked: who hosts?\nYou answered: @User A does.",
+	} {
+		if !strings.Contains(found.Text, want) {
+			t.Errorf("anonymized context doesn't contain %q:\n%s", want, found.Text)
+		}
+	}
+}
+
+// Pseudonyms are stable across contexts but differ between guilds
+func TestPseudonymizeStable(t *testing.T) {
+	first := newAuthorNamer(AuthorNamesPseudonymize, "g1").name("111", "ann")
+	again := newAuthorNamer(AuthorNamesPseudonymize, "g1")
+	again.name("222", "bob")
+	if got := again.name("111", "ann"); got != first {
+		t.Errorf("pseudonym in a second context = %q, want %q", got, first)
+	}
+	if other := newAuthorNamer(AuthorNamesPseudonymize, "g2").name("111", "ann"); other == first {
+		t.Errorf("pseudonym %q is the same in another guild", other)
+	}
+}
+
+// Switching a guild to anonymized names applies to the very next search,
+// even one the context cache already answered by name
+func TestSetAuthorNamesAppliesImmediately(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{ContextCacheTTL: time.Minute})
+	msg := testMessage("m1", "g1", "v1", "game night is friday", 0)
+	msg.Author, msg.Username = "111", "ann"
+	upsertAll(t, store, msg)
+
+	search := func() string {
+		t.Helper()
+		found, err := r.SearchContextInRange(context.Background(), "when is game night", "g1", "c1", "", 5, database.TimeRange{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return found.Text
+	}
+
+	if text := search(); !strings.Contains(text, "ann") {
+		t.Fatalf("context = %q, want the author named", text)
+	}
+	if err := r.SetAuthorNames("g1", AuthorNamesAnonymize); err != nil {
+		t.Fatalf("SetAuthorNames: %v", err)
+	}
+	if text := search(); strings.Contains(text, "ann") || !strings.Contains(text, "User A") {
+		t.Errorf("context after anonymizing = %q, want the author labelled", text)
+	}
+
+	if err := r.SetAuthorNames("g1", "nicknames"); err == nil {
+		t.Error("SetAuthorNames accepted an unknown mode")
+	}
+	if got := r.AuthorNames("g1"); got != AuthorNamesAnonymize {
+		t.Errorf("AuthorNames after a rejected change = %q, want %q", got, AuthorNamesAnonymize)
+	}
+
+	if err := r.SetAuthorNames("g1", ""); err != nil {
+		t.Fatalf("SetAuthorNames clearing the override: %v", err)
+	}
+	if got := r.AuthorNames("g1"); got != AuthorNamesReal {
+		t.Errorf("AuthorNames without an override = %q, want the default %q", got, AuthorNamesReal)
+	}
+}
+
+// fakeUserNames is a UserNameSource counting its lookups
+type fakeUserNames struct {
+	names   map[string]string
+	lookups int
+}
+
+func (f *fakeUserNames) UserName(guildID, userID string) string {
+	f.lookups++
+	return f.names[userID]
+}
+
+func TestMentionsNamedInNamesMode(t *testing.T) {
+	users := &fakeUserNames{names: map[string]string{"333": "cat"}}
+	r, _, _, _ := newTestRetriever(t, config.RAGConfig{})
+	r.SetUserNames(users)
+	names := r.authorNamer(AuthorNamesReal, "g1")
+
+	names.name("111", "ann")
+	tests := []struct {
+		text string
+		want string
+	}{
+		// Authors already in the context need no lookup
+		{"thanks <@111>", "thanks @ann"},
+		{"ask <@!333> and <@333>", "ask @cat and @cat"},
+		{"who is <@999>?", "who is <@999>?"},
+	}
+	for _, tt := range tests {
+		if got := names.mentions(tt.text); got != tt.want {
+			t.Errorf("mentions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if users.lookups != 2 {
+		t.Errorf("%d username lookups, want one per unknown user", users.lookups)
+	}
+}
@@ -0,0 +1,240 @@
+// internal/rag/backfill.go
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/models"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BackfillProgress is reported after each checkpoint
+type BackfillProgress struct {
+	Processed int64
+	Total     int64
+}
+
+// backfillBatch is one page of source messages, numbered in fetch order
+type backfillBatch struct {
+	seq      int
+	messages []models.DiscordMessage
+	lastID   uint
+}
+
+type backfillResult struct {
+	seq    int
+	lastID uint
+	count  int
+	err    error
+}
+
+// ErrBackfillUnsupported means the vector store can't be backfilled:
+// backfills read and write the discord_messages table, which only the
+// pgvector store keeps messages in
+var ErrBackfillUnsupported = errors.New("backfills need the pgvector vector store")
+
+// CanBackfill reports whether the vector store supports backfills
+func (r *RAGRetriever) CanBackfill() bool {
+	_, ok := r.store.(*PGVectorStore)
+	return ok
+}
+
+// Backfill embeds a guild's messages stored under the from version again
+// under the to version. Batches are embedded by concurrent workers that
+// share the embedding rate limit. Progress is checkpointed at the last
+// message ID below which every batch has finished, so an interrupted
+// backfill resumes there; batches embedded past it are skipped on resume.
+func (r *RAGRetriever) Backfill(ctx context.Context, guildID, from, to string, onProgress func(BackfillProgress)) error {
+	if from == to {
+		return fmt.Errorf("source and target embedding versions are both %q", to)
+	}
+	if !r.CanBackfill() {
+		return ErrBackfillUnsupported
+	}
+	ctx = ai.WithGuildID(ctx, guildID)
+
+	if err := r.db.CheckEmbeddingSettings(to, r.AI.NormalizesEmbeddings()); err != nil {
+		return err
+	}
+
+	checkpoint, err := r.db.GetBackfillProgress(guildID, to)
+	if err != nil {
+		return fmt.Errorf("failed to load backfill progress: %v", err)
+	}
+
+	remaining, err := r.db.CountMessagesToBackfill(ctx, guildID, from, to, checkpoint.LastID)
+	if err != nil {
+		return fmt.Errorf("failed to count messages to backfill: %v", err)
+	}
+	checkpoint.Total = checkpoint.Processed + remaining
+	if err := r.db.SaveBackfillProgress(checkpoint); err != nil {
+		return fmt.Errorf("failed to save backfill progress: %v", err)
+	}
+	if onProgress != nil {
+		onProgress(BackfillProgress{Processed: checkpoint.Processed, Total: checkpoint.Total})
+	}
+	if remaining == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := r.cfg.BackfillWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	batchSize := r.cfg.BackfillBatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+
+	// A shared ticker spaces embedding requests across all workers. It is
+	// waited on per request, since a batch may take several.
+	if r.cfg.BackfillRequestsPerMinute > 0 {
+		ticker := time.NewTicker(time.Minute / time.Duration(r.cfg.BackfillRequestsPerMinute))
+		defer ticker.Stop()
+		ctx = ai.WithEmbeddingThrottle(ctx, ticker.C)
+	}
+
+	batches := make(chan backfillBatch)
+	results := make(chan backfillResult)
+
+	fetchErr := make(chan error, 1)
+	go func() {
+		defer close(batches)
+		fetchErr <- r.fetchBackfillBatches(ctx, guildID, from, to, checkpoint.LastID, batchSize, batches)
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				count, err := r.embedBackfillBatch(ctx, to, batch.messages)
+				results <- backfillResult{seq: batch.seq, lastID: batch.lastID, count: count, err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	cursor := newBackfillCursor()
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+				cancel()
+			}
+			continue
+		}
+		if firstErr != nil || !cursor.finish(result, checkpoint) {
+			continue
+		}
+
+		if err := r.db.SaveBackfillProgress(checkpoint); err != nil {
+			firstErr = fmt.Errorf("failed to save backfill progress: %v", err)
+			cancel()
+			continue
+		}
+		if onProgress != nil {
+			onProgress(BackfillProgress{Processed: checkpoint.Processed, Total: checkpoint.Total})
+		}
+	}
+
+	if err := <-fetchErr; err != nil && firstErr == nil {
+		firstErr = err
+	}
+	// The fetcher stops quietly when ctx ends, so a backfill interrupted
+	// between batches would otherwise look complete
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// backfillCursor advances a backfill's checkpoint over finished batches.
+// Workers finish batches out of order, so the checkpoint only moves past
+// a batch once every batch fetched before it has finished too.
+type backfillCursor struct {
+	done map[int]backfillResult
+	next int
+}
+
+func newBackfillCursor() *backfillCursor {
+	return &backfillCursor{done: make(map[int]backfillResult)}
+}
+
+// finish records a successful batch, reporting whether the checkpoint moved
+func (c *backfillCursor) finish(result backfillResult, checkpoint *models.BackfillProgress) bool {
+	c.done[result.seq] = result
+	advanced := false
+	for {
+		finished, ok := c.done[c.next]
+		if !ok {
+			return advanced
+		}
+		delete(c.done, c.next)
+		checkpoint.LastID = finished.lastID
+		checkpoint.Processed += int64(finished.count)
+		c.next++
+		advanced = true
+	}
+}
+
+// fetchBackfillBatches pages through the source messages after afterID,
+// numbering batches in order
+func (r *RAGRetriever) fetchBackfillBatches(ctx context.Context, guildID, from, to string, afterID uint, batchSize int, batches chan<- backfillBatch) error {
+	for seq := 0; ; seq++ {
+		messages, err := r.db.MessagesToBackfill(ctx, guildID, from, to, afterID, batchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to load messages to backfill: %v", err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		afterID = messages[len(messages)-1].ID
+		select {
+		case batches <- backfillBatch{seq: seq, messages: messages, lastID: afterID}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// embedBackfillBatch stores copies of messages embedded under version
+func (r *RAGRetriever) embedBackfillBatch(ctx context.Context, version string, messages []models.DiscordMessage) (int, error) {
+	texts := make([]string, len(messages))
+	for i, msg := range messages {
+		texts[i] = r.embeddingText(embeddingSource(&msg))
+	}
+
+	embeddings, err := r.AI.GenerateEmbeddings(ctx, texts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate embeddings: %v", err)
+	}
+
+	copies := make([]*models.DiscordMessage, len(messages))
+	for i, msg := range messages {
+		msg.ID = 0
+		msg.CreatedAt = time.Time{}
+		msg.EmbeddingVersion = version
+		copies[i] = &msg
+	}
+
+	if err := r.db.CreateMessagesWithEmbeddings(copies, embeddings); err != nil {
+		return 0, fmt.Errorf("failed to store embeddings: %v", err)
+	}
+	return len(copies), nil
+}
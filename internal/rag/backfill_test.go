@@ -0,0 +1,120 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/models"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackfillCursorWaitsForEarlierBatches(t *testing.T) {
+	cursor := newBackfillCursor()
+	checkpoint := &models.BackfillProgress{LastID: 5, Processed: 5}
+
+	steps := []struct {
+		result    backfillResult
+		advanced  bool
+		lastID    uint
+		processed int64
+	}{
+		// Batch 1 finishing first mustn't skip over batch 0
+		{backfillResult{seq: 1, lastID: 20, count: 10}, false, 5, 5},
+		{backfillResult{seq: 3, lastID: 40, count: 10}, false, 5, 5},
+		{backfillResult{seq: 0, lastID: 10, count: 5}, true, 20, 20},
+		{backfillResult{seq: 2, lastID: 30, count: 8}, true, 40, 38},
+		{backfillResult{seq: 4, lastID: 45, count: 2}, true, 45, 40},
+	}
+	for i, step := range steps {
+		advanced := cursor.finish(step.result, checkpoint)
+		if advanced != step.advanced || checkpoint.LastID != step.lastID || checkpoint.Processed != step.processed {
+			t.Errorf("step %d: advanced %v to ID %d with %d processed; want %v, %d, %d",
+				i, advanced, checkpoint.LastID, checkpoint.Processed, step.advanced, step.lastID, step.processed)
+		}
+	}
+}
+
+func TestBackfillNeedsPGVectorStore(t *testing.T) {
+	r := NewRAGRetrieverWithStore(nil, NewMemoryStore(), nil, config.RAGConfig{})
+
+	if err := r.Backfill(context.Background(), "g1", "v1", "v2", nil); !errors.Is(err, ErrBackfillUnsupported) {
+		t.Errorf("Backfill error = %v, want ErrBackfillUnsupported", err)
+	}
+	if err := r.Backfill(context.Background(), "g1", "v1", "v1", nil); err == nil {
+		t.Error("Backfill to the source version succeeded")
+	}
+}
+
+func TestBackfillResumes(t *testing.T) {
+	db := openTestDB(t)
+	guildID := testGuild(t, db)
+	aiService, fake := newTestAI(t, config.AIConfig{})
+	from, to := "test-v1", fmt.Sprintf("test-v2-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		db.Where("version = ?", to).Delete(&models.EmbeddingSettings{})
+	})
+
+	const total = 40
+	messages := make([]*models.DiscordMessage, total)
+	embeddings := make([][]float32, total)
+	for i := range messages {
+		messages[i] = &models.DiscordMessage{
+			MessageID:        fmt.Sprintf("%s-%d", guildID, i),
+			GuildID:          guildID,
+			ChannelID:        "c1",
+			Content:          fmt.Sprintf("message number %d", i),
+			Timestamp:        time.Now(),
+			EmbeddingVersion: from,
+		}
+		embeddings[i] = bagOfWords(messages[i].Content)
+	}
+	if err := db.CreateMessagesWithEmbeddings(messages, embeddings); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRAGRetriever(db, aiService, config.RAGConfig{BackfillWorkers: 3, BackfillBatchSize: 4})
+
+	// Interrupt the first run partway
+	ctx, cancel := context.WithCancel(context.Background())
+	err := r.Backfill(ctx, guildID, from, to, func(p BackfillProgress) {
+		if p.Processed >= total/2 {
+			cancel()
+		}
+	})
+	cancel()
+	if err == nil {
+		t.Fatal("interrupted backfill reported success")
+	}
+
+	checkpoint, err := db.GetBackfillProgress(guildID, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Processed < total/2 || checkpoint.Processed >= total {
+		t.Fatalf("checkpoint after interruption = %d processed, want partial progress", checkpoint.Processed)
+	}
+	_, embeddedBefore := fake.embedded()
+
+	var last BackfillProgress
+	if err := r.Backfill(context.Background(), guildID, from, to, func(p BackfillProgress) { last = p }); err != nil {
+		t.Fatalf("resumed Backfill: %v", err)
+	}
+	if last.Processed != last.Total {
+		t.Errorf("final progress = %+v, want complete", last)
+	}
+
+	counts, err := db.CountMessagesByVersion(guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[to] != total {
+		t.Errorf("%d messages under %s, want each of the %d once", counts[to], to, total)
+	}
+
+	// Messages embedded before the interruption aren't embedded again
+	if _, embeddedAfter := fake.embedded(); embeddedAfter-embeddedBefore > total-int(checkpoint.Processed) {
+		t.Errorf("resume embedded %d messages, want at most the %d left", embeddedAfter-embeddedBefore, total-int(checkpoint.Processed))
+	}
+}
@@ -0,0 +1,120 @@
+// internal/rag/cache.go
+package rag
+
+import (
+	"discord-rag-bot/internal/database"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type cacheEntry struct {
+	value     RetrievedContext
+	expiresAt time.Time
+}
+
+// contextCache holds recent SearchRelevantContext results keyed by guild,
+// channel and normalized query. Entries expire after the TTL, or earlier
+// when something they may have been built from is deleted.
+type contextCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+}
+
+// CacheStats reports context cache effectiveness
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+func newContextCache(ttl time.Duration) *contextCache {
+	return &contextCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func cacheKey(query, guildID, channelID, categoryID, version, authorNames string, limit int, timeRange database.TimeRange) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	var since, until int64
+	if !timeRange.Since.IsZero() {
+		since = timeRange.Since.Unix()
+	}
+	if !timeRange.Until.IsZero() {
+		until = timeRange.Until.Unix()
+	}
+	return fmt.Sprintf("%s:%s:%s:%s:%s:%d:%d-%d:%s", guildID, channelID, categoryID, version, authorNames, limit, since, until, normalized)
+}
+
+func (c *contextCache) get(key string) (RetrievedContext, bool) {
+	if c.ttl <= 0 {
+		return RetrievedContext{}, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		return RetrievedContext{}, false
+	}
+	c.hits.Add(1)
+	return entry.value, true
+}
+
+func (c *contextCache) set(key string, value RetrievedContext) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Sweep expired entries so the map doesn't grow without bound
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// invalidateGuild drops every entry for the guild, whose keys all start
+// with its ID
+func (c *contextCache) invalidateGuild(guildID string) {
+	prefix := guildID + ":"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func (c *contextCache) stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
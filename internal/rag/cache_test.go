@@ -0,0 +1,96 @@
+package rag
+
+import (
+	"discord-rag-bot/internal/database"
+	"testing"
+	"time"
+)
+
+func TestContextCacheHit(t *testing.T) {
+	cache := newContextCache(time.Minute)
+	key := cacheKey("When is game night?", "g1", "c1", "", "v1", "", 5, database.TimeRange{})
+
+	if _, ok := cache.get(key); ok {
+		t.Fatal("empty cache returned a hit")
+	}
+	cache.set(key, RetrievedContext{Text: "context"})
+
+	value, ok := cache.get(key)
+	if !ok || value.Text != "context" {
+		t.Fatalf("get = %q, %v; want the cached context", value.Text, ok)
+	}
+
+	stats := cache.stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("stats = %+v, want 1 hit, 1 miss, 1 entry", stats)
+	}
+}
+
+func TestContextCacheKeyNormalizesQuery(t *testing.T) {
+	a := cacheKey("When is  game night?", "g1", "c1", "", "v1", "", 5, database.TimeRange{})
+	b := cacheKey("  when IS game\tnight? ", "g1", "c1", "", "v1", "", 5, database.TimeRange{})
+	if a != b {
+		t.Errorf("keys differ for the same normalized query: %q, %q", a, b)
+	}
+
+	other := cacheKey("When is game night?", "g2", "c1", "", "v1", "", 5, database.TimeRange{})
+	if a == other {
+		t.Error("keys for different guilds are equal")
+	}
+}
+
+func TestContextCacheExpires(t *testing.T) {
+	cache := newContextCache(10 * time.Millisecond)
+	cache.set("g1:key", RetrievedContext{Text: "context"})
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.get("g1:key"); ok {
+		t.Error("expired entry returned a hit")
+	}
+	if stats := cache.stats(); stats.Entries != 0 {
+		t.Errorf("expired entry still counted: %+v", stats)
+	}
+}
+
+func TestContextCacheDisabled(t *testing.T) {
+	cache := newContextCache(0)
+	cache.set("g1:key", RetrievedContext{Text: "context"})
+
+	if _, ok := cache.get("g1:key"); ok {
+		t.Error("disabled cache returned a hit")
+	}
+	if stats := cache.stats(); stats.Entries != 0 || stats.Misses != 0 {
+		t.Errorf("disabled cache recorded activity: %+v", stats)
+	}
+}
+
+func TestContextCacheInvalidateGuild(t *testing.T) {
+	cache := newContextCache(time.Minute)
+	cache.set(cacheKey("q", "g1", "c1", "", "v1", "", 5, database.TimeRange{}), RetrievedContext{Text: "one"})
+	cache.set(cacheKey("q", "g10", "c1", "", "v1", "", 5, database.TimeRange{}), RetrievedContext{Text: "ten"})
+
+	cache.invalidateGuild("g1")
+
+	if _, ok := cache.get(cacheKey("q", "g1", "c1", "", "v1", "", 5, database.TimeRange{})); ok {
+		t.Error("invalidated guild's entry still cached")
+	}
+	if _, ok := cache.get(cacheKey("q", "g10", "c1", "", "v1", "", 5, database.TimeRange{})); !ok {
+		t.Error("entry of a guild whose ID shares the prefix was dropped")
+	}
+}
+
+func TestContextCacheKeyTimeRange(t *testing.T) {
+	ranges := []database.TimeRange{
+		{},
+		{Since: baseTime},
+		{Since: baseTime.AddDate(0, 0, -6)},
+		{Since: baseTime, Until: baseTime.Add(time.Hour)},
+	}
+	keys := make(map[string]bool)
+	for _, timeRange := range ranges {
+		keys[cacheKey("game night", "g1", "c1", "", "v1", "", 5, timeRange)] = true
+	}
+	if len(keys) != len(ranges) {
+		t.Errorf("cache keys for different time ranges collide: %v", keys)
+	}
+}
@@ -0,0 +1,150 @@
+// internal/rag/embedcache.go
+package rag
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// embeddingEntryOverhead approximates the bookkeeping memory of an entry
+// beyond its key and vector: list element, map slot and slice header
+const embeddingEntryOverhead = 128
+
+// embeddingCache remembers query embeddings so repeated questions skip the
+// embeddings API. It is bounded by an entry count and an approximate
+// memory budget (a 1536-dimension vector is about 6KB), evicting the least
+// recently used entries when either is exceeded. Entries idle for longer
+// than idleTTL are dropped as well.
+type embeddingCache struct {
+	maxEntries int
+	maxBytes   int64
+	idleTTL    time.Duration
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	bytes   int64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type embeddingCacheEntry struct {
+	key       string
+	embedding []float32
+	size      int64
+	usedAt    time.Time
+}
+
+// EmbeddingCacheStats reports the query embedding cache's size and
+// effectiveness
+type EmbeddingCacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	// Bytes is the approximate memory held by the entries
+	Bytes int64
+}
+
+// newEmbeddingCache returns a cache holding at most maxEntries embeddings
+// in about maxBytes. A zero maxEntries disables it; zero maxBytes or
+// idleTTL leaves that bound off.
+func newEmbeddingCache(maxEntries int, maxBytes int64, idleTTL time.Duration) *embeddingCache {
+	return &embeddingCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		idleTTL:    idleTTL,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func embeddingEntrySize(key string, embedding []float32) int64 {
+	return int64(len(key)) + 4*int64(len(embedding)) + embeddingEntryOverhead
+}
+
+// get returns a copy of the cached embedding for key, so callers can't
+// alter the cached vector
+func (c *embeddingCache) get(key string, now time.Time) ([]float32, bool) {
+	if c.maxEntries <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok && c.idle(elem.Value.(*embeddingCacheEntry), now) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	entry := elem.Value.(*embeddingCacheEntry)
+	entry.usedAt = now
+	c.order.MoveToFront(elem)
+	return append([]float32(nil), entry.embedding...), true
+}
+
+func (c *embeddingCache) set(key string, embedding []float32, now time.Time) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	entry := &embeddingCacheEntry{
+		key:       key,
+		embedding: append([]float32(nil), embedding...),
+		size:      embeddingEntrySize(key, embedding),
+		usedAt:    now,
+	}
+	if c.maxBytes > 0 && entry.size > c.maxBytes {
+		return // Would evict everything and still not fit
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += entry.size
+
+	// Least recently used entries are at the back, so idle ones are too
+	for back := c.order.Back(); back != nil && c.idle(back.Value.(*embeddingCacheEntry), now); back = c.order.Back() {
+		c.remove(back)
+	}
+	for c.order.Len() > c.maxEntries || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *embeddingCache) idle(entry *embeddingCacheEntry, now time.Time) bool {
+	return c.idleTTL > 0 && now.Sub(entry.usedAt) > c.idleTTL
+}
+
+// remove drops an entry; the caller holds mu
+func (c *embeddingCache) remove(elem *list.Element) {
+	entry := elem.Value.(*embeddingCacheEntry)
+	c.order.Remove(elem)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *embeddingCache) stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return EmbeddingCacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: c.order.Len(),
+		Bytes:   c.bytes,
+	}
+}
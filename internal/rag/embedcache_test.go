@@ -0,0 +1,152 @@
+package rag
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func testVector(value float32) []float32 {
+	return []float32{value, value, value, value}
+}
+
+// cachedKeys reports which of keys are still cached, without counting as
+// uses or being dropped as idle
+func cachedKeys(c *embeddingCache, keys ...string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var cached []string
+	for _, key := range keys {
+		if _, ok := c.entries[key]; ok {
+			cached = append(cached, key)
+		}
+	}
+	return cached
+}
+
+func TestEmbeddingCacheEvictsByCount(t *testing.T) {
+	cache := newEmbeddingCache(3, 0, 0)
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		cache.set(key, testVector(1), now)
+	}
+
+	// Using a makes b the least recently used
+	if _, ok := cache.get("a", now); !ok {
+		t.Fatal("a not cached")
+	}
+	cache.set("d", testVector(1), now)
+
+	if got := cachedKeys(cache, "a", "b", "c", "d"); !slices.Equal(got, []string{"a", "c", "d"}) {
+		t.Errorf("cached %v, want b evicted as least recently used", got)
+	}
+	if stats := cache.stats(); stats.Entries != 3 {
+		t.Errorf("%d entries, want 3", stats.Entries)
+	}
+}
+
+func TestEmbeddingCacheEvictsByMemory(t *testing.T) {
+	size := embeddingEntrySize("a", testVector(1))
+	cache := newEmbeddingCache(100, 2*size, 0)
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		cache.set(key, testVector(1), now)
+	}
+
+	if got := cachedKeys(cache, "a", "b", "c"); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("cached %v, want the oldest evicted to stay within memory", got)
+	}
+	if stats := cache.stats(); stats.Bytes != 2*size {
+		t.Errorf("%d bytes counted, want %d", stats.Bytes, 2*size)
+	}
+
+	// An entry larger than the whole budget isn't cached, and evicts nothing
+	cache.set("huge", make([]float32, 1000), now)
+	if got := cachedKeys(cache, "b", "c", "huge"); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("cached %v after an oversized entry, want [b c]", got)
+	}
+}
+
+func TestEmbeddingCacheReplacesEntry(t *testing.T) {
+	cache := newEmbeddingCache(10, 0, 0)
+	now := time.Now()
+	cache.set("a", testVector(1), now)
+	cache.set("a", testVector(2), now)
+
+	embedding, ok := cache.get("a", now)
+	if !ok || embedding[0] != 2 {
+		t.Errorf("get = %v, %v; want the newer embedding", embedding, ok)
+	}
+	if stats := cache.stats(); stats.Entries != 1 || stats.Bytes != embeddingEntrySize("a", testVector(2)) {
+		t.Errorf("stats = %+v, want one entry counted once", stats)
+	}
+}
+
+func TestEmbeddingCacheIdleTTL(t *testing.T) {
+	cache := newEmbeddingCache(10, 0, time.Minute)
+	now := time.Now()
+	cache.set("a", testVector(1), now)
+	cache.set("b", testVector(1), now)
+
+	// Being used keeps a fresh
+	if _, ok := cache.get("a", now.Add(50*time.Second)); !ok {
+		t.Fatal("a dropped before going idle")
+	}
+	if _, ok := cache.get("b", now.Add(61*time.Second)); ok {
+		t.Error("b returned after idling past the TTL")
+	}
+	if _, ok := cache.get("a", now.Add(100*time.Second)); !ok {
+		t.Error("a dropped though it was used within the TTL")
+	}
+
+	// Idle entries are also swept when adding
+	cache.set("c", testVector(1), now.Add(200*time.Second))
+	if got := cachedKeys(cache, "a", "b", "c"); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("cached %v, want idle entries swept", got)
+	}
+}
+
+func TestEmbeddingCacheReturnsCopies(t *testing.T) {
+	cache := newEmbeddingCache(10, 0, 0)
+	now := time.Now()
+	embedding := testVector(1)
+	cache.set("a", embedding, now)
+	embedding[0] = 9
+
+	got, _ := cache.get("a", now)
+	if got[0] != 1 {
+		t.Fatal("changing the stored slice changed the cached embedding")
+	}
+	got[0] = 9
+	if again, _ := cache.get("a", now); again[0] != 1 {
+		t.Error("changing a returned embedding changed the cached one")
+	}
+}
+
+func TestEmbeddingCacheStats(t *testing.T) {
+	cache := newEmbeddingCache(10, 0, 0)
+	now := time.Now()
+	cache.get("a", now)
+	cache.set("a", testVector(1), now)
+	cache.get("a", now)
+	cache.get("a", now)
+
+	stats := cache.stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("stats = %+v, want 2 hits, 1 miss, 1 entry", stats)
+	}
+}
+
+func TestEmbeddingCacheDisabled(t *testing.T) {
+	cache := newEmbeddingCache(0, 0, 0)
+	now := time.Now()
+	cache.set("a", testVector(1), now)
+
+	if _, ok := cache.get("a", now); ok {
+		t.Error("disabled cache returned a hit")
+	}
+	if stats := cache.stats(); stats.Entries != 0 || stats.Misses != 0 {
+		t.Errorf("disabled cache recorded activity: %+v", stats)
+	}
+}
@@ -0,0 +1,78 @@
+// internal/rag/explain.go
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"math"
+)
+
+// RetrievalExplanation breaks down how the context for a question was
+// built, for debugging answers
+type RetrievalExplanation struct {
+	Mode    string
+	Version string
+	// EmbeddingNorm is the query embedding's L2 norm; zero when the mode
+	// didn't embed the question
+	EmbeddingNorm float64
+	// MaxDistance is the configured distance threshold, zero if none
+	MaxDistance float64
+	// Matches are the similarity search results, most similar first
+	Matches []RetrievalMatch
+	// Recent are the recent messages included
+	Recent []models.DiscordMessage
+	// Interactions is how many previous answers were included
+	Interactions int
+	// Context is the context the model would see
+	Context string
+}
+
+// RetrievalMatch is one similarity search result
+type RetrievalMatch struct {
+	Message  models.DiscordMessage
+	Distance float64
+	// Passed reports whether the match was within the distance threshold
+	// and so used in the context
+	Passed bool
+}
+
+// ExplainRetrieval runs retrieval for a question like
+// SearchRelevantContext, bypassing the cache, and reports the scoring
+// behind the context
+func (r *RAGRetriever) ExplainRetrieval(ctx context.Context, query, guildID, channelID, categoryID string, limit int) (*RetrievalExplanation, error) {
+	ctx = ai.WithGuildID(ctx, guildID)
+	version := r.EmbeddingVersion(guildID)
+
+	found, err := r.retrieve(ctx, query, guildID, channelID, version, r.categoryScope(categoryID), limit, database.TimeRange{})
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &RetrievalExplanation{
+		Mode:          r.cfg.RetrievalMode,
+		Version:       version,
+		EmbeddingNorm: vectorNorm(found.embedding),
+		MaxDistance:   r.cfg.MaxDistance,
+		Recent:        found.recent,
+		Interactions:  len(found.interactions),
+		Context:       formatContext(found.similar, found.recent, found.interactions, r.authorNamer(r.AuthorNames(guildID), guildID), r.prompts).Text,
+	}
+	for _, msg := range found.candidates {
+		explanation.Matches = append(explanation.Matches, RetrievalMatch{
+			Message:  msg,
+			Distance: msg.Distance,
+			Passed:   r.withinDistance(msg),
+		})
+	}
+	return explanation, nil
+}
+
+func vectorNorm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,75 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainRetrieval(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{RetrievalMode: "hybrid", RecentMessages: 1, MaxDistance: 0.5, ContextCacheTTL: time.Minute})
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "game night is on friday", 0),
+		testMessage("m2", "g1", "v1", "lunch plans for game day", 1),
+		testMessage("m3", "g1", "v1", "see you all", 2),
+	)
+
+	e, err := r.ExplainRetrieval(context.Background(), "when is game night on friday", "g1", "c1", "", 5)
+	if err != nil {
+		t.Fatalf("ExplainRetrieval: %v", err)
+	}
+	if e.Mode != "hybrid" || e.Version != "v1" || e.MaxDistance != 0.5 {
+		t.Errorf("explanation = mode %q, version %q, threshold %v, want hybrid, v1 and 0.5", e.Mode, e.Version, e.MaxDistance)
+	}
+	if want := vectorNorm(bagOfWords("when is game night on friday")); math.Abs(e.EmbeddingNorm-want) > 1e-9 || want == 0 {
+		t.Errorf("EmbeddingNorm = %v, want %v", e.EmbeddingNorm, want)
+	}
+
+	var ids []string
+	var passed []bool
+	for i, match := range e.Matches {
+		ids = append(ids, match.Message.MessageID)
+		passed = append(passed, match.Passed)
+		if match.Passed != (match.Distance <= 0.5) {
+			t.Errorf("%s at distance %v: passed = %v with a 0.5 threshold", match.Message.MessageID, match.Distance, match.Passed)
+		}
+		if i > 0 && match.Distance < e.Matches[i-1].Distance {
+			t.Errorf("matches out of order: %v before %v", e.Matches[i-1].Distance, match.Distance)
+		}
+	}
+	if !slices.Equal(ids, []string{"m1", "m2", "m3"}) || !slices.Equal(passed, []bool{true, false, false}) {
+		t.Errorf("matches = %v passing %v, want every message with only m1 passing", ids, passed)
+	}
+	if recent := messageIDs(e.Recent); !slices.Equal(recent, []string{"m3"}) {
+		t.Errorf("recent = %v, want [m3]", recent)
+	}
+	if !strings.Contains(e.Context, "game night is on friday") || strings.Contains(e.Context, "lunch plans") {
+		t.Errorf("context = %q, want only the passing match and recent activity", e.Context)
+	}
+
+	// Explanations are always computed fresh
+	if _, ok := r.cache.get(cacheKey("when is game night on friday", "g1", "c1", "", "v1", AuthorNamesReal, 5, database.TimeRange{})); ok {
+		t.Error("ExplainRetrieval cached its context")
+	}
+}
+
+func TestExplainRetrievalRecentMode(t *testing.T) {
+	r, store, fake, _ := newTestRetriever(t, config.RAGConfig{RetrievalMode: retrievalRecent})
+	upsertAll(t, store, testMessage("m1", "g1", "v1", "game night is on friday", 0))
+
+	e, err := r.ExplainRetrieval(context.Background(), "when is game night", "g1", "c1", "", 5)
+	if err != nil {
+		t.Fatalf("ExplainRetrieval: %v", err)
+	}
+	if requests, _ := fake.embedded(); e.EmbeddingNorm != 0 || len(e.Matches) != 0 || requests != 0 {
+		t.Errorf("recent-only explanation has norm %v and %d matches after %d embedding requests, want none", e.EmbeddingNorm, len(e.Matches), requests)
+	}
+	if recent := messageIDs(e.Recent); !slices.Equal(recent, []string{"m1"}) {
+		t.Errorf("recent = %v, want [m1]", recent)
+	}
+}
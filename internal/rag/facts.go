@@ -0,0 +1,100 @@
+// internal/rag/facts.go
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"log"
+)
+
+// factsEnabled reports whether facts added by admins are searched and
+// ranked on their own rather than like any other message
+func (r *RAGRetriever) factsEnabled() bool {
+	return r.cfg.MaxFacts > 0 && (r.cfg.FactBoost > 0 || r.cfg.FactDistance > 0)
+}
+
+// pinnedFact reports whether msg is a fact close enough to the question to
+// be used whatever else was found
+func (r *RAGRetriever) pinnedFact(msg models.DiscordMessage) bool {
+	return msg.IsFact && r.factsEnabled() && r.cfg.FactDistance > 0 && msg.Distance <= r.cfg.FactDistance
+}
+
+// withFacts replaces the facts among the similar messages with the
+// closest MaxFacts facts overall, ranked among the messages as if they
+// were FactBoost closer. Facts within FactDistance are kept even if they
+// rank past the limit, at the expense of the lowest ranked messages. If
+// facts can't be searched, the messages are returned unchanged.
+func (r *RAGRetriever) withFacts(ctx context.Context, embedding []float32, guildID, version string, similar []models.DiscordMessage, limit int) []models.DiscordMessage {
+	if !r.factsEnabled() || embedding == nil {
+		return similar
+	}
+
+	found, err := r.store.SearchFacts(ctx, embedding, guildID, version, min(r.cfg.MaxFacts, limit))
+	if err != nil {
+		log.Printf("Error searching facts: %v", err)
+		return similar
+	}
+
+	var facts, messages []models.DiscordMessage
+	for _, msg := range found {
+		if r.withinDistance(msg) {
+			facts = append(facts, msg)
+		}
+	}
+	for _, msg := range similar {
+		if !msg.IsFact {
+			messages = append(messages, msg)
+		}
+	}
+	return r.mergeFacts(messages, facts, limit)
+}
+
+// mergeFacts interleaves facts, closest first, into messages, which keep
+// their order, and keeps the first limit. A fact goes before the next
+// message if its boosted distance is smaller.
+func (r *RAGRetriever) mergeFacts(messages, facts []models.DiscordMessage, limit int) []models.DiscordMessage {
+	merged := make([]models.DiscordMessage, 0, len(messages)+len(facts))
+	pinned := 0
+	for len(messages) > 0 || len(facts) > 0 {
+		if len(facts) > 0 && (len(messages) == 0 || facts[0].Distance*(1-r.cfg.FactBoost) < messages[0].Distance) {
+			if r.pinnedFact(facts[0]) {
+				pinned++
+			}
+			merged = append(merged, facts[0])
+			facts = facts[1:]
+		} else {
+			merged = append(merged, messages[0])
+			messages = messages[1:]
+		}
+	}
+
+	// Hold slots for the pinned facts that haven't been reached yet
+	kept := make([]models.DiscordMessage, 0, min(limit, len(merged)))
+	for _, msg := range merged {
+		switch {
+		case r.pinnedFact(msg):
+			kept = append(kept, msg)
+			pinned--
+		case len(kept)+pinned < limit:
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// ListFacts returns the guild's facts stored under the write embedding
+// version, oldest first
+func (r *RAGRetriever) ListFacts(ctx context.Context, guildID string) ([]models.DiscordMessage, error) {
+	return r.store.ListFacts(ctx, guildID, r.WriteEmbeddingVersion())
+}
+
+// DeleteFact removes a guild's fact, reporting whether there was one.
+// Cached contexts for the guild are dropped so the fact isn't served from
+// them until they expire.
+func (r *RAGRetriever) DeleteFact(ctx context.Context, guildID, messageID string) (bool, error) {
+	deleted, err := r.store.DeleteFact(ctx, guildID, messageID)
+	if deleted {
+		r.cache.invalidateGuild(guildID)
+	}
+	return deleted, err
+}
@@ -0,0 +1,204 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"slices"
+	"testing"
+)
+
+// testFact returns an embedded fact added minutes after baseTime
+func testFact(id, guildID, version, content string, minutes int) *models.DiscordMessage {
+	fact := testMessage(id, guildID, version, content, minutes)
+	fact.IsFact = true
+	return fact
+}
+
+func TestFactLifecycle(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{})
+	ctx := context.Background()
+
+	fact := &models.DiscordMessage{MessageID: "fact:1", GuildID: "g1", Content: "game nights are on fridays", Timestamp: baseTime, IsFact: true}
+	if err := r.StoreMessageWithEmbedding(ctx, fact); err != nil {
+		t.Fatalf("storing fact: %v", err)
+	}
+	upsertAll(t, store, testMessage("m1", "g1", "v1", "see you friday", 1))
+
+	facts, err := r.ListFacts(ctx, "g1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facts) != 1 || facts[0].MessageID != "fact:1" || facts[0].Embedding == nil {
+		t.Fatalf("ListFacts = %+v, want the embedded fact alone", facts)
+	}
+
+	// A real message can't be deleted as a fact
+	if deleted, err := r.DeleteFact(ctx, "g1", "m1"); err != nil || deleted {
+		t.Errorf("DeleteFact of a message = %v, %v; want nothing deleted", deleted, err)
+	}
+	// Nor can another guild's fact
+	if deleted, err := r.DeleteFact(ctx, "g2", "fact:1"); err != nil || deleted {
+		t.Errorf("DeleteFact from another guild = %v, %v; want nothing deleted", deleted, err)
+	}
+
+	key := cacheKey("when is game night?", "g1", "c1", "", "v1", "", 5, database.TimeRange{})
+	r.cache.set(key, RetrievedContext{Text: "game nights are on fridays"})
+	if deleted, err := r.DeleteFact(ctx, "g1", "fact:1"); err != nil || !deleted {
+		t.Fatalf("DeleteFact = %v, %v; want the fact deleted", deleted, err)
+	}
+	if _, ok := r.cache.get(key); ok {
+		t.Error("context built with the deleted fact still cached")
+	}
+
+	if got := storedIDs(t, store, "g1", "v1"); !slices.Equal(got, []string{"m1"}) {
+		t.Errorf("stored %v after deleting the fact, want [m1]", got)
+	}
+	if deleted, _ := r.DeleteFact(ctx, "g1", "fact:1"); deleted {
+		t.Error("deleting the fact again reported a deletion")
+	}
+}
+
+func TestMemoryStoreListFacts(t *testing.T) {
+	store := NewMemoryStore()
+	upsertAll(t, store,
+		testFact("fact:2", "g1", "v1", "second", 2),
+		testFact("fact:1", "g1", "v1", "first", 1),
+		testFact("fact:1", "g1", "v2", "first", 1),
+		testFact("fact:3", "g2", "v1", "other guild", 0),
+		testMessage("m1", "g1", "v1", "not a fact", 0),
+	)
+
+	facts, err := store.ListFacts(context.Background(), "g1", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, fact := range facts {
+		ids = append(ids, fact.MessageID)
+	}
+	if !slices.Equal(ids, []string{"fact:1", "fact:2"}) {
+		t.Errorf("ListFacts = %v, want the guild's facts under v1, oldest first", ids)
+	}
+
+	// Deleting removes the fact under every version
+	if deleted, err := store.DeleteFact(context.Background(), "g1", "fact:1"); err != nil || !deleted {
+		t.Fatalf("DeleteFact = %v, %v", deleted, err)
+	}
+	if got := storedIDs(t, store, "g1", "v2"); len(got) != 0 {
+		t.Errorf("v2 still holds %v", got)
+	}
+}
+
+// ranked returns messages, or facts if their IDs start with "f", at the
+// given distances
+func ranked(distances map[string]float64, ids ...string) []models.DiscordMessage {
+	messages := make([]models.DiscordMessage, len(ids))
+	for i, id := range ids {
+		messages[i] = models.DiscordMessage{MessageID: id, Distance: distances[id], IsFact: id[0] == 'f'}
+	}
+	return messages
+}
+
+func messageIDs(messages []models.DiscordMessage) []string {
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.MessageID
+	}
+	return ids
+}
+
+func TestMergeFacts(t *testing.T) {
+	distances := map[string]float64{"m1": 0.1, "m2": 0.2, "m3": 0.3, "m5": 0.5, "f3": 0.3, "f35": 0.35, "f5": 0.5}
+	tests := []struct {
+		name     string
+		cfg      config.RAGConfig
+		messages []string
+		facts    []string
+		limit    int
+		want     []string
+	}{
+		{
+			name:     "boost ranks a fact ahead of closer messages",
+			cfg:      config.RAGConfig{FactBoost: 0.5, MaxFacts: 2},
+			messages: []string{"m1", "m2", "m3"},
+			facts:    []string{"f35"},
+			limit:    3,
+			want:     []string{"m1", "f35", "m2"},
+		},
+		{
+			name:     "without a boost a tie goes to the message",
+			cfg:      config.RAGConfig{FactDistance: 0.1, MaxFacts: 2},
+			messages: []string{"m1", "m3", "m5"},
+			facts:    []string{"f3"},
+			limit:    3,
+			want:     []string{"m1", "m3", "f3"},
+		},
+		{
+			name:     "facts ranked past the limit are dropped",
+			cfg:      config.RAGConfig{FactBoost: 0.2, MaxFacts: 2},
+			messages: []string{"m1", "m2", "m3"},
+			facts:    []string{"f5"},
+			limit:    3,
+			want:     []string{"m1", "m2", "m3"},
+		},
+		{
+			name:     "a fact within FactDistance is kept past the limit",
+			cfg:      config.RAGConfig{FactBoost: 0.2, FactDistance: 0.4, MaxFacts: 2},
+			messages: []string{"m1", "m2", "m3"},
+			facts:    []string{"f35"},
+			limit:    3,
+			want:     []string{"m1", "m2", "f35"},
+		},
+		{
+			name:     "pinned facts displace the lowest ranked messages",
+			cfg:      config.RAGConfig{FactBoost: 0.2, FactDistance: 0.4, MaxFacts: 2},
+			messages: []string{"m1", "m2"},
+			facts:    []string{"f3", "f5"},
+			limit:    2,
+			want:     []string{"m1", "f3"},
+		},
+		{
+			name:     "fewer results than the limit",
+			cfg:      config.RAGConfig{FactBoost: 0.2, MaxFacts: 2},
+			messages: []string{"m2"},
+			facts:    []string{"f3"},
+			limit:    5,
+			want:     []string{"m2", "f3"},
+		},
+	}
+	for _, tt := range tests {
+		r := &RAGRetriever{cfg: tt.cfg}
+		got := r.mergeFacts(ranked(distances, tt.messages...), ranked(distances, tt.facts...), tt.limit)
+		if ids := messageIDs(got); !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: merged %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
+
+func TestWithFactsReplacesFacts(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{FactBoost: 0.2, MaxFacts: 1})
+	upsertAll(t, store,
+		testFact("fact:near", "g1", "v1", "game nights are on fridays", 0),
+		testFact("fact:far", "g1", "v1", "the wiki lists every rule", 0),
+	)
+
+	// The similarity search found the farther fact; it is swapped for the
+	// closest one, and only MaxFacts are used
+	similar := []models.DiscordMessage{
+		{MessageID: "m1", Distance: 0.1},
+		{MessageID: "fact:far", Distance: 0.9, IsFact: true},
+	}
+	got := r.withFacts(context.Background(), bagOfWords("when are game nights"), "g1", "v1", similar, 5)
+	if ids := messageIDs(got); !slices.Equal(ids, []string{"m1", "fact:near"}) {
+		t.Errorf("withFacts = %v, want [m1 fact:near]", ids)
+	}
+
+	// With facts ranked like messages, the search results stand
+	r.cfg.MaxFacts = 0
+	got = r.withFacts(context.Background(), bagOfWords("when are game nights"), "g1", "v1", similar, 5)
+	if ids := messageIDs(got); !slices.Equal(ids, []string{"m1", "fact:far"}) {
+		t.Errorf("withFacts with facts disabled = %v, want the search results", ids)
+	}
+}
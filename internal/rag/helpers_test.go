@@ -0,0 +1,276 @@
+package rag
+
+import (
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeOpenAI serves the embeddings and chat completions endpoints. Each
+// text's embedding is its bag of words hashed into EmbeddingDimensions, so
+// texts sharing words are close. Embedding requests fail while failures is
+// positive, counting it down, and chat completions fail as too long while
+// tooLong is. With hang set, requests wait until the client gives up.
+type fakeOpenAI struct {
+	mu       sync.Mutex
+	requests int
+	texts    int
+	failures int
+	tooLong  int
+	hang     bool
+	// systems and prompts are the system and user prompts of chat
+	// completion requests
+	systems []string
+	prompts []string
+}
+
+func (f *fakeOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	hang := f.hang
+	f.mu.Unlock()
+	if hang {
+		// The server only notices the client leaving once the body is read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/embeddings"):
+		f.serveEmbeddings(w, r)
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		f.serveChat(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeOpenAI) serveEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input []string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.requests++
+	fail := f.failures > 0
+	if fail {
+		f.failures--
+	} else {
+		f.texts += len(req.Input)
+	}
+	f.mu.Unlock()
+
+	if fail {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "simulated failure", "type": "invalid_request_error"}}`))
+		return
+	}
+
+	resp := openai.EmbeddingResponse{Object: "list", Model: openai.AdaEmbeddingV2}
+	for i, text := range req.Input {
+		resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: bagOfWords(text)})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// serveChat answers every chat completion with "answer"
+func (f *fakeOpenAI) serveChat(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case openai.ChatMessageRoleSystem:
+			f.systems = append(f.systems, msg.Content)
+		case openai.ChatMessageRoleUser:
+			f.prompts = append(f.prompts, msg.Content)
+		}
+	}
+	tooLong := f.tooLong > 0
+	if tooLong {
+		f.tooLong--
+	}
+	f.mu.Unlock()
+
+	if tooLong {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "maximum context length exceeded", "type": "invalid_request_error", "code": "context_length_exceeded"}}`))
+		return
+	}
+
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Object:  "chat.completion",
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "answer"}}},
+	})
+}
+
+// failNext makes the next n embedding requests fail
+func (f *fakeOpenAI) failNext(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = n
+}
+
+// hangRequests makes requests wait until the client gives up
+func (f *fakeOpenAI) hangRequests() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hang = true
+}
+
+// userPrompts returns the user prompts of the chat completions requested
+func (f *fakeOpenAI) userPrompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.prompts...)
+}
+
+// systemPrompts returns the system prompts of the chat completions requested
+func (f *fakeOpenAI) systemPrompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.systems...)
+}
+
+// embedded returns how many requests were made and texts embedded
+func (f *fakeOpenAI) embedded() (requests, texts int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests, f.texts
+}
+
+func bagOfWords(text string) []float32 {
+	embedding := make([]float32, database.EmbeddingDimensions)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		h := fnv.New32a()
+		h.Write([]byte(strings.Trim(word, ".,!?")))
+		embedding[h.Sum32()%database.EmbeddingDimensions]++
+	}
+	return embedding
+}
+
+// newTestAI returns an AI service backed by a fakeOpenAI
+func newTestAI(t *testing.T, cfg config.AIConfig) (*ai.AIService, *fakeOpenAI) {
+	t.Helper()
+
+	if cfg.ChatModel == "" {
+		cfg.ChatModel = openai.GPT4oMini
+	}
+	if cfg.TTSFormat == "" {
+		cfg.TTSFormat = string(ai.AudioFormatMP3)
+	}
+
+	fake := &fakeOpenAI{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	clientConfig := openai.DefaultConfig("test-key")
+	clientConfig.BaseURL = server.URL + "/v1"
+	return ai.NewAIServiceWithClientConfig(clientConfig, cfg), fake
+}
+
+// openTestDB connects to the Postgres database named by the TEST_DB_*
+// variables, skipping the test if TEST_DB_HOST isn't set
+func openTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	host := os.Getenv("TEST_DB_HOST")
+	if host == "" {
+		t.Skip("TEST_DB_HOST not set")
+	}
+	port, err := strconv.Atoi(os.Getenv("TEST_DB_PORT"))
+	if err != nil {
+		port = 5432
+	}
+
+	db, err := database.NewDB(host, os.Getenv("TEST_DB_USER"), os.Getenv("TEST_DB_PASSWORD"), os.Getenv("TEST_DB_NAME"), port)
+	if err != nil {
+		t.Fatalf("connecting to test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// testGuild returns a guild ID no other test run uses, whose data is
+// purged when the test ends
+func testGuild(t *testing.T, db *database.DB) string {
+	t.Helper()
+
+	guildID := fmt.Sprintf("test-%s-%d", t.Name(), time.Now().UnixNano())
+	t.Cleanup(func() {
+		if err := db.PurgeGuild(guildID); err != nil {
+			t.Errorf("purging %s: %v", guildID, err)
+		}
+	})
+	return guildID
+}
+
+// memorySettings keeps guild settings in memory, counting loads and saves
+type memorySettings struct {
+	mu       sync.Mutex
+	settings map[string]models.GuildSettings
+	loads    int
+	saves    int
+}
+
+func newMemorySettings() *memorySettings {
+	return &memorySettings{settings: make(map[string]models.GuildSettings)}
+}
+
+func (m *memorySettings) GetGuildSettings(guildID string) (*models.GuildSettings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loads++
+	settings, ok := m.settings[guildID]
+	if !ok {
+		settings = models.GuildSettings{GuildID: guildID}
+	}
+	return &settings, nil
+}
+
+func (m *memorySettings) SaveGuildSettings(settings *models.GuildSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.saves++
+	m.settings[settings.GuildID] = *settings
+	return nil
+}
+
+// counts returns how many times settings were loaded and saved
+func (m *memorySettings) counts() (loads, saves int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loads, m.saves
+}
@@ -0,0 +1,53 @@
+// internal/rag/metrics.go
+package rag
+
+import (
+	"discord-rag-bot/internal/models"
+	"expvar"
+	"log"
+)
+
+// retrievalMetrics are published under "retrieval" in /debug/vars. The
+// mean distance over time is distance_sum / results.
+var retrievalMetrics = expvar.NewMap("retrieval")
+
+// distanceSummary describes how close a search's results were to the query
+type distanceSummary struct {
+	Min, Max, Mean float64
+}
+
+// summarizeDistances reports the spread of the results' distances; ok is
+// false when there were no results
+func summarizeDistances(messages []models.DiscordMessage) (summary distanceSummary, ok bool) {
+	if len(messages) == 0 {
+		return distanceSummary{}, false
+	}
+
+	summary.Min, summary.Max = messages[0].Distance, messages[0].Distance
+	var sum float64
+	for _, msg := range messages {
+		summary.Min = min(summary.Min, msg.Distance)
+		summary.Max = max(summary.Max, msg.Distance)
+		sum += msg.Distance
+	}
+	summary.Mean = sum / float64(len(messages))
+	return summary, true
+}
+
+// recordRetrieval logs and counts the quality of a search's results, so
+// operators can tune thresholds and spot guilds lacking relevant content
+func recordRetrieval(guildID string, messages []models.DiscordMessage) {
+	retrievalMetrics.Add("queries", 1)
+
+	summary, ok := summarizeDistances(messages)
+	if !ok {
+		retrievalMetrics.Add("empty_results", 1)
+		log.Printf("Retrieval in guild %s found no messages", guildID)
+		return
+	}
+
+	retrievalMetrics.Add("results", int64(len(messages)))
+	retrievalMetrics.AddFloat("distance_sum", summary.Mean*float64(len(messages)))
+	log.Printf("Retrieval in guild %s: %d messages, distance min %.3f / mean %.3f / max %.3f",
+		guildID, len(messages), summary.Min, summary.Mean, summary.Max)
+}
@@ -0,0 +1,89 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"expvar"
+	"math"
+	"testing"
+)
+
+func TestSummarizeDistances(t *testing.T) {
+	if _, ok := summarizeDistances(nil); ok {
+		t.Error("summarizeDistances of no results succeeded")
+	}
+
+	summary, ok := summarizeDistances([]models.DiscordMessage{{Distance: 0.4}, {Distance: 0.1}, {Distance: 0.7}})
+	want := distanceSummary{Min: 0.1, Max: 0.7, Mean: 0.4}
+	if !ok || math.Abs(summary.Min-want.Min) > 1e-9 || math.Abs(summary.Max-want.Max) > 1e-9 || math.Abs(summary.Mean-want.Mean) > 1e-9 {
+		t.Errorf("summarizeDistances = %+v, %v, want %+v", summary, ok, want)
+	}
+}
+
+// metricValue reads one of the retrieval counters
+func metricValue(name string) float64 {
+	switch v := retrievalMetrics.Get(name).(type) {
+	case *expvar.Int:
+		return float64(v.Value())
+	case *expvar.Float:
+		return v.Value()
+	}
+	return 0
+}
+
+func TestRecordRetrieval(t *testing.T) {
+	queries, empty, results, sum := metricValue("queries"), metricValue("empty_results"), metricValue("results"), metricValue("distance_sum")
+
+	recordRetrieval("g1", []models.DiscordMessage{{Distance: 0.25}, {Distance: 0.5}})
+	recordRetrieval("g1", nil)
+
+	if got := metricValue("queries") - queries; got != 2 {
+		t.Errorf("queries went up by %v, want 2", got)
+	}
+	if got := metricValue("empty_results") - empty; got != 1 {
+		t.Errorf("empty_results went up by %v, want 1", got)
+	}
+	if got := metricValue("results") - results; got != 2 {
+		t.Errorf("results went up by %v, want 2", got)
+	}
+	if got := metricValue("distance_sum") - sum; math.Abs(got-0.75) > 1e-9 {
+		t.Errorf("distance_sum went up by %v, want 0.75", got)
+	}
+}
+
+// Cosine distances run from 0 for the same direction to 2 for the
+// opposite one, and the search reports them unchanged
+func TestSearchDistanceBounds(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{})
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "when is game night", 0),
+		testMessage("m2", "g1", "v1", "game night is friday", 1),
+		testMessage("m3", "g1", "v1", "unrelated lunch plans", 2),
+	)
+	opposite := testMessage("m4", "g1", "v1", "", 3)
+	negated := bagOfWords("when is game night")
+	for i := range negated {
+		negated[i] = -negated[i]
+	}
+	opposite.SetEmbedding(negated)
+	upsertAll(t, store, opposite)
+
+	found, err := r.SearchContextInRange(context.Background(), "when is game night", "g1", "c1", "", 10, database.TimeRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"m1": 0, "m3": 1, "m4": 2}
+	for _, msg := range found.similar {
+		if msg.Distance < -1e-6 || msg.Distance > 2+1e-6 {
+			t.Errorf("%s has distance %v, outside [0, 2]", msg.MessageID, msg.Distance)
+		}
+		if d, ok := want[msg.MessageID]; ok && math.Abs(msg.Distance-d) > 1e-6 {
+			t.Errorf("%s has distance %v, want %v", msg.MessageID, msg.Distance, d)
+		}
+	}
+	if len(found.similar) != 4 {
+		t.Errorf("found %v, want every message", messageIDs(found.similar))
+	}
+}
@@ -0,0 +1,91 @@
+// internal/rag/preprocess.go
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/models"
+	"log"
+	"regexp"
+	"strings"
+)
+
+var (
+	codeFencePattern   = regexp.MustCompile("```[A-Za-z0-9_+-]*\\n?")
+	maskedLinkPattern  = regexp.MustCompile(`\[([^\]]+)\]\(<?(\S+?)>?\)`)
+	angleURLPattern    = regexp.MustCompile(`<(https?://[^\s>]+)>`)
+	embedURLPattern    = regexp.MustCompile(`https?://\S+`)
+	customEmojiPattern = regexp.MustCompile(`<a?(:\w+:)\d+>`)
+	linePrefixPattern  = regexp.MustCompile(`(?m)^[ \t]*(?:#{1,3}[ \t]+|-#[ \t]+|>{1,3}[ \t]?)`)
+	boldPattern        = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	underlinePattern   = regexp.MustCompile(`__(.+?)__`)
+	strikePattern      = regexp.MustCompile(`~~(.+?)~~`)
+	spoilerPattern     = regexp.MustCompile(`\|\|(.+?)\|\|`)
+	italicPattern      = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	// Underscore italics only count at word boundaries, so snake_case
+	// identifiers survive
+	underscorePattern = regexp.MustCompile(`(^|[^\w])_([^_\s](?:[^_]*[^_\s])?)_([^\w]|$)`)
+)
+
+// normalizeForEmbedding reduces Discord markdown to its plain text so the
+// embedding reflects what was said rather than how it was formatted. Code
+// keeps its content, masked links keep their text, custom emoji keep
+// their name and whitespace is collapsed. URLs are replaced with
+// urlPlaceholder unless it is empty.
+func normalizeForEmbedding(text, urlPlaceholder string) string {
+	text = codeFencePattern.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "`", "")
+	text = angleURLPattern.ReplaceAllString(text, "$1")
+	if urlPlaceholder != "" {
+		text = maskedLinkPattern.ReplaceAllString(text, "$1 "+urlPlaceholder)
+		text = embedURLPattern.ReplaceAllLiteralString(text, urlPlaceholder)
+	} else {
+		text = maskedLinkPattern.ReplaceAllString(text, "$1 $2")
+	}
+	text = customEmojiPattern.ReplaceAllString(text, "$1")
+	text = linePrefixPattern.ReplaceAllString(text, "")
+	for _, pattern := range []*regexp.Regexp{boldPattern, underlinePattern, strikePattern, spoilerPattern, italicPattern} {
+		text = pattern.ReplaceAllString(text, "$1")
+	}
+	text = underscorePattern.ReplaceAllString(text, "$1$2$3")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// summarize sets a summary on messages longer than EmbedSummarizeOver, so
+// it is embedded in place of the content. A message that is no longer long
+// loses its summary; one that fails to summarize keeps its content.
+func (r *RAGRetriever) summarize(ctx context.Context, message *models.DiscordMessage) {
+	message.Summary = ""
+	if r.cfg.EmbedSummarizeOver <= 0 || len([]rune(message.Content)) <= r.cfg.EmbedSummarizeOver {
+		return
+	}
+
+	summary, err := r.AI.Summarize(ctx, message.Content)
+	if err != nil {
+		log.Printf("Embedding message %s unsummarized: %v", message.MessageID, err)
+		return
+	}
+	message.Summary = summary
+}
+
+// embeddingSource is the text of a message that gets embedded: its summary
+// if it has one, otherwise its content
+func embeddingSource(message *models.DiscordMessage) string {
+	if message.Summary != "" {
+		return message.Summary
+	}
+	return message.Content
+}
+
+// embeddingText is the text sent to the embedding model for content,
+// preprocessed if configured
+func (r *RAGRetriever) embeddingText(content string) string {
+	if !r.cfg.EmbedPreprocess {
+		return content
+	}
+	normalized := normalizeForEmbedding(content, r.cfg.EmbedURLPlaceholder)
+	if normalized == "" {
+		// Nothing but formatting; embed it as is rather than an empty string
+		return content
+	}
+	return normalized
+}
@@ -0,0 +1,163 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeForEmbedding(t *testing.T) {
+	tests := []struct {
+		name, text, placeholder, want string
+	}{
+		{"plain text", "just some words", "", "just some words"},
+		{"whitespace", "  lots\n\nof \t space  ", "", "lots of space"},
+		{"emphasis", "**bold** __under__ ~~gone~~ ||secret|| *it*", "", "bold under gone secret it"},
+		{"underscore italics", "really _mean_ it", "", "really mean it"},
+		{"snake_case", "set max_retry_count first", "", "set max_retry_count first"},
+		{"inline code", "run `go test` now", "", "run go test now"},
+		{"code fence", "```go\nfmt.Println(1)\n```", "", "fmt.Println(1)"},
+		{"headings and quotes", "# Title\n> quoted\n-# small", "", "Title quoted small"},
+		{"custom emoji", "nice <:pog:123456> and <a:dance:789>", "", "nice :pog: and :dance:"},
+		{"URL kept", "see https://example.com/a?b=c", "", "see https://example.com/a?b=c"},
+		{"URL replaced", "see https://example.com/a?b=c now", "[link]", "see [link] now"},
+		{"suppressed embed", "see <https://example.com>", "[link]", "see [link]"},
+		{"masked link kept", "[the docs](https://example.com)", "", "the docs https://example.com"},
+		{"masked link replaced", "[the docs](<https://example.com>)", "[link]", "the docs [link]"},
+		{"only formatting", "** **", "", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeForEmbedding(tt.text, tt.placeholder); got != tt.want {
+			t.Errorf("%s: normalizeForEmbedding(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEmbeddingText(t *testing.T) {
+	tests := []struct {
+		name       string
+		preprocess bool
+		text, want string
+	}{
+		{"off", false, "**bold**  text", "**bold**  text"},
+		{"on", true, "**bold**  text", "bold text"},
+		{"nothing left", true, "** **", "** **"},
+	}
+	for _, tt := range tests {
+		r := &RAGRetriever{cfg: config.RAGConfig{EmbedPreprocess: tt.preprocess}}
+		if got := r.embeddingText(tt.text); got != tt.want {
+			t.Errorf("%s: embeddingText(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+// The preprocessed text is what gets embedded; the stored content stays
+// as it was written
+func TestPreprocessKeepsContent(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{EmbedPreprocess: true, EmbedURLPlaceholder: "[link]"})
+	content := "**Game night** is on `friday`, see https://example.com/rsvp"
+	if err := r.StoreMessageWithEmbedding(context.Background(), testMessage("m1", "g1", "", content, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Recent(context.Background(), "g1", "", "v1", -1)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("Recent = %d messages, %v, want the stored one", len(stored), err)
+	}
+	if stored[0].Content != content {
+		t.Errorf("stored content = %q, want %q", stored[0].Content, content)
+	}
+	want := bagOfWords("Game night is on friday, see [link]")
+	if !slices.Equal(stored[0].Embedding.Slice(), want) {
+		t.Error("embedding isn't of the preprocessed text")
+	}
+}
+
+// Queries are preprocessed the same way, so a formatted question matches
+// the plain message it asks about
+func TestPreprocessQuery(t *testing.T) {
+	for _, preprocess := range []bool{false, true} {
+		r, store, _, _ := newTestRetriever(t, config.RAGConfig{EmbedPreprocess: preprocess})
+		upsertAll(t, store, testMessage("m1", "g1", "v1", "deploy script", 0))
+
+		found, err := r.SearchContextInRange(context.Background(), "**deploy** `script`", "g1", "c1", "", 5, database.TimeRange{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exact := len(found.similar) == 1 && found.similar[0].Distance < 1e-6
+		if exact != preprocess {
+			t.Errorf("preprocess=%v: query matched the message exactly = %v", preprocess, exact)
+		}
+	}
+}
+
+// Only messages over the threshold, counted in characters, are summarized
+func TestSummarizeThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		content   string
+		summary   string
+	}{
+		{"disabled", 0, "a long message about game night", ""},
+		{"at the threshold", 5, "ééééé", ""},
+		{"over the threshold", 5, "éééééé", "answer"},
+	}
+	for _, tt := range tests {
+		r, _, fake, _ := newTestRetriever(t, config.RAGConfig{EmbedSummarizeOver: tt.threshold})
+		msg := testMessage("m1", "g1", "", tt.content, 0)
+		r.summarize(context.Background(), msg)
+
+		if msg.Summary != tt.summary {
+			t.Errorf("%s: summary = %q, want %q", tt.name, msg.Summary, tt.summary)
+		}
+		summarized := len(fake.userPrompts()) != 0
+		if summarized != (tt.summary != "") {
+			t.Errorf("%s: chat model called = %v", tt.name, summarized)
+		}
+	}
+}
+
+// A long message keeps its content verbatim and is embedded by its summary
+func TestSummarizeBeforeEmbed(t *testing.T) {
+	r, store, fake, _ := newTestRetriever(t, config.RAGConfig{EmbedSummarizeOver: 10})
+	content := "game night moved to friday because the venue is booked on thursday"
+	if err := r.StoreMessageWithEmbedding(context.Background(), testMessage("m1", "g1", "", content, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if prompts := fake.userPrompts(); !slices.Equal(prompts, []string{content}) {
+		t.Errorf("summarized %q, want the message content", prompts)
+	}
+	stored, err := store.Recent(context.Background(), "g1", "", "v1", -1)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("Recent = %d messages, %v, want the stored one", len(stored), err)
+	}
+	if stored[0].Content != content || stored[0].Summary != "answer" {
+		t.Errorf("stored content %q and summary %q, want the original and the summary", stored[0].Content, stored[0].Summary)
+	}
+	if !slices.Equal(stored[0].Embedding.Slice(), bagOfWords("answer")) {
+		t.Error("embedding isn't of the summary")
+	}
+}
+
+// A message that fails to summarize is embedded by its content, and one
+// that is no longer long loses a summary it had
+func TestSummarizeFallsBackToContent(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{EmbedSummarizeOver: 10})
+	fake.tooLong = 1
+	msg := testMessage("m1", "g1", "", "a message long enough to summarize", 0)
+	r.summarize(context.Background(), msg)
+	if msg.Summary != "" || embeddingSource(msg) != msg.Content {
+		t.Errorf("after a failed summary, summary = %q and source = %q, want the content", msg.Summary, embeddingSource(msg))
+	}
+
+	edited := testMessage("m1", "g1", "", "short now", 0)
+	edited.Summary = "an old summary"
+	r.summarize(context.Background(), edited)
+	if edited.Summary != "" {
+		t.Errorf("short message kept summary %q", edited.Summary)
+	}
+}
@@ -0,0 +1,189 @@
+// internal/rag/prompts.go
+package rag
+
+import (
+	"discord-rag-bot/internal/config"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PromptData is what prompt templates can reference
+type PromptData struct {
+	// Persona introduces the bot, e.g. "Jarvis, a helpful Discord bot assistant"
+	Persona string
+	BotName string
+	Guild   string
+	User    string
+	Query   string
+	// Context is the retrieved server history
+	Context string
+	// LanguageInstruction is a guideline line for the answer language, if any
+	LanguageInstruction string
+	// History is the earlier turns of an ongoing conversation, if any
+	History string
+}
+
+const defaultSystemPrompt = `You are {{.Persona}} for the "{{.Guild}}" server.
+You have access to the server's message history and should provide helpful, contextual responses.
+
+Current conversation context from server messages:
+{{.Context}}
+
+Guidelines:
+- Be friendly and conversational
+- Reference relevant context when helpful
+- Keep responses concise but informative
+- Adapt your tone to match the server's culture
+- If you don't have relevant context, say so politely
+{{- if .LanguageInstruction}}
+{{.LanguageInstruction}}
+{{- end}}
+{{- if .History}}
+
+Earlier in your conversation with {{.User}}:
+{{.History}}
+{{- end}}`
+
+const defaultUserPrompt = `{{.User}} asked: {{.Query}}`
+
+// MessageData is what the message template can reference for each message
+// in the context
+type MessageData struct {
+	Channel string
+	Author  string
+	Content string
+	// Time is when the message was sent, as "2006-01-02 15:04" UTC;
+	// Timestamp is the same time for custom layouts
+	Time      string
+	Timestamp time.Time
+	// Link jumps to the message in Discord; empty for entries that aren't
+	// a single message, such as thread titles
+	Link string
+}
+
+const defaultMessageFormat = `[{{.Channel}}] {{.Author}}: {{.Content}}`
+
+// PromptTemplates render the system and user messages of a chat request,
+// and each message of the context
+type PromptTemplates struct {
+	system  *template.Template
+	user    *template.Template
+	message *template.Template
+}
+
+// sampleData exercises every optional section when validating templates
+var sampleData = PromptData{
+	Persona:             "a helpful Discord bot assistant",
+	BotName:             "Bot",
+	Guild:               "Server",
+	User:                "user",
+	Query:               "question",
+	Context:             "context",
+	LanguageInstruction: "- instruction",
+	History:             "history",
+}
+
+// sampleMessage exercises every field when validating the message template
+var sampleMessage = MessageData{
+	Channel:   "general",
+	Author:    "user",
+	Content:   "message",
+	Time:      "2024-01-01 12:00",
+	Timestamp: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	Link:      "https://discord.com/channels/1/2/3",
+}
+
+// parsePrompt parses and test-renders a template against sample, so a
+// misspelled field fails at startup rather than on the first question
+func parsePrompt(name, text string, sample interface{}) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s prompt template: %v", name, err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+		return nil, fmt.Errorf("invalid %s prompt template: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+func defaultPromptTemplates() *PromptTemplates {
+	return &PromptTemplates{
+		system:  template.Must(parsePrompt("system", defaultSystemPrompt, sampleData)),
+		user:    template.Must(parsePrompt("user", defaultUserPrompt, sampleData)),
+		message: template.Must(parsePrompt("message", defaultMessageFormat, sampleMessage)),
+	}
+}
+
+// LoadPromptTemplates reads the configured prompt template files, using
+// the built-in prompt for any that aren't set
+func LoadPromptTemplates(cfg config.RAGConfig) (*PromptTemplates, error) {
+	systemText, err := readPromptFile(cfg.SystemPromptFile, defaultSystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+	userText, err := readPromptFile(cfg.UserPromptFile, defaultUserPrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	system, err := parsePrompt("system", systemText, sampleData)
+	if err != nil {
+		return nil, err
+	}
+	user, err := parsePrompt("user", userText, sampleData)
+	if err != nil {
+		return nil, err
+	}
+
+	messageText := cfg.MessageTemplate
+	if messageText == "" {
+		messageText = defaultMessageFormat
+	}
+	message, err := parsePrompt("message", messageText, sampleMessage)
+	if err != nil {
+		return nil, err
+	}
+	return &PromptTemplates{system: system, user: user, message: message}, nil
+}
+
+func readPromptFile(path, fallback string) (string, error) {
+	if path == "" {
+		return fallback, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt template: %v", err)
+	}
+	return string(data), nil
+}
+
+// Render produces the system and user prompts for data
+func (p *PromptTemplates) Render(data PromptData) (system, user string, err error) {
+	var sb strings.Builder
+	if err := p.system.Execute(&sb, data); err != nil {
+		return "", "", fmt.Errorf("failed to render system prompt: %v", err)
+	}
+	system = sb.String()
+
+	sb.Reset()
+	if err := p.user.Execute(&sb, data); err != nil {
+		return "", "", fmt.Errorf("failed to render user prompt: %v", err)
+	}
+	return system, sb.String(), nil
+}
+
+// RenderMessage formats one message of the context. The template was
+// validated at load, so a failure here is unexpected; the built-in format
+// is used rather than dropping the message.
+func (p *PromptTemplates) RenderMessage(data MessageData) string {
+	var sb strings.Builder
+	if err := p.message.Execute(&sb, data); err != nil {
+		log.Printf("Error rendering message template, using the default format: %v", err)
+		return fmt.Sprintf("[%s] %s: %s", data.Channel, data.Author, data.Content)
+	}
+	return sb.String()
+}
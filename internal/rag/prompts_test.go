@@ -0,0 +1,103 @@
+package rag
+
+import (
+	"discord-rag-bot/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writePromptFile(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prompt.tmpl")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultPromptsRender(t *testing.T) {
+	system, user, err := defaultPromptTemplates().Render(PromptData{
+		Persona: "Jarvis, a helpful Discord bot assistant",
+		Guild:   "Game Night",
+		User:    "alice",
+		Query:   "when do we play?",
+		Context: "[general] bob: Fridays at 21:00",
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	for _, want := range []string{"Jarvis, a helpful Discord bot assistant", `"Game Night" server`, "[general] bob: Fridays at 21:00"} {
+		if !strings.Contains(system, want) {
+			t.Errorf("system prompt doesn't contain %q:\n%s", want, system)
+		}
+	}
+	// Optional sections are left out when empty
+	if strings.Contains(system, "Earlier in your conversation") {
+		t.Errorf("system prompt has a history section without history:\n%s", system)
+	}
+	if user != "alice asked: when do we play?" {
+		t.Errorf("user prompt = %q", user)
+	}
+}
+
+func TestLoadPromptTemplatesFromFiles(t *testing.T) {
+	prompts, err := LoadPromptTemplates(config.RAGConfig{
+		SystemPromptFile: writePromptFile(t, "{{.BotName}} helps {{.Guild}}.\n{{.Context}}"),
+		UserPromptFile:   writePromptFile(t, "{{.User}}: {{.Query}}"),
+		MessageTemplate:  "{{.Time}} #{{.Channel}} <{{.Author}}> {{.Content}}",
+	})
+	if err != nil {
+		t.Fatalf("LoadPromptTemplates: %v", err)
+	}
+
+	system, user, err := prompts.Render(PromptData{BotName: "Jarvis", Guild: "Game Night", User: "alice", Query: "hi", Context: "ctx"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if system != "Jarvis helps Game Night.\nctx" || user != "alice: hi" {
+		t.Errorf("Render = %q, %q", system, user)
+	}
+
+	message := prompts.RenderMessage(MessageData{
+		Channel:   "general",
+		Author:    "bob",
+		Content:   "hello",
+		Time:      "2024-01-01 12:00",
+		Timestamp: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if message != "2024-01-01 12:00 #general <bob> hello" {
+		t.Errorf("RenderMessage = %q", message)
+	}
+}
+
+func TestLoadPromptTemplatesRejectsUnknownPlaceholders(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RAGConfig
+	}{
+		{"system", config.RAGConfig{SystemPromptFile: writePromptFile(t, "You help {{.Server}}.")}},
+		{"user", config.RAGConfig{UserPromptFile: writePromptFile(t, "{{.Username}} asked {{.Query}}")}},
+		{"message", config.RAGConfig{MessageTemplate: "{{.Channel}} {{.Message}}"}},
+		{"syntax", config.RAGConfig{SystemPromptFile: writePromptFile(t, "{{.Context")}},
+		{"missing file", config.RAGConfig{UserPromptFile: filepath.Join(t.TempDir(), "missing.tmpl")}},
+	}
+	for _, tt := range tests {
+		if _, err := LoadPromptTemplates(tt.cfg); err == nil {
+			t.Errorf("%s: LoadPromptTemplates succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestLoadPromptTemplatesDefaults(t *testing.T) {
+	prompts, err := LoadPromptTemplates(config.RAGConfig{})
+	if err != nil {
+		t.Fatalf("LoadPromptTemplates: %v", err)
+	}
+	if got := prompts.RenderMessage(MessageData{Channel: "general", Author: "bob", Content: "hello"}); got != "[general] bob: hello" {
+		t.Errorf("RenderMessage = %q, want the default format", got)
+	}
+}
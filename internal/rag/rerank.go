@@ -0,0 +1,68 @@
+// internal/rag/rerank.go
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/models"
+	"log"
+	"sort"
+)
+
+// SetReranker enables re-ranking similarity search results before they
+// are used; nil disables it
+func (r *RAGRetriever) SetReranker(reranker ai.Reranker) {
+	r.reranker = reranker
+}
+
+// searchLimit is how many results to fetch from the vector store: enough
+// candidates for the re-ranker to choose from, if one is set
+func (r *RAGRetriever) searchLimit(limit int) int {
+	if r.reranker == nil {
+		return limit
+	}
+	return max(limit, r.cfg.RerankCandidates)
+}
+
+// rerank orders messages by the re-ranker's relevance to the query and
+// keeps the best limit. If re-ranking fails, the vector order is kept.
+func (r *RAGRetriever) rerank(ctx context.Context, query string, messages []models.DiscordMessage, limit int) []models.DiscordMessage {
+	if r.reranker != nil && len(messages) > 1 {
+		documents := make([]string, len(messages))
+		for i, msg := range messages {
+			documents[i] = msg.Content
+		}
+
+		scores, err := r.reranker.Rerank(ctx, query, documents)
+		if err == nil && len(scores) == len(messages) {
+			messages = orderByScore(messages, scores)
+		} else if err != nil {
+			log.Printf("Re-ranking failed, keeping vector order: %v", err)
+		} else {
+			log.Printf("Re-ranker returned %d scores for %d messages, keeping vector order", len(scores), len(messages))
+		}
+	}
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages
+}
+
+// orderByScore sorts messages by descending score; equal scores keep their
+// vector order
+func orderByScore(messages []models.DiscordMessage, scores []float64) []models.DiscordMessage {
+	order := make([]int, len(messages))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	ordered := make([]models.DiscordMessage, len(messages))
+	for i, idx := range order {
+		ordered[i] = messages[idx]
+	}
+	return ordered
+}
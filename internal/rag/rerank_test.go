@@ -0,0 +1,159 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mockReranker scores documents with score, or fails with err. It records
+// the documents of each call.
+type mockReranker struct {
+	mu    sync.Mutex
+	calls [][]string
+	score func(query, document string) float64
+	err   error
+}
+
+func (m *mockReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, documents)
+	m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	scores := make([]float64, len(documents))
+	for i, doc := range documents {
+		scores[i] = m.score(query, doc)
+	}
+	return scores, nil
+}
+
+// preferring scores documents containing word above the rest
+func preferring(word string) func(query, document string) float64 {
+	return func(query, document string) float64 {
+		if strings.Contains(document, word) {
+			return 1
+		}
+		return 0
+	}
+}
+
+func contents(messages []models.DiscordMessage) []string {
+	var texts []string
+	for _, msg := range messages {
+		texts = append(texts, msg.Content)
+	}
+	return texts
+}
+
+func TestSearchLimit(t *testing.T) {
+	r := &RAGRetriever{cfg: config.RAGConfig{RerankCandidates: 20}}
+	if got := r.searchLimit(5); got != 5 {
+		t.Errorf("searchLimit without a re-ranker = %d, want 5", got)
+	}
+	r.SetReranker(&mockReranker{})
+	if got := r.searchLimit(5); got != 20 {
+		t.Errorf("searchLimit with a re-ranker = %d, want the 20 candidates", got)
+	}
+	if got := r.searchLimit(30); got != 30 {
+		t.Errorf("searchLimit over the candidates = %d, want 30", got)
+	}
+}
+
+func TestRerank(t *testing.T) {
+	messages := []models.DiscordMessage{{Content: "a"}, {Content: "b pick"}, {Content: "c"}, {Content: "d pick"}}
+	tests := []struct {
+		name     string
+		reranker *mockReranker
+		limit    int
+		want     []string
+	}{
+		{"reordered", &mockReranker{score: preferring("pick")}, 4, []string{"b pick", "d pick", "a", "c"}},
+		{"best kept", &mockReranker{score: preferring("pick")}, 2, []string{"b pick", "d pick"}},
+		{"failure keeps vector order", &mockReranker{err: errors.New("boom")}, 3, []string{"a", "b pick", "c"}},
+	}
+	for _, tt := range tests {
+		r := &RAGRetriever{}
+		r.SetReranker(tt.reranker)
+		got := contents(r.rerank(context.Background(), "query", slices.Clone(messages), tt.limit))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: rerank = %q, want %q", tt.name, got, tt.want)
+		}
+		if len(tt.reranker.calls) != 1 || !slices.Equal(tt.reranker.calls[0], contents(messages)) {
+			t.Errorf("%s: re-ranker called with %q, want every candidate once", tt.name, tt.reranker.calls)
+		}
+	}
+}
+
+// Scores that don't line up with the messages can't be trusted to order
+// them
+type shortReranker struct{}
+
+func (shortReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	return []float64{1}, nil
+}
+
+func TestRerankScoreCountMismatch(t *testing.T) {
+	r := &RAGRetriever{}
+	r.SetReranker(shortReranker{})
+	messages := []models.DiscordMessage{{Content: "a"}, {Content: "b"}, {Content: "c"}}
+	if got := contents(r.rerank(context.Background(), "query", messages, 2)); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("rerank = %q, want the vector order", got)
+	}
+}
+
+func TestRerankSkipped(t *testing.T) {
+	messages := []models.DiscordMessage{{Content: "a"}, {Content: "b"}}
+
+	r := &RAGRetriever{}
+	if got := contents(r.rerank(context.Background(), "query", messages, 1)); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("rerank without a re-ranker = %q, want the vector order cut to the limit", got)
+	}
+
+	mock := &mockReranker{score: preferring("b")}
+	r.SetReranker(mock)
+	r.rerank(context.Background(), "query", messages[:1], 5)
+	if len(mock.calls) != 0 {
+		t.Error("re-ranker called for a single message")
+	}
+}
+
+func TestOrderByScoreStable(t *testing.T) {
+	messages := []models.DiscordMessage{{Content: "a"}, {Content: "b"}, {Content: "c"}, {Content: "d"}}
+	got := contents(orderByScore(messages, []float64{1, 2, 1, 2}))
+	if want := []string{"b", "d", "a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("orderByScore = %q, want %q", got, want)
+	}
+}
+
+// With a re-ranker the search fetches the configured number of candidates
+// and answers from the ones it ranks best, not the nearest
+func TestSearchReranks(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{RerankCandidates: 3})
+	mock := &mockReranker{score: preferring("snacks")}
+	r.SetReranker(mock)
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "game night is on friday", 0),
+		testMessage("m2", "g1", "v1", "game night at the club", 1),
+		testMessage("m3", "g1", "v1", "snacks for game night", 2),
+		testMessage("m4", "g1", "v1", "the weather is nice", 3),
+	)
+
+	found, err := r.SearchContextInRange(context.Background(), "when is game night", "g1", "c1", "", 2, database.TimeRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.calls) != 1 || len(mock.calls[0]) != 3 || slices.Contains(mock.calls[0], "the weather is nice") {
+		t.Fatalf("re-ranker calls = %q, want one with the 3 nearest candidates", mock.calls)
+	}
+	if got := messageIDs(found.similar); len(got) != 2 || got[0] != "m3" {
+		t.Errorf("similar = %v, want 2 led by m3, which the re-ranker preferred", got)
+	}
+}
@@ -2,67 +2,670 @@
 package rag
 
 import (
+	"context"
+	"crypto/sha256"
 	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/config"
 	"discord-rag-bot/internal/database"
 	"discord-rag-bot/internal/models"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"strings"
-
-	"github.com/pgvector/pgvector-go"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 type RAGRetriever struct {
-	db *database.DB
-	AI *ai.AIService // Export this field (capital A)
+	db       *database.DB
+	settings guildSettingsStore
+	store    VectorStore
+	AI       *ai.AIService // Export this field (capital A)
+	cfg      config.RAGConfig
+	cache    *contextCache
+	vectors  *embeddingCache // query embeddings
+	botName  string
+	prompts  *PromptTemplates
+	live     LiveMessageSource
+	users    UserNameSource
+	// reranker reorders similarity search results; nil keeps vector order
+	reranker ai.Reranker
+	// deadLetters records messages that exhausted their embedding retries
+	deadLetters failedEmbeddingRecorder
+	// interactions finds past answers to similar questions
+	interactions interactionSearcher
+
+	// lastEviction maps guild ID to when its message cap was last enforced
+	lastEviction sync.Map
+
+	// settingsCache holds the guild settings loaded so far; guarded by
+	// settingsMu
+	settingsMu    sync.Mutex
+	settingsCache map[string]models.GuildSettings
+}
+
+// guildSettingsStore loads and saves per-guild settings
+type guildSettingsStore interface {
+	GetGuildSettings(guildID string) (*models.GuildSettings, error)
+	SaveGuildSettings(settings *models.GuildSettings) error
+}
+
+// interactionSearcher finds logged interactions similar to a question
+type interactionSearcher interface {
+	SearchSimilarInteractions(ctx context.Context, embedding []float32, guildID, version string, limit int) ([]models.BotInteraction, error)
+}
+
+// evictionInterval spaces out enforcing a guild's message cap, which is a
+// soft limit and needn't run on every insert
+const evictionInterval = time.Minute
+
+// LiveMessageSource reads a channel's latest messages directly from Discord
+type LiveMessageSource interface {
+	// RecentChannelMessages returns up to limit messages, oldest first
+	RecentChannelMessages(ctx context.Context, channelID string, limit int) ([]models.DiscordMessage, error)
+}
+
+// NewRAGRetriever creates a retriever that searches messages with pgvector
+func NewRAGRetriever(db *database.DB, aiService *ai.AIService, cfg config.RAGConfig) *RAGRetriever {
+	return NewRAGRetrieverWithStore(db, NewPGVectorStore(db), aiService, cfg)
 }
 
-func NewRAGRetriever(db *database.DB, aiService *ai.AIService) *RAGRetriever {
+// NewRAGRetrieverWithStore creates a retriever backed by the given vector
+// store. The database is still used for settings and recent activity.
+func NewRAGRetrieverWithStore(db *database.DB, store VectorStore, aiService *ai.AIService, cfg config.RAGConfig) *RAGRetriever {
 	return &RAGRetriever{
-		db: db,
-		AI: aiService, // Use exported field
+		db:           db,
+		settings:     db,
+		store:        store,
+		AI:           aiService, // Use exported field
+		cfg:          cfg,
+		cache:        newContextCache(cfg.ContextCacheTTL),
+		vectors:      newEmbeddingCache(cfg.EmbeddingCacheSize, int64(cfg.EmbeddingCacheMB)<<20, cfg.EmbeddingCacheIdle),
+		prompts:      defaultPromptTemplates(),
+		deadLetters:  db,
+		interactions: db,
+	}
+}
+
+// SetLiveSource enables merging live channel messages into the recent
+// activity context when RAGConfig.LiveMessages is set
+func (r *RAGRetriever) SetLiveSource(source LiveMessageSource) {
+	r.live = source
+}
+
+// SetPromptTemplates replaces the built-in prompts, e.g. with ones from
+// LoadPromptTemplates
+func (r *RAGRetriever) SetPromptTemplates(prompts *PromptTemplates) {
+	r.prompts = prompts
+}
+
+// SetBotName sets the name the bot uses for itself where a guild hasn't
+// chosen one
+func (r *RAGRetriever) SetBotName(name string) {
+	r.botName = name
+}
+
+// BotName returns the bot's name in a guild, honoring its override
+func (r *RAGRetriever) BotName(guildID string) string {
+	if guildID == "" {
+		return r.botName
+	}
+
+	settings, err := r.guildSettings(guildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+		return r.botName
+	}
+
+	if settings.BotName != "" {
+		return settings.BotName
+	}
+	return r.botName
+}
+
+// SetGuildBotName stores a guild's bot name override; empty clears it
+func (r *RAGRetriever) SetGuildBotName(guildID, name string) error {
+	return r.updateGuildSettings(guildID, func(settings *models.GuildSettings) {
+		settings.BotName = name
+	})
+}
+
+// CacheStats returns hit/miss counters for the context cache
+func (r *RAGRetriever) CacheStats() CacheStats {
+	return r.cache.stats()
+}
+
+// EmbeddingCacheStats returns the query embedding cache's size and counters
+func (r *RAGRetriever) EmbeddingCacheStats() EmbeddingCacheStats {
+	return r.vectors.stats()
+}
+
+// SearchRelevantContext builds the prompt context for a query: messages
+// semantically similar to it, plus recent activity in the asking channel (or
+// the whole guild if configured)
+func (r *RAGRetriever) SearchRelevantContext(ctx context.Context, query string, guildID, channelID string, limit int) (string, error) {
+	return r.SearchRelevantContextInRange(ctx, query, guildID, channelID, "", limit, database.TimeRange{})
+}
+
+// SearchRelevantContextInRange is SearchRelevantContext restricted to
+// messages sent within timeRange. categoryID is the asking channel's
+// category, used for category-aware retrieval when configured.
+func (r *RAGRetriever) SearchRelevantContextInRange(ctx context.Context, query string, guildID, channelID, categoryID string, limit int, timeRange database.TimeRange) (string, error) {
+	found, err := r.SearchContextInRange(ctx, query, guildID, channelID, categoryID, limit, timeRange)
+	return found.Text, err
+}
+
+// RetrievedContext is a prompt context along with the entries it was
+// built from, for showing users what an answer was based on
+type RetrievedContext struct {
+	Text string
+	// Sources holds each formatted message and previous answer in the
+	// context, in the order they appear
+	Sources []string
+
+	// similar, recent and interactions are what Text was formatted from,
+	// under the authorNames naming mode, so it can be formatted again with
+	// fewer of them
+	similar      []models.DiscordMessage
+	recent       []models.DiscordMessage
+	interactions []models.BotInteraction
+	authorNames  string
+}
+
+// SearchContextInRange is SearchRelevantContextInRange, also returning the
+// context's sources
+func (r *RAGRetriever) SearchContextInRange(ctx context.Context, query string, guildID, channelID, categoryID string, limit int, timeRange database.TimeRange) (RetrievedContext, error) {
+	ctx = ai.WithGuildID(ctx, guildID)
+	version := r.EmbeddingVersion(guildID)
+	scope := r.categoryScope(categoryID)
+	authorNames := r.AuthorNames(guildID)
+	key := cacheKey(query, guildID, channelID, scope.CategoryID, version, authorNames, limit, timeRange)
+	if cached, ok := r.cache.get(key); ok {
+		return cached, nil
+	}
+
+	found, err := r.retrieve(ctx, query, guildID, channelID, version, scope, limit, timeRange)
+	if err != nil {
+		return RetrievedContext{}, err
+	}
+
+	result := formatContext(found.similar, found.recent, found.interactions, r.authorNamer(authorNames, guildID), r.prompts)
+	r.cache.set(key, result)
+
+	return result, nil
+}
+
+// retrieval is everything gathered for one question before formatting
+type retrieval struct {
+	// embedding is nil in recent-only mode, which doesn't search
+	embedding []float32
+	// candidates are the similarity search results, with distances;
+	// similar are the ones within the distance threshold
+	candidates   []models.DiscordMessage
+	similar      []models.DiscordMessage
+	recent       []models.DiscordMessage
+	interactions []models.BotInteraction
+}
+
+// retrieve runs the configured retrieval for a question
+func (r *RAGRetriever) retrieve(ctx context.Context, query, guildID, channelID, version string, scope database.CategoryScope, limit int, timeRange database.TimeRange) (*retrieval, error) {
+	mode := r.cfg.RetrievalMode
+	found := &retrieval{}
+
+	// Recent-only retrieval needs no query embedding
+	if mode != retrievalRecent {
+		var err error
+		found.embedding, err = r.queryEmbedding(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate query embedding: %v", err)
+		}
+
+		// Search for similar messages
+		found.candidates, err = r.store.Search(ctx, found.embedding, guildID, version, r.searchLimit(limit), timeRange, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search similar messages: %w", err)
+		}
+		recordRetrieval(guildID, found.candidates)
+
+		for _, msg := range found.candidates {
+			if r.withinDistance(msg) {
+				found.similar = append(found.similar, msg)
+			}
+		}
+		found.similar = r.rerank(ctx, query, found.similar, limit)
+		found.similar = r.withFacts(ctx, found.embedding, guildID, version, found.similar, limit)
+		if r.cfg.MaxMessagesPerGuild > 0 && r.cfg.EvictionPolicy == database.EvictLeastRetrieved {
+			go r.markRetrieved(found.similar)
+		}
+	}
+
+	if mode != retrievalSemantic {
+		found.recent = r.recentActivity(ctx, guildID, channelID, version, r.recentLimit(mode, limit), timeRange)
+	}
+
+	// Reuse previous answers to similar questions
+	if found.embedding != nil && r.cfg.IncludeInteractions && r.cfg.InteractionLimit > 0 {
+		var err error
+		found.interactions, err = r.interactions.SearchSimilarInteractions(ctx, found.embedding, guildID, version, r.cfg.InteractionLimit)
+		if err != nil {
+			log.Printf("Error searching past interactions: %v", err)
+		}
+	}
+
+	return found, nil
+}
+
+// queryEmbedding embeds a question, reusing the cached embedding of the
+// same text if there is one
+func (r *RAGRetriever) queryEmbedding(ctx context.Context, query string) ([]float32, error) {
+	text := r.embeddingText(query)
+	if embedding, ok := r.vectors.get(text, time.Now()); ok {
+		return embedding, nil
+	}
+
+	embedding, err := r.AI.GenerateEmbedding(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	r.vectors.set(text, embedding, time.Now())
+	return embedding, nil
+}
+
+// withinDistance reports whether a search result is close enough to the
+// question to be used. Facts have their own, usually looser, threshold.
+func (r *RAGRetriever) withinDistance(msg models.DiscordMessage) bool {
+	return r.cfg.MaxDistance <= 0 || msg.Distance <= r.cfg.MaxDistance || r.pinnedFact(msg)
+}
+
+const (
+	retrievalSemantic = "semantic"
+	retrievalRecent   = "recent"
+)
+
+// recentLimit is how many recent messages to include. Recent-only
+// retrieval takes at least as many as a similarity search would have.
+func (r *RAGRetriever) recentLimit(mode string, limit int) int {
+	if mode == retrievalRecent {
+		return max(r.cfg.RecentMessages, limit)
+	}
+	return r.cfg.RecentMessages
+}
+
+// recentActivity fetches the latest stored messages (from the asking
+// channel, or the whole guild if configured) merged with live ones, for
+// temporal context
+func (r *RAGRetriever) recentActivity(ctx context.Context, guildID, channelID, version string, limit int, timeRange database.TimeRange) []models.DiscordMessage {
+	var recent []models.DiscordMessage
+	if limit > 0 {
+		recentChannel := channelID
+		if r.cfg.RecentGuildWide {
+			recentChannel = ""
+		}
+		var err error
+		recent, err = r.store.Recent(ctx, guildID, recentChannel, version, limit)
+		if err != nil {
+			log.Printf("Error fetching recent messages: %v", err)
+		}
+	}
+
+	// Ground on the immediate conversation, including messages not stored
+	if r.live != nil && r.cfg.LiveMessages > 0 && channelID != "" {
+		live, err := r.live.RecentChannelMessages(ctx, channelID, r.cfg.LiveMessages)
+		if err != nil {
+			log.Printf("Error fetching live channel messages: %v", err)
+		}
+		recent = mergeRecent(recent, live)
+	}
+
+	if timeRange.IsZero() {
+		return recent
+	}
+	var inRange []models.DiscordMessage
+	for _, msg := range recent {
+		if timeRange.Contains(msg.Timestamp) {
+			inRange = append(inRange, msg)
+		}
+	}
+	return inRange
+}
+
+const (
+	categoryModeBoost = "boost"
+	categoryModeOnly  = "only"
+)
+
+// categoryScope applies the configured category mode to the asking
+// channel's category. The zero scope searches the whole guild evenly.
+func (r *RAGRetriever) categoryScope(categoryID string) database.CategoryScope {
+	if categoryID == "" {
+		return database.CategoryScope{}
+	}
+
+	switch r.cfg.CategoryMode {
+	case categoryModeOnly:
+		return database.CategoryScope{CategoryID: categoryID, Only: true}
+	case categoryModeBoost:
+		if r.cfg.CategoryBoost <= 0 || r.cfg.CategoryBoost >= 1 {
+			return database.CategoryScope{}
+		}
+		return database.CategoryScope{CategoryID: categoryID, Boost: r.cfg.CategoryBoost}
+	default:
+		return database.CategoryScope{}
+	}
+}
+
+// mergeRecent combines stored and live recent messages in chronological
+// order, keeping one copy of messages present in both
+func mergeRecent(stored, live []models.DiscordMessage) []models.DiscordMessage {
+	if len(live) == 0 {
+		return stored
+	}
+
+	seen := make(map[string]bool, len(stored))
+	merged := make([]models.DiscordMessage, 0, len(stored)+len(live))
+	for _, msg := range stored {
+		seen[msg.MessageID] = true
+		merged = append(merged, msg)
+	}
+	for _, msg := range live {
+		if !seen[msg.MessageID] {
+			seen[msg.MessageID] = true
+			merged = append(merged, msg)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+	return merged
+}
+
+func formatMessage(msg models.DiscordMessage, names *authorNamer, prompts *PromptTemplates) string {
+	return prompts.RenderMessage(MessageData{
+		Channel:   msg.ChannelName,
+		Author:    names.name(msg.Author, msg.Username),
+		Content:   names.mentions(msg.Content),
+		Time:      msg.Timestamp.UTC().Format("2006-01-02 15:04"),
+		Timestamp: msg.Timestamp,
+		Link:      messageLink(msg),
+	})
+}
+
+// messageLink is the Discord URL of a stored message, or empty if the entry
+// isn't a message of its own (thread titles are stored under "thread:" IDs)
+func messageLink(msg models.DiscordMessage) string {
+	if msg.GuildID == "" || msg.MessageID == "" || strings.Trim(msg.MessageID, "0123456789") != "" {
+		return ""
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", msg.GuildID, msg.ChannelID, msg.MessageID)
+}
+
+func formatInteraction(interaction models.BotInteraction, names *authorNamer) string {
+	return fmt.Sprintf("%s asked: %s\nYou answered: %s", names.name(interaction.UserID, interaction.Username), names.mentions(interaction.Query), names.mentions(interaction.Response))
+}
+
+// Section headings of a formatted context
+const (
+	similarHeading      = "Relevant messages:"
+	recentHeading       = "Recent activity:"
+	interactionsHeading = "Previous answers to similar questions:"
+)
+
+// formatContext renders retrieved messages, adding a recent-activity section
+// for recent messages that weren't already retrieved as similar, and a
+// section for relevant previous answers. Authors are labelled by names and
+// messages formatted with the prompts' message template.
+func formatContext(similar, recent []models.DiscordMessage, interactions []models.BotInteraction, names *authorNamer, prompts *PromptTemplates) RetrievedContext {
+	seen := make(map[string]bool, len(similar))
+	var similarParts []string
+	for _, msg := range similar {
+		seen[msg.MessageID] = true
+		similarParts = append(similarParts, formatMessage(msg, names, prompts))
+	}
+
+	var recentParts []string
+	for _, msg := range recent {
+		if !seen[msg.MessageID] {
+			recentParts = append(recentParts, formatMessage(msg, names, prompts))
+		}
+	}
+
+	var interactionParts []string
+	for _, interaction := range interactions {
+		interactionParts = append(interactionParts, formatInteraction(interaction, names))
+	}
+
+	result := RetrievedContext{
+		Sources:      append(append(append([]string(nil), similarParts...), recentParts...), interactionParts...),
+		similar:      similar,
+		recent:       recent,
+		interactions: interactions,
+		authorNames:  names.mode,
+	}
+	if len(recentParts) == 0 && len(interactionParts) == 0 {
+		result.Text = strings.Join(similarParts, "\n")
+		return result
+	}
+
+	var sections []string
+	if len(similarParts) > 0 {
+		sections = append(sections, similarHeading+"\n"+strings.Join(similarParts, "\n"))
+	}
+	if len(recentParts) > 0 {
+		sections = append(sections, recentHeading+"\n"+strings.Join(recentParts, "\n"))
+	}
+	if len(interactionParts) > 0 {
+		sections = append(sections, interactionsHeading+"\n"+strings.Join(interactionParts, "\n\n"))
+	}
+	result.Text = strings.Join(sections, "\n\n")
+	return result
+}
+
+// ChatModel returns the active chat model for a guild, honoring its override
+func (r *RAGRetriever) ChatModel(guildID string) string {
+	if guildID == "" {
+		return r.AI.DefaultChatModel()
+	}
+
+	settings, err := r.guildSettings(guildID)
+	if err != nil {
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+		return r.AI.DefaultChatModel()
+	}
+
+	if settings.ChatModel != "" && ai.IsSupportedChatModel(settings.ChatModel) {
+		return settings.ChatModel
 	}
+	return r.AI.DefaultChatModel()
 }
 
-func (r *RAGRetriever) SearchRelevantContext(query string, guildID string, limit int) (string, error) {
-	// Generate embedding for the query
-	embedding, err := r.AI.GenerateEmbedding(query)
+// SetChatModel stores a guild's chat model override after validating it
+func (r *RAGRetriever) SetChatModel(guildID, model string) error {
+	if !ai.IsSupportedChatModel(model) {
+		return fmt.Errorf("unsupported model %q", model)
+	}
+
+	return r.updateGuildSettings(guildID, func(settings *models.GuildSettings) {
+		settings.ChatModel = model
+	})
+}
+
+// EmbeddingVersion returns the embedding version searched for a guild. A
+// guild is pinned to the version it first searched, so bumping the
+// configured version only changes what new embeddings are stored under;
+// searches stay on the old version until SetEmbeddingVersion moves them
+// after a backfill. The in-memory store keeps nothing from before a
+// restart, so there it just follows the configured version.
+func (r *RAGRetriever) EmbeddingVersion(guildID string) string {
+	if guildID == "" {
+		return r.cfg.EmbeddingVersion
+	}
+
+	settings, err := r.guildSettings(guildID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate query embedding: %v", err)
+		log.Printf("Error loading guild settings for %s: %v", guildID, err)
+		return r.cfg.EmbeddingVersion
+	}
+
+	if settings.EmbeddingVersion != "" {
+		return settings.EmbeddingVersion
 	}
+	if !r.CanBackfill() {
+		return r.cfg.EmbeddingVersion
+	}
+
+	version, ok := r.initialEmbeddingVersion(guildID)
+	if ok {
+		err := r.updateGuildSettings(guildID, func(settings *models.GuildSettings) {
+			// Another request may have pinned it meanwhile
+			if settings.EmbeddingVersion == "" {
+				settings.EmbeddingVersion = version
+			}
+			version = settings.EmbeddingVersion
+		})
+		if err != nil {
+			log.Printf("Error pinning embedding version %s for guild %s: %v", version, guildID, err)
+		}
+	}
+	return version
+}
 
-	// Search for similar messages
-	messages, err := r.db.SearchSimilarMessages(embedding, guildID, limit)
+// initialEmbeddingVersion picks the version a guild is pinned to: the
+// configured one, unless the guild's messages are only embedded under
+// others, in which case the one holding the most of them. It reports false
+// if the messages couldn't be counted, so nothing should be pinned yet.
+func (r *RAGRetriever) initialEmbeddingVersion(guildID string) (string, bool) {
+	counts, err := r.store.CountByVersion(context.Background(), guildID)
 	if err != nil {
-		return "", fmt.Errorf("failed to search similar messages: %v", err)
+		log.Printf("Error counting embeddings for guild %s: %v", guildID, err)
+		return r.cfg.EmbeddingVersion, false
+	}
+
+	version := r.cfg.EmbeddingVersion
+	if counts[version] > 0 {
+		return version, true
 	}
+	var most int64
+	for v, count := range counts {
+		if count > most || (count == most && v < version) {
+			version, most = v, count
+		}
+	}
+	return version, true
+}
+
+// WriteEmbeddingVersion returns the version new embeddings are stored under
+func (r *RAGRetriever) WriteEmbeddingVersion() string {
+	return r.cfg.EmbeddingVersion
+}
+
+// ErrBackfillIncomplete means a guild can't switch to an embedding version
+// yet because some of the messages it searches now aren't embedded under it
+var ErrBackfillIncomplete = errors.New("backfill not complete")
+
+// SetEmbeddingVersion switches the embedding version searched for a guild.
+// Every message under the version searched now must have been backfilled
+// to the new one first, so no history disappears from searches. The switch
+// is a single settings update, so searches move over at once.
+func (r *RAGRetriever) SetEmbeddingVersion(ctx context.Context, guildID, version string) error {
+	current := r.EmbeddingVersion(guildID)
+	if version != current && r.CanBackfill() {
+		remaining, err := r.db.CountMessagesToBackfill(ctx, guildID, current, version, 0)
+		if err != nil {
+			return fmt.Errorf("failed to check backfill progress: %v", err)
+		}
+		if remaining > 0 {
+			return fmt.Errorf("%w: %d messages under %s aren't embedded under %s yet", ErrBackfillIncomplete, remaining, current, version)
+		}
+	}
+
+	return r.updateGuildSettings(guildID, func(settings *models.GuildSettings) {
+		settings.EmbeddingVersion = version
+	})
+}
+
+// GenerateResponse answers a question from the context retrieved for it
+func (r *RAGRetriever) GenerateResponse(ctx context.Context, query string, retrieved RetrievedContext, username, guildID, guildName string) (string, error) {
+	return r.GenerateResponseWithHistory(ctx, query, retrieved, "", "", username, guildID, guildName)
+}
 
-	// Build context string
-	var contextParts []string
-	for _, msg := range messages {
-		contextParts = append(contextParts, fmt.Sprintf("[%s] %s: %s",
-			msg.ChannelName, msg.Username, msg.Content))
+// persona introduces the bot in the system prompt
+func persona(name string) string {
+	if name == "" {
+		return "a helpful Discord bot assistant"
 	}
+	return fmt.Sprintf("%s, a helpful Discord bot assistant", name)
+}
 
-	return strings.Join(contextParts, "\n"), nil
+// languageInstruction returns the prompt guideline for the answer language.
+// detected is the language of the question when already known (e.g. from
+// speech recognition); otherwise the model is asked to match the question.
+func languageInstruction(setting, detected string) string {
+	switch {
+	case setting == "":
+		return ""
+	case !strings.EqualFold(setting, "auto"):
+		return fmt.Sprintf("- Always respond in %s, regardless of the language of the server history", setting)
+	case detected != "":
+		return fmt.Sprintf("- Respond in %s, the language the user is speaking, even if the server history is in another language", detected)
+	default:
+		return "- Respond in the same language as the user's question, even if the server history is in another language"
+	}
 }
 
-func (r *RAGRetriever) GenerateResponse(query, context, username, guildName string) (string, error) {
-	systemPrompt := fmt.Sprintf(`You are a helpful Discord bot assistant for the "%s" server. 
-You have access to the server's message history and should provide helpful, contextual responses.
+const (
+	emptyContextInstruct = "instruct"
+	emptyContextReply    = "reply"
+)
 
-Current conversation context from server messages:
-%s
+// noHistoryContext stands in for the context when nothing was retrieved,
+// so the model doesn't answer as if it knew the server
+const noHistoryContext = "(No server history is available yet. Say so if the question depends on it, and don't make up past conversations.)"
 
-Guidelines:
-- Be friendly and conversational
-- Reference relevant context when helpful
-- Keep responses concise but informative
-- Adapt your tone to match the server's culture
-- If you don't have relevant context, say so politely`, guildName, context)
+// GenerateResponseWithHistory is GenerateResponse with the preceding turns of
+// an ongoing conversation, so follow-up questions can be resolved, and the
+// question's language if known
+func (r *RAGRetriever) GenerateResponseWithHistory(ctx context.Context, query string, retrieved RetrievedContext, history, language, username, guildID, guildName string) (string, error) {
+	if strings.TrimSpace(retrieved.Text) == "" {
+		switch r.cfg.EmptyContextMode {
+		case emptyContextReply:
+			return r.cfg.EmptyContextReply, nil
+		case emptyContextInstruct:
+			retrieved = RetrievedContext{Text: noHistoryContext}
+		}
+	}
+	return r.generateResponse(ctx, query, retrieved, history, language, username, guildID, guildName)
+}
 
-	userPrompt := fmt.Sprintf("%s asked: %s", username, query)
+// generateResponse renders the prompts and asks the model, trimming the
+// context for as long as it doesn't fit
+func (r *RAGRetriever) generateResponse(ctx context.Context, query string, retrieved RetrievedContext, history, language, username, guildID, guildName string) (string, error) {
+	ctx = ai.WithGuildID(ctx, guildID)
+	botName := r.BotName(guildID)
+	systemPrompt, userPrompt, err := r.prompts.Render(PromptData{
+		Persona:             persona(botName),
+		BotName:             botName,
+		Guild:               guildName,
+		User:                username,
+		Query:               query,
+		Context:             retrieved.Text,
+		LanguageInstruction: languageInstruction(r.cfg.ResponseLanguage, language),
+		History:             history,
+	})
+	if err != nil {
+		return "", err
+	}
 
-	response, err := r.AI.GenerateResponse(systemPrompt, userPrompt)
+	response, err := r.AI.GenerateResponseWithModel(ctx, r.ChatModel(guildID), systemPrompt, userPrompt)
+	if errors.Is(err, ai.ErrContextLengthExceeded) {
+		if trimmed, ok := r.trimContext(retrieved, guildID); ok {
+			log.Printf("Prompt too long for guild %s, retrying with %d of %d context bytes", guildID, len(trimmed.Text), len(retrieved.Text))
+			return r.generateResponse(ctx, query, trimmed, history, language, username, guildID, guildName)
+		}
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to generate AI response: %v", err)
 	}
@@ -70,18 +673,252 @@ Guidelines:
 	return response, nil
 }
 
+// trimContext drops the lower-ranked half of the similar messages and
+// formats the rest again. Once none are left it drops the older half of the
+// recent messages, then the lower-ranked half of the previous answers, so
+// entries always go whole. Returns false once there is nothing left to drop.
+func (r *RAGRetriever) trimContext(retrieved RetrievedContext, guildID string) (RetrievedContext, bool) {
+	similar, recent, interactions := retrieved.similar, retrieved.recent, retrieved.interactions
+	switch {
+	case len(similar) > 0:
+		similar = similar[:len(similar)/2]
+	case len(recent) > 0:
+		recent = recent[len(recent)-len(recent)/2:]
+	case len(interactions) > 0:
+		interactions = interactions[:len(interactions)/2]
+	default:
+		return RetrievedContext{}, false
+	}
+	return formatContext(similar, recent, interactions, r.authorNamer(retrieved.authorNames, guildID), r.prompts), true
+}
+
+const (
+	interactionLoggingHash     = "hash"
+	interactionLoggingMetadata = "metadata"
+)
+
+// redactInteraction applies the interaction logging mode, recording text
+// lengths first. It reports whether the text was kept.
+func redactInteraction(mode string, interaction *models.BotInteraction) bool {
+	interaction.QueryLength = utf8.RuneCountInString(interaction.Query)
+	interaction.ResponseLength = utf8.RuneCountInString(interaction.Response)
+
+	switch mode {
+	case interactionLoggingHash:
+		interaction.Query = hashText(interaction.Query)
+		interaction.Response = hashText(interaction.Response)
+		return false
+	case interactionLoggingMetadata:
+		interaction.Query = ""
+		interaction.Response = ""
+		return false
+	default:
+		return true
+	}
+}
+
+// hashPrefix marks text replaced by its hash
+const hashPrefix = "sha256:"
+
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// QueryRedacted reports whether an interaction's question wasn't stored
+// because of the interaction logging mode
+func QueryRedacted(interaction *models.BotInteraction) bool {
+	return interaction.Query == "" || strings.HasPrefix(interaction.Query, hashPrefix)
+}
+
+// StoreInteraction logs a bot interaction according to the logging mode,
+// embedding it first when past interactions are used for retrieval. An
+// embedding failure still logs it.
+func (r *RAGRetriever) StoreInteraction(ctx context.Context, interaction *models.BotInteraction) error {
+	ctx = ai.WithGuildID(ctx, interaction.GuildID)
+	interaction.EmbeddingVersion = r.cfg.EmbeddingVersion
+	if !redactInteraction(r.cfg.InteractionLogging, interaction) {
+		return r.db.WithContext(ctx).Create(interaction).Error
+	}
+
+	if r.cfg.IncludeInteractions {
+		embedding, err := r.AI.GenerateEmbedding(ctx, r.embeddingText(interaction.Query+"\n"+interaction.Response))
+		if err != nil {
+			log.Printf("Error embedding interaction: %v", err)
+		} else {
+			interaction.SetEmbedding(embedding)
+		}
+	}
+
+	return r.db.WithContext(ctx).Create(interaction).Error
+}
+
 // StoreMessageWithEmbedding stores a message and generates its embedding
-func (r *RAGRetriever) StoreMessageWithEmbedding(message *models.DiscordMessage) error {
+func (r *RAGRetriever) StoreMessageWithEmbedding(ctx context.Context, message *models.DiscordMessage) error {
+	ctx = ai.WithGuildID(ctx, message.GuildID)
+	if message.EmbeddingVersion == "" {
+		message.EmbeddingVersion = r.cfg.EmbeddingVersion
+	}
+
 	// Generate embedding for the message content
 	if message.Content != "" {
-		embedding, err := r.AI.GenerateEmbedding(message.Content)
+		r.summarize(ctx, message)
+		embedding, err := r.embedMessage(ctx, message)
 		if err != nil {
-			return fmt.Errorf("failed to generate embedding: %v", err)
+			return err
 		}
 
-		// Convert to pgvector format
-		message.Embedding = pgvector.NewVector(embedding)
+		message.SetEmbedding(embedding)
+	}
+
+	if err := r.store.Upsert(ctx, message); err != nil {
+		return err
 	}
 
-	return r.db.Create(message).Error
+	r.enforceMessageCap(message.GuildID)
+	return nil
+}
+
+// RecentMessages returns up to limit of the newest messages stored for a
+// guild under version, oldest first
+func (r *RAGRetriever) RecentMessages(ctx context.Context, guildID, version string, limit int) ([]models.DiscordMessage, error) {
+	return r.store.Recent(ctx, guildID, "", version, limit)
+}
+
+// CountMessagesByVersion returns how many of a guild's messages have an
+// embedding under each version
+func (r *RAGRetriever) CountMessagesByVersion(ctx context.Context, guildID string) (map[string]int64, error) {
+	return r.store.CountByVersion(ctx, guildID)
+}
+
+// DeleteMessages removes stored messages by Discord message ID, under
+// every embedding version
+func (r *RAGRetriever) DeleteMessages(ctx context.Context, messageIDs ...string) error {
+	return r.store.Delete(ctx, messageIDs...)
+}
+
+// embedRetryDelay is the wait before the first embedding retry, doubled
+// for each one after
+var embedRetryDelay = time.Second
+
+// failedEmbeddingRecorder is where dead-lettered messages are kept
+type failedEmbeddingRecorder interface {
+	RecordFailedEmbedding(ctx context.Context, failed *models.FailedEmbedding) error
+}
+
+// ErrEmbeddingRetrying is returned by StoreMessageWithEmbedding when the
+// message couldn't be embedded yet and is being retried in the background
+var ErrEmbeddingRetrying = errors.New("embedding failed, retrying in the background")
+
+// embedMessage embeds a message's content. A failure isn't retried here:
+// with retries configured, the message is handed to retryEmbedding and
+// ErrEmbeddingRetrying is returned; otherwise it is dead-lettered.
+func (r *RAGRetriever) embedMessage(ctx context.Context, message *models.DiscordMessage) ([]float32, error) {
+	embedding, err := r.AI.GenerateEmbedding(ctx, r.embeddingText(embeddingSource(message)))
+	if err == nil {
+		return embedding, nil
+	}
+	if r.cfg.EmbedMaxRetries <= 0 {
+		r.deadLetter(message, 1, err)
+		return nil, fmt.Errorf("failed to generate embedding: %v", err)
+	}
+
+	log.Printf("Embedding message %s failed, retrying in the background: %v", message.MessageID, err)
+	go r.retryEmbedding(message, err)
+	return nil, fmt.Errorf("%w: %v", ErrEmbeddingRetrying, err)
+}
+
+// retryEmbedding retries embedding a message that failed once, up to
+// EmbedMaxRetries times within EmbedRetryTimeout, and stores it once it
+// succeeds. It runs on its own so the backoff never holds up ingestion or
+// the caller's deadline, and a message that still fails, or runs out of
+// time, is dead-lettered rather than retried forever.
+func (r *RAGRetriever) retryEmbedding(message *models.DiscordMessage, cause error) {
+	ctx := ai.WithGuildID(context.Background(), message.GuildID)
+	if r.cfg.EmbedRetryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.EmbedRetryTimeout)
+		defer cancel()
+	}
+
+	delay := embedRetryDelay
+	for attempt := 2; attempt <= r.cfg.EmbedMaxRetries+1; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			r.deadLetter(message, attempt-1, fmt.Errorf("retries timed out after %s: %v", r.cfg.EmbedRetryTimeout, cause))
+			return
+		}
+		delay *= 2
+
+		embedding, err := r.AI.GenerateEmbedding(ctx, r.embeddingText(embeddingSource(message)))
+		if err != nil {
+			cause = err
+			log.Printf("Embedding message %s failed (attempt %d/%d): %v", message.MessageID, attempt, r.cfg.EmbedMaxRetries+1, err)
+			continue
+		}
+
+		message.SetEmbedding(embedding)
+		if err := r.store.Upsert(ctx, message); err != nil {
+			log.Printf("Error storing message %s after retrying its embedding: %v", message.MessageID, err)
+			return
+		}
+		r.enforceMessageCap(message.GuildID)
+		return
+	}
+	r.deadLetter(message, r.cfg.EmbedMaxRetries+1, cause)
+}
+
+// deadLetter records a message that exhausted its embedding retries. The
+// retries' context may be what ran out, so the record doesn't use it.
+func (r *RAGRetriever) deadLetter(message *models.DiscordMessage, attempts int, cause error) {
+	log.Printf("Giving up embedding message %s in guild %s after %d attempts: %v", message.MessageID, message.GuildID, attempts, cause)
+
+	failed := &models.FailedEmbedding{
+		MessageID: message.MessageID,
+		GuildID:   message.GuildID,
+		ChannelID: message.ChannelID,
+		Author:    message.Author,
+		Content:   message.Content,
+		Attempts:  attempts,
+		LastError: cause.Error(),
+	}
+	if err := r.deadLetters.RecordFailedEmbedding(context.Background(), failed); err != nil {
+		log.Printf("Error recording failed embedding for message %s: %v", message.MessageID, err)
+	}
+}
+
+func (r *RAGRetriever) markRetrieved(messages []models.DiscordMessage) {
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.MessageID
+	}
+	if err := r.store.MarkRetrieved(context.Background(), ids, time.Now()); err != nil {
+		log.Printf("Error marking messages retrieved: %v", err)
+	}
+}
+
+// enforceMessageCap evicts a guild's excess messages in the background, at
+// most once per evictionInterval
+func (r *RAGRetriever) enforceMessageCap(guildID string) {
+	if r.cfg.MaxMessagesPerGuild <= 0 || guildID == "" {
+		return
+	}
+
+	now := time.Now()
+	if last, ok := r.lastEviction.Load(guildID); ok && now.Sub(last.(time.Time)) < evictionInterval {
+		return
+	}
+	r.lastEviction.Store(guildID, now)
+
+	go func() {
+		evicted, err := r.store.Evict(context.Background(), guildID, r.cfg.MaxMessagesPerGuild, r.cfg.EvictionPolicy)
+		if err != nil {
+			log.Printf("Error evicting messages for guild %s: %v", guildID, err)
+			return
+		}
+		if evicted > 0 {
+			log.Printf("Evicted %d stored messages from guild %s (cap %d, policy %s)", evicted, guildID, r.cfg.MaxMessagesPerGuild, r.cfg.EvictionPolicy)
+		}
+	}()
 }
@@ -0,0 +1,681 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deadLetterChan collects dead-lettered messages
+type deadLetterChan chan *models.FailedEmbedding
+
+func (c deadLetterChan) RecordFailedEmbedding(ctx context.Context, failed *models.FailedEmbedding) error {
+	c <- failed
+	return nil
+}
+
+// newTestRetriever returns a retriever over a MemoryStore, in-memory guild
+// settings and a fake OpenAI, dead-lettering to the returned channel. It
+// has no database, so only the paths that don't need one can be used.
+func newTestRetriever(t *testing.T, cfg config.RAGConfig) (*RAGRetriever, *MemoryStore, *fakeOpenAI, deadLetterChan) {
+	t.Helper()
+
+	if cfg.EmbeddingVersion == "" {
+		cfg.EmbeddingVersion = "v1"
+	}
+	aiService, fake := newTestAI(t, config.AIConfig{})
+	store := NewMemoryStore()
+	r := NewRAGRetrieverWithStore(nil, store, aiService, cfg)
+	r.settings = newMemorySettings()
+	deadLetters := make(deadLetterChan, 10)
+	r.deadLetters = deadLetters
+	return r, store, fake, deadLetters
+}
+
+// shortRetries shortens the embedding retry backoff for the test
+func shortRetries(t *testing.T) {
+	delay := embedRetryDelay
+	embedRetryDelay = time.Millisecond
+	t.Cleanup(func() { embedRetryDelay = delay })
+}
+
+func awaitDeadLetter(t *testing.T, deadLetters deadLetterChan) *models.FailedEmbedding {
+	t.Helper()
+	select {
+	case failed := <-deadLetters:
+		return failed
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was never dead-lettered")
+		return nil
+	}
+}
+
+func TestEmbeddingFailureWithoutRetriesDeadLetters(t *testing.T) {
+	r, store, fake, deadLetters := newTestRetriever(t, config.RAGConfig{})
+	fake.failNext(1)
+
+	err := r.StoreMessageWithEmbedding(context.Background(), testMessage("m1", "g1", "", "hello there", 0))
+	if err == nil || errors.Is(err, ErrEmbeddingRetrying) {
+		t.Fatalf("StoreMessageWithEmbedding error = %v, want a plain failure", err)
+	}
+
+	failed := awaitDeadLetter(t, deadLetters)
+	if failed.MessageID != "m1" || failed.Attempts != 1 || failed.Content != "hello there" {
+		t.Errorf("dead letter = %+v, want m1 after 1 attempt", failed)
+	}
+	if ids := storedIDs(t, store, "g1", "v1"); len(ids) != 0 {
+		t.Errorf("failed message was stored: %v", ids)
+	}
+}
+
+func TestEmbeddingRetriesExhaustedDeadLetters(t *testing.T) {
+	shortRetries(t)
+	r, store, fake, deadLetters := newTestRetriever(t, config.RAGConfig{EmbedMaxRetries: 2})
+	fake.failNext(3)
+
+	err := r.StoreMessageWithEmbedding(context.Background(), testMessage("m1", "g1", "", "hello there", 0))
+	if !errors.Is(err, ErrEmbeddingRetrying) {
+		t.Fatalf("StoreMessageWithEmbedding error = %v, want ErrEmbeddingRetrying", err)
+	}
+
+	failed := awaitDeadLetter(t, deadLetters)
+	if failed.Attempts != 3 || !strings.Contains(failed.LastError, "simulated failure") {
+		t.Errorf("dead letter = %+v, want 3 attempts with the provider's error", failed)
+	}
+	if requests, _ := fake.embedded(); requests != 3 {
+		t.Errorf("%d embedding requests, want the first and 2 retries", requests)
+	}
+	if ids := storedIDs(t, store, "g1", "v1"); len(ids) != 0 {
+		t.Errorf("failed message was stored: %v", ids)
+	}
+}
+
+func TestEmbeddingRetrySucceeds(t *testing.T) {
+	shortRetries(t)
+	r, store, fake, deadLetters := newTestRetriever(t, config.RAGConfig{EmbedMaxRetries: 2})
+	fake.failNext(2)
+
+	err := r.StoreMessageWithEmbedding(context.Background(), testMessage("m1", "g1", "", "hello there", 0))
+	if !errors.Is(err, ErrEmbeddingRetrying) {
+		t.Fatalf("StoreMessageWithEmbedding error = %v, want ErrEmbeddingRetrying", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(storedIDs(t, store, "g1", "v1")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("message wasn't stored after its last retry succeeded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case failed := <-deadLetters:
+		t.Errorf("message dead-lettered although a retry succeeded: %+v", failed)
+	default:
+	}
+}
+
+func TestEmbeddingRetryTimeoutDeadLetters(t *testing.T) {
+	delay := embedRetryDelay
+	embedRetryDelay = time.Second
+	t.Cleanup(func() { embedRetryDelay = delay })
+
+	r, _, fake, deadLetters := newTestRetriever(t, config.RAGConfig{EmbedMaxRetries: 5, EmbedRetryTimeout: 20 * time.Millisecond})
+	fake.failNext(1)
+
+	if err := r.StoreMessageWithEmbedding(context.Background(), testMessage("m1", "g1", "", "hello there", 0)); !errors.Is(err, ErrEmbeddingRetrying) {
+		t.Fatalf("StoreMessageWithEmbedding error = %v, want ErrEmbeddingRetrying", err)
+	}
+
+	// The retry budget ran out before the first retry was due
+	failed := awaitDeadLetter(t, deadLetters)
+	if failed.Attempts != 1 || !strings.Contains(failed.LastError, "timed out") {
+		t.Errorf("dead letter = %+v, want 1 attempt and a timeout", failed)
+	}
+}
+
+func TestFormatContextSources(t *testing.T) {
+	similar := []models.DiscordMessage{
+		{MessageID: "1", Author: "u1", Username: "ann", Content: "game night is friday\nbring snacks", Timestamp: baseTime},
+	}
+	recent := []models.DiscordMessage{
+		similar[0],
+		{MessageID: "2", Author: "u2", Username: "bob", Content: "see you there", Timestamp: baseTime.Add(time.Minute)},
+	}
+	interactions := []models.BotInteraction{
+		{UserID: "u2", Username: "bob", Query: "when?", Response: "Friday.\n\nAt 21:00."},
+	}
+
+	found := formatContext(similar, recent, interactions, newAuthorNamer(AuthorNamesReal, "g1"), defaultPromptTemplates())
+	if len(found.Sources) != 3 {
+		t.Fatalf("%d sources, want one per message and answer: %q", len(found.Sources), found.Sources)
+	}
+	// Multi-line entries stay whole rather than being split
+	for i, want := range []string{"bring snacks", "see you there", "At 21:00."} {
+		if !strings.Contains(found.Sources[i], want) {
+			t.Errorf("source %d = %q, want it to contain %q", i+1, found.Sources[i], want)
+		}
+		if !strings.Contains(found.Text, found.Sources[i]) {
+			t.Errorf("source %d isn't in the context text", i+1)
+		}
+	}
+}
+
+// withCancelAfter returns a context cancelled after d
+func withCancelAfter(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	time.AfterFunc(d, cancel)
+	return ctx
+}
+
+// A request stuck on OpenAI must end as soon as its caller gives up, well
+// before the client's own timeouts
+func TestCancelAbortsRetrieval(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{})
+	fake.hangRequests()
+
+	start := time.Now()
+	_, err := r.SearchContextInRange(withCancelAfter(t, 50*time.Millisecond), "what happened", "g1", "c1", "", 5, database.TimeRange{})
+	if err == nil {
+		t.Fatal("SearchContextInRange succeeded after being cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("SearchContextInRange returned %s after being cancelled", elapsed)
+	}
+	if _, ok := r.cache.get(cacheKey("what happened", "g1", "c1", "", "v1", AuthorNamesReal, 5, database.TimeRange{})); ok {
+		t.Error("cancelled retrieval was cached")
+	}
+}
+
+func TestCancelAbortsGeneration(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{})
+	fake.hangRequests()
+
+	start := time.Now()
+	response, err := r.GenerateResponse(withCancelAfter(t, 50*time.Millisecond), "what happened", RetrievedContext{Text: "some context"}, "ann", "g1", "Guild")
+	if err == nil {
+		t.Fatalf("GenerateResponse = %q after being cancelled, want an error rather than a fallback answer", response)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GenerateResponse returned %s after being cancelled", elapsed)
+	}
+}
+
+func TestCancelledBeforeGeneration(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := r.GenerateResponse(ctx, "what happened", RetrievedContext{Text: "some context"}, "ann", "g1", "Guild"); err == nil {
+		t.Error("GenerateResponse succeeded with a cancelled context")
+	}
+	if prompts := fake.userPrompts(); len(prompts) != 0 {
+		t.Errorf("%d completions requested with a cancelled context", len(prompts))
+	}
+}
+
+func TestRecentActivityChannelScope(t *testing.T) {
+	for _, guildWide := range []bool{false, true} {
+		r, store, _, _ := newTestRetriever(t, config.RAGConfig{RecentMessages: 3, RecentGuildWide: guildWide})
+		other := testMessage("m2", "g1", "v1", "elsewhere", 2)
+		other.ChannelID = "c2"
+		upsertAll(t, store, testMessage("m1", "g1", "v1", "here", 1), other)
+
+		var ids []string
+		for _, msg := range r.recentActivity(context.Background(), "g1", "c1", "v1", r.recentLimit("", 5), database.TimeRange{}) {
+			ids = append(ids, msg.MessageID)
+		}
+		want := []string{"m1"}
+		if guildWide {
+			want = []string{"m1", "m2"}
+		}
+		if !slices.Equal(ids, want) {
+			t.Errorf("RecentGuildWide=%v: recent activity = %v, want %v", guildWide, ids, want)
+		}
+	}
+}
+
+func TestRecentLimit(t *testing.T) {
+	r := &RAGRetriever{cfg: config.RAGConfig{RecentMessages: 3}}
+	if got := r.recentLimit("", 5); got != 3 {
+		t.Errorf("recentLimit = %d, want the configured 3", got)
+	}
+	if got := r.recentLimit(retrievalRecent, 5); got != 5 {
+		t.Errorf("recentLimit in recent-only mode = %d, want the search limit 5", got)
+	}
+}
+
+func TestRetrievalModes(t *testing.T) {
+	tests := []struct {
+		mode     string
+		embeds   bool
+		similar  []string
+		recent   []string
+		sections []string
+	}{
+		// Similar messages alone aren't given a heading
+		{retrievalSemantic, true, []string{"m1"}, nil, nil},
+		{retrievalRecent, false, nil, []string{"m1", "m2", "m3"}, []string{recentHeading}},
+		{"hybrid", true, []string{"m1"}, []string{"m2", "m3"}, []string{similarHeading, recentHeading}},
+	}
+	for _, tt := range tests {
+		r, store, fake, _ := newTestRetriever(t, config.RAGConfig{RetrievalMode: tt.mode, RecentMessages: 2, MaxDistance: 0.5})
+		upsertAll(t, store,
+			testMessage("m1", "g1", "v1", "game night is on friday", 0),
+			testMessage("m2", "g1", "v1", "lunch plans", 1),
+			testMessage("m3", "g1", "v1", "see you all", 2),
+		)
+
+		found, err := r.SearchContextInRange(context.Background(), "when is game night?", "g1", "c1", "", 3, database.TimeRange{})
+		if err != nil {
+			t.Fatalf("mode %s: %v", tt.mode, err)
+		}
+		if !strings.Contains(found.Text, "game night is on friday") {
+			t.Errorf("mode %s: context = %q, want the game night message", tt.mode, found.Text)
+		}
+		if requests, _ := fake.embedded(); (requests > 0) != tt.embeds {
+			t.Errorf("mode %s: %d embedding requests, want embedding %v", tt.mode, requests, tt.embeds)
+		}
+		if ids := messageIDs(found.similar); !slices.Equal(ids, tt.similar) {
+			t.Errorf("mode %s: similar = %v, want %v", tt.mode, ids, tt.similar)
+		}
+		var recent []string
+		for _, msg := range found.recent {
+			if !slices.Contains(tt.similar, msg.MessageID) {
+				recent = append(recent, msg.MessageID)
+			}
+		}
+		if !slices.Equal(recent, tt.recent) {
+			t.Errorf("mode %s: recent = %v, want %v", tt.mode, recent, tt.recent)
+		}
+		for _, heading := range []string{similarHeading, recentHeading} {
+			if strings.Contains(found.Text, heading) != slices.Contains(tt.sections, heading) {
+				t.Errorf("mode %s: context has %q = %v, want sections %q:\n%s", tt.mode, heading, !slices.Contains(tt.sections, heading), tt.sections, found.Text)
+			}
+		}
+	}
+}
+
+func TestMergeRecent(t *testing.T) {
+	at := func(id string, minutes int) models.DiscordMessage {
+		return models.DiscordMessage{MessageID: id, Content: "stored " + id, Timestamp: baseTime.Add(time.Duration(minutes) * time.Minute)}
+	}
+	live := func(id string, minutes int) models.DiscordMessage {
+		msg := at(id, minutes)
+		msg.Content = "live " + id
+		return msg
+	}
+	tests := []struct {
+		name         string
+		stored, live []models.DiscordMessage
+		want         []string
+	}{
+		{"no live messages", []models.DiscordMessage{at("1", 0), at("2", 1)}, nil, []string{"stored 1", "stored 2"}},
+		{"nothing stored", nil, []models.DiscordMessage{live("1", 0)}, []string{"live 1"}},
+		{"interleaved", []models.DiscordMessage{at("1", 0), at("3", 2)}, []models.DiscordMessage{live("2", 1), live("4", 3)}, []string{"stored 1", "live 2", "stored 3", "live 4"}},
+		// The stored copy of a message is the one kept
+		{"overlap", []models.DiscordMessage{at("1", 0), at("2", 1)}, []models.DiscordMessage{live("2", 1), live("3", 2)}, []string{"stored 1", "stored 2", "live 3"}},
+		{"live duplicates", nil, []models.DiscordMessage{live("1", 0), live("1", 0)}, []string{"live 1"}},
+		// Messages sent in the same second keep their order
+		{"same time", []models.DiscordMessage{at("1", 0)}, []models.DiscordMessage{live("2", 0)}, []string{"stored 1", "live 2"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, msg := range mergeRecent(tt.stored, tt.live) {
+			got = append(got, msg.Content)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: mergeRecent = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeLive is a LiveMessageSource returning fixed messages
+type fakeLive struct {
+	messages []models.DiscordMessage
+	err      error
+	limit    int
+}
+
+func (f *fakeLive) RecentChannelMessages(ctx context.Context, channelID string, limit int) ([]models.DiscordMessage, error) {
+	f.limit = limit
+	return f.messages, f.err
+}
+
+func TestRecentActivityMergesLive(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{RecentMessages: 5, LiveMessages: 3})
+	upsertAll(t, store, testMessage("m1", "g1", "v1", "stored", 0), testMessage("m2", "g1", "v1", "stored", 2))
+	live := &fakeLive{messages: []models.DiscordMessage{
+		{MessageID: "m2", Content: "live", Timestamp: baseTime.Add(2 * time.Minute)},
+		{MessageID: "m3", Content: "not stored yet", Timestamp: baseTime.Add(3 * time.Minute)},
+	}}
+	r.SetLiveSource(live)
+
+	recent := r.recentActivity(context.Background(), "g1", "c1", "v1", 5, database.TimeRange{})
+	if ids := messageIDs(recent); !slices.Equal(ids, []string{"m1", "m2", "m3"}) {
+		t.Errorf("recent activity = %v, want stored and live messages once each", ids)
+	}
+	if live.limit != 3 {
+		t.Errorf("asked for %d live messages, want the configured 3", live.limit)
+	}
+
+	// A failing live source leaves the stored messages
+	live.messages, live.err = nil, errors.New("discord down")
+	recent = r.recentActivity(context.Background(), "g1", "c1", "v1", 5, database.TimeRange{})
+	if ids := messageIDs(recent); !slices.Equal(ids, []string{"m1", "m2"}) {
+		t.Errorf("recent activity with the live source failing = %v, want the stored messages", ids)
+	}
+}
+
+func TestCategoryScope(t *testing.T) {
+	tests := []struct {
+		mode       string
+		boost      float64
+		categoryID string
+		want       database.CategoryScope
+	}{
+		{categoryModeBoost, 0.2, "games", database.CategoryScope{CategoryID: "games", Boost: 0.2}},
+		{categoryModeOnly, 0.2, "games", database.CategoryScope{CategoryID: "games", Only: true}},
+		{"off", 0.2, "games", database.CategoryScope{}},
+		{"", 0.2, "games", database.CategoryScope{}},
+		// A channel outside any category searches the whole guild
+		{categoryModeOnly, 0.2, "", database.CategoryScope{}},
+		{categoryModeBoost, 0.2, "", database.CategoryScope{}},
+		// Boosts outside (0, 1) would hide or invert distances
+		{categoryModeBoost, 0, "games", database.CategoryScope{}},
+		{categoryModeBoost, 1, "games", database.CategoryScope{}},
+		{categoryModeBoost, -0.5, "games", database.CategoryScope{}},
+	}
+	for _, tt := range tests {
+		r := &RAGRetriever{cfg: config.RAGConfig{CategoryMode: tt.mode, CategoryBoost: tt.boost}}
+		if got := r.categoryScope(tt.categoryID); got != tt.want {
+			t.Errorf("categoryScope(%q) with mode %q and boost %v = %+v, want %+v", tt.categoryID, tt.mode, tt.boost, got, tt.want)
+		}
+	}
+}
+
+func TestCategoryOnlyRetrieval(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{CategoryMode: categoryModeOnly})
+	here := testMessage("m1", "g1", "v1", "game night is on friday", 0)
+	here.CategoryID = "games"
+	elsewhere := testMessage("m2", "g1", "v1", "game night is on friday", 1)
+	elsewhere.CategoryID = "events"
+	upsertAll(t, store, here, elsewhere)
+
+	for categoryID, want := range map[string][]string{"games": {"m1"}, "events": {"m2"}} {
+		found, err := r.SearchContextInRange(context.Background(), "when is game night?", "g1", "c1", categoryID, 5, database.TimeRange{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := messageIDs(found.similar); !slices.Equal(ids, want) {
+			t.Errorf("asked in category %s: found %v, want %v", categoryID, ids, want)
+		}
+	}
+}
+
+func TestLanguageInstruction(t *testing.T) {
+	tests := []struct {
+		setting  string
+		detected string
+		want     string
+	}{
+		{"", "French", ""},
+		{"German", "", "Always respond in German"},
+		{"German", "French", "Always respond in German"},
+		{"auto", "French", "Respond in French, the language the user is speaking"},
+		{"AUTO", "", "Respond in the same language as the user's question"},
+	}
+	for _, tt := range tests {
+		got := languageInstruction(tt.setting, tt.detected)
+		if (tt.want == "" && got != "") || !strings.Contains(got, tt.want) {
+			t.Errorf("languageInstruction(%q, %q) = %q, want it to contain %q", tt.setting, tt.detected, got, tt.want)
+		}
+	}
+}
+
+func TestResponseLanguageInPrompt(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{ResponseLanguage: "auto"})
+
+	if _, err := r.GenerateResponseWithHistory(context.Background(), "quoi de neuf ?", RetrievedContext{Text: "some context"}, "", "French", "ann", "g1", "Guild"); err != nil {
+		t.Fatalf("GenerateResponseWithHistory: %v", err)
+	}
+	if _, err := r.GenerateResponse(context.Background(), "what's new?", RetrievedContext{Text: "some context"}, "ann", "g1", "Guild"); err != nil {
+		t.Fatalf("GenerateResponse: %v", err)
+	}
+
+	systems := fake.systemPrompts()
+	if len(systems) != 2 {
+		t.Fatalf("%d completions requested, want 2", len(systems))
+	}
+	if want := languageInstruction("auto", "French"); !strings.Contains(systems[0], want) {
+		t.Errorf("system prompt with a detected language doesn't contain %q:\n%s", want, systems[0])
+	}
+	if want := languageInstruction("auto", ""); !strings.Contains(systems[1], want) {
+		t.Errorf("system prompt doesn't contain %q:\n%s", want, systems[1])
+	}
+}
+
+func TestResponseLanguageUnset(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{})
+
+	if _, err := r.GenerateResponseWithHistory(context.Background(), "quoi de neuf ?", RetrievedContext{Text: "some context"}, "", "French", "ann", "g1", "Guild"); err != nil {
+		t.Fatalf("GenerateResponseWithHistory: %v", err)
+	}
+	if systems := fake.systemPrompts(); len(systems) != 1 || strings.Contains(systems[0], "French") {
+		t.Errorf("system prompts = %q, want no language instruction", systems)
+	}
+}
+
+func TestEmptyContextModes(t *testing.T) {
+	const reply = "I don't know this server yet."
+	tests := []struct {
+		mode      string
+		context   string
+		want      string
+		completed bool
+		prompt    string
+	}{
+		{"answer", "", "answer", true, ""},
+		{"", " \n", "answer", true, ""},
+		{emptyContextInstruct, "", "answer", true, noHistoryContext},
+		{emptyContextReply, "", reply, false, ""},
+		// Retrieved history is used whatever the mode
+		{emptyContextInstruct, "ann: game night is friday", "answer", true, "ann: game night is friday"},
+		{emptyContextReply, "ann: game night is friday", "answer", true, "ann: game night is friday"},
+	}
+	for _, tt := range tests {
+		r, _, fake, _ := newTestRetriever(t, config.RAGConfig{EmptyContextMode: tt.mode, EmptyContextReply: reply})
+
+		got, err := r.GenerateResponse(context.Background(), "when is game night?", RetrievedContext{Text: tt.context}, "ann", "g1", "Guild")
+		if err != nil {
+			t.Fatalf("mode %q: GenerateResponse: %v", tt.mode, err)
+		}
+		if got != tt.want {
+			t.Errorf("mode %q with context %q: answer = %q, want %q", tt.mode, tt.context, got, tt.want)
+		}
+
+		systems := fake.systemPrompts()
+		if completed := len(systems) > 0; completed != tt.completed {
+			t.Errorf("mode %q with context %q: model asked = %v, want %v", tt.mode, tt.context, completed, tt.completed)
+			continue
+		}
+		if tt.completed && tt.prompt != "" && !strings.Contains(systems[0], tt.prompt) {
+			t.Errorf("mode %q with context %q: system prompt doesn't contain %q:\n%s", tt.mode, tt.context, tt.prompt, systems[0])
+		}
+		if tt.completed && tt.prompt == "" && strings.Contains(systems[0], noHistoryContext) {
+			t.Errorf("mode %q: system prompt says there's no history", tt.mode)
+		}
+	}
+}
+
+func TestBotNameInPrompt(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{})
+	r.SetBotName("Jarvis")
+	if err := r.SetGuildBotName("g2", "Friday"); err != nil {
+		t.Fatalf("SetGuildBotName: %v", err)
+	}
+
+	for _, guildID := range []string{"g1", "g2", ""} {
+		if _, err := r.GenerateResponse(context.Background(), "hi", RetrievedContext{Text: "some context"}, "ann", guildID, "Guild"); err != nil {
+			t.Fatalf("GenerateResponse in %q: %v", guildID, err)
+		}
+	}
+
+	systems := fake.systemPrompts()
+	if len(systems) != 3 {
+		t.Fatalf("%d completions requested, want 3", len(systems))
+	}
+	for i, want := range []string{persona("Jarvis"), persona("Friday"), persona("Jarvis")} {
+		if !strings.Contains(systems[i], want) {
+			t.Errorf("system prompt %d doesn't introduce the bot as %q:\n%s", i, want, systems[i])
+		}
+	}
+}
+
+func TestBotNameUnset(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{})
+
+	if name := r.BotName("g1"); name != "" {
+		t.Errorf("BotName = %q, want none", name)
+	}
+	if _, err := r.GenerateResponse(context.Background(), "hi", RetrievedContext{Text: "some context"}, "ann", "g1", "Guild"); err != nil {
+		t.Fatalf("GenerateResponse: %v", err)
+	}
+	if systems := fake.systemPrompts(); len(systems) != 1 || !strings.Contains(systems[0], "You are a helpful Discord bot assistant") {
+		t.Errorf("system prompts = %q, want the unnamed persona", systems)
+	}
+}
+
+// fakeInteractions returns canned past answers, counting searches
+type fakeInteractions struct {
+	found    []models.BotInteraction
+	searches int
+}
+
+func (f *fakeInteractions) SearchSimilarInteractions(ctx context.Context, embedding []float32, guildID, version string, limit int) ([]models.BotInteraction, error) {
+	f.searches++
+	return f.found[:min(limit, len(f.found))], nil
+}
+
+func TestRetrievalIncludesInteractions(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{IncludeInteractions: true, InteractionLimit: 1})
+	interactions := &fakeInteractions{found: []models.BotInteraction{
+		{UserID: "u1", Username: "ann", Query: "when is game night?", Response: "Fridays at 21:00"},
+		{UserID: "u2", Username: "bob", Query: "where?", Response: "In #games"},
+	}}
+	r.interactions = interactions
+	upsertAll(t, store, testMessage("m1", "g1", "v1", "game night moved", 1))
+
+	found, err := r.SearchContextInRange(context.Background(), "when is game night", "g1", "c1", "", 5, database.TimeRange{})
+	if err != nil {
+		t.Fatalf("SearchContextInRange: %v", err)
+	}
+	if interactions.searches != 1 {
+		t.Errorf("%d interaction searches, want 1", interactions.searches)
+	}
+	want := interactionsHeading + "\nann asked: when is game night?\nYou answered: Fridays at 21:00"
+	if !strings.Contains(found.Text, want) {
+		t.Errorf("context doesn't contain the past answer:\n%s", found.Text)
+	}
+	if strings.Contains(found.Text, "bob") {
+		t.Errorf("context has more past answers than the limit:\n%s", found.Text)
+	}
+	if last := found.Sources[len(found.Sources)-1]; !strings.HasPrefix(last, "ann asked:") {
+		t.Errorf("last source = %q, want the past answer", last)
+	}
+}
+
+func TestRetrievalWithoutInteractions(t *testing.T) {
+	configs := map[string]config.RAGConfig{
+		"disabled":    {InteractionLimit: 1},
+		"no limit":    {IncludeInteractions: true},
+		"recent only": {IncludeInteractions: true, InteractionLimit: 1, RetrievalMode: retrievalRecent, RecentMessages: 5},
+	}
+	for name, cfg := range configs {
+		r, _, _, _ := newTestRetriever(t, cfg)
+		interactions := &fakeInteractions{found: []models.BotInteraction{{Username: "ann", Query: "q", Response: "a"}}}
+		r.interactions = interactions
+
+		found, err := r.SearchContextInRange(context.Background(), "when is game night", "g1", "c1", "", 5, database.TimeRange{})
+		if err != nil {
+			t.Fatalf("%s: SearchContextInRange: %v", name, err)
+		}
+		if interactions.searches != 0 || strings.Contains(found.Text, interactionsHeading) {
+			t.Errorf("%s: past answers searched %d times, context:\n%s", name, interactions.searches, found.Text)
+		}
+	}
+}
+
+func TestContextTooLongRetriesWithFewerMessages(t *testing.T) {
+	r, _, fake, _ := newTestRetriever(t, config.RAGConfig{})
+	fake.tooLong = 1
+	var similar []models.DiscordMessage
+	for i, content := range []string{"game night is friday\nbring snacks", "it starts at 21:00", "bob hosts\nat his place", "ann brings cards"} {
+		similar = append(similar, models.DiscordMessage{MessageID: strconv.Itoa(i), Author: "u1", Username: "ann", Content: content, Timestamp: baseTime})
+	}
+	retrieved := formatContext(similar, nil, nil, newAuthorNamer(AuthorNamesReal, "g1"), r.prompts)
+
+	response, err := r.GenerateResponse(context.Background(), "when is game night?", retrieved, "ann", "g1", "Guild")
+	if err != nil || response != "answer" {
+		t.Fatalf("GenerateResponse = %q, %v, want the answer from the retry", response, err)
+	}
+
+	systems := fake.systemPrompts()
+	if len(systems) != 2 {
+		t.Fatalf("%d completions requested, want the first and one retry", len(systems))
+	}
+	if !strings.Contains(systems[0], retrieved.Text) {
+		t.Fatalf("first system prompt doesn't contain the full context:\n%s", systems[0])
+	}
+	// The retry keeps the higher-ranked half, each message whole
+	trimmed := formatContext(similar[:2], nil, nil, newAuthorNamer(AuthorNamesReal, "g1"), r.prompts)
+	if !strings.Contains(systems[1], trimmed.Text) {
+		t.Errorf("retry system prompt doesn't contain the top two messages:\n%s", systems[1])
+	}
+	for _, dropped := range []string{"bob hosts", "at his place", "ann brings cards"} {
+		if strings.Contains(systems[1], dropped) {
+			t.Errorf("retry system prompt still contains %q from a lower-ranked message", dropped)
+		}
+	}
+}
+
+func TestRedactInteraction(t *testing.T) {
+	const query, response = "où est la soirée ?", "Chez Bob."
+	tests := []struct {
+		mode                string
+		kept                bool
+		wantQuery, wantResp string
+	}{
+		{"", true, query, response},
+		{"full", true, query, response},
+		{interactionLoggingHash, false, hashText(query), hashText(response)},
+		{interactionLoggingMetadata, false, "", ""},
+	}
+	for _, tt := range tests {
+		interaction := &models.BotInteraction{Query: query, Response: response}
+		if kept := redactInteraction(tt.mode, interaction); kept != tt.kept {
+			t.Errorf("mode %q: kept = %v, want %v", tt.mode, kept, tt.kept)
+		}
+		if interaction.Query != tt.wantQuery || interaction.Response != tt.wantResp {
+			t.Errorf("mode %q: stored %q / %q, want %q / %q", tt.mode, interaction.Query, interaction.Response, tt.wantQuery, tt.wantResp)
+		}
+		// Lengths are of the original text, in characters
+		if interaction.QueryLength != 18 || interaction.ResponseLength != 9 {
+			t.Errorf("mode %q: lengths = %d, %d, want 18, 9", tt.mode, interaction.QueryLength, interaction.ResponseLength)
+		}
+		if got := QueryRedacted(interaction); got == tt.kept {
+			t.Errorf("mode %q: QueryRedacted = %v", tt.mode, got)
+		}
+	}
+
+	if hashText(query) == hashText(response) || !strings.HasPrefix(hashText(query), hashPrefix) {
+		t.Errorf("hashText(%q) = %q, want a distinct %s hash", query, hashText(query), hashPrefix)
+	}
+}
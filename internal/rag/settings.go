@@ -0,0 +1,64 @@
+// internal/rag/settings.go
+package rag
+
+import (
+	"discord-rag-bot/internal/models"
+	"fmt"
+)
+
+// guildSettings returns a guild's settings, loading them from the store only
+// the first time. Every setting the retriever reads is written through
+// updateGuildSettings, which keeps the copy in memory current, so answering
+// a question costs no settings query.
+func (r *RAGRetriever) guildSettings(guildID string) (*models.GuildSettings, error) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	if settings, ok := r.settingsCache[guildID]; ok {
+		return &settings, nil
+	}
+
+	settings, err := r.settings.GetGuildSettings(guildID)
+	if err != nil {
+		return nil, err
+	}
+	if r.settingsCache == nil {
+		r.settingsCache = make(map[string]models.GuildSettings)
+	}
+	r.settingsCache[guildID] = *settings
+	return settings, nil
+}
+
+// updateGuildSettings applies change to a guild's settings and saves them.
+// They are loaded from the store rather than memory so fields the bot saves
+// directly, like the channel allowlist, aren't overwritten with stale ones.
+func (r *RAGRetriever) updateGuildSettings(guildID string, change func(settings *models.GuildSettings)) error {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	settings, err := r.settings.GetGuildSettings(guildID)
+	if err != nil {
+		return fmt.Errorf("failed to load guild settings: %v", err)
+	}
+
+	change(settings)
+	if err := r.settings.SaveGuildSettings(settings); err != nil {
+		delete(r.settingsCache, guildID)
+		return err
+	}
+	if r.settingsCache == nil {
+		r.settingsCache = make(map[string]models.GuildSettings)
+	}
+	r.settingsCache[guildID] = *settings
+	return nil
+}
+
+// ForgetGuild drops everything the retriever keeps in memory for a guild,
+// for when its stored data has been purged
+func (r *RAGRetriever) ForgetGuild(guildID string) {
+	r.settingsMu.Lock()
+	delete(r.settingsCache, guildID)
+	r.settingsMu.Unlock()
+
+	r.cache.invalidateGuild(guildID)
+}
@@ -0,0 +1,149 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/config"
+	"discord-rag-bot/internal/database"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestChatModelSetAndGet(t *testing.T) {
+	r, _, _, _ := newTestRetriever(t, config.RAGConfig{})
+
+	if got := r.ChatModel("g1"); got != openai.GPT4oMini {
+		t.Fatalf("ChatModel = %q before any override, want the default %q", got, openai.GPT4oMini)
+	}
+	if err := r.SetChatModel("g1", openai.GPT4o); err != nil {
+		t.Fatalf("SetChatModel: %v", err)
+	}
+	if got := r.ChatModel("g1"); got != openai.GPT4o {
+		t.Errorf("ChatModel = %q after switching, want %q", got, openai.GPT4o)
+	}
+	if got := r.ChatModel("g2"); got != openai.GPT4oMini {
+		t.Errorf("another guild's model = %q, want the default", got)
+	}
+	if got := r.ChatModel(""); got != openai.GPT4oMini {
+		t.Errorf("model outside a guild = %q, want the default", got)
+	}
+}
+
+func TestChatModelAllowlist(t *testing.T) {
+	r, _, _, _ := newTestRetriever(t, config.RAGConfig{})
+	settings := r.settings.(*memorySettings)
+
+	for _, model := range []string{"gpt-5-turbo-ultra", "", "GPT-4O"} {
+		if err := r.SetChatModel("g1", model); err == nil {
+			t.Errorf("SetChatModel(%q) accepted a model not on the allowlist", model)
+		}
+	}
+	if _, saves := settings.counts(); saves != 0 {
+		t.Errorf("rejected models were saved %d times", saves)
+	}
+
+	// A stored model dropped from the allowlist since falls back
+	stored, _ := settings.GetGuildSettings("g1")
+	stored.ChatModel = "text-davinci-003"
+	settings.SaveGuildSettings(stored)
+	if got := r.ChatModel("g1"); got != openai.GPT4oMini {
+		t.Errorf("ChatModel = %q for an unsupported stored model, want the default", got)
+	}
+
+	for _, model := range ai.SupportedChatModels {
+		if err := r.SetChatModel("g1", model); err != nil {
+			t.Errorf("SetChatModel(%q): %v", model, err)
+		}
+	}
+}
+
+func TestEmbeddingVersionScopesSearch(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{ContextCacheTTL: time.Minute})
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "game night is friday", 1),
+		testMessage("m2", "g1", "v2", "game night is saturday", 2),
+	)
+	search := func() string {
+		t.Helper()
+		found, err := r.SearchContextInRange(context.Background(), "when is game night", "g1", "c1", "", 5, database.TimeRange{})
+		if err != nil {
+			t.Fatalf("SearchContextInRange: %v", err)
+		}
+		return found.Text
+	}
+
+	if text := search(); !strings.Contains(text, "friday") || strings.Contains(text, "saturday") {
+		t.Errorf("context under v1 = %q, want only the v1 message", text)
+	}
+	if err := r.SetEmbeddingVersion(context.Background(), "g1", "v2"); err != nil {
+		t.Fatalf("SetEmbeddingVersion: %v", err)
+	}
+	if got := r.EmbeddingVersion("g1"); got != "v2" {
+		t.Errorf("EmbeddingVersion = %q after switching, want v2", got)
+	}
+	// The same question mustn't be answered from the cached v1 context
+	if text := search(); !strings.Contains(text, "saturday") || strings.Contains(text, "friday") {
+		t.Errorf("context under v2 = %q, want only the v2 message", text)
+	}
+	if got := r.EmbeddingVersion("g2"); got != "v1" {
+		t.Errorf("another guild's version = %q, want the configured v1", got)
+	}
+}
+
+func TestEmbeddingVersionLoadsSettingsOnce(t *testing.T) {
+	r, _, _, _ := newTestRetriever(t, config.RAGConfig{})
+	settings := r.settings.(*memorySettings)
+
+	for range 3 {
+		if got := r.EmbeddingVersion("g1"); got != "v1" {
+			t.Fatalf("EmbeddingVersion = %q, want the configured v1", got)
+		}
+	}
+	if loads, _ := settings.counts(); loads != 1 {
+		t.Errorf("guild settings loaded %d times for three lookups, want once", loads)
+	}
+}
+
+func TestSearchLoadsSettingsOnce(t *testing.T) {
+	r, store, _, _ := newTestRetriever(t, config.RAGConfig{ContextCacheTTL: time.Minute})
+	settings := r.settings.(*memorySettings)
+	upsertAll(t, store, testMessage("m1", "g1", "v1", "game night moved", 1))
+
+	for _, query := range []string{"when is game night", "when is game night", "where is game night"} {
+		if _, err := r.SearchContextInRange(context.Background(), query, "g1", "c1", "", 5, database.TimeRange{}); err != nil {
+			t.Fatalf("SearchContextInRange: %v", err)
+		}
+	}
+	if loads, _ := settings.counts(); loads != 1 {
+		t.Errorf("guild settings loaded %d times for three searches, want once", loads)
+	}
+}
+
+// Settings the bot saves itself survive the retriever saving its own
+func TestUpdateGuildSettingsKeepsOtherFields(t *testing.T) {
+	r, _, _, _ := newTestRetriever(t, config.RAGConfig{})
+	settings := r.settings.(*memorySettings)
+
+	r.ChatModel("g1")
+	stored, _ := settings.GetGuildSettings("g1")
+	stored.ChannelAllowlist = true
+	settings.SaveGuildSettings(stored)
+
+	if err := r.SetChatModel("g1", openai.GPT4o); err != nil {
+		t.Fatalf("SetChatModel: %v", err)
+	}
+	stored, _ = settings.GetGuildSettings("g1")
+	if !stored.ChannelAllowlist || stored.ChatModel != openai.GPT4o {
+		t.Errorf("stored settings = %+v, want the allowlist kept and the new model", stored)
+	}
+
+	r.ForgetGuild("g1")
+	stored.ChatModel = openai.GPT4Turbo
+	settings.SaveGuildSettings(stored)
+	if got := r.ChatModel("g1"); got != openai.GPT4Turbo {
+		t.Errorf("ChatModel = %q after ForgetGuild, want it reloaded as %q", got, openai.GPT4Turbo)
+	}
+}
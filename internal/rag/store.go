@@ -0,0 +1,343 @@
+// internal/rag/store.go
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// VectorStore holds embedded messages for similarity search
+type VectorStore interface {
+	// Upsert stores a message, replacing any previous copy with the same
+	// MessageID and EmbeddingVersion. Messages without an embedding are
+	// stored but never found.
+	Upsert(ctx context.Context, message *models.DiscordMessage) error
+	// Search returns up to limit messages in the guild embedded under
+	// version closest to embedding, most similar first, honoring the
+	// category scope
+	Search(ctx context.Context, embedding []float32, guildID, version string, limit int, timeRange database.TimeRange, scope database.CategoryScope) ([]models.DiscordMessage, error)
+	// SearchFacts is Search restricted to facts added by admins, ignoring
+	// time and category
+	SearchFacts(ctx context.Context, embedding []float32, guildID, version string, limit int) ([]models.DiscordMessage, error)
+	// Recent returns up to limit of the newest messages in the guild (or
+	// only the channel, unless channelID is empty) embedded under version,
+	// oldest first. Facts aren't activity and are left out.
+	Recent(ctx context.Context, guildID, channelID, version string, limit int) ([]models.DiscordMessage, error)
+	// MarkRetrieved records that messages were just returned by a search
+	MarkRetrieved(ctx context.Context, messageIDs []string, at time.Time) error
+	// CountByVersion returns how many of the guild's messages have an
+	// embedding under each version
+	CountByVersion(ctx context.Context, guildID string) (map[string]int64, error)
+	// Evict trims the guild to its limit messages ranked first by policy
+	// (database.EvictOldest or database.EvictLeastRetrieved), deleting a
+	// message's rows under every version together and never deleting
+	// facts. It returns how many rows were deleted.
+	Evict(ctx context.Context, guildID string, limit int, policy string) (int64, error)
+	// Delete removes messages by Discord message ID, under every version
+	Delete(ctx context.Context, messageIDs ...string) error
+	// ListFacts returns the guild's facts stored under version, oldest
+	// first
+	ListFacts(ctx context.Context, guildID, version string) ([]models.DiscordMessage, error)
+	// DeleteFact removes a guild's fact under every version, reporting
+	// whether there was one. Real messages are never deleted.
+	DeleteFact(ctx context.Context, guildID, messageID string) (bool, error)
+}
+
+// PGVectorStore is the default VectorStore, backed by the discord_messages
+// table and pgvector
+type PGVectorStore struct {
+	db *database.DB
+}
+
+// NewPGVectorStore returns a store over the database's messages table
+func NewPGVectorStore(db *database.DB) *PGVectorStore {
+	return &PGVectorStore{db: db}
+}
+
+// Upsert stores the message, retrying if the database is briefly
+// unreachable
+func (s *PGVectorStore) Upsert(ctx context.Context, message *models.DiscordMessage) error {
+	return s.db.UpsertMessage(ctx, message)
+}
+
+// Search runs the database's configured similarity query
+func (s *PGVectorStore) Search(ctx context.Context, embedding []float32, guildID, version string, limit int, timeRange database.TimeRange, scope database.CategoryScope) ([]models.DiscordMessage, error) {
+	return s.db.SearchSimilarMessages(ctx, embedding, guildID, version, limit, timeRange, scope)
+}
+
+// SearchFacts runs the similarity query over facts only
+func (s *PGVectorStore) SearchFacts(ctx context.Context, embedding []float32, guildID, version string, limit int) ([]models.DiscordMessage, error) {
+	return s.db.SearchSimilarFacts(ctx, embedding, guildID, version, limit)
+}
+
+// Recent reads the newest messages, oldest first
+func (s *PGVectorStore) Recent(ctx context.Context, guildID, channelID, version string, limit int) ([]models.DiscordMessage, error) {
+	return s.db.GetRecentMessages(ctx, guildID, channelID, version, limit)
+}
+
+// MarkRetrieved stamps the messages' last retrieval time, which the
+// least-retrieved eviction policy ranks by
+func (s *PGVectorStore) MarkRetrieved(ctx context.Context, messageIDs []string, at time.Time) error {
+	return s.db.MarkRetrieved(ctx, messageIDs, at)
+}
+
+// CountByVersion counts the guild's embedded messages per version
+func (s *PGVectorStore) CountByVersion(ctx context.Context, guildID string) (map[string]int64, error) {
+	return s.db.CountMessagesByVersion(guildID)
+}
+
+// Evict deletes the guild's messages beyond limit in a single statement
+func (s *PGVectorStore) Evict(ctx context.Context, guildID string, limit int, policy string) (int64, error) {
+	return s.db.EvictGuildMessages(ctx, guildID, limit, policy)
+}
+
+// Delete removes the messages' rows under every version
+func (s *PGVectorStore) Delete(ctx context.Context, messageIDs ...string) error {
+	return s.db.DeleteMessages(ctx, messageIDs...)
+}
+
+// ListFacts returns the guild's facts under version
+func (s *PGVectorStore) ListFacts(ctx context.Context, guildID, version string) ([]models.DiscordMessage, error) {
+	return s.db.ListFacts(ctx, guildID, version)
+}
+
+// DeleteFact removes a fact's rows, leaving real messages alone
+func (s *PGVectorStore) DeleteFact(ctx context.Context, guildID, messageID string) (bool, error) {
+	return s.db.DeleteFact(ctx, guildID, messageID)
+}
+
+// MemoryStore is an in-process VectorStore ranking by cosine similarity. It
+// suits tests and small deployments; nothing is persisted across restarts.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	messages map[memoryKey]models.DiscordMessage
+}
+
+type memoryKey struct {
+	messageID string
+	version   string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		messages: make(map[memoryKey]models.DiscordMessage),
+	}
+}
+
+func (s *MemoryStore) Upsert(ctx context.Context, message *models.DiscordMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages[memoryKey{message.MessageID, message.EmbeddingVersion}] = *message
+	return nil
+}
+
+func (s *MemoryStore) Search(ctx context.Context, embedding []float32, guildID, version string, limit int, timeRange database.TimeRange, scope database.CategoryScope) ([]models.DiscordMessage, error) {
+	type scored struct {
+		message models.DiscordMessage
+		rank    float64
+	}
+
+	s.mu.RLock()
+	var candidates []scored
+	for _, msg := range s.messages {
+		if msg.GuildID != guildID || msg.EmbeddingVersion != version || msg.Embedding == nil || !timeRange.Contains(msg.Timestamp) {
+			continue
+		}
+		inCategory := scope.CategoryID != "" && msg.CategoryID == scope.CategoryID
+		if scope.CategoryID != "" && scope.Only && !inCategory {
+			continue
+		}
+
+		msg.Distance = 1 - ai.CosineSimilarity(embedding, msg.Embedding.Slice())
+		rank := msg.Distance
+		if inCategory && scope.Boost > 0 {
+			rank *= 1 - scope.Boost
+		}
+		candidates = append(candidates, scored{message: msg, rank: rank})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].rank < candidates[j].rank
+	})
+
+	if limit >= 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	messages := make([]models.DiscordMessage, len(candidates))
+	for i, c := range candidates {
+		messages[i] = c.message
+	}
+	return messages, nil
+}
+
+func (s *MemoryStore) SearchFacts(ctx context.Context, embedding []float32, guildID, version string, limit int) ([]models.DiscordMessage, error) {
+	s.mu.RLock()
+	var facts []models.DiscordMessage
+	for _, msg := range s.messages {
+		if msg.IsFact && msg.GuildID == guildID && msg.EmbeddingVersion == version && msg.Embedding != nil {
+			msg.Distance = 1 - ai.CosineSimilarity(embedding, msg.Embedding.Slice())
+			facts = append(facts, msg)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(facts, func(i, j int) bool {
+		return facts[i].Distance < facts[j].Distance
+	})
+	if limit >= 0 && len(facts) > limit {
+		facts = facts[:limit]
+	}
+	return facts, nil
+}
+
+func (s *MemoryStore) Recent(ctx context.Context, guildID, channelID, version string, limit int) ([]models.DiscordMessage, error) {
+	s.mu.RLock()
+	var recent []models.DiscordMessage
+	for _, msg := range s.messages {
+		if msg.GuildID == guildID && msg.EmbeddingVersion == version && !msg.IsFact && (channelID == "" || msg.ChannelID == channelID) {
+			recent = append(recent, msg)
+		}
+	}
+	s.mu.RUnlock()
+
+	// Newest first to pick them, then back to chronological order
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].Timestamp.After(recent[j].Timestamp)
+	})
+	if limit >= 0 && len(recent) > limit {
+		recent = recent[:limit]
+	}
+	for i, j := 0, len(recent)-1; i < j; i, j = i+1, j-1 {
+		recent[i], recent[j] = recent[j], recent[i]
+	}
+	return recent, nil
+}
+
+func (s *MemoryStore) MarkRetrieved(ctx context.Context, messageIDs []string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		ids[id] = true
+	}
+	for key, msg := range s.messages {
+		if ids[key.messageID] {
+			retrieved := at
+			msg.LastRetrievedAt = &retrieved
+			s.messages[key] = msg
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CountByVersion(ctx context.Context, guildID string) (map[string]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, msg := range s.messages {
+		if msg.GuildID == guildID && msg.Embedding != nil {
+			counts[msg.EmbeddingVersion]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) Evict(ctx context.Context, guildID string, limit int, policy string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Rank each message by its latest row, as the SQL version does
+	ranks := make(map[string]time.Time)
+	for key, msg := range s.messages {
+		if msg.GuildID != guildID || msg.IsFact {
+			continue
+		}
+		rank := msg.Timestamp
+		if policy == database.EvictLeastRetrieved && msg.LastRetrievedAt != nil {
+			rank = *msg.LastRetrievedAt
+		}
+		if rank.After(ranks[key.messageID]) {
+			ranks[key.messageID] = rank
+		}
+	}
+	if len(ranks) <= limit {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(ranks))
+	for id := range ranks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ranks[ids[i]].After(ranks[ids[j]])
+	})
+
+	evict := make(map[string]bool, len(ids)-limit)
+	for _, id := range ids[max(limit, 0):] {
+		evict[id] = true
+	}
+	var deleted int64
+	for key := range s.messages {
+		if evict[key.messageID] {
+			delete(s.messages, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, messageIDs ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		ids[id] = true
+	}
+	for key := range s.messages {
+		if ids[key.messageID] {
+			delete(s.messages, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListFacts(ctx context.Context, guildID, version string) ([]models.DiscordMessage, error) {
+	s.mu.RLock()
+	var facts []models.DiscordMessage
+	for _, msg := range s.messages {
+		if msg.IsFact && msg.GuildID == guildID && msg.EmbeddingVersion == version {
+			facts = append(facts, msg)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(facts, func(i, j int) bool {
+		return facts[i].Timestamp.Before(facts[j].Timestamp)
+	})
+	return facts, nil
+}
+
+func (s *MemoryStore) DeleteFact(ctx context.Context, guildID, messageID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := false
+	for key, msg := range s.messages {
+		if key.messageID == messageID && msg.GuildID == guildID && msg.IsFact {
+			delete(s.messages, key)
+			deleted = true
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,344 @@
+package rag
+
+import (
+	"context"
+	"discord-rag-bot/internal/ai"
+	"discord-rag-bot/internal/database"
+	"discord-rag-bot/internal/models"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// baseTime is when the first test message was sent
+var baseTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// testMessage returns an embedded message sent minutes after baseTime
+func testMessage(id, guildID, version, content string, minutes int) *models.DiscordMessage {
+	msg := &models.DiscordMessage{
+		MessageID:        id,
+		GuildID:          guildID,
+		ChannelID:        "c1",
+		Content:          content,
+		Timestamp:        baseTime.Add(time.Duration(minutes) * time.Minute),
+		EmbeddingVersion: version,
+	}
+	msg.SetEmbedding(bagOfWords(content))
+	return msg
+}
+
+func upsertAll(t *testing.T, store VectorStore, messages ...*models.DiscordMessage) {
+	t.Helper()
+	for _, msg := range messages {
+		if err := store.Upsert(context.Background(), msg); err != nil {
+			t.Fatalf("Upsert %s: %v", msg.MessageID, err)
+		}
+	}
+}
+
+// storedIDs returns the IDs of the guild's messages under version, sorted
+func storedIDs(t *testing.T, store VectorStore, guildID, version string) []string {
+	t.Helper()
+	messages, err := store.Recent(context.Background(), guildID, "", version, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	facts, err := store.ListFacts(context.Background(), guildID, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, msg := range append(messages, facts...) {
+		ids = append(ids, msg.MessageID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestMemoryStoreEvictOldest(t *testing.T) {
+	store := NewMemoryStore()
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "first", 1),
+		testMessage("m2", "g1", "v1", "second", 2),
+		testMessage("m3", "g1", "v1", "third", 3),
+		testMessage("m4", "g1", "v1", "fourth", 4),
+		testMessage("other", "g2", "v1", "other guild", 0),
+	)
+
+	evicted, err := store.Evict(context.Background(), "g1", 2, database.EvictOldest)
+	if err != nil || evicted != 2 {
+		t.Fatalf("Evict = %d, %v; want 2 rows", evicted, err)
+	}
+	if ids := storedIDs(t, store, "g1", "v1"); !slices.Equal(ids, []string{"m3", "m4"}) {
+		t.Errorf("kept %v, want the newest two", ids)
+	}
+	if ids := storedIDs(t, store, "g2", "v1"); len(ids) != 1 {
+		t.Errorf("other guild's messages were evicted: %v", ids)
+	}
+
+	// Under the cap nothing is evicted
+	if evicted, err := store.Evict(context.Background(), "g1", 2, database.EvictOldest); err != nil || evicted != 0 {
+		t.Errorf("second Evict = %d, %v; want nothing", evicted, err)
+	}
+}
+
+func TestMemoryStoreEvictLeastRetrieved(t *testing.T) {
+	store := NewMemoryStore()
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "first", 1),
+		testMessage("m2", "g1", "v1", "second", 2),
+		testMessage("m3", "g1", "v1", "third", 3),
+	)
+	// The oldest message is still useful; the newer ones never came up
+	if err := store.MarkRetrieved(context.Background(), []string{"m1"}, baseTime.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Evict(context.Background(), "g1", 2, database.EvictLeastRetrieved); err != nil {
+		t.Fatal(err)
+	}
+	if ids := storedIDs(t, store, "g1", "v1"); !slices.Equal(ids, []string{"m1", "m3"}) {
+		t.Errorf("kept %v, want the retrieved message and the newest", ids)
+	}
+
+	// The same data under EvictOldest drops the retrieved message instead
+	store = NewMemoryStore()
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "first", 1),
+		testMessage("m2", "g1", "v1", "second", 2),
+		testMessage("m3", "g1", "v1", "third", 3),
+	)
+	store.MarkRetrieved(context.Background(), []string{"m1"}, baseTime.Add(time.Hour))
+	store.Evict(context.Background(), "g1", 2, database.EvictOldest)
+	if ids := storedIDs(t, store, "g1", "v1"); !slices.Equal(ids, []string{"m2", "m3"}) {
+		t.Errorf("kept %v under EvictOldest, want the newest two", ids)
+	}
+}
+
+func TestMemoryStoreEvictKeepsFacts(t *testing.T) {
+	store := NewMemoryStore()
+	fact := testMessage("fact:1", "g1", "v1", "game night is on friday", 0)
+	fact.IsFact = true
+	upsertAll(t, store,
+		fact,
+		testMessage("m1", "g1", "v1", "first", 1),
+		testMessage("m2", "g1", "v1", "second", 2),
+	)
+
+	if _, err := store.Evict(context.Background(), "g1", 1, database.EvictOldest); err != nil {
+		t.Fatal(err)
+	}
+	if ids := storedIDs(t, store, "g1", "v1"); !slices.Equal(ids, []string{"fact:1", "m2"}) {
+		t.Errorf("kept %v, want the fact and the newest message", ids)
+	}
+}
+
+func TestMemoryStoreEvictAcrossVersions(t *testing.T) {
+	store := NewMemoryStore()
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "first", 1),
+		testMessage("m1", "g1", "v2", "first", 1),
+		testMessage("m2", "g1", "v1", "second", 2),
+		testMessage("m2", "g1", "v2", "second", 2),
+	)
+
+	// Each message counts once towards the cap, and goes with all its rows
+	evicted, err := store.Evict(context.Background(), "g1", 1, database.EvictOldest)
+	if err != nil || evicted != 2 {
+		t.Fatalf("Evict = %d, %v; want both rows of one message", evicted, err)
+	}
+	for _, version := range []string{"v1", "v2"} {
+		if ids := storedIDs(t, store, "g1", version); !slices.Equal(ids, []string{"m2"}) {
+			t.Errorf("kept %v under %s, want m2", ids, version)
+		}
+	}
+}
+
+func TestMemoryStoreRecentChannel(t *testing.T) {
+	store := NewMemoryStore()
+	other := testMessage("m2", "g1", "v1", "elsewhere", 2)
+	other.ChannelID = "c2"
+	fact := testMessage("fact:1", "g1", "v1", "a fact", 4)
+	fact.IsFact = true
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "first", 1),
+		other,
+		testMessage("m3", "g1", "v1", "third", 3),
+		fact,
+		testMessage("m4", "g1", "v2", "other version", 5),
+	)
+
+	tests := []struct {
+		channelID string
+		limit     int
+		want      []string
+	}{
+		{"c1", 10, []string{"m1", "m3"}},
+		{"c2", 10, []string{"m2"}},
+		{"", 10, []string{"m1", "m2", "m3"}},
+		{"", 2, []string{"m2", "m3"}},
+	}
+	for _, tt := range tests {
+		recent, err := store.Recent(context.Background(), "g1", tt.channelID, "v1", tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, msg := range recent {
+			ids = append(ids, msg.MessageID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("Recent(%q, %d) = %v, want %v", tt.channelID, tt.limit, ids, tt.want)
+		}
+	}
+}
+
+func TestMemoryStoreSearchTimeRange(t *testing.T) {
+	store := NewMemoryStore()
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "game night", 0),
+		testMessage("m2", "g1", "v1", "game night", 60),
+		testMessage("m3", "g1", "v1", "game night", 120),
+	)
+
+	tests := []struct {
+		name      string
+		timeRange database.TimeRange
+		want      []string
+	}{
+		{"unbounded", database.TimeRange{}, []string{"m1", "m2", "m3"}},
+		{"since", database.TimeRange{Since: baseTime.Add(time.Hour)}, []string{"m2", "m3"}},
+		{"until", database.TimeRange{Until: baseTime.Add(time.Hour)}, []string{"m1", "m2"}},
+		{"between", database.TimeRange{Since: baseTime.Add(time.Minute), Until: baseTime.Add(90 * time.Minute)}, []string{"m2"}},
+		{"empty", database.TimeRange{Since: baseTime.Add(3 * time.Hour)}, nil},
+	}
+	for _, tt := range tests {
+		found, err := store.Search(context.Background(), bagOfWords("game night"), "g1", "v1", -1, tt.timeRange, database.CategoryScope{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := messageIDs(found)
+		sort.Strings(ids)
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: found %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
+
+func TestMemoryStoreSearchCategory(t *testing.T) {
+	store := NewMemoryStore()
+	elsewhere := testMessage("m1", "g1", "v1", "game night friday at bob's place", 0)
+	elsewhere.CategoryID = "events"
+	here := testMessage("m2", "g1", "v1", "game night friday", 1)
+	here.CategoryID = "games"
+	uncategorized := testMessage("m3", "g1", "v1", "game night", 2)
+	upsertAll(t, store, elsewhere, here, uncategorized)
+
+	tests := []struct {
+		name  string
+		scope database.CategoryScope
+		want  []string
+	}{
+		{"no scope", database.CategoryScope{}, []string{"m1", "m2", "m3"}},
+		{"small boost", database.CategoryScope{CategoryID: "games", Boost: 0.2}, []string{"m1", "m2", "m3"}},
+		{"large boost", database.CategoryScope{CategoryID: "games", Boost: 0.7}, []string{"m2", "m1", "m3"}},
+		{"only", database.CategoryScope{CategoryID: "games", Only: true}, []string{"m2"}},
+		{"only an empty category", database.CategoryScope{CategoryID: "voice", Only: true}, nil},
+	}
+	query := bagOfWords("game night friday at bob's")
+	for _, tt := range tests {
+		found, err := store.Search(context.Background(), query, "g1", "v1", -1, database.TimeRange{}, tt.scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := messageIDs(found); !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: found %v, want %v", tt.name, ids, tt.want)
+		}
+		for _, msg := range found {
+			if want := 1 - ai.CosineSimilarity(query, msg.Embedding.Slice()); msg.Distance != want {
+				t.Errorf("%s: %s has distance %v, want the unboosted %v", tt.name, msg.MessageID, msg.Distance, want)
+			}
+		}
+	}
+}
+
+func TestMemoryStoreUpsertReplacesByVersion(t *testing.T) {
+	store := NewMemoryStore()
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "game night friday", 0),
+		testMessage("m1", "g1", "v2", "game night friday", 0),
+		testMessage("m1", "g1", "v1", "game night saturday", 0),
+	)
+
+	for version, want := range map[string]string{"v1": "game night saturday", "v2": "game night friday"} {
+		found, err := store.Search(context.Background(), bagOfWords("game night"), "g1", version, -1, database.TimeRange{}, database.CategoryScope{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].Content != want {
+			t.Errorf("%s: found %+v, want only %q", version, found, want)
+		}
+	}
+}
+
+func TestMemoryStoreSearchOrderAndLimit(t *testing.T) {
+	store := NewMemoryStore()
+	unembedded := testMessage("m5", "g1", "v1", "game night friday at bob's", 4)
+	unembedded.Embedding = nil
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "game night friday at bob's", 0),
+		testMessage("m2", "g1", "v1", "lunch on friday", 1),
+		testMessage("m3", "g1", "v1", "game night friday", 2),
+		testMessage("m4", "g2", "v1", "game night friday at bob's", 3),
+		unembedded,
+	)
+
+	query := bagOfWords("game night friday at bob's")
+	found, err := store.Search(context.Background(), query, "g1", "v1", -1, database.TimeRange{}, database.CategoryScope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := messageIDs(found); !slices.Equal(ids, []string{"m1", "m3", "m2"}) {
+		t.Errorf("found %v, want the guild's embedded messages most similar first", ids)
+	}
+	for i := 1; i < len(found); i++ {
+		if found[i].Distance < found[i-1].Distance {
+			t.Errorf("distances %v and %v out of order", found[i-1].Distance, found[i].Distance)
+		}
+	}
+
+	for limit, want := range map[int][]string{0: nil, 2: {"m1", "m3"}, 10: {"m1", "m3", "m2"}} {
+		found, err := store.Search(context.Background(), query, "g1", "v1", limit, database.TimeRange{}, database.CategoryScope{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := messageIDs(found); !slices.Equal(ids, want) {
+			t.Errorf("limit %d: found %v, want %v", limit, ids, want)
+		}
+	}
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+	store := NewMemoryStore()
+	upsertAll(t, store,
+		testMessage("m1", "g1", "v1", "one", 0),
+		testMessage("m1", "g1", "v2", "one", 0),
+		testMessage("m2", "g1", "v1", "two", 1),
+		testMessage("m3", "g1", "v1", "three", 2),
+	)
+
+	if err := store.Delete(context.Background(), "m1", "m3", "missing"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(context.Background()); err != nil {
+		t.Fatalf("Delete with no IDs: %v", err)
+	}
+	if ids := storedIDs(t, store, "g1", "v1"); !slices.Equal(ids, []string{"m2"}) {
+		t.Errorf("v1 holds %v after delete, want [m2]", ids)
+	}
+	if ids := storedIDs(t, store, "g1", "v2"); len(ids) != 0 {
+		t.Errorf("v2 holds %v after delete, want m1 gone under every version", ids)
+	}
+}